@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/usadamasa/kubectl-localmesh/internal/certs"
+)
+
+type caOptions struct {
+	caDir string
+}
+
+var caOpts = &caOptions{}
+
+var caCmd = &cobra.Command{
+	Use:   "ca",
+	Short: "Manage the local development CA used for TLS",
+	Long: `Manage the local certificate authority that signs the per-host certificates
+served on the TLS listener (the 'tls:' block in services.yaml).
+
+The CA is generated on first use and stored in ~/.config/kubectl-localmesh/ca
+unless --ca-dir (or tls.ca_dir in services.yaml) is set.
+
+Examples:
+  kubectl-localmesh ca print > localmesh-ca.crt
+  sudo kubectl-localmesh ca install`,
+}
+
+var caPrintCmd = &cobra.Command{
+	Use:   "print",
+	Short: "Print the CA certificate (PEM) to stdout",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ca, err := loadCA()
+		if err != nil {
+			return err
+		}
+		_, err = cmd.OutOrStdout().Write(ca.CertPEM())
+		return err
+	},
+}
+
+var caInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Add the CA certificate to the system trust store",
+	Long: `Add the CA certificate to the system trust store (macOS System keychain,
+or the ca-certificates store on Debian/Ubuntu, RHEL/Fedora and Arch Linux).
+This usually requires sudo.
+
+Browsers and runtimes with their own trust store are not updated, e.g.
+Firefox, or Node.js (use NODE_EXTRA_CA_CERTS with the output of 'ca print').`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ca, err := loadCA()
+		if err != nil {
+			return err
+		}
+		if err := ca.Install(cmd.OutOrStdout(), cmd.ErrOrStderr()); err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(cmd.OutOrStdout(), "installed %s into the system trust store\n", ca.CertFile())
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(caCmd)
+	caCmd.AddCommand(caPrintCmd, caInstallCmd)
+
+	caCmd.PersistentFlags().StringVar(&caOpts.caDir, "ca-dir", "", "CA directory (default ~/.config/kubectl-localmesh/ca)")
+}
+
+// loadCA は、CAを読み込む（存在しない場合は生成する）
+func loadCA() (*certs.CA, error) {
+	dir, err := certs.ResolveDir(caOpts.caDir)
+	if err != nil {
+		return nil, err
+	}
+	return certs.LoadOrCreateCA(dir)
+}
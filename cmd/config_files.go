@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/usadamasa/kubectl-localmesh/internal/config"
+)
+
+// configFiles は、-f で指定された設定ファイル（未指定の場合は位置引数）を返す
+func configFiles(flagFiles, args []string) ([]string, error) {
+	files := flagFiles
+	if len(files) == 0 {
+		files = args
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("config file required: use -f or provide as argument")
+	}
+	return files, nil
+}
+
+// loadOptions は、--set の値とサービスの選択から設定ファイルの読み込みオプションを作る
+func loadOptions(set []string, selection config.Selection) (config.LoadOptions, error) {
+	vars, err := config.ParseSet(set)
+	if err != nil {
+		return config.LoadOptions{}, err
+	}
+	return config.LoadOptions{Set: vars, Selection: selection}, nil
+}
+
+// addSelectionFlags は、起動するサービスを選択するフラグを追加する
+func addSelectionFlags(cmd *cobra.Command, sel *config.Selection) {
+	cmd.Flags().StringVar(&sel.Profile, "profile", "", "start only the services of a profile in 'profiles:'")
+	cmd.Flags().StringSliceVar(&sel.Only, "only", nil, "start only services with these hosts or tags (comma-separated)")
+	cmd.Flags().StringSliceVar(&sel.Exclude, "exclude", nil, "skip services with these hosts or tags (comma-separated)")
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/usadamasa/kubectl-localmesh/internal/dns"
+)
+
+type dnsOptions struct {
+	name    string
+	server  string
+	domains []string
+}
+
+var dnsOpts = &dnsOptions{}
+
+var dnsCmd = &cobra.Command{
+	Use:   "dns",
+	Short: "Route domains to the DNS server of an instance through systemd-resolved",
+	Long: `Route the queries for domains to the DNS server of an instance ('up --dns')
+through a systemd-resolved drop-in (split DNS, Linux only).
+
+'up --dns' runs as the invoking user and calls 'dns apply' and 'dns remove'
+through 'sudo -n' when it is not root, so that only the drop-in edit runs as
+root. Each instance has its own drop-in,
+/etc/systemd/resolved.conf.d/kubectl-localmesh-<name>.conf.`,
+}
+
+var dnsApplyCmd = &cobra.Command{
+	Use:   "apply --name NAME --server ADDR:PORT --domain DOMAIN...",
+	Short: "Write the systemd-resolved drop-in of an instance",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return dns.ApplyResolved(dnsOpts.name, dnsOpts.server, dnsOpts.domains)
+	},
+}
+
+var dnsRemoveCmd = &cobra.Command{
+	Use:   "remove --name NAME",
+	Short: "Remove the systemd-resolved drop-in of an instance",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return dns.RemoveResolved(dnsOpts.name)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dnsCmd)
+	dnsCmd.AddCommand(dnsApplyCmd, dnsRemoveCmd)
+
+	for _, c := range []*cobra.Command{dnsApplyCmd, dnsRemoveCmd} {
+		c.Flags().StringVar(&dnsOpts.name, "name", "", "name of the instance")
+		_ = c.MarkFlagRequired("name")
+	}
+	dnsApplyCmd.Flags().StringVar(&dnsOpts.server, "server", "", "loopback address and port of the DNS server")
+	dnsApplyCmd.Flags().StringArrayVar(&dnsOpts.domains, "domain", nil, "domain to route to the server (repeatable)")
+	_ = dnsApplyCmd.MarkFlagRequired("server")
+	_ = dnsApplyCmd.MarkFlagRequired("domain")
+}
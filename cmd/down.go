@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/usadamasa/kubectl-localmesh/internal/run"
+)
+
+type downOptions struct {
+	pid     int
+	name    string
+	all     bool
+	timeout time.Duration
+}
+
+var downOpts = &downOptions{}
+
+var downCmd = &cobra.Command{
+	Use:   "down",
+	Short: "Stop a running local service mesh",
+	Long: `Gracefully stop a running 'up' process and clean up its /etc/hosts entries.
+
+Running instances are found in the runtime state directory written by 'up'.
+If the process has already exited without cleaning up (e.g. it was killed),
+its leftover /etc/hosts entries and state are removed.
+
+Examples:
+  kubectl-localmesh down
+  kubectl-localmesh down --name backend
+  kubectl-localmesh down --pid 12345
+  kubectl-localmesh down --all`,
+	Args: cobra.NoArgs,
+	RunE: runDown,
+}
+
+func init() {
+	rootCmd.AddCommand(downCmd)
+
+	downCmd.Flags().IntVar(&downOpts.pid, "pid", 0, "PID of the instance to stop")
+	downCmd.Flags().StringVar(&downOpts.name, "name", "", "name of the instance to stop")
+	downCmd.Flags().BoolVar(&downOpts.all, "all", false, "stop all running instances")
+	downCmd.Flags().DurationVar(&downOpts.timeout, "timeout", 10*time.Second, "time to wait for the instance to exit")
+}
+
+func runDown(cmd *cobra.Command, args []string) error {
+	return run.Down(downOpts.pid, downOpts.name, downOpts.all, downOpts.timeout)
+}
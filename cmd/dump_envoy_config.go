@@ -9,8 +9,11 @@ import (
 )
 
 type dumpEnvoyConfigOptions struct {
-	configFile string
-	mockConfig string
+	configFiles  []string
+	set          []string
+	selection    config.Selection
+	mockConfig   string
+	forceCluster bool
 }
 
 var dumpEnvoyConfigOpts = &dumpEnvoyConfigOptions{}
@@ -25,10 +28,13 @@ var dumpEnvoyConfigCmd = &cobra.Command{
 - ルーティングの問題のデバッグ
 - Envoy設定パターンの学習
 - --mock-configによるオフライン設定検証
+- 複数の設定ファイルをマージした結果の確認
 
 Examples:
   kubectl-localmesh dump-envoy-config -f services.yaml
   kubectl-localmesh dump-envoy-config services.yaml
+  kubectl-localmesh dump-envoy-config -f services.yaml -f services.local.yaml
+  kubectl-localmesh dump-envoy-config -f services.yaml --set PREVIEW_NS=pr-1234
   kubectl-localmesh dump-envoy-config -f services.yaml --mock-config mocks.yaml`,
 	RunE: runDumpEnvoyConfig,
 }
@@ -36,33 +42,46 @@ Examples:
 func init() {
 	rootCmd.AddCommand(dumpEnvoyConfigCmd)
 
-	dumpEnvoyConfigCmd.Flags().StringVarP(
-		&dumpEnvoyConfigOpts.configFile,
-		"config", "f", "",
-		"設定ファイルのパス",
+	dumpEnvoyConfigCmd.Flags().StringArrayVarP(
+		&dumpEnvoyConfigOpts.configFiles,
+		"config", "f", nil,
+		"設定ファイルまたはディレクトリのパス（複数指定時は後のファイルが優先）",
 	)
+	dumpEnvoyConfigCmd.Flags().StringArrayVar(
+		&dumpEnvoyConfigOpts.set,
+		"set", nil,
+		"vars:の変数を上書き（key=value、複数指定可）",
+	)
+	addSelectionFlags(dumpEnvoyConfigCmd, &dumpEnvoyConfigOpts.selection)
 	dumpEnvoyConfigCmd.Flags().StringVar(
 		&dumpEnvoyConfigOpts.mockConfig,
 		"mock-config", "",
 		"オフラインモード用のモック設定（クラスタ接続不要）",
 	)
+	dumpEnvoyConfigCmd.Flags().BoolVar(
+		&dumpEnvoyConfigOpts.forceCluster,
+		"force-cluster", false,
+		"接続先がcluster:と一致しなくても警告のみで続行",
+	)
 }
 
 func runDumpEnvoyConfig(cmd *cobra.Command, args []string) error {
-	if dumpEnvoyConfigOpts.configFile == "" && len(args) > 0 {
-		dumpEnvoyConfigOpts.configFile = args[0]
+	files, err := configFiles(dumpEnvoyConfigOpts.configFiles, args)
+	if err != nil {
+		return err
 	}
 
-	if dumpEnvoyConfigOpts.configFile == "" {
-		return fmt.Errorf("config file required: use -f or provide as argument")
+	loadOpts, err := loadOptions(dumpEnvoyConfigOpts.set, dumpEnvoyConfigOpts.selection)
+	if err != nil {
+		return err
 	}
 
-	cfg, err := config.Load(dumpEnvoyConfigOpts.configFile)
+	cfg, err := config.LoadFiles(loadOpts, files...)
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
 	ctx := cmd.Context()
 
-	return run.DumpEnvoyConfig(ctx, cfg, dumpEnvoyConfigOpts.mockConfig)
+	return run.DumpEnvoyConfig(ctx, cfg, dumpEnvoyConfigOpts.mockConfig, globalKube, dumpEnvoyConfigOpts.forceCluster)
 }
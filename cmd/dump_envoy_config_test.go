@@ -1,7 +1,7 @@
 package cmd
 
 import (
-	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -12,7 +12,7 @@ func TestDumpEnvoyConfigCommand_FlagParsing(t *testing.T) {
 	tests := []struct {
 		name        string
 		args        []string
-		wantConfig  string
+		wantConfig  []string
 		wantMock    string
 		wantErr     bool
 		errContains string
@@ -20,28 +20,28 @@ func TestDumpEnvoyConfigCommand_FlagParsing(t *testing.T) {
 		{
 			name:       "flag形式で設定ファイル指定",
 			args:       []string{"-f", "testdata/test-services.yaml"},
-			wantConfig: "testdata/test-services.yaml",
+			wantConfig: []string{"testdata/test-services.yaml"},
 			wantMock:   "",
 			wantErr:    false,
 		},
 		{
 			name:       "long flag形式で設定ファイル指定",
 			args:       []string{"--config", "testdata/test-services.yaml"},
-			wantConfig: "testdata/test-services.yaml",
+			wantConfig: []string{"testdata/test-services.yaml"},
 			wantMock:   "",
 			wantErr:    false,
 		},
 		{
 			name:       "位置引数で設定ファイル指定",
 			args:       []string{"testdata/test-services.yaml"},
-			wantConfig: "testdata/test-services.yaml",
+			wantConfig: []string{"testdata/test-services.yaml"},
 			wantMock:   "",
 			wantErr:    false,
 		},
 		{
 			name:       "mock-config指定",
 			args:       []string{"-f", "testdata/test-services.yaml", "--mock-config", "testdata/mocks.yaml"},
-			wantConfig: "testdata/test-services.yaml",
+			wantConfig: []string{"testdata/test-services.yaml"},
 			wantMock:   "testdata/mocks.yaml",
 			wantErr:    false,
 		},
@@ -60,17 +60,14 @@ func TestDumpEnvoyConfigCommand_FlagParsing(t *testing.T) {
 			cmd := &cobra.Command{
 				Use: "test",
 				RunE: func(cmd *cobra.Command, args []string) error {
-					if dumpEnvoyConfigOpts.configFile == "" && len(args) > 0 {
-						dumpEnvoyConfigOpts.configFile = args[0]
-					}
-					if dumpEnvoyConfigOpts.configFile == "" {
-						return fmt.Errorf("config file required")
-					}
-					return nil
+					// フラグが指定されていない場合、位置引数を使用
+					files, err := configFiles(dumpEnvoyConfigOpts.configFiles, args)
+					dumpEnvoyConfigOpts.configFiles = files
+					return err
 				},
 			}
 
-			cmd.Flags().StringVarP(&dumpEnvoyConfigOpts.configFile, "config", "f", "", "config yaml path")
+			cmd.Flags().StringArrayVarP(&dumpEnvoyConfigOpts.configFiles, "config", "f", nil, "config yaml path")
 			cmd.Flags().StringVar(&dumpEnvoyConfigOpts.mockConfig, "mock-config", "", "mock config path")
 			cmd.SetArgs(tt.args)
 
@@ -87,8 +84,8 @@ func TestDumpEnvoyConfigCommand_FlagParsing(t *testing.T) {
 			}
 
 			if !tt.wantErr {
-				if dumpEnvoyConfigOpts.configFile != tt.wantConfig {
-					t.Errorf("configFile = %v, want %v", dumpEnvoyConfigOpts.configFile, tt.wantConfig)
+				if !reflect.DeepEqual(dumpEnvoyConfigOpts.configFiles, tt.wantConfig) {
+					t.Errorf("configFiles = %v, want %v", dumpEnvoyConfigOpts.configFiles, tt.wantConfig)
 				}
 				if dumpEnvoyConfigOpts.mockConfig != tt.wantMock {
 					t.Errorf("mockConfig = %v, want %v", dumpEnvoyConfigOpts.mockConfig, tt.wantMock)
@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"github.com/usadamasa/kubectl-localmesh/internal/hosts"
+)
+
+type hostsOptions struct {
+	name    string
+	id      string
+	pid     int
+	start   int64
+	replace bool
+}
+
+var hostsOpts = &hostsOptions{}
+
+var hostsCmd = &cobra.Command{
+	Use:   "hosts",
+	Short: "Inspect and edit the kubectl-localmesh blocks of /etc/hosts",
+	Long: `Inspect and edit the blocks of /etc/hosts managed by kubectl-localmesh.
+
+Each block records the name, instance ID, PID and user of the 'up' process that
+wrote it, so that several instances can run side by side.
+'up' runs as the invoking user and calls 'hosts apply' and 'hosts remove'
+through 'sudo -n' when it cannot write /etc/hosts itself, so that only the
+/etc/hosts edit runs as root. Blocks of stopped instances are reclaimed by the
+next 'up'; 'hosts clean' removes them explicitly.
+
+Examples:
+  kubectl-localmesh hosts show
+  sudo kubectl-localmesh hosts clean`,
+}
+
+var hostsApplyCmd = &cobra.Command{
+	Use:   "apply --id ID --pid PID [--start UNIX_SECONDS] [--name NAME]",
+	Short: "Write the block of an instance from 'IP hostname' lines on stdin",
+	Long: `Read 'IP hostname' lines from stdin and add them to /etc/hosts as the
+block of the instance. Blocks of stopped instances are removed first. Fails if
+another block has the same name or one of the hostnames. With --replace, the
+entries of the instance's own block are replaced in place.
+
+Only loopback addresses are accepted. Under sudo, --pid must be a process of
+the user who ran sudo, who is recorded as the owner of the block.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		owner, err := hosts.NewOwner(hostsOpts.name, hostsOpts.id, hostsOpts.pid, hostsOpts.start)
+		if err != nil {
+			return err
+		}
+		if err := owner.VerifyProcess(); err != nil {
+			return err
+		}
+		entries, err := hosts.ParseEntries(cmd.InOrStdin())
+		if err != nil {
+			return fmt.Errorf("invalid hosts entries: %w", err)
+		}
+		if hostsOpts.replace {
+			return hosts.UpdateEntries(owner, entries)
+		}
+		return hosts.Claim(cmd.OutOrStdout(), owner, entries)
+	},
+}
+
+var hostsRemoveCmd = &cobra.Command{
+	Use:   "remove --id ID",
+	Short: "Remove the block of an instance from /etc/hosts",
+	Long: `Remove the block with the instance ID from /etc/hosts. Blocks of other
+instances are kept. Under sudo, only blocks of the user who ran sudo are removed.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// 名前とPIDは削除するブロックの特定に使わない（所有者の確認には呼び出し元のユーザーを使う）
+		owner, err := hosts.NewOwner("", hostsOpts.id, 1, 0)
+		if err != nil {
+			return err
+		}
+		return hosts.RemoveEntries(owner)
+	},
+}
+
+var hostsShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "List the kubectl-localmesh blocks and whether their owner is running",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		blocks, orphanEnds, err := hosts.Inspect()
+		if err != nil {
+			return err
+		}
+		printHostsBlocks(cmd.OutOrStdout(), blocks, orphanEnds)
+		return nil
+	},
+}
+
+var hostsCleanCmd = &cobra.Command{
+	Use:   "clean",
+	Short: "Remove the blocks of stopped instances and broken markers",
+	Long: `Remove every kubectl-localmesh block of /etc/hosts that is not owned by a
+running instance: blocks of stopped instances, blocks written by older versions
+(without an owner) and blocks without an end marker. End markers without a start
+marker are removed too. Blocks of running instances are kept.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		removed, orphanEnds, err := hosts.Clean()
+		if err != nil {
+			return err
+		}
+		out := cmd.OutOrStdout()
+		for _, b := range removed {
+			_, _ = fmt.Fprintf(out, "removed block at line %d (%s, %d entries)\n", b.Line, describeHostsOwner(b), len(b.Entries))
+		}
+		if orphanEnds > 0 {
+			_, _ = fmt.Fprintf(out, "removed %d end marker(s) without a start marker\n", orphanEnds)
+		}
+		if len(removed) == 0 && orphanEnds == 0 {
+			_, _ = fmt.Fprintln(out, "nothing to clean")
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(hostsCmd)
+	hostsCmd.AddCommand(hostsApplyCmd, hostsRemoveCmd, hostsShowCmd, hostsCleanCmd)
+
+	for _, c := range []*cobra.Command{hostsApplyCmd, hostsRemoveCmd} {
+		c.Flags().StringVar(&hostsOpts.id, "id", "", "instance ID of the block")
+		_ = c.MarkFlagRequired("id")
+	}
+	hostsApplyCmd.Flags().StringVar(&hostsOpts.name, "name", "", "name of the instance")
+	hostsApplyCmd.Flags().IntVar(&hostsOpts.pid, "pid", 0, "PID of the 'up' process that owns the block")
+	_ = hostsApplyCmd.MarkFlagRequired("pid")
+	hostsApplyCmd.Flags().Int64Var(&hostsOpts.start, "start", 0, "start time (Unix seconds) of the 'up' process, used to tell it from a process reusing the PID")
+	hostsApplyCmd.Flags().BoolVar(&hostsOpts.replace, "replace", false, "replace the entries of the instance's existing block")
+}
+
+// printHostsBlocks は、hosts show の出力を書き込む
+func printHostsBlocks(w io.Writer, blocks []hosts.Block, orphanEnds []int) {
+	if len(blocks) == 0 && len(orphanEnds) == 0 {
+		_, _ = fmt.Fprintln(w, "no kubectl-localmesh entries in /etc/hosts")
+		return
+	}
+	for _, b := range blocks {
+		_, _ = fmt.Fprintf(w, "line %d: %s\n", b.Line, describeHostsOwner(b))
+		for _, e := range b.Entries {
+			_, _ = fmt.Fprintf(w, "  %s %s\n", e.IP, e.Hostname)
+		}
+	}
+	for _, line := range orphanEnds {
+		_, _ = fmt.Fprintf(w, "line %d: end marker without a start marker\n", line)
+	}
+}
+
+// describeHostsOwner は、ブロックの所有者と状態を返す
+func describeHostsOwner(b hosts.Block) string {
+	var s string
+	switch b.Status() {
+	case "running":
+		s = fmt.Sprintf("%s, running", b.Owner)
+	case "stopped":
+		s = fmt.Sprintf("%s, stopped", b.Owner)
+	default:
+		s = "owner unknown, written by an older version"
+	}
+	if !b.Closed {
+		s += ", no end marker"
+	}
+	return s
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/usadamasa/kubectl-localmesh/internal/loopback"
+)
+
+var loopbackCmd = &cobra.Command{
+	Use:   "loopback",
+	Short: "Add and remove the loopback aliases of TCP services (macOS)",
+	Long: `Add and remove the loopback addresses (127.0.0.2, 127.0.0.3, ...) that TCP
+services listen on as aliases of lo0. Only macOS needs them; on Linux the whole
+127.0.0.0/8 is already assigned to lo.
+
+'up' runs as the invoking user and calls 'loopback apply' and 'loopback remove'
+through 'sudo -n' when it is not root, so that only the alias edit runs as
+root. Only addresses in 127.0.0.0/8 other than 127.0.0.1 are accepted.`,
+}
+
+var loopbackApplyCmd = &cobra.Command{
+	Use:   "apply ADDRESS",
+	Short: "Add a loopback address as an alias of lo0",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return loopback.ApplyAlias(args[0])
+	},
+}
+
+var loopbackRemoveCmd = &cobra.Command{
+	Use:   "remove ADDRESS",
+	Short: "Remove a loopback alias from lo0",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return loopback.RemoveAlias(args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(loopbackCmd)
+	loopbackCmd.AddCommand(loopbackApplyCmd, loopbackRemoveCmd)
+}
@@ -2,10 +2,14 @@ package cmd
 
 import (
 	"github.com/spf13/cobra"
+	"github.com/usadamasa/kubectl-localmesh/internal/k8s"
 )
 
 var globalLogLevel string
 
+// globalKube はkubectlと同じクラスタ・ユーザーの指定
+var globalKube k8s.ClientOptions
+
 var rootCmd = &cobra.Command{
 	Use:   "kubectl-localmesh",
 	Short: "Local-only pseudo service mesh built on kubectl port-forward",
@@ -24,6 +28,19 @@ func init() {
 		"info",
 		"log level: debug|info|warn",
 	)
+	addKubeFlags(rootCmd, &globalKube)
+}
+
+// addKubeFlags は、kubectlと同じkubeconfig・context・ユーザーのフラグを追加する
+func addKubeFlags(cmd *cobra.Command, opts *k8s.ClientOptions) {
+	flags := cmd.PersistentFlags()
+	flags.StringVar(&opts.Kubeconfig, "kubeconfig", "", "path to the kubeconfig file to use for CLI requests")
+	flags.StringVar(&opts.Context, "context", "", "the name of the kubeconfig context to use (overrides kube_context in the config)")
+	flags.StringVar(&opts.Cluster, "cluster", "", "the name of the kubeconfig cluster to use")
+	flags.StringVar(&opts.User, "user", "", "the name of the kubeconfig user to use")
+	flags.StringVar(&opts.As, "as", "", "username to impersonate for the operation")
+	flags.StringArrayVar(&opts.AsGroups, "as-group", nil, "group to impersonate for the operation (repeatable)")
+	flags.StringVar(&opts.RequestTimeout, "request-timeout", "0", "the length of time to wait before giving up on a single server request (e.g. 1s, 2m, 3h); 0 means no timeout")
 }
 
 func Execute() error {
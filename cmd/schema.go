@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"encoding/json"
+
+	"github.com/spf13/cobra"
+	"github.com/usadamasa/kubectl-localmesh/internal/config"
+)
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema for services.yaml",
+	Long: `Print a JSON Schema (draft 2020-12) for services.yaml to stdout,
+for autocompletion and validation in editors.
+
+Examples:
+  kubectl-localmesh schema > services.schema.json
+
+  # With the YAML language server (VS Code, Neovim, ...), add to services.yaml:
+  # yaml-language-server: $schema=./services.schema.json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+		return enc.Encode(config.Schema())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(schemaCmd)
+}
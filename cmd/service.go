@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/usadamasa/kubectl-localmesh/internal/run"
+)
+
+type serviceOptions struct {
+	pid    int
+	name   string
+	output string
+}
+
+var serviceOpts = &serviceOptions{}
+
+var serviceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "Inspect and control services of a running local service mesh",
+	Long: `Inspect and control services of a running 'up' process through its control API.
+
+The control API is served over a Unix socket in the runtime state directory
+and can also be called directly, e.g.:
+  curl --unix-socket "$XDG_RUNTIME_DIR/kubectl-localmesh/<pid>.sock" http://localhost/v1/services
+
+Examples:
+  kubectl-localmesh service list
+  kubectl-localmesh service reconnect users-api.localhost
+  kubectl-localmesh service disable billing.localhost
+  kubectl-localmesh service enable billing.localhost --pid 12345
+  kubectl-localmesh service list --name backend`,
+}
+
+var serviceListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List services with their forwarding state",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return run.ListServices(cmd.Context(), cmd.OutOrStdout(), serviceOpts.pid, serviceOpts.name, serviceOpts.output)
+	},
+}
+
+var serviceReconnectCmd = &cobra.Command{
+	Use:   "reconnect HOST",
+	Short: "Reconnect the port-forward or SSH tunnel of a service",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return run.ReconnectService(cmd.Context(), cmd.OutOrStdout(), serviceOpts.pid, serviceOpts.name, args[0])
+	},
+}
+
+var serviceEnableCmd = &cobra.Command{
+	Use:   "enable HOST",
+	Short: "Enable a disabled service",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return run.SetServiceEnabled(cmd.Context(), cmd.OutOrStdout(), serviceOpts.pid, serviceOpts.name, args[0], true)
+	},
+}
+
+var serviceDisableCmd = &cobra.Command{
+	Use:   "disable HOST",
+	Short: "Disable a service (stop forwarding and remove its route)",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return run.SetServiceEnabled(cmd.Context(), cmd.OutOrStdout(), serviceOpts.pid, serviceOpts.name, args[0], false)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serviceCmd)
+	serviceCmd.AddCommand(serviceListCmd, serviceReconnectCmd, serviceEnableCmd, serviceDisableCmd)
+
+	serviceCmd.PersistentFlags().IntVar(&serviceOpts.pid, "pid", 0, "PID of the instance to control")
+	serviceCmd.PersistentFlags().StringVar(&serviceOpts.name, "name", "", "name of the instance to control")
+	serviceListCmd.Flags().StringVarP(&serviceOpts.output, "output", "o", "table", "output format: table|json")
+}
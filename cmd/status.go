@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/usadamasa/kubectl-localmesh/internal/run"
+)
+
+type statusOptions struct {
+	output string
+}
+
+var statusOpts = &statusOptions{}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the status of running local service meshes",
+	Long: `Show per-service forwarding state and health of running 'up' processes.
+
+Examples:
+  kubectl-localmesh status
+  kubectl-localmesh status -o json`,
+	Args: cobra.NoArgs,
+	RunE: runStatus,
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+
+	statusCmd.Flags().StringVarP(&statusOpts.output, "output", "o", "table", "output format: table|json")
+}
+
+func runStatus(cmd *cobra.Command, args []string) error {
+	return run.Status(cmd.OutOrStdout(), statusOpts.output)
+}
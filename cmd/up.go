@@ -12,8 +12,15 @@ import (
 )
 
 type upOptions struct {
-	configFile  string
-	noEditHosts bool
+	configFiles  []string
+	set          []string
+	selection    config.Selection
+	noEditHosts  bool
+	watch        bool
+	proxy        string
+	forceCluster bool
+	name         string
+	dns          bool
 }
 
 var upOpts = &upOptions{}
@@ -24,32 +31,71 @@ var upCmd = &cobra.Command{
 	Long: `Start kubectl port-forward processes for all configured services
 and run a local Envoy proxy for host-based routing.
 
+With --proxy=builtin, a built-in Go proxy is used instead of Envoy,
+so 'envoy' does not need to be installed.
+
+Several instances can run side by side under different names (--name or
+'name:' in the config). Each gets its own /etc/hosts block; hostnames must
+not overlap.
+
+With --dns, a DNS server on a loopback address (dns.listen, default
+127.0.0.1:15353) answers A/AAAA queries for every host, including wildcard
+hosts like '*.preview.localhost' that /etc/hosts cannot hold. Other names are
+forwarded to dns.upstreams, or answered with NXDOMAIN. On Linux,
+dns.resolved_domains routes those domains to the server through
+systemd-resolved (split DNS).
+
 Examples:
   kubectl-localmesh up -f services.yaml
   kubectl-localmesh up services.yaml
-  kubectl-localmesh up -f services.yaml --no-edit-hosts`,
+  kubectl-localmesh up -f services.yaml -f services.local.yaml
+  kubectl-localmesh up -f services.yaml --set PREVIEW_NS=pr-1234
+  kubectl-localmesh up -f services.yaml --profile backend
+  kubectl-localmesh up -f services.yaml --only users-api.localhost,users-db.localhost
+  kubectl-localmesh up -f services.yaml --exclude database
+  kubectl-localmesh up -f services.yaml --no-edit-hosts
+  kubectl-localmesh up -f services.yaml --watch
+  kubectl-localmesh up -f services.yaml --proxy=builtin
+  kubectl-localmesh up -f services.yaml --force-cluster
+  kubectl-localmesh up -f backend.yaml --name backend
+  kubectl-localmesh up -f services.yaml --dns --no-edit-hosts`,
 	RunE: runUp,
 }
 
 func init() {
 	rootCmd.AddCommand(upCmd)
 
-	upCmd.Flags().StringVarP(&upOpts.configFile, "config", "f", "", "config yaml path")
+	upCmd.Flags().StringArrayVarP(&upOpts.configFiles, "config", "f", nil, "config yaml path or directory (repeatable, later files win)")
+	upCmd.Flags().StringArrayVar(&upOpts.set, "set", nil, "override a variable of 'vars:' (key=value, repeatable)")
+	addSelectionFlags(upCmd, &upOpts.selection)
 	upCmd.Flags().BoolVar(&upOpts.noEditHosts, "no-edit-hosts", false, "skip updating /etc/hosts")
+	upCmd.Flags().BoolVar(&upOpts.watch, "watch", false, "reload the config file on change without restarting")
+	upCmd.Flags().StringVar(&upOpts.proxy, "proxy", run.ProxyEnvoy, "proxy implementation: envoy|builtin")
+	upCmd.Flags().StringVar(&upOpts.name, "name", "", "name of the instance (overrides 'name:' in the config, default \"default\")")
+	upCmd.Flags().BoolVar(&upOpts.dns, "dns", false, "run a DNS server that resolves the hosts (see 'dns:' in the config)")
+	upCmd.Flags().BoolVar(&upOpts.forceCluster, "force-cluster", false, "start even if the cluster does not match 'cluster:' in the config")
 }
 
 func runUp(cmd *cobra.Command, args []string) error {
 	// フラグが指定されていない場合、位置引数を使用
-	if upOpts.configFile == "" && len(args) > 0 {
-		upOpts.configFile = args[0]
+	files, err := configFiles(upOpts.configFiles, args)
+	if err != nil {
+		return err
 	}
 
-	if upOpts.configFile == "" {
-		return fmt.Errorf("config file required: use -f or provide as argument")
+	if upOpts.name != "" {
+		if err := config.ValidateName(upOpts.name); err != nil {
+			return fmt.Errorf("invalid --name: %w", err)
+		}
+	}
+
+	loadOpts, err := loadOptions(upOpts.set, upOpts.selection)
+	if err != nil {
+		return err
 	}
 
-	// 設定ファイルの読み込み
-	cfg, err := config.Load(upOpts.configFile)
+	// 設定ファイルの読み込み（複数指定時はマージ）
+	cfg, err := config.LoadFiles(loadOpts, files...)
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
@@ -63,5 +109,16 @@ func runUp(cmd *cobra.Command, args []string) error {
 	// 論理反転: noEditHosts=false → updateHosts=true
 	updateHosts := !upOpts.noEditHosts
 
-	return run.Run(ctx, cfg, globalLogLevel, updateHosts)
+	return run.Run(ctx, cfg, run.Options{
+		LogLevel:     globalLogLevel,
+		UpdateHosts:  updateHosts,
+		ConfigPaths:  files,
+		LoadOptions:  loadOpts,
+		Watch:        upOpts.watch,
+		Proxy:        upOpts.proxy,
+		Kube:         globalKube,
+		ForceCluster: upOpts.forceCluster,
+		Name:         upOpts.name,
+		DNS:          upOpts.dns,
+	})
 }
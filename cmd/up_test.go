@@ -1,8 +1,8 @@
 package cmd
 
 import (
-	"fmt"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -13,26 +13,38 @@ func TestUpCommand_FlagParsing(t *testing.T) {
 	tests := []struct {
 		name        string
 		args        []string
-		wantConfig  string
+		wantConfig  []string
 		wantErr     bool
 		errContains string
 	}{
 		{
 			name:       "flag形式で設定ファイル指定",
 			args:       []string{"-f", "testdata/test-services.yaml"},
-			wantConfig: "testdata/test-services.yaml",
+			wantConfig: []string{"testdata/test-services.yaml"},
 			wantErr:    false,
 		},
 		{
 			name:       "long flag形式で設定ファイル指定",
 			args:       []string{"--config", "testdata/test-services.yaml"},
-			wantConfig: "testdata/test-services.yaml",
+			wantConfig: []string{"testdata/test-services.yaml"},
 			wantErr:    false,
 		},
 		{
 			name:       "位置引数で設定ファイル指定",
 			args:       []string{"testdata/test-services.yaml"},
-			wantConfig: "testdata/test-services.yaml",
+			wantConfig: []string{"testdata/test-services.yaml"},
+			wantErr:    false,
+		},
+		{
+			name:       "flag形式で複数の設定ファイル指定",
+			args:       []string{"-f", "testdata/test-services.yaml", "-f", "testdata/local"},
+			wantConfig: []string{"testdata/test-services.yaml", "testdata/local"},
+			wantErr:    false,
+		},
+		{
+			name:       "位置引数で複数の設定ファイル指定",
+			args:       []string{"testdata/test-services.yaml", "testdata/local"},
+			wantConfig: []string{"testdata/test-services.yaml", "testdata/local"},
 			wantErr:    false,
 		},
 		{
@@ -52,18 +64,13 @@ func TestUpCommand_FlagParsing(t *testing.T) {
 				Use: "test",
 				RunE: func(cmd *cobra.Command, args []string) error {
 					// フラグが指定されていない場合、位置引数を使用
-					if upOpts.configFile == "" && len(args) > 0 {
-						upOpts.configFile = args[0]
-					}
-
-					if upOpts.configFile == "" {
-						return fmt.Errorf("config file required")
-					}
-					return nil
+					files, err := configFiles(upOpts.configFiles, args)
+					upOpts.configFiles = files
+					return err
 				},
 			}
 
-			cmd.Flags().StringVarP(&upOpts.configFile, "config", "f", "", "config yaml path")
+			cmd.Flags().StringArrayVarP(&upOpts.configFiles, "config", "f", nil, "config yaml path")
 			cmd.SetArgs(tt.args)
 
 			err := cmd.Execute()
@@ -78,8 +85,8 @@ func TestUpCommand_FlagParsing(t *testing.T) {
 				}
 			}
 
-			if !tt.wantErr && upOpts.configFile != tt.wantConfig {
-				t.Errorf("configFile = %v, want %v", upOpts.configFile, tt.wantConfig)
+			if !tt.wantErr && !reflect.DeepEqual(upOpts.configFiles, tt.wantConfig) {
+				t.Errorf("configFiles = %v, want %v", upOpts.configFiles, tt.wantConfig)
 			}
 		})
 	}
@@ -115,14 +122,13 @@ func TestUpCommand_NoEditHosts(t *testing.T) {
 			cmd := &cobra.Command{
 				Use: "test",
 				RunE: func(cmd *cobra.Command, args []string) error {
-					if upOpts.configFile == "" && len(args) > 0 {
-						upOpts.configFile = args[0]
-					}
-					return nil
+					files, err := configFiles(upOpts.configFiles, args)
+					upOpts.configFiles = files
+					return err
 				},
 			}
 
-			cmd.Flags().StringVarP(&upOpts.configFile, "config", "f", "", "config yaml path")
+			cmd.Flags().StringArrayVarP(&upOpts.configFiles, "config", "f", nil, "config yaml path")
 			cmd.Flags().BoolVar(&upOpts.noEditHosts, "no-edit-hosts", false, "skip updating /etc/hosts")
 			cmd.SetArgs(tt.args)
 
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/usadamasa/kubectl-localmesh/internal/config"
+)
+
+type validateOptions struct {
+	configFiles []string
+	set         []string
+}
+
+var validateOpts = &validateOptions{}
+
+var validateCmd = &cobra.Command{
+	Use:   "validate [config-file...]",
+	Short: "Validate a services.yaml without starting anything",
+	Long: `Check services.yaml and report every problem with its line and column.
+Multiple files are checked as merged by 'up'.
+
+Unlike 'up', unknown fields (e.g. a misspelled 'port_nmae') are rejected,
+with a suggestion when a known field has a similar name.
+
+Examples:
+  kubectl-localmesh validate -f services.yaml
+  kubectl-localmesh validate services.yaml`,
+	RunE: runValidate,
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+
+	validateCmd.Flags().StringArrayVarP(&validateOpts.configFiles, "config", "f", nil, "config yaml path or directory (repeatable, later files win)")
+	validateCmd.Flags().StringArrayVar(&validateOpts.set, "set", nil, "override a variable of 'vars:' (key=value, repeatable)")
+}
+
+func runValidate(cmd *cobra.Command, args []string) error {
+	files, err := configFiles(validateOpts.configFiles, args)
+	if err != nil {
+		return err
+	}
+
+	loadOpts, err := loadOptions(validateOpts.set, config.Selection{})
+	if err != nil {
+		return err
+	}
+
+	problems, err := config.Validate(loadOpts, files...)
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	if len(problems) == 0 {
+		_, _ = fmt.Fprintf(out, "%s: ok\n", strings.Join(files, ", "))
+		return nil
+	}
+	for _, p := range problems {
+		_, _ = fmt.Fprintln(out, p)
+	}
+	return fmt.Errorf("%d problem(s) found", len(problems))
+}
@@ -0,0 +1,354 @@
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	caCertFile = "ca.crt"
+	caKeyFile  = "ca.key"
+	hostsDir   = "hosts"
+
+	caValidity   = 10 * 365 * 24 * time.Hour
+	hostValidity = 397 * 24 * time.Hour // ブラウザが受け付けるサーバー証明書の最長期間
+	// renewBefore より有効期限が近いサーバー証明書は再発行する
+	renewBefore = 30 * 24 * time.Hour
+)
+
+// CA is a local development certificate authority persisted in a directory.
+type CA struct {
+	dir  string
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+// HostCert is the certificate and key files issued for a single host.
+type HostCert struct {
+	Host     string
+	CertFile string
+	KeyFile  string
+}
+
+// DefaultDir returns the default CA directory, ~/.config/kubectl-localmesh/ca.
+// When running under sudo, the home directory of the invoking user is used so
+// that 'sudo kubectl-localmesh up' and 'kubectl-localmesh ca' share the same CA.
+func DefaultDir() (string, error) {
+	home, err := invokingUserHome()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "kubectl-localmesh", "ca"), nil
+}
+
+// ResolveDir returns dir with a leading "~/" expanded, or DefaultDir when dir is empty.
+func ResolveDir(dir string) (string, error) {
+	if dir == "" {
+		return DefaultDir()
+	}
+	if dir == "~" || strings.HasPrefix(dir, "~/") {
+		home, err := invokingUserHome()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, strings.TrimPrefix(dir, "~")), nil
+	}
+	return dir, nil
+}
+
+// LoadOrCreateCA loads the CA stored in dir, generating and persisting a new
+// one on first use.
+func LoadOrCreateCA(dir string) (*CA, error) {
+	ca, err := loadCA(dir)
+	if err == nil {
+		return ca, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return createCA(dir)
+}
+
+// CertFile returns the path of the CA certificate (PEM).
+func (ca *CA) CertFile() string {
+	return filepath.Join(ca.dir, caCertFile)
+}
+
+// CertPEM returns the CA certificate in PEM format.
+func (ca *CA) CertPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+}
+
+// HostCertPaths returns the paths where the certificate of host is stored in dir.
+func HostCertPaths(dir, host string) HostCert {
+	name := fileName(host)
+	return HostCert{
+		Host:     host,
+		CertFile: filepath.Join(dir, hostsDir, name+".crt"),
+		KeyFile:  filepath.Join(dir, hostsDir, name+".key"),
+	}
+}
+
+// EnsureHostCert returns the certificate of host, issuing a new one when it
+// does not exist yet, was issued by another CA or is about to expire.
+func (ca *CA) EnsureHostCert(host string) (HostCert, error) {
+	hc := HostCertPaths(ca.dir, host)
+	if ca.validHostCert(hc) {
+		return hc, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return HostCert{}, err
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return HostCert{}, err
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(hostValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		return HostCert{}, fmt.Errorf("failed to issue certificate for %s: %w", host, err)
+	}
+
+	if err := mkdirOwned(filepath.Dir(hc.CertFile)); err != nil {
+		return HostCert{}, err
+	}
+	if err := writeKey(hc.KeyFile, key); err != nil {
+		return HostCert{}, err
+	}
+	if err := writePEM(hc.CertFile, "CERTIFICATE", der, 0644); err != nil {
+		return HostCert{}, err
+	}
+	return hc, nil
+}
+
+// validHostCert は、保存済みの証明書がこのCAで発行され、当面有効かどうかを返す
+func (ca *CA) validHostCert(hc HostCert) bool {
+	cert, err := readCert(hc.CertFile)
+	if err != nil {
+		return false
+	}
+	if _, err := os.Stat(hc.KeyFile); err != nil {
+		return false
+	}
+	if time.Until(cert.NotAfter) < renewBefore {
+		return false
+	}
+	return cert.CheckSignatureFrom(ca.cert) == nil && cert.VerifyHostname(hc.Host) == nil
+}
+
+// loadCA は、dirに保存されたCAを読み込む
+func loadCA(dir string) (*CA, error) {
+	cert, err := readCert(filepath.Join(dir, caCertFile))
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, caKeyFile))
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("invalid CA key in %s", dir)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CA key in %s: %w", dir, err)
+	}
+	key, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported CA key type in %s", dir)
+	}
+
+	return &CA{dir: dir, cert: cert, key: key}, nil
+}
+
+// createCA は、新しいCAを生成してdirに保存する
+func createCA(dir string) (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"kubectl-localmesh development CA"},
+			CommonName:   "kubectl-localmesh " + caOwner(),
+		},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mkdirOwned(dir); err != nil {
+		return nil, err
+	}
+	if err := writeKey(filepath.Join(dir, caKeyFile), key); err != nil {
+		return nil, err
+	}
+	if err := writePEM(filepath.Join(dir, caCertFile), "CERTIFICATE", der, 0644); err != nil {
+		return nil, err
+	}
+
+	return &CA{dir: dir, cert: cert, key: key}, nil
+}
+
+// readCert は、PEM形式の証明書ファイルを読み込む
+func readCert(path string) (*x509.Certificate, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("invalid certificate in %s", path)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// writeKey は、秘密鍵をPKCS#8のPEM形式で所有者のみ読める権限で書き込む
+func writeKey(path string, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	return writePEM(path, "PRIVATE KEY", der, 0600)
+}
+
+// writePEM は、PEMファイルを一時ファイル経由でアトミックに書き込む
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if err := pem.Encode(tmp, &pem.Block{Type: blockType, Bytes: der}); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	if err := chownToInvokingUser(tmp.Name()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// mkdirOwned は、ディレクトリを作成し、sudo実行時は呼び出し元ユーザーの所有にする
+func mkdirOwned(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	return chownToInvokingUser(dir)
+}
+
+// chownToInvokingUser は、sudo経由で実行された場合にファイルの所有者を呼び出し元ユーザーに変更する。
+// sudoなしで実行する ca コマンドや up --no-edit-hosts からも同じCAを使えるようにする。
+func chownToInvokingUser(path string) error {
+	uid, gid, ok := sudoUser()
+	if !ok {
+		return nil
+	}
+	return os.Chown(path, uid, gid)
+}
+
+// sudoUser は、sudo経由で実行されている場合に呼び出し元ユーザーのUID/GIDを返す
+func sudoUser() (uid, gid int, ok bool) {
+	if os.Geteuid() != 0 {
+		return 0, 0, false
+	}
+	uid, errUID := strconv.Atoi(os.Getenv("SUDO_UID"))
+	gid, errGID := strconv.Atoi(os.Getenv("SUDO_GID"))
+	if errUID != nil || errGID != nil {
+		return 0, 0, false
+	}
+	return uid, gid, true
+}
+
+// invokingUserHome は、sudo経由の場合は呼び出し元ユーザーの、それ以外は現在のユーザーのホームディレクトリを返す
+func invokingUserHome() (string, error) {
+	if uid, _, ok := sudoUser(); ok {
+		if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+			return u.HomeDir, nil
+		}
+	}
+	return os.UserHomeDir()
+}
+
+// caOwner は、CAの識別用にユーザー名とホスト名を返す
+func caOwner() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if sudo := os.Getenv("SUDO_USER"); sudo != "" && os.Geteuid() == 0 {
+		name = sudo
+	}
+	hostname, _ := os.Hostname()
+	return name + "@" + hostname
+}
+
+// newSerial は、証明書のランダムなシリアル番号を生成する
+func newSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// fileName は、ホスト名をファイル名として安全な文字列に変換する
+func fileName(host string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, strings.ToLower(host))
+}
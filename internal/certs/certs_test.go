@@ -0,0 +1,152 @@
+package certs
+
+import (
+	"bytes"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadOrCreateCA_Persists(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "ca")
+
+	ca1, err := LoadOrCreateCA(dir)
+	if err != nil {
+		t.Fatalf("LoadOrCreateCA failed: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, caKeyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("expected CA key permission 0600, got %o", perm)
+	}
+	if !ca1.cert.IsCA {
+		t.Error("expected a CA certificate")
+	}
+
+	// 2回目は保存済みのCAを読み込む
+	ca2, err := LoadOrCreateCA(dir)
+	if err != nil {
+		t.Fatalf("LoadOrCreateCA failed: %v", err)
+	}
+	if !bytes.Equal(ca1.CertPEM(), ca2.CertPEM()) {
+		t.Error("expected the persisted CA to be reused")
+	}
+}
+
+func TestEnsureHostCert(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := LoadOrCreateCA(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hc, err := ca.EnsureHostCert("users-api.localhost")
+	if err != nil {
+		t.Fatalf("EnsureHostCert failed: %v", err)
+	}
+	if hc != HostCertPaths(dir, "users-api.localhost") {
+		t.Errorf("unexpected paths: %+v", hc)
+	}
+
+	// CAで検証できるサーバー証明書であること
+	cert, err := readCert(hc.CertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	if _, err := cert.Verify(x509.VerifyOptions{
+		DNSName:   "users-api.localhost",
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}); err != nil {
+		t.Errorf("certificate does not verify: %v", err)
+	}
+
+	// 有効な証明書は再利用される
+	before, err := os.ReadFile(hc.CertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ca.EnsureHostCert("users-api.localhost"); err != nil {
+		t.Fatal(err)
+	}
+	after, err := os.ReadFile(hc.CertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("expected a valid certificate to be reused")
+	}
+
+	// CAが作り直された場合は再発行される
+	if err := os.Remove(filepath.Join(dir, caCertFile)); err != nil {
+		t.Fatal(err)
+	}
+	newCA, err := LoadOrCreateCA(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newCA.EnsureHostCert("users-api.localhost"); err != nil {
+		t.Fatal(err)
+	}
+	reissued, err := readCert(hc.CertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reissued.CheckSignatureFrom(newCA.cert); err != nil {
+		t.Errorf("expected certificate to be reissued by the new CA: %v", err)
+	}
+}
+
+func TestHostCertPaths(t *testing.T) {
+	tests := []struct {
+		host     string
+		wantCert string
+	}{
+		{"users-api.localhost", "/ca/hosts/users-api.localhost.crt"},
+		{"Users.Localhost", "/ca/hosts/users.localhost.crt"},
+		{"../etc/passwd", "/ca/hosts/.._etc_passwd.crt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			got := HostCertPaths("/ca", tt.host)
+			if got.CertFile != tt.wantCert {
+				t.Errorf("expected %s, got %s", tt.wantCert, got.CertFile)
+			}
+		})
+	}
+}
+
+func TestResolveDir(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+
+	tests := []struct {
+		dir  string
+		want string
+	}{
+		{"", filepath.Join(home, ".config", "kubectl-localmesh", "ca")},
+		{"~/certs", filepath.Join(home, "certs")},
+		{"/var/lib/localmesh", "/var/lib/localmesh"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dir, func(t *testing.T) {
+			got, err := ResolveDir(tt.dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package certs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// systemTrustTarget は、Linuxのシステム証明書ストアへの配置先と更新コマンド
+type systemTrustTarget struct {
+	dir    string
+	update []string
+}
+
+// linuxTrustTargets は、ディストリビューションごとの配置先（先に見つかったものを使用）
+var linuxTrustTargets = []systemTrustTarget{
+	{dir: "/usr/local/share/ca-certificates", update: []string{"update-ca-certificates"}},           // Debian/Ubuntu
+	{dir: "/etc/pki/ca-trust/source/anchors", update: []string{"update-ca-trust", "extract"}},       // RHEL/Fedora
+	{dir: "/etc/ca-certificates/trust-source/anchors", update: []string{"trust", "extract-compat"}}, // Arch
+}
+
+// Install adds the CA certificate to the system trust store. It usually needs
+// root privileges. Browsers or runtimes with their own trust store (Firefox,
+// Node.js, ...) have to be configured separately.
+func (ca *CA) Install(stdout, stderr io.Writer) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return runCommand(stdout, stderr,
+			"security", "add-trusted-cert", "-d", "-r", "trustRoot",
+			"-k", "/Library/Keychains/System.keychain", ca.CertFile())
+	case "linux":
+		for _, target := range linuxTrustTargets {
+			if info, err := os.Stat(target.dir); err != nil || !info.IsDir() {
+				continue
+			}
+			dst := filepath.Join(target.dir, "kubectl-localmesh-ca.crt")
+			if err := os.WriteFile(dst, ca.CertPEM(), 0644); err != nil {
+				return fmt.Errorf("failed to write %s: %w", dst, err)
+			}
+			return runCommand(stdout, stderr, target.update[0], target.update[1:]...)
+		}
+		return fmt.Errorf("no supported system trust store found; add %s to your trust store manually", ca.CertFile())
+	default:
+		return fmt.Errorf("installing the CA is not supported on %s; add %s to your trust store manually", runtime.GOOS, ca.CertFile())
+	}
+}
+
+func runCommand(stdout, stderr io.Writer, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w", name, err)
+	}
+	return nil
+}
@@ -2,18 +2,79 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"regexp"
+	"slices"
 	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	ListenerPort int                      `yaml:"listener_port"`
-	SSHBastions  map[string]*SSHBastion   `yaml:"ssh_bastions,omitempty"`
-	Services     []ServiceDefinition      `yaml:"services"`
+	// Include は先に読み込んでマージする設定ファイルまたはディレクトリ（このファイルからの相対パス）
+	Include []string `yaml:"include,omitempty"`
+	// Vars は値の中で ${NAME} として参照できる変数（--setで上書き可能）
+	Vars map[string]string `yaml:"vars,omitempty"`
+	// Name はインスタンスの名前（--nameが優先、/etc/hostsの管理ブロックと状態ファイルに記録する）
+	Name string `yaml:"name,omitempty"`
+	// KubeContext はkubeconfigのcontext（--contextが優先、省略時はcurrent-context）
+	KubeContext string `yaml:"kube_context,omitempty"`
+	// Cluster は接続先のクラスタの確認（一致しない場合はup・dump-envoy-configを中断する）
+	Cluster      *ClusterGuard `yaml:"cluster,omitempty"`
+	ListenerPort int           `yaml:"listener_port"`
+	TLS          *TLSConfig    `yaml:"tls,omitempty"`
+	// DNS はup --dnsで起動するDNSサーバーの設定
+	DNS         *DNSConfig             `yaml:"dns,omitempty"`
+	SSHBastions map[string]*SSHBastion `yaml:"ssh_bastions,omitempty"`
+	// Profiles はup --profileで起動するサービスの組み合わせ
+	Profiles map[string]*Profile `yaml:"profiles,omitempty"`
+	Services []ServiceDefinition `yaml:"services"`
+
+	files []string // 読み込んだ設定ファイル（マージ順）
 }
 
+// DefaultName は、name:も--nameも指定しない場合のインスタンスの名前
+const DefaultName = "default"
+
+// namePattern は、インスタンスの名前に使える文字列
+var namePattern = regexp.MustCompile(`^[0-9A-Za-z_-]{1,64}$`)
+
+// ValidateName checks that name can be used as the name of an instance:
+// 1-64 letters, digits, '-' or '_'.
+func ValidateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("name must be 1-64 letters, digits, '-' or '_', got '%s'", name)
+	}
+	return nil
+}
+
+// EffectiveName returns name, or DefaultName when it is not set.
+func (cfg *Config) EffectiveName() string {
+	if cfg.Name != "" {
+		return cfg.Name
+	}
+	return DefaultName
+}
+
+// TLSConfig はローカルCAによるTLS終端の設定（指定時のみ有効）
+type TLSConfig struct {
+	ListenerPort int    `yaml:"listener_port,omitempty"` // TLSリスナーのポート（デフォルト443）
+	CADir        string `yaml:"ca_dir,omitempty"`        // CAと証明書の保存先（デフォルト ~/.config/kubectl-localmesh/ca）
+}
+
+// ClusterGuard は接続先のクラスタとして期待する値（指定した値のみ確認する）
+type ClusterGuard struct {
+	Context       string `yaml:"context,omitempty"`        // kubeconfigのcontext名
+	Server        string `yaml:"server,omitempty"`         // APIサーバーのURL
+	Namespace     string `yaml:"namespace,omitempty"`      // UIDを確認するnamespace（デフォルト kube-system）
+	NamespaceUID  string `yaml:"namespace_uid,omitempty"`  // namespaceのUID
+	CAFingerprint string `yaml:"ca_fingerprint,omitempty"` // クラスタのCA証明書のSHA-256（sha256:<hex>）
+}
+
+// DefaultGuardNamespace は、cluster.namespace_uidで確認するnamespaceのデフォルト
+const DefaultGuardNamespace = "kube-system"
+
 type SSHBastion struct {
 	Instance string `yaml:"instance"` // GCP Compute Instance名
 	Zone     string `yaml:"zone"`     // GCPゾーン
@@ -24,12 +85,16 @@ type SSHBastion struct {
 type Service interface {
 	GetHost() string
 	GetKind() string
+	GetTags() []string
 	Validate(*Config) error
 }
 
 // ServiceDefinition はタグ付きユニオン型のルート構造体
 type ServiceDefinition struct {
 	service Service
+	// YAML上の位置（YAMLから読み込んだ場合のみ）
+	file         string
+	line, column int
 }
 
 // KubernetesService はKubernetes Service（HTTP/gRPC）を表現
@@ -39,7 +104,74 @@ type KubernetesService struct {
 	Service   string `yaml:"service"`
 	PortName  string `yaml:"port_name,omitempty"`
 	Port      int    `yaml:"port,omitempty"`
-	Protocol  string `yaml:"protocol"` // http|grpc
+	Protocol  string `yaml:"protocol,omitempty"` // http|grpc|tcp（省略時はServiceのappProtocolとポート名から推測）
+	// Tags は --profile / --only / --exclude でサービスを選択するためのタグ
+	Tags []string `yaml:"tags,omitempty"`
+	// ListenPort はprotocol: tcpの場合にローカルでリスンするポート
+	ListenPort int `yaml:"listen_port,omitempty"`
+	// UpstreamProtocol はport-forward先へのHTTPプロトコル（省略時はprotocolから決定）
+	UpstreamProtocol string `yaml:"upstream_protocol,omitempty"`
+	// Routes はパス・ヘッダーによる振り分け（一致しないリクエストはこのサービスへ転送）
+	Routes []HTTPRoute `yaml:"routes,omitempty"`
+
+	// このサービスへ転送するリクエストの書き換え
+	HostRewrite   string `yaml:"host_rewrite,omitempty"`
+	PrefixRewrite string `yaml:"prefix_rewrite,omitempty"`
+	// ホスト内のすべてのリクエスト・レスポンスに対するヘッダーの追加（同名のヘッダーは上書き）と削除
+	RequestHeadersToAdd     []HeaderValue `yaml:"request_headers_to_add,omitempty"`
+	RequestHeadersToRemove  []string      `yaml:"request_headers_to_remove,omitempty"`
+	ResponseHeadersToAdd    []HeaderValue `yaml:"response_headers_to_add,omitempty"`
+	ResponseHeadersToRemove []string      `yaml:"response_headers_to_remove,omitempty"`
+}
+
+// HeaderValue は追加するヘッダー
+type HeaderValue struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+// 上流（port-forward先）へのHTTPプロトコル
+const (
+	UpstreamHTTP1    = "http1"     // HTTP/1.1（平文）
+	UpstreamH2C      = "h2c"       // HTTP/2 prior knowledge（平文）
+	UpstreamAuto     = "auto"      // クライアントと同じプロトコル（平文）
+	UpstreamHTTP1TLS = "http1-tls" // HTTP/1.1 over TLS
+	UpstreamH2TLS    = "h2-tls"    // HTTP/2 over TLS
+	UpstreamAutoTLS  = "auto-tls"  // TLSのALPNでHTTP/2かHTTP/1.1を選択
+)
+
+// UpstreamProtocols は upstream_protocol に指定できる値
+var UpstreamProtocols = []string{
+	UpstreamHTTP1, UpstreamH2C, UpstreamAuto,
+	UpstreamHTTP1TLS, UpstreamH2TLS, UpstreamAutoTLS,
+}
+
+// EffectiveUpstreamProtocol returns upstream_protocol, or the default for the
+// service protocol when it is not set: h2c for grpc and http1 for http. When
+// protocol is omitted, call it on the result of WithProtocol.
+func (k *KubernetesService) EffectiveUpstreamProtocol() string {
+	if k.UpstreamProtocol != "" {
+		return k.UpstreamProtocol
+	}
+	if k.Protocol == "grpc" {
+		return UpstreamH2C
+	}
+	return UpstreamHTTP1
+}
+
+// WithProtocol returns a copy of the service with protocol set to the
+// protocol resolved from the Service when it is omitted. protocol is http
+// when it is empty.
+func (k *KubernetesService) WithProtocol(protocol string) *KubernetesService {
+	if k.Protocol != "" {
+		return k
+	}
+	if protocol == "" {
+		protocol = "http"
+	}
+	resolved := *k
+	resolved.Protocol = protocol
+	return &resolved
 }
 
 // TCPService はGCP SSH Bastion経由のTCP接続を表現
@@ -48,19 +180,46 @@ type TCPService struct {
 	SSHBastion string `yaml:"ssh_bastion"`
 	TargetHost string `yaml:"target_host"`
 	TargetPort int    `yaml:"target_port"`
+	// Tags は --profile / --only / --exclude でサービスを選択するためのタグ
+	Tags []string `yaml:"tags,omitempty"`
+	// LocalPort はローカルでリスンするポート（省略時はtarget_port）
+	LocalPort int `yaml:"local_port,omitempty"`
+	// ListenAddress はローカルでリスンするアドレス（省略時はホスト名ごとに自動で割り当て）
+	ListenAddress string `yaml:"listen_address,omitempty"`
+}
+
+// EffectiveLocalPort returns local_port, or target_port when it is not set.
+func (t *TCPService) EffectiveLocalPort() int {
+	if t.LocalPort != 0 {
+		return t.LocalPort
+	}
+	return t.TargetPort
 }
 
 // インターフェース実装
-func (k *KubernetesService) GetHost() string { return k.Host }
-func (k *KubernetesService) GetKind() string { return "kubernetes" }
-func (t *TCPService) GetHost() string        { return t.Host }
-func (t *TCPService) GetKind() string        { return "tcp" }
+func (k *KubernetesService) GetHost() string   { return k.Host }
+func (k *KubernetesService) GetKind() string   { return "kubernetes" }
+func (k *KubernetesService) GetTags() []string { return k.Tags }
+func (t *TCPService) GetHost() string          { return t.Host }
+func (t *TCPService) GetKind() string          { return "tcp" }
+func (t *TCPService) GetTags() []string        { return t.Tags }
+
+// NewServiceDefinition はServiceを包んだServiceDefinitionを生成
+func NewServiceDefinition(svc Service) ServiceDefinition {
+	return ServiceDefinition{service: svc}
+}
 
 // Get は内部のServiceインターフェースを取得
 func (sd *ServiceDefinition) Get() Service {
 	return sd.service
 }
 
+// Line returns the line of the entry in the YAML source, or 0 if the entry
+// was not loaded from YAML.
+func (sd *ServiceDefinition) Line() int {
+	return sd.line
+}
+
 // AsKubernetes は型アサーション（type switchの代替）
 func (sd *ServiceDefinition) AsKubernetes() (*KubernetesService, bool) {
 	k8s, ok := sd.service.(*KubernetesService)
@@ -75,6 +234,8 @@ func (sd *ServiceDefinition) AsTCP() (*TCPService, bool) {
 
 // UnmarshalYAML でタグ付きユニオン型を実現
 func (sd *ServiceDefinition) UnmarshalYAML(node *yaml.Node) error {
+	sd.line, sd.column = node.Line, node.Column
+
 	// 1. まず汎用マップとしてデコード
 	var raw map[string]interface{}
 	if err := node.Decode(&raw); err != nil {
@@ -105,8 +266,14 @@ func (sd *ServiceDefinition) UnmarshalYAML(node *yaml.Node) error {
 			return err
 		}
 		sd.service = &tcpSvc
+	case "kubernetes-discovery":
+		var discovery KubernetesDiscovery
+		if err := node.Decode(&discovery); err != nil {
+			return err
+		}
+		sd.service = &discovery
 	default:
-		return fmt.Errorf("unknown service kind: %s (must be 'kubernetes' or 'tcp')", kind)
+		return fmt.Errorf("unknown service kind: %s (must be 'kubernetes', 'tcp' or 'kubernetes-discovery')", kind)
 	}
 
 	return nil
@@ -135,6 +302,14 @@ func (sd *ServiceDefinition) MarshalYAML() (interface{}, error) {
 			Alias:      Alias{Kind: "tcp"},
 			TCPService: svc,
 		}, nil
+	case *KubernetesDiscovery:
+		return struct {
+			Alias
+			*KubernetesDiscovery `yaml:",inline"`
+		}{
+			Alias:               Alias{Kind: "kubernetes-discovery"},
+			KubernetesDiscovery: svc,
+		}, nil
 	default:
 		return nil, fmt.Errorf("unknown service type: %T", svc)
 	}
@@ -151,8 +326,51 @@ func (k *KubernetesService) Validate(cfg *Config) error {
 	if k.Service == "" {
 		return fmt.Errorf("service is required for kubernetes service '%s'", k.Host)
 	}
-	if k.Protocol != "http" && k.Protocol != "grpc" {
-		return fmt.Errorf("protocol must be 'http' or 'grpc' for kubernetes service '%s', got '%s'", k.Host, k.Protocol)
+	if k.Protocol != "" && k.Protocol != "http" && k.Protocol != "grpc" && k.Protocol != "tcp" {
+		return fmt.Errorf("protocol must be 'http', 'grpc' or 'tcp' for kubernetes service '%s', got '%s'", k.Host, k.Protocol)
+	}
+	if err := validateTags(k.Tags); err != nil {
+		return fmt.Errorf("%w for kubernetes service '%s'", err, k.Host)
+	}
+	if k.Protocol == "tcp" {
+		return k.validateTCP()
+	}
+	if k.ListenPort != 0 {
+		return fmt.Errorf("listen_port is only supported with protocol 'tcp' for kubernetes service '%s'", k.Host)
+	}
+	if k.UpstreamProtocol != "" && !slices.Contains(UpstreamProtocols, k.UpstreamProtocol) {
+		return fmt.Errorf("upstream_protocol must be one of %s for kubernetes service '%s', got '%s'",
+			strings.Join(UpstreamProtocols, ", "), k.Host, k.UpstreamProtocol)
+	}
+	if err := k.validateRewrites(); err != nil {
+		return fmt.Errorf("%w for kubernetes service '%s'", err, k.Host)
+	}
+	return k.validateRoutes()
+}
+
+// validateTCP は、protocol: tcpの場合の設定を検証する（HTTP向けの設定は指定できない）
+func (k *KubernetesService) validateTCP() error {
+	if k.ListenPort <= 0 || k.ListenPort > 65535 {
+		return fmt.Errorf("listen_port is required for kubernetes service '%s' with protocol 'tcp'", k.Host)
+	}
+
+	httpOnly := []struct {
+		field string
+		set   bool
+	}{
+		{"upstream_protocol", k.UpstreamProtocol != ""},
+		{"routes", len(k.Routes) > 0},
+		{"host_rewrite", k.HostRewrite != ""},
+		{"prefix_rewrite", k.PrefixRewrite != ""},
+		{"request_headers_to_add", len(k.RequestHeadersToAdd) > 0},
+		{"request_headers_to_remove", len(k.RequestHeadersToRemove) > 0},
+		{"response_headers_to_add", len(k.ResponseHeadersToAdd) > 0},
+		{"response_headers_to_remove", len(k.ResponseHeadersToRemove) > 0},
+	}
+	for _, f := range httpOnly {
+		if f.set {
+			return fmt.Errorf("%s is not supported with protocol 'tcp' for kubernetes service '%s'", f.field, k.Host)
+		}
 	}
 	return nil
 }
@@ -173,46 +391,215 @@ func (t *TCPService) Validate(cfg *Config) error {
 	if t.TargetPort == 0 {
 		return fmt.Errorf("target_port is required for tcp service '%s'", t.Host)
 	}
+	if t.LocalPort < 0 || t.LocalPort > 65535 {
+		return fmt.Errorf("local_port must be between 1 and 65535 for tcp service '%s', got %d", t.Host, t.LocalPort)
+	}
+	if t.ListenAddress != "" {
+		if err := validateListenAddress(t.ListenAddress); err != nil {
+			return fmt.Errorf("%w for tcp service '%s'", err, t.Host)
+		}
+	}
+	if err := validateTags(t.Tags); err != nil {
+		return fmt.Errorf("%w for tcp service '%s'", err, t.Host)
+	}
 	return nil
 }
 
+// Load reads a single configuration file. See LoadFiles.
 func Load(path string) (*Config, error) {
-	b, err := os.ReadFile(path)
+	return LoadFiles(LoadOptions{}, path)
+}
+
+// LoadFiles reads and merges configuration files. Each path is a file or a
+// directory, and files listed in 'include:' are merged before the file that
+// includes them (see Sources). Later files win: ssh_bastions are replaced by
+// name, services by host, and other values only when set.
+//
+// ${NAME} in values is replaced with the variable from opts.Set, 'vars:' of
+// any file, or the environment, in that order, before the services are
+// decoded.
+func LoadFiles(opts LoadOptions, paths ...string) (*Config, error) {
+	sources, err := readSources(paths)
 	if err != nil {
 		return nil, err
 	}
+	for i := range sources {
+		if err := sources[i].parse(); err != nil {
+			if len(sources) > 1 {
+				return nil, fmt.Errorf("%s: %w", sources[i].path, err)
+			}
+			return nil, err
+		}
+	}
+
+	exp, errs := newExpander(sources, opts.Set)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+
 	var cfg Config
-	if err := yaml.Unmarshal(b, &cfg); err != nil {
-		return nil, err
+	for _, src := range sources {
+		if errs := exp.expandNode(src); len(errs) > 0 {
+			return nil, errs[0]
+		}
+		var c Config
+		if err := src.decode(&c); err != nil {
+			if len(sources) > 1 {
+				return nil, fmt.Errorf("%s: %w", src.path, err)
+			}
+			return nil, err
+		}
+		c.setFile(src.path)
+		cfg.merge(&c)
+		cfg.files = append(cfg.files, src.path)
 	}
+	cfg.Vars = exp.vars
+	path := strings.Join(paths, ", ")
 
-	// デフォルト値設定
-	if cfg.ListenerPort == 0 {
-		cfg.ListenerPort = 80
+	cfg.setDefaults()
+	if err := cfg.validateName(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateTLS(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateCluster(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateDNS(); err != nil {
+		return nil, err
 	}
 	if len(cfg.Services) == 0 {
 		return nil, fmt.Errorf("no services configured in %s", path)
 	}
 
 	// バリデーション
-	for i, svcDef := range cfg.Services {
-		svc := svcDef.Get()
-		if svc == nil {
-			return nil, fmt.Errorf("invalid service entry at index %d: service is nil", i)
+	for i := range cfg.Services {
+		if err := cfg.validateEntry(i); err != nil {
+			return nil, err
 		}
+	}
 
-		// 文字列フィールドのトリム（各サービス型で実施）
-		trimServiceFields(svc)
+	// サービス間の衝突（すべての衝突をまとめて報告する）
+	if err := cfg.validateConflicts(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateProfiles(); err != nil {
+		return nil, err
+	}
 
-		// 各サービスのバリデーション
-		if err := svc.Validate(&cfg); err != nil {
-			return nil, fmt.Errorf("invalid service entry at index %d: %w", i, err)
-		}
+	// 起動するサービスの選択（設定全体を検証した後に行う）
+	if err := cfg.selectServices(opts.Selection); err != nil {
+		return nil, err
 	}
 
 	return &cfg, nil
 }
 
+// setDefaults は省略された値にデフォルト値を設定する
+func (cfg *Config) setDefaults() {
+	if cfg.ListenerPort == 0 {
+		cfg.ListenerPort = 80
+	}
+	cfg.Name = strings.TrimSpace(cfg.Name)
+	cfg.KubeContext = strings.TrimSpace(cfg.KubeContext)
+	if c := cfg.Cluster; c != nil {
+		c.Context = strings.TrimSpace(c.Context)
+		c.Server = strings.TrimSuffix(strings.TrimSpace(c.Server), "/")
+		c.Namespace = strings.TrimSpace(c.Namespace)
+		c.NamespaceUID = strings.TrimSpace(c.NamespaceUID)
+		c.CAFingerprint = normalizeFingerprint(c.CAFingerprint)
+		if c.NamespaceUID != "" && c.Namespace == "" {
+			c.Namespace = DefaultGuardNamespace
+		}
+	}
+	if cfg.TLS != nil {
+		if cfg.TLS.ListenerPort == 0 {
+			cfg.TLS.ListenerPort = 443
+		}
+		cfg.TLS.CADir = strings.TrimSpace(cfg.TLS.CADir)
+	}
+	if cfg.DNS != nil {
+		cfg.DNS.setDefaults()
+	}
+}
+
+// validateName は、インスタンスの名前を検証する
+func (cfg *Config) validateName() error {
+	if cfg.Name == "" {
+		return nil
+	}
+	return ValidateName(cfg.Name)
+}
+
+// validateTLS は、TLSリスナーの設定を検証する
+func (cfg *Config) validateTLS() error {
+	if cfg.TLS != nil && cfg.TLS.ListenerPort == cfg.ListenerPort {
+		return fmt.Errorf("tls.listener_port must differ from listener_port (%d)", cfg.ListenerPort)
+	}
+	return nil
+}
+
+// validateCluster は、接続先のクラスタの確認の設定を検証する
+func (cfg *Config) validateCluster() error {
+	c := cfg.Cluster
+	if c == nil {
+		return nil
+	}
+	if c.Context == "" && c.Server == "" && c.NamespaceUID == "" && c.CAFingerprint == "" {
+		return fmt.Errorf("cluster must specify at least one of context, server, namespace_uid or ca_fingerprint")
+	}
+	if c.Server != "" {
+		if u, err := url.Parse(c.Server); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("cluster.server must be an http(s) URL, got '%s'", c.Server)
+		}
+	}
+	if c.Namespace != "" && c.NamespaceUID == "" {
+		return fmt.Errorf("cluster.namespace requires cluster.namespace_uid")
+	}
+	if c.CAFingerprint != "" && !fingerprintPattern.MatchString(c.CAFingerprint) {
+		return fmt.Errorf("cluster.ca_fingerprint must be a SHA-256 fingerprint (sha256:<64 hex digits>), got '%s'", c.CAFingerprint)
+	}
+	return nil
+}
+
+// fingerprintPattern は、正規化したCA証明書のフィンガープリント
+var fingerprintPattern = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// normalizeFingerprint は、CA証明書のフィンガープリントをsha256:<hex>の形式にする
+// （大文字やopensslの出力のような:区切りも受け付ける）
+func normalizeFingerprint(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return ""
+	}
+	s = strings.TrimPrefix(s, "sha256:")
+	return "sha256:" + strings.ReplaceAll(s, ":", "")
+}
+
+// validateEntry は、i番目のサービスエントリの文字列フィールドをトリムして検証する
+func (cfg *Config) validateEntry(i int) error {
+	svc := cfg.Services[i].Get()
+	if svc == nil {
+		return fmt.Errorf("invalid service entry at index %d: service is nil", i)
+	}
+
+	// 文字列フィールドのトリム（各サービス型で実施）
+	trimServiceFields(svc)
+
+	// 各サービスのバリデーション
+	if err := svc.Validate(cfg); err != nil {
+		return fmt.Errorf("invalid service entry at index %d: %w", i, err)
+	}
+	// kubernetes-discoveryのhost_templateはServiceごとに展開した後のホスト名を検証する
+	if _, ok := svc.(*KubernetesDiscovery); !ok {
+		if err := validateHost(svc.GetHost()); err != nil {
+			return fmt.Errorf("invalid service entry at index %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
 // trimServiceFields は文字列フィールドをトリム
 func trimServiceFields(svc Service) {
 	switch s := svc.(type) {
@@ -222,10 +609,39 @@ func trimServiceFields(svc Service) {
 		s.Service = strings.TrimSpace(s.Service)
 		s.PortName = strings.TrimSpace(s.PortName)
 		s.Protocol = strings.TrimSpace(s.Protocol)
+		trimStrings(s.Tags)
+		s.UpstreamProtocol = strings.TrimSpace(s.UpstreamProtocol)
+		trimRoutes(s.Routes)
+		s.HostRewrite = strings.TrimSpace(s.HostRewrite)
+		s.PrefixRewrite = strings.TrimSpace(s.PrefixRewrite)
+		for i := range s.RequestHeadersToAdd {
+			s.RequestHeadersToAdd[i].Name = strings.TrimSpace(s.RequestHeadersToAdd[i].Name)
+		}
+		for i := range s.ResponseHeadersToAdd {
+			s.ResponseHeadersToAdd[i].Name = strings.TrimSpace(s.ResponseHeadersToAdd[i].Name)
+		}
+		trimStrings(s.RequestHeadersToRemove)
+		trimStrings(s.ResponseHeadersToRemove)
 	case *TCPService:
 		s.Host = strings.TrimSpace(s.Host)
 		s.SSHBastion = strings.TrimSpace(s.SSHBastion)
 		s.TargetHost = strings.TrimSpace(s.TargetHost)
+		s.ListenAddress = strings.TrimSpace(s.ListenAddress)
+		trimStrings(s.Tags)
+	case *KubernetesDiscovery:
+		trimStrings(s.Namespaces)
+		s.Selector = strings.TrimSpace(s.Selector)
+		s.HostTemplate = strings.TrimSpace(s.HostTemplate)
+		s.PortName = strings.TrimSpace(s.PortName)
+		s.Protocol = strings.TrimSpace(s.Protocol)
+		trimStrings(s.Tags)
+	}
+}
+
+// trimStrings は各要素をトリム
+func trimStrings(values []string) {
+	for i := range values {
+		values[i] = strings.TrimSpace(values[i])
 	}
 }
 
@@ -238,6 +654,10 @@ type MockService struct {
 	Service      string `yaml:"service"`
 	PortName     string `yaml:"port_name"`
 	ResolvedPort int    `yaml:"resolved_port"`
+	// AppProtocol はServiceのポートのappProtocol（protocolの推測に使う）
+	AppProtocol string `yaml:"app_protocol,omitempty"`
+	// Labels はkubernetes-discoveryのセレクタと照合するServiceのラベル
+	Labels map[string]string `yaml:"labels,omitempty"`
 }
 
 func LoadMockConfig(path string) (*MockConfig, error) {
@@ -1,8 +1,12 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -896,6 +900,46 @@ func TestKubernetesService_ValidateEdgeCases(t *testing.T) {
 			wantErr: true,
 			errMsg:  "protocol must be",
 		},
+		{
+			name:    "invalid upstream_protocol",
+			svc:     &KubernetesService{Host: "test.localhost", Namespace: "test", Service: "svc", Protocol: "http", UpstreamProtocol: "h3"},
+			wantErr: true,
+			errMsg:  "upstream_protocol must be one of",
+		},
+		{
+			name:    "tcp without listen_port",
+			svc:     &KubernetesService{Host: "db.localhost", Namespace: "db", Service: "postgres", Protocol: "tcp"},
+			wantErr: true,
+			errMsg:  "listen_port is required",
+		},
+		{
+			name:    "tcp with invalid listen_port",
+			svc:     &KubernetesService{Host: "db.localhost", Namespace: "db", Service: "postgres", Protocol: "tcp", ListenPort: 70000},
+			wantErr: true,
+			errMsg:  "listen_port is required",
+		},
+		{
+			name:    "tcp with http options",
+			svc:     &KubernetesService{Host: "db.localhost", Namespace: "db", Service: "postgres", Protocol: "tcp", ListenPort: 5432, HostRewrite: "postgres"},
+			wantErr: true,
+			errMsg:  "host_rewrite is not supported with protocol 'tcp'",
+		},
+		{
+			name:    "listen_port without tcp",
+			svc:     &KubernetesService{Host: "test.localhost", Namespace: "test", Service: "svc", Protocol: "http", ListenPort: 8080},
+			wantErr: true,
+			errMsg:  "listen_port is only supported with protocol 'tcp'",
+		},
+		{
+			name:    "valid tcp",
+			svc:     &KubernetesService{Host: "db.localhost", Namespace: "db", Service: "postgres", Protocol: "tcp", ListenPort: 5432},
+			wantErr: false,
+		},
+		{
+			name:    "valid upstream_protocol",
+			svc:     &KubernetesService{Host: "test.localhost", Namespace: "test", Service: "svc", Protocol: "grpc", UpstreamProtocol: "h2-tls"},
+			wantErr: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -911,6 +955,26 @@ func TestKubernetesService_ValidateEdgeCases(t *testing.T) {
 	}
 }
 
+func TestKubernetesService_EffectiveUpstreamProtocol(t *testing.T) {
+	tests := []struct {
+		name string
+		svc  KubernetesService
+		want string
+	}{
+		{"httpのデフォルト", KubernetesService{Protocol: "http"}, UpstreamHTTP1},
+		{"grpcのデフォルト", KubernetesService{Protocol: "grpc"}, UpstreamH2C},
+		{"明示的な指定", KubernetesService{Protocol: "http", UpstreamProtocol: UpstreamAutoTLS}, UpstreamAutoTLS},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.svc.EffectiveUpstreamProtocol(); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
 func TestTCPService_ValidateEdgeCases(t *testing.T) {
 	// TCPServiceの全バリデーションパスをカバー
 	cfg := &Config{
@@ -931,6 +995,29 @@ func TestTCPService_ValidateEdgeCases(t *testing.T) {
 			wantErr: true,
 			errMsg:  "ssh_bastion is required",
 		},
+		{
+			name:    "local_port out of range",
+			svc:     &TCPService{Host: "db.localhost", SSHBastion: "primary", TargetHost: "10.0.0.1", TargetPort: 5432, LocalPort: 70000},
+			wantErr: true,
+			errMsg:  "local_port must be between 1 and 65535",
+		},
+		{
+			name:    "listen_address is not an IP address",
+			svc:     &TCPService{Host: "db.localhost", SSHBastion: "primary", TargetHost: "10.0.0.1", TargetPort: 5432, ListenAddress: "localhost"},
+			wantErr: true,
+			errMsg:  "listen_address must be an IP address",
+		},
+		{
+			name:    "listen_address in automatic range",
+			svc:     &TCPService{Host: "db.localhost", SSHBastion: "primary", TargetHost: "10.0.0.1", TargetPort: 5432, ListenAddress: "127.0.0.5"},
+			wantErr: true,
+			errMsg:  "reserved for automatic assignment",
+		},
+		{
+			name:    "local_port and listen_address",
+			svc:     &TCPService{Host: "db.localhost", SSHBastion: "primary", TargetHost: "10.0.0.1", TargetPort: 5432, LocalPort: 15432, ListenAddress: "127.0.0.1"},
+			wantErr: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -946,6 +1033,282 @@ func TestTCPService_ValidateEdgeCases(t *testing.T) {
 	}
 }
 
+func TestTCPService_EffectiveLocalPort(t *testing.T) {
+	if got := (&TCPService{TargetPort: 5432}).EffectiveLocalPort(); got != 5432 {
+		t.Errorf("expected target_port 5432, got %d", got)
+	}
+	if got := (&TCPService{TargetPort: 5432, LocalPort: 15432}).EffectiveLocalPort(); got != 15432 {
+		t.Errorf("expected local_port 15432, got %d", got)
+	}
+}
+
+func TestLoad_TCPListenerConflicts(t *testing.T) {
+	header := `
+listener_port: 8080
+ssh_bastions:
+  primary:
+    instance: bastion
+    zone: zone
+    project: proj
+services:
+`
+	tcp := func(host string, port int, extra string) string {
+		return fmt.Sprintf(`  - kind: tcp
+    host: %s
+    ssh_bastion: primary
+    target_host: %s
+    target_port: %d
+%s`, host, host, port, extra)
+	}
+
+	tests := []struct {
+		name     string
+		services string
+		tls      string
+		errMsg   string
+	}{
+		{
+			name:     "automatic addresses on the same port",
+			services: tcp("a.localhost", 5432, "") + tcp("b.localhost", 5432, ""),
+		},
+		{
+			name:     "distinct explicit addresses on the same port",
+			services: tcp("a.localhost", 5432, "    listen_address: 127.0.0.1\n") + tcp("b.localhost", 5432, "    listen_address: 127.0.1.1\n"),
+		},
+		{
+			name:     "same explicit address and port",
+			services: tcp("a.localhost", 5432, "    listen_address: 127.0.0.1\n") + tcp("b.localhost", 15432, "    local_port: 5432\n    listen_address: 127.0.0.1\n"),
+			errMsg:   "service entry at index 1 ('b.localhost', line 15): port 5432 conflicts with service entry at index 0 ('a.localhost', line 9)",
+		},
+		{
+			name:     "unspecified address overlaps automatic address",
+			services: tcp("a.localhost", 5432, "") + tcp("b.localhost", 5432, "    listen_address: 0.0.0.0\n"),
+			errMsg:   "port 5432 conflicts with service entry at index 0 ('a.localhost', line 9)",
+		},
+		{
+			name:     "local_port equals listener_port",
+			services: tcp("a.localhost", 5432, "    local_port: 8080\n"),
+			errMsg:   "service entry at index 0 ('a.localhost', line 9): port 8080 conflicts with listener_port",
+		},
+		{
+			name:     "target_port equals tls listener_port",
+			services: tcp("a.localhost", 8443, ""),
+			tls:      "tls:\n  listener_port: 8443\n",
+			errMsg:   "port 8443 conflicts with tls.listener_port",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(tt.tls+header+tt.services), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := Load(configPath)
+			if tt.errMsg == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected error containing '%s', got nil", tt.errMsg)
+			}
+			if !containsString(err.Error(), tt.errMsg) {
+				t.Errorf("expected error containing '%s', got '%s'", tt.errMsg, err.Error())
+			}
+		})
+	}
+}
+
+func TestLoad_Conflicts(t *testing.T) {
+	content := `listener_port: 8080
+ssh_bastions:
+  primary:
+    instance: bastion
+    zone: zone
+    project: proj
+services:
+  - kind: kubernetes
+    host: users-api.localhost
+    namespace: users
+    service: api
+    port: 8080
+    protocol: http
+  - kind: kubernetes
+    host: Users-API.localhost
+    namespace: users-v2
+    service: api
+    port: 8080
+    protocol: http
+  - kind: kubernetes
+    host: users-v2.localhost
+    namespace: users
+    service: v2-api
+    port: 8080
+    protocol: http
+  - kind: tcp
+    host: db.localhost
+    ssh_bastion: primary
+    target_host: 10.0.0.1
+    target_port: 8080
+`
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Load(configPath)
+	var conflictErr *ConflictError
+	if !errors.As(err, &conflictErr) {
+		t.Fatalf("expected ConflictError, got %v", err)
+	}
+
+	// すべての衝突がインデックスと行番号付きでまとめて報告される
+	want := []string{
+		"service entry at index 1 ('Users-API.localhost', line 14): duplicate host, already used by service entry at index 0 ('users-api.localhost', line 8)",
+		"service entry at index 3 ('db.localhost', line 26): port 8080 conflicts with listener_port",
+		"service entry at index 2 ('users-v2.localhost', line 20): cluster name 'users_v2_api_8080' is already used by service entry at index 1 ('Users-API.localhost', line 14)",
+	}
+	var got []string
+	for _, c := range conflictErr.Conflicts {
+		got = append(got, c.Message)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected conflicts:\n got: %q\nwant: %q", got, want)
+	}
+	if conflictErr.Conflicts[0].Index != 1 || conflictErr.Conflicts[1].Index != 3 {
+		t.Errorf("unexpected conflict indices: %+v", conflictErr.Conflicts)
+	}
+	if !containsString(err.Error(), "3 conflict(s) between service entries") {
+		t.Errorf("unexpected error message: %s", err.Error())
+	}
+}
+
+func TestLoad_ConflictingPortNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		portName string
+		wantErr  bool
+	}{
+		{name: "same port_name", portName: "http", wantErr: true},
+		{name: "different port_name", portName: "grpc", wantErr: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := fmt.Sprintf(`services:
+  - kind: kubernetes
+    host: a.localhost
+    namespace: default
+    service: web
+    port_name: http
+    protocol: http
+  - kind: kubernetes
+    host: b.localhost
+    namespace: default
+    service: web
+    port_name: %s
+    protocol: http
+`, tt.portName)
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := Load(configPath)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad_RouteClusterConflicts(t *testing.T) {
+	tests := []struct {
+		name    string
+		admin   string // admin.localhostの定義
+		wantErr string
+	}{
+		{
+			name: "route target shared across hosts",
+			admin: `    service: admin
+    port: 8080
+    protocol: http
+    routes:
+      - prefix: /auth
+        service: auth
+        port: 80`,
+		},
+		{
+			name: "service shared with a route target",
+			admin: `    service: auth
+    port: 80
+    protocol: http`,
+		},
+		{
+			name: "different upstream_protocol",
+			admin: `    service: admin
+    port: 8080
+    protocol: http
+    routes:
+      - prefix: /auth
+        service: auth
+        port: 80
+        upstream_protocol: h2c`,
+			wantErr: "route at index 0 of service entry at index 1 ('admin.localhost', line 12): upstream_protocol 'h2c' of cluster 'default_auth_80' differs from 'http1' of route at index 0 of service entry at index 0 ('app.localhost', line 2)",
+		},
+		{
+			name: "TCP service",
+			admin: `    service: auth
+    port: 80
+    protocol: tcp
+    listen_port: 15432`,
+			wantErr: "service entry at index 1 ('admin.localhost', line 12): cluster 'default_auth_80' is already used by route at index 0 of service entry at index 0 ('app.localhost', line 2); a TCP service cannot share its Service port with routes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := `services:
+  - kind: kubernetes
+    host: app.localhost
+    namespace: default
+    service: web
+    port: 8080
+    protocol: http
+    routes:
+      - prefix: /auth
+        service: auth
+        port: 80
+  - kind: kubernetes
+    host: admin.localhost
+    namespace: default
+` + tt.admin + "\n"
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := Load(configPath)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			var conflictErr *ConflictError
+			if !errors.As(err, &conflictErr) {
+				t.Fatalf("expected ConflictError, got %v", err)
+			}
+			if len(conflictErr.Conflicts) != 1 || conflictErr.Conflicts[0].Message != tt.wantErr {
+				t.Errorf("unexpected conflicts: %+v\nwant: %s", conflictErr.Conflicts, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestLoad_InvalidFile(t *testing.T) {
 	// 存在しないファイル
 	_, err := Load("/nonexistent/path/to/config.yaml")
@@ -973,3 +1336,803 @@ listener_port: 80
 		t.Errorf("expected error containing 'no services configured', got '%s'", err.Error())
 	}
 }
+
+func TestLoad_TLS(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		wantPort int
+		wantDir  string
+		wantNil  bool
+		errMsg   string
+	}{
+		{
+			name: "tls未指定",
+			content: `
+services:
+  - kind: kubernetes
+    host: users.localhost
+    namespace: users
+    service: users-api
+    port: 8080
+    protocol: http
+`,
+			wantNil: true,
+		},
+		{
+			name: "デフォルトのTLSポート",
+			content: `
+tls: {}
+services:
+  - kind: kubernetes
+    host: users.localhost
+    namespace: users
+    service: users-api
+    port: 8080
+    protocol: http
+`,
+			wantPort: 443,
+		},
+		{
+			name: "ポートとCAディレクトリを指定",
+			content: `
+tls:
+  listener_port: 8443
+  ca_dir: " ~/certs "
+services:
+  - kind: kubernetes
+    host: users.localhost
+    namespace: users
+    service: users-api
+    port: 8080
+    protocol: http
+`,
+			wantPort: 8443,
+			wantDir:  "~/certs",
+		},
+		{
+			name: "listener_portと重複",
+			content: `
+listener_port: 443
+tls: {}
+services:
+  - kind: kubernetes
+    host: users.localhost
+    namespace: users
+    service: users-api
+    port: 8080
+    protocol: http
+`,
+			errMsg: "tls.listener_port must differ from listener_port",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.errMsg != "" {
+				if err == nil || !containsString(err.Error(), tt.errMsg) {
+					t.Fatalf("expected error containing '%s', got %v", tt.errMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+
+			if tt.wantNil {
+				if cfg.TLS != nil {
+					t.Errorf("expected no tls config, got %+v", cfg.TLS)
+				}
+				return
+			}
+			if cfg.TLS.ListenerPort != tt.wantPort {
+				t.Errorf("expected tls.listener_port %d, got %d", tt.wantPort, cfg.TLS.ListenerPort)
+			}
+			if cfg.TLS.CADir != tt.wantDir {
+				t.Errorf("expected tls.ca_dir %q, got %q", tt.wantDir, cfg.TLS.CADir)
+			}
+		})
+	}
+}
+
+func TestLoad_Cluster(t *testing.T) {
+	const services = `
+services:
+  - kind: kubernetes
+    host: users.localhost
+    namespace: users
+    service: users-api
+    port: 8080
+    protocol: http
+`
+	fingerprint := "sha256:" + strings.Repeat("ab", 32)
+	tests := []struct {
+		name    string
+		cluster string
+		want    *ClusterGuard
+		errMsg  string
+	}{
+		{
+			name: "cluster未指定",
+		},
+		{
+			name: "すべての値を指定",
+			cluster: `cluster:
+  context: " staging "
+  server: https://staging.example.com:6443/
+  namespace: default
+  namespace_uid: 4f0c6c1e-0000-4000-8000-000000000001
+  ca_fingerprint: "` + fingerprint + `"
+`,
+			want: &ClusterGuard{
+				Context:       "staging",
+				Server:        "https://staging.example.com:6443",
+				Namespace:     "default",
+				NamespaceUID:  "4f0c6c1e-0000-4000-8000-000000000001",
+				CAFingerprint: fingerprint,
+			},
+		},
+		{
+			name: "namespaceのデフォルトとフィンガープリントの正規化",
+			cluster: `cluster:
+  namespace_uid: 4f0c6c1e-0000-4000-8000-000000000001
+  ca_fingerprint: "` + strings.TrimSuffix(strings.Repeat("AB:", 32), ":") + `"
+`,
+			want: &ClusterGuard{
+				Namespace:     "kube-system",
+				NamespaceUID:  "4f0c6c1e-0000-4000-8000-000000000001",
+				CAFingerprint: fingerprint,
+			},
+		},
+		{
+			name:    "値の指定なし",
+			cluster: "cluster: {}\n",
+			errMsg:  "cluster must specify at least one of context, server, namespace_uid or ca_fingerprint",
+		},
+		{
+			name:    "不正なserver",
+			cluster: "cluster:\n  server: staging.example.com\n",
+			errMsg:  "cluster.server must be an http(s) URL, got 'staging.example.com'",
+		},
+		{
+			name:    "namespace_uidなしのnamespace",
+			cluster: "cluster:\n  context: staging\n  namespace: default\n",
+			errMsg:  "cluster.namespace requires cluster.namespace_uid",
+		},
+		{
+			name:    "不正なフィンガープリント",
+			cluster: "cluster:\n  ca_fingerprint: md5:abcd\n",
+			errMsg:  "cluster.ca_fingerprint must be a SHA-256 fingerprint",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(tt.cluster+services), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.errMsg != "" {
+				if err == nil || !containsString(err.Error(), tt.errMsg) {
+					t.Fatalf("expected error containing '%s', got %v", tt.errMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			if !reflect.DeepEqual(cfg.Cluster, tt.want) {
+				t.Errorf("expected cluster %+v, got %+v", tt.want, cfg.Cluster)
+			}
+		})
+	}
+}
+
+func TestLoad_Routes(t *testing.T) {
+	content := `
+services:
+  - kind: kubernetes
+    host: app.localhost
+    namespace: default
+    service: web
+    port: 8080
+    protocol: http
+    routes:
+      - prefix: /api
+        service: " api "
+        port: 8080
+      - regex: /v[0-9]+/.*
+        namespace: auth
+        service: auth
+        port_name: grpc
+        upstream_protocol: h2c
+      - headers:
+          - name: x-canary
+          - name: x-version
+            exact: "2"
+        service: canary
+`
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	k8sSvc, ok := cfg.Services[0].AsKubernetes()
+	if !ok {
+		t.Fatal("expected kubernetes service")
+	}
+	if len(k8sSvc.Routes) != 3 {
+		t.Fatalf("expected 3 routes, got %d", len(k8sSvc.Routes))
+	}
+
+	r := k8sSvc.Routes
+	if r[0].Prefix != "/api" || r[0].Service != "api" || r[0].Port != 8080 {
+		t.Errorf("unexpected route[0]: %+v", r[0])
+	}
+	if k8sSvc.RouteNamespace(r[0]) != "default" || k8sSvc.RouteNamespace(r[1]) != "auth" {
+		t.Errorf("unexpected namespaces: %s, %s", k8sSvc.RouteNamespace(r[0]), k8sSvc.RouteNamespace(r[1]))
+	}
+	if k8sSvc.RouteUpstreamProtocol(r[0]) != UpstreamHTTP1 || k8sSvc.RouteUpstreamProtocol(r[1]) != UpstreamH2C {
+		t.Errorf("unexpected upstream protocols: %s, %s", k8sSvc.RouteUpstreamProtocol(r[0]), k8sSvc.RouteUpstreamProtocol(r[1]))
+	}
+	if len(r[2].Headers) != 2 || r[2].Headers[1].Exact != "2" {
+		t.Errorf("unexpected headers: %+v", r[2].Headers)
+	}
+}
+
+func TestHTTPRoute_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		route  HTTPRoute
+		errMsg string // 空の場合はエラーなし
+	}{
+		{name: "prefix", route: HTTPRoute{Prefix: "/api", Service: "api"}},
+		{name: "headersのみ", route: HTTPRoute{Headers: []HeaderMatch{{Name: "x-canary"}}, Service: "canary"}},
+		{name: "転送先なし", route: HTTPRoute{Prefix: "/api"}, errMsg: "service is required"},
+		{name: "条件なし", route: HTTPRoute{Service: "api"}, errMsg: "prefix, path, regex or headers is required"},
+		{name: "複数のパス条件", route: HTTPRoute{Prefix: "/api", Path: "/api", Service: "api"}, errMsg: "only one of prefix, path or regex"},
+		{name: "スラッシュで始まらないprefix", route: HTTPRoute{Prefix: "api", Service: "api"}, errMsg: "prefix must start with '/'"},
+		{name: "スラッシュで始まらないpath", route: HTTPRoute{Path: "healthz", Service: "api"}, errMsg: "path must start with '/'"},
+		{name: "不正な正規表現", route: HTTPRoute{Regex: "/v[0-9", Service: "api"}, errMsg: "invalid regex"},
+		{name: "ヘッダー名なし", route: HTTPRoute{Headers: []HeaderMatch{{Exact: "1"}}, Service: "api"}, errMsg: "header name is required"},
+		{
+			name:   "ヘッダーの複数条件",
+			route:  HTTPRoute{Headers: []HeaderMatch{{Name: "x-version", Exact: "1", Prefix: "1"}}, Service: "api"},
+			errMsg: "only one of exact, prefix or regex",
+		},
+		{
+			name:   "ヘッダーの不正な正規表現",
+			route:  HTTPRoute{Headers: []HeaderMatch{{Name: "x-version", Regex: "("}}, Service: "api"},
+			errMsg: "invalid regex",
+		},
+		{name: "不正なupstream_protocol", route: HTTPRoute{Prefix: "/api", Service: "api", UpstreamProtocol: "h3"}, errMsg: "upstream_protocol must be one of"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &KubernetesService{
+				Host: "app.localhost", Namespace: "default", Service: "web", Protocol: "http",
+				Routes: []HTTPRoute{tt.route},
+			}
+			err := svc.Validate(&Config{})
+			if tt.errMsg == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected error containing '%s', got nil", tt.errMsg)
+			}
+			if !containsString(err.Error(), tt.errMsg) || !containsString(err.Error(), "route at index 0") {
+				t.Errorf("expected error containing '%s', got '%s'", tt.errMsg, err.Error())
+			}
+		})
+	}
+}
+
+func TestKubernetesService_ValidateRewrites(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(k *KubernetesService)
+		errMsg string // 空の場合はエラーなし
+	}{
+		{
+			name: "すべて指定",
+			modify: func(k *KubernetesService) {
+				k.HostRewrite = "users-api.users.svc.cluster.local"
+				k.PrefixRewrite = "/users/"
+				k.RequestHeadersToAdd = []HeaderValue{{Name: "x-env", Value: "local"}}
+				k.RequestHeadersToRemove = []string{"cookie"}
+				k.ResponseHeadersToAdd = []HeaderValue{{Name: "access-control-allow-origin", Value: "*"}}
+				k.ResponseHeadersToRemove = []string{"server"}
+			},
+		},
+		{
+			name:   "host_rewriteにパス",
+			modify: func(k *KubernetesService) { k.HostRewrite = "users.internal/api" },
+			errMsg: "host_rewrite must be a host name",
+		},
+		{
+			name:   "スラッシュで始まらないprefix_rewrite",
+			modify: func(k *KubernetesService) { k.PrefixRewrite = "users/" },
+			errMsg: "prefix_rewrite must start with '/'",
+		},
+		{
+			name:   "ヘッダー名なし",
+			modify: func(k *KubernetesService) { k.RequestHeadersToAdd = []HeaderValue{{Value: "local"}} },
+			errMsg: "header name is required in request_headers_to_add",
+		},
+		{
+			name:   "Hostヘッダーの削除",
+			modify: func(k *KubernetesService) { k.RequestHeadersToRemove = []string{"Host"} },
+			errMsg: "header 'Host' cannot be modified in request_headers_to_remove",
+		},
+		{
+			name:   "疑似ヘッダーの追加",
+			modify: func(k *KubernetesService) { k.ResponseHeadersToAdd = []HeaderValue{{Name: ":status", Value: "200"}} },
+			errMsg: "cannot be modified in response_headers_to_add",
+		},
+		{
+			name:   "不正なヘッダー名",
+			modify: func(k *KubernetesService) { k.ResponseHeadersToRemove = []string{"x powered by"} },
+			errMsg: "invalid header name 'x powered by' in response_headers_to_remove",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &KubernetesService{Host: "users.localhost", Namespace: "users", Service: "users-api", Protocol: "http"}
+			tt.modify(svc)
+
+			err := svc.Validate(&Config{})
+			if tt.errMsg == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected error containing '%s', got nil", tt.errMsg)
+			}
+			if !containsString(err.Error(), tt.errMsg) {
+				t.Errorf("expected error containing '%s', got '%s'", tt.errMsg, err.Error())
+			}
+		})
+	}
+}
+
+func TestLoad_Name(t *testing.T) {
+	const services = `
+services:
+  - kind: kubernetes
+    host: users.localhost
+    namespace: users
+    service: users-api
+    port: 8080
+    protocol: http
+`
+	tests := []struct {
+		name   string
+		config string
+		want   string
+		errMsg string
+	}{
+		{name: "name未指定", want: "default"},
+		{name: "名前を指定", config: "name: \" backend \"\n", want: "backend"},
+		{name: "不正な名前", config: "name: back end\n", errMsg: "name must be 1-64 letters, digits, '-' or '_', got 'back end'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(tt.config+services), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.errMsg != "" {
+				if err == nil || !containsString(err.Error(), tt.errMsg) {
+					t.Fatalf("expected error containing '%s', got %v", tt.errMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			if got := cfg.EffectiveName(); got != tt.want {
+				t.Errorf("expected name '%s', got '%s'", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLoad_DNS(t *testing.T) {
+	const services = `
+services:
+  - kind: kubernetes
+    host: users.localhost
+    namespace: users
+    service: users-api
+    port: 8080
+    protocol: http
+`
+	tests := []struct {
+		name   string
+		dns    string
+		want   *DNSConfig
+		errMsg string
+	}{
+		{
+			name: "dns未指定",
+		},
+		{
+			name: "デフォルト値",
+			dns:  "dns: {}\n",
+			want: &DNSConfig{Listen: "127.0.0.1:15353"},
+		},
+		{
+			name: "すべての値を指定",
+			dns: `dns:
+  listen: 127.0.0.53:5300
+  upstreams: [192.168.1.1, "[2001:db8::1]:5353", 8.8.8.8]
+  resolved_domains: [" Mesh.Test. ", "~preview.test"]
+`,
+			want: &DNSConfig{
+				Listen:          "127.0.0.53:5300",
+				Upstreams:       []string{"192.168.1.1:53", "[2001:db8::1]:5353", "8.8.8.8:53"},
+				ResolvedDomains: []string{"mesh.test", "preview.test"},
+			},
+		},
+		{
+			name:   "ループバックアドレス以外",
+			dns:    "dns:\n  listen: 0.0.0.0:53\n",
+			errMsg: "dns.listen must be a loopback address and port like '127.0.0.1:15353', got '0.0.0.0:53'",
+		},
+		{
+			name:   "ポートなし",
+			dns:    "dns:\n  listen: 127.0.0.1\n",
+			errMsg: "dns.listen must be a loopback address and port",
+		},
+		{
+			name:   "不正な転送先",
+			dns:    "dns:\n  upstreams: [dns.google]\n",
+			errMsg: "dns.upstreams must be IP addresses with an optional port, got 'dns.google'",
+		},
+		{
+			name:   "自身への転送",
+			dns:    "dns:\n  upstreams: [\"127.0.0.1:15353\"]\n",
+			errMsg: "dns.upstreams must not contain dns.listen (127.0.0.1:15353)",
+		},
+		{
+			name:   "不正なドメイン",
+			dns:    "dns:\n  resolved_domains: [\"mesh test\"]\n",
+			errMsg: "dns.resolved_domains must be domain names of two or more labels like 'mesh.test', got 'mesh test'",
+		},
+		{
+			name:   "トップレベルドメイン",
+			dns:    "dns:\n  resolved_domains: [com]\n",
+			errMsg: "dns.resolved_domains must be domain names of two or more labels like 'mesh.test', got 'com'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(tt.dns+services), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.errMsg != "" {
+				if err == nil || !containsString(err.Error(), tt.errMsg) {
+					t.Fatalf("expected error containing '%s', got %v", tt.errMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			if !reflect.DeepEqual(cfg.DNS, tt.want) {
+				t.Errorf("expected dns %+v, got %+v", tt.want, cfg.DNS)
+			}
+		})
+	}
+}
+
+func TestLoad_WildcardHost(t *testing.T) {
+	tests := []struct {
+		host   string
+		errMsg string
+	}{
+		{host: "*.preview.localhost"},
+		{host: "pr-*.preview.localhost", errMsg: "wildcard host must be '*.' followed by a domain, like '*.preview.localhost', got 'pr-*.preview.localhost'"},
+		{host: "*.*.localhost", errMsg: "wildcard host must be '*.' followed by a domain"},
+		{host: "*.", errMsg: "wildcard host must be '*.' followed by a domain"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			content := `services:
+  - kind: kubernetes
+    host: "` + tt.host + `"
+    namespace: preview
+    service: web
+    port: 8080
+    protocol: http
+`
+			if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := Load(configPath)
+			if tt.errMsg == "" {
+				if err != nil {
+					t.Fatalf("Load failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !containsString(err.Error(), tt.errMsg) {
+				t.Fatalf("expected error containing '%s', got %v", tt.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestLoadFiles_Merge(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	shared := write("services.yaml", `listener_port: 8080
+name: backend
+kube_context: dev
+dns:
+  listen: 127.0.0.1:5300
+  upstreams: [192.168.1.1]
+cluster:
+  context: dev
+  server: https://dev.example.com
+tls:
+  ca_dir: /tmp/ca
+ssh_bastions:
+  primary:
+    instance: bastion
+    zone: zone-a
+  secondary:
+    instance: bastion-2
+    zone: zone-b
+services:
+  - kind: kubernetes
+    host: users-api.localhost
+    namespace: users
+    service: users-api
+    port: 8080
+    protocol: http
+  - kind: tcp
+    host: users-db.localhost
+    ssh_bastion: primary
+    target_host: 10.0.0.1
+    target_port: 5432
+`)
+	local := write("local.yaml", `kube_context: " staging "
+dns:
+  resolved_domains: [mesh.test]
+cluster:
+  context: staging
+tls:
+  listener_port: 8443
+ssh_bastions:
+  primary:
+    instance: my-bastion
+    zone: zone-c
+services:
+  - kind: kubernetes
+    host: Users-API.localhost
+    namespace: users
+    service: users-api
+    port: 9090
+    protocol: grpc
+  - kind: kubernetes
+    host: debug.localhost
+    namespace: debug
+    service: debug
+    port: 8080
+    protocol: http
+`)
+
+	cfg, err := LoadFiles(LoadOptions{}, shared, local)
+	if err != nil {
+		t.Fatalf("LoadFiles failed: %v", err)
+	}
+
+	// 指定されていない値は先のファイルのまま
+	if cfg.ListenerPort != 8080 {
+		t.Errorf("expected listener_port 8080, got %d", cfg.ListenerPort)
+	}
+	if cfg.Name != "backend" {
+		t.Errorf("expected name 'backend', got '%s'", cfg.Name)
+	}
+	if cfg.KubeContext != "staging" {
+		t.Errorf("expected kube_context 'staging', got '%s'", cfg.KubeContext)
+	}
+	wantDNS := &DNSConfig{Listen: "127.0.0.1:5300", Upstreams: []string{"192.168.1.1:53"}, ResolvedDomains: []string{"mesh.test"}}
+	if !reflect.DeepEqual(cfg.DNS, wantDNS) {
+		t.Errorf("expected dns %+v, got %+v", wantDNS, cfg.DNS)
+	}
+	if want := (&ClusterGuard{Context: "staging", Server: "https://dev.example.com"}); !reflect.DeepEqual(cfg.Cluster, want) {
+		t.Errorf("expected cluster %+v, got %+v", want, cfg.Cluster)
+	}
+	if cfg.TLS == nil || cfg.TLS.ListenerPort != 8443 || cfg.TLS.CADir != "/tmp/ca" {
+		t.Errorf("unexpected tls: %+v", cfg.TLS)
+	}
+
+	// ssh_bastionsは名前ごとに置き換え
+	if cfg.SSHBastions["primary"].Instance != "my-bastion" || cfg.SSHBastions["secondary"].Instance != "bastion-2" {
+		t.Errorf("unexpected ssh_bastions: primary=%+v secondary=%+v", cfg.SSHBastions["primary"], cfg.SSHBastions["secondary"])
+	}
+
+	// servicesはhostごとに置き換え（位置は先の定義のまま）、新しいhostは末尾に追加
+	var hosts []string
+	for _, sd := range cfg.Services {
+		hosts = append(hosts, sd.Get().GetHost())
+	}
+	if !reflect.DeepEqual(hosts, []string{"Users-API.localhost", "users-db.localhost", "debug.localhost"}) {
+		t.Fatalf("unexpected services: %v", hosts)
+	}
+	k8sSvc, _ := cfg.Services[0].AsKubernetes()
+	if k8sSvc.Port != 9090 || k8sSvc.Protocol != "grpc" {
+		t.Errorf("expected overridden service, got %+v", k8sSvc)
+	}
+}
+
+func TestLoadFiles_DirectoryAndInclude(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	service := func(host string, port int) string {
+		return fmt.Sprintf(`  - kind: kubernetes
+    host: %s
+    namespace: default
+    service: web
+    port: %d
+    protocol: http
+`, host, port)
+	}
+
+	// ディレクトリ内のYAMLは名前順に読み込む
+	write("conf.d/20-b.yaml", "services:\n"+service("b.localhost", 8081))
+	write("conf.d/10-a.yaml", "services:\n"+service("a.localhost", 8080))
+	write("conf.d/README.md", "not a config")
+	// includeしたファイルは先に読み込まれ、includeしたファイル自身が優先される
+	main := write("services.yaml", "include:\n  - conf.d\nlistener_port: 9000\nservices:\n"+service("b.localhost", 9090))
+
+	sources, err := Sources(main)
+	if err != nil {
+		t.Fatalf("Sources failed: %v", err)
+	}
+	want := []string{
+		filepath.Join(dir, "conf.d", "10-a.yaml"),
+		filepath.Join(dir, "conf.d", "20-b.yaml"),
+		main,
+	}
+	if !reflect.DeepEqual(sources, want) {
+		t.Errorf("unexpected sources:\n got: %v\nwant: %v", sources, want)
+	}
+
+	cfg, err := LoadFiles(LoadOptions{}, main)
+	if err != nil {
+		t.Fatalf("LoadFiles failed: %v", err)
+	}
+	if cfg.ListenerPort != 9000 || len(cfg.Services) != 2 {
+		t.Fatalf("unexpected config: listener_port=%d services=%d", cfg.ListenerPort, len(cfg.Services))
+	}
+	b, _ := cfg.Services[1].AsKubernetes()
+	if b.Host != "b.localhost" || b.Port != 9090 {
+		t.Errorf("expected b.localhost from services.yaml, got %+v", b)
+	}
+
+	// 同じファイルを指定しても1回だけ読み込む
+	if sources, err := Sources(main, filepath.Join(dir, "conf.d")); err != nil || len(sources) != 3 {
+		t.Errorf("expected 3 sources, got %v (err=%v)", sources, err)
+	}
+}
+
+func TestLoadFiles_IncludeCycle(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.yaml")
+	b := filepath.Join(dir, "b.yaml")
+	if err := os.WriteFile(a, []byte("include: [b.yaml]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, []byte("include: [a.yaml]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := LoadFiles(LoadOptions{}, a)
+	if err == nil {
+		t.Fatal("expected error for include cycle, got nil")
+	}
+	if !containsString(err.Error(), "include cycle") {
+		t.Errorf("expected error containing 'include cycle', got '%s'", err.Error())
+	}
+}
+
+func TestLoadFiles_ConflictsAcrossFiles(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.yaml")
+	b := filepath.Join(dir, "b.yaml")
+	content := `services:
+  - kind: kubernetes
+    host: %s
+    namespace: default
+    service: web
+    port: 8080
+    protocol: http
+`
+	if err := os.WriteFile(a, []byte(fmt.Sprintf(content, "a.localhost")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, []byte(fmt.Sprintf(content, "b.localhost")), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 複数のファイルを読み込んだ場合はファイル名と行番号で参照する
+	_, err := LoadFiles(LoadOptions{}, a, b)
+	want := fmt.Sprintf("service entry at index 1 ('b.localhost', %s:2): cluster name 'default_web_8080' is already used by service entry at index 0 ('a.localhost', %s:2)", b, a)
+	if err == nil || !containsString(err.Error(), want) {
+		t.Errorf("expected error containing '%s', got '%v'", want, err)
+	}
+}
+
+func TestKubernetesService_WithProtocol(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol string
+		resolved string
+		want     string
+	}{
+		{name: "configured protocol wins", protocol: "http", resolved: "grpc", want: "http"},
+		{name: "resolved protocol", resolved: "grpc", want: "grpc"},
+		{name: "default http", want: "http"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := &KubernetesService{Host: "app.localhost", Protocol: tt.protocol}
+			got := k.WithProtocol(tt.resolved)
+			if got.Protocol != tt.want {
+				t.Errorf("WithProtocol(%q).Protocol = %q, want %q", tt.resolved, got.Protocol, tt.want)
+			}
+			if k.Protocol != tt.protocol {
+				t.Errorf("original protocol changed to %q", k.Protocol)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ConflictError reports service entries that cannot be used together in one
+// configuration. Conflicts lists every conflict found.
+type ConflictError struct {
+	Conflicts []Conflict
+}
+
+// Conflict is a service entry that conflicts with an earlier entry or with a
+// listener of the configuration.
+type Conflict struct {
+	Index   int    // index of the conflicting service entry
+	Message string // description including the indices and lines of the entries
+}
+
+func (e *ConflictError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d conflict(s) between service entries:", len(e.Conflicts))
+	for _, c := range e.Conflicts {
+		b.WriteString("\n  - ")
+		b.WriteString(c.Message)
+	}
+	return b.String()
+}
+
+// validateConflicts は、サービス間の衝突をすべて検出してまとめて返す
+func (cfg *Config) validateConflicts() error {
+	conflicts := cfg.conflicts()
+	if len(conflicts) == 0 {
+		return nil
+	}
+	return &ConflictError{Conflicts: conflicts}
+}
+
+// conflicts は、サービス間の衝突をすべて返す
+func (cfg *Config) conflicts() []Conflict {
+	var conflicts []Conflict
+	conflicts = append(conflicts, cfg.hostConflicts()...)
+	conflicts = append(conflicts, cfg.listenerConflicts()...)
+	conflicts = append(conflicts, cfg.clusterConflicts()...)
+	return conflicts
+}
+
+// describeEntry は、エラーメッセージで参照するサービスエントリの表記を返す
+func (cfg *Config) describeEntry(i int) string {
+	sd := &cfg.Services[i]
+	if len(cfg.files) > 1 && sd.file != "" {
+		return fmt.Sprintf("service entry at index %d ('%s', %s:%d)", i, sd.Get().GetHost(), sd.file, sd.Line())
+	}
+	if sd.Line() > 0 {
+		return fmt.Sprintf("service entry at index %d ('%s', line %d)", i, sd.Get().GetHost(), sd.Line())
+	}
+	return fmt.Sprintf("service entry at index %d ('%s')", i, sd.Get().GetHost())
+}
+
+// hostConflicts は、同じホスト名を持つサービスエントリを返す
+func (cfg *Config) hostConflicts() []Conflict {
+	var conflicts []Conflict
+	first := map[string]int{}
+	for i := range cfg.Services {
+		// kubernetes-discoveryのホスト名は起動時に決まる（重複したServiceは起動時に除外する）
+		if _, ok := cfg.Services[i].Get().(*KubernetesDiscovery); ok {
+			continue
+		}
+		// ホスト名は大文字小文字を区別しない
+		host := strings.ToLower(cfg.Services[i].Get().GetHost())
+		if j, ok := first[host]; ok {
+			conflicts = append(conflicts, Conflict{
+				Index:   i,
+				Message: fmt.Sprintf("%s: duplicate host, already used by %s", cfg.describeEntry(i), cfg.describeEntry(j)),
+			})
+			continue
+		}
+		first[host] = i
+	}
+	return conflicts
+}
+
+// clusterUse は、Envoyのクラスタを参照するサービスエントリまたはroutesの転送先
+type clusterUse struct {
+	index    int    // サービスエントリのインデックス
+	route    int    // routesのインデックス（サービスエントリ自身は-1）
+	upstream string // 上流のHTTPプロトコル（protocolを省略しServiceから推測する場合は空）
+	tcp      bool   // protocol: tcpのサービス（TCPリスナーがクラスタを使う）
+}
+
+// describeClusterUse は、エラーメッセージで参照するクラスタの利用元の表記を返す
+func (cfg *Config) describeClusterUse(u clusterUse) string {
+	if u.route < 0 {
+		return cfg.describeEntry(u.index)
+	}
+	return fmt.Sprintf("route at index %d of %s", u.route, cfg.describeEntry(u.index))
+}
+
+// clusterConflicts は、同じクラスタ名になるサービスエントリと、共有できないroutesの転送先を返す。
+// サービスエントリ同士はEnvoyのvirtual host名・TCPリスナー名も重複するため共有できない。
+// routesの転送先は同じService・ポートのクラスタ（port-forward）を共有するため、
+// TCPサービスのクラスタや、上流のHTTPプロトコルが異なるクラスタは参照できない。
+// port_nameとportが同じポートを指す場合はServiceを取得するまで分からないため、
+// 起動時にポートを解決したクラスタ名で再確認する（run.checkClusters）。
+func (cfg *Config) clusterConflicts() []Conflict {
+	var conflicts []Conflict
+	entries := map[string]int{}         // クラスタ名ごとの最初のサービスエントリ
+	first := map[string]clusterUse{}    // クラスタ名ごとの最初の利用元
+	protocol := map[string]clusterUse{} // クラスタ名ごとの上流のプロトコルが分かる最初の利用元
+	for i := range cfg.Services {
+		var name string
+		var uses []clusterUse
+		switch s := cfg.Services[i].Get().(type) {
+		case *KubernetesService:
+			name = kubernetesClusterKey(s.Namespace, s.Service, s.Port, s.PortName)
+			self := clusterUse{index: i, route: -1, tcp: s.Protocol == "tcp"}
+			if s.Protocol != "" && !self.tcp {
+				self.upstream = s.EffectiveUpstreamProtocol()
+			}
+			uses = append(uses, self)
+		case *TCPService:
+			name = s.ClusterName()
+		default:
+			continue
+		}
+
+		if j, ok := entries[name]; ok {
+			conflicts = append(conflicts, Conflict{
+				Index:   i,
+				Message: fmt.Sprintf("%s: cluster name '%s' is already used by %s", cfg.describeEntry(i), name, cfg.describeEntry(j)),
+			})
+			continue
+		}
+		entries[name] = i
+
+		k, ok := cfg.Services[i].Get().(*KubernetesService)
+		if !ok {
+			first[name] = clusterUse{index: i, route: -1, tcp: true}
+			continue
+		}
+		names := []string{name}
+		for ri, r := range k.Routes {
+			u := clusterUse{index: i, route: ri}
+			if r.UpstreamProtocol != "" || k.Protocol != "" {
+				u.upstream = k.RouteUpstreamProtocol(r)
+			}
+			uses = append(uses, u)
+			names = append(names, kubernetesClusterKey(k.RouteNamespace(r), r.Service, r.Port, r.PortName))
+		}
+
+		for ui, u := range uses {
+			name := names[ui]
+			f, ok := first[name]
+			switch {
+			case !ok:
+				first[name] = u
+			case f.tcp || u.tcp:
+				conflicts = append(conflicts, Conflict{
+					Index: i,
+					Message: fmt.Sprintf("%s: cluster '%s' is already used by %s; a TCP service cannot share its Service port with routes",
+						cfg.describeClusterUse(u), name, cfg.describeClusterUse(f)),
+				})
+				continue
+			}
+			if u.upstream == "" {
+				continue
+			}
+			if p, ok := protocol[name]; ok && p.upstream != u.upstream {
+				conflicts = append(conflicts, Conflict{
+					Index: i,
+					Message: fmt.Sprintf("%s: upstream_protocol '%s' of cluster '%s' differs from '%s' of %s",
+						cfg.describeClusterUse(u), u.upstream, name, p.upstream, cfg.describeClusterUse(p)),
+				})
+				continue
+			}
+			protocol[name] = u
+		}
+	}
+	return conflicts
+}
+
+// kubernetesClusterKey は、Service・ポートのクラスタ名を返す。
+// port_nameのみの場合はポート番号が決まらないため、同じport_nameの参照だけを同じクラスタとみなす。
+func kubernetesClusterKey(namespace, service string, port int, portName string) string {
+	if port != 0 {
+		return KubernetesClusterName(namespace, service, port)
+	}
+	return SanitizeName(fmt.Sprintf("%s_%s_%s", namespace, service, portName))
+}
+
+// SanitizeName replaces characters that cannot be used in Envoy resource
+// names with '_'.
+func SanitizeName(s string) string {
+	out := make([]rune, 0, len(s))
+	for _, r := range s {
+		if r >= 'a' && r <= 'z' ||
+			r >= 'A' && r <= 'Z' ||
+			r >= '0' && r <= '9' ||
+			r == '_' {
+			out = append(out, r)
+		} else {
+			out = append(out, '_')
+		}
+	}
+	return string(out)
+}
+
+// KubernetesClusterName returns the Envoy cluster name of a Service port.
+func KubernetesClusterName(namespace, service string, port int) string {
+	return SanitizeName(fmt.Sprintf("%s_%s_%d", namespace, service, port))
+}
+
+// ClusterName returns the Envoy cluster name of the bastion target.
+func (t *TCPService) ClusterName() string {
+	return SanitizeName(fmt.Sprintf("tcp_%s_%s_%d", t.SSHBastion, t.TargetHost, t.TargetPort))
+}
@@ -0,0 +1,202 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// DefaultHostTemplate is the host_template of kubernetes-discovery entries
+// when it is not set.
+const DefaultHostTemplate = "{{.Service}}.{{.Namespace}}.localhost"
+
+// KubernetesDiscovery はラベルセレクタに一致するKubernetes Serviceをまとめて転送するエントリ
+type KubernetesDiscovery struct {
+	Namespaces []string `yaml:"namespaces"`
+	// Selector はServiceのラベルセレクタ（kubectl -l と同じ書式、省略時はすべてのService）
+	Selector string `yaml:"selector,omitempty"`
+	// HostTemplate はServiceごとのホスト名（{{.Service}}と{{.Namespace}}を参照できる）
+	HostTemplate string `yaml:"host_template,omitempty"`
+	// PortName は転送するServiceのポート名（省略時は最初のポート、該当するポートがないServiceは対象外）
+	PortName string `yaml:"port_name,omitempty"`
+	// Protocol はhttp|grpc（省略時はポート名から推測）
+	Protocol string `yaml:"protocol,omitempty"`
+	// Watch が true の場合、起動後に作成・削除されたServiceもメッシュに反映する
+	Watch bool `yaml:"watch,omitempty"`
+	// Tags は --profile / --only / --exclude でサービスを選択するためのタグ（見つかったServiceに引き継ぐ）
+	Tags []string `yaml:"tags,omitempty"`
+}
+
+// DiscoveredService is a Service found for a kubernetes-discovery entry.
+type DiscoveredService struct {
+	Namespace string
+	Service   string
+	Port      int    // Service port (spec.ports[].port)
+	PortName  string // name of the port (spec.ports[].name)
+	Protocol  string // protocol inferred from the port, used when the entry has no protocol
+	// UpstreamProtocol is the upstream protocol inferred with Protocol for a
+	// port serving TLS (e.g. appProtocol https), and empty otherwise.
+	UpstreamProtocol string
+}
+
+// hostTemplateData はhost_templateから参照できる値
+type hostTemplateData struct {
+	Service   string
+	Namespace string
+}
+
+// GetHost はホスト名のテンプレートを返す（エラーメッセージでエントリを示すために使う）
+func (d *KubernetesDiscovery) GetHost() string   { return d.EffectiveHostTemplate() }
+func (d *KubernetesDiscovery) GetKind() string   { return "kubernetes-discovery" }
+func (d *KubernetesDiscovery) GetTags() []string { return d.Tags }
+
+// EffectiveHostTemplate returns host_template, or DefaultHostTemplate when it
+// is not set.
+func (d *KubernetesDiscovery) EffectiveHostTemplate() string {
+	if d.HostTemplate != "" {
+		return d.HostTemplate
+	}
+	return DefaultHostTemplate
+}
+
+// Host returns the host of a Service found for the entry.
+func (d *KubernetesDiscovery) Host(namespace, service string) (string, error) {
+	tmpl, err := template.New("host_template").Option("missingkey=error").Parse(d.EffectiveHostTemplate())
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, hostTemplateData{Service: service, Namespace: namespace}); err != nil {
+		return "", err
+	}
+	host := strings.TrimSpace(b.String())
+	if host == "" || strings.ContainsAny(host, " \t\n") {
+		return "", fmt.Errorf("host_template produced invalid host '%s' for %s/%s", host, namespace, service)
+	}
+	return strings.ToLower(host), nil
+}
+
+func (d *KubernetesDiscovery) Validate(cfg *Config) error {
+	if len(d.Namespaces) == 0 {
+		return fmt.Errorf("namespaces is required for kubernetes-discovery service '%s'", d.EffectiveHostTemplate())
+	}
+	for _, ns := range d.Namespaces {
+		if ns == "" {
+			return fmt.Errorf("namespaces must not contain empty values for kubernetes-discovery service '%s'", d.EffectiveHostTemplate())
+		}
+	}
+	if _, err := labels.Parse(d.Selector); err != nil {
+		return fmt.Errorf("invalid selector '%s' for kubernetes-discovery service '%s': %w", d.Selector, d.EffectiveHostTemplate(), err)
+	}
+	if _, err := d.Host("namespace", "service"); err != nil {
+		return fmt.Errorf("invalid host_template for kubernetes-discovery service '%s': %w", d.EffectiveHostTemplate(), err)
+	}
+	if d.Protocol != "" && d.Protocol != "http" && d.Protocol != "grpc" {
+		return fmt.Errorf("protocol must be 'http' or 'grpc' for kubernetes-discovery service '%s', got '%s'", d.EffectiveHostTemplate(), d.Protocol)
+	}
+	if err := validateTags(d.Tags); err != nil {
+		return fmt.Errorf("%w for kubernetes-discovery service '%s'", err, d.EffectiveHostTemplate())
+	}
+	return nil
+}
+
+// service は、見つかったServiceを転送するkubernetesのエントリを返す
+func (d *KubernetesDiscovery) service(found DiscoveredService) (*KubernetesService, error) {
+	host, err := d.Host(found.Namespace, found.Service)
+	if err != nil {
+		return nil, err
+	}
+	// protocolを指定したエントリでは、ポートから推測した上流のプロトコルも使わない
+	protocol, upstreamProtocol := d.Protocol, ""
+	if protocol == "" {
+		protocol, upstreamProtocol = found.Protocol, found.UpstreamProtocol
+	}
+	if protocol == "" {
+		protocol = "http"
+	}
+	return &KubernetesService{
+		Host:             host,
+		Namespace:        found.Namespace,
+		Service:          found.Service,
+		Port:             found.Port,
+		Protocol:         protocol,
+		UpstreamProtocol: upstreamProtocol,
+		Tags:             d.Tags,
+	}, nil
+}
+
+// HasDiscovery reports whether cfg has kubernetes-discovery entries.
+func (cfg *Config) HasDiscovery() bool {
+	for i := range cfg.Services {
+		if _, ok := cfg.Services[i].Get().(*KubernetesDiscovery); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpandDiscovery returns a copy of cfg in which each kubernetes-discovery
+// entry is replaced by kubernetes entries for the Services that discover
+// finds for it. Other entries take precedence: a found Service whose host or
+// Envoy cluster is already used is left out and described in skipped.
+func (cfg *Config) ExpandDiscovery(discover func(*KubernetesDiscovery) ([]DiscoveredService, error)) (expanded *Config, skipped []string, err error) {
+	out := *cfg
+	out.Services = nil
+
+	// 明示的なエントリのホスト名とクラスタ名（routesの転送先を含む）を優先する。
+	// port_nameで指定したポートは番号が決まらないため、Serviceとポート名で記録する。
+	hosts := map[string]bool{}
+	clusters := map[string]bool{}
+	for i := range cfg.Services {
+		switch s := cfg.Services[i].Get().(type) {
+		case *KubernetesService:
+			hosts[strings.ToLower(s.Host)] = true
+			clusters[kubernetesClusterKey(s.Namespace, s.Service, s.Port, s.PortName)] = true
+			for _, r := range s.Routes {
+				clusters[kubernetesClusterKey(s.RouteNamespace(r), r.Service, r.Port, r.PortName)] = true
+			}
+		case *TCPService:
+			hosts[strings.ToLower(s.Host)] = true
+		}
+	}
+
+	for _, sd := range cfg.Services {
+		d, ok := sd.Get().(*KubernetesDiscovery)
+		if !ok {
+			out.Services = append(out.Services, sd)
+			continue
+		}
+		found, err := discover(d)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, f := range found {
+			svc, err := d.service(f)
+			if err != nil {
+				return nil, nil, err
+			}
+			cluster := KubernetesClusterName(f.Namespace, f.Service, f.Port)
+			named := f.PortName != "" && clusters[kubernetesClusterKey(f.Namespace, f.Service, 0, f.PortName)]
+			switch {
+			case hosts[svc.Host]:
+				skipped = append(skipped, fmt.Sprintf("%s/%s: host '%s' is already used", f.Namespace, f.Service, svc.Host))
+				continue
+			case clusters[cluster] || named:
+				skipped = append(skipped, fmt.Sprintf("%s/%s: port %d is already forwarded", f.Namespace, f.Service, f.Port))
+				continue
+			}
+			hosts[svc.Host] = true
+			clusters[cluster] = true
+			if f.PortName != "" {
+				clusters[kubernetesClusterKey(f.Namespace, f.Service, 0, f.PortName)] = true
+			}
+
+			entry := sd
+			entry.service = svc
+			out.Services = append(out.Services, entry)
+		}
+	}
+	return &out, skipped, nil
+}
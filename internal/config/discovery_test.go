@@ -0,0 +1,231 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoad_KubernetesDiscovery(t *testing.T) {
+	content := `services:
+  - kind: kubernetes-discovery
+    namespaces: [" users ", billing]
+    selector: "app.kubernetes.io/part-of=shop,tier!=batch"
+    host_template: "{{.Service}}-{{.Namespace}}.localhost"
+    port_name: http
+    watch: true
+    tags: [shop]
+`
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	d, ok := cfg.Services[0].Get().(*KubernetesDiscovery)
+	if !ok {
+		t.Fatalf("expected KubernetesDiscovery, got %T", cfg.Services[0].Get())
+	}
+	want := &KubernetesDiscovery{
+		Namespaces:   []string{"users", "billing"},
+		Selector:     "app.kubernetes.io/part-of=shop,tier!=batch",
+		HostTemplate: "{{.Service}}-{{.Namespace}}.localhost",
+		PortName:     "http",
+		Watch:        true,
+		Tags:         []string{"shop"},
+	}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("unexpected entry: %+v", d)
+	}
+}
+
+func TestLoad_KubernetesDiscoveryErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		entry  string
+		errMsg string
+	}{
+		{
+			name:   "namespaces required",
+			entry:  "selector: app=web",
+			errMsg: "namespaces is required for kubernetes-discovery service '{{.Service}}.{{.Namespace}}.localhost'",
+		},
+		{
+			name:   "empty namespace",
+			entry:  "namespaces: [users, \"\"]",
+			errMsg: "namespaces must not contain empty values",
+		},
+		{
+			name:   "invalid selector",
+			entry:  "namespaces: [users]\n    selector: \"app in (web\"",
+			errMsg: "invalid selector 'app in (web'",
+		},
+		{
+			name:   "unknown template field",
+			entry:  "namespaces: [users]\n    host_template: \"{{.Name}}.localhost\"",
+			errMsg: "invalid host_template for kubernetes-discovery service '{{.Name}}.localhost'",
+		},
+		{
+			name:   "template syntax",
+			entry:  "namespaces: [users]\n    host_template: \"{{.Service.localhost\"",
+			errMsg: "invalid host_template",
+		},
+		{
+			name:   "tcp is not supported",
+			entry:  "namespaces: [users]\n    protocol: tcp",
+			errMsg: "protocol must be 'http' or 'grpc' for kubernetes-discovery service",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := "services:\n  - kind: kubernetes-discovery\n    " + tt.entry + "\n"
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := Load(configPath)
+			if err == nil {
+				t.Fatalf("expected error containing '%s', got nil", tt.errMsg)
+			}
+			if !containsString(err.Error(), tt.errMsg) {
+				t.Errorf("expected error containing '%s', got '%s'", tt.errMsg, err.Error())
+			}
+		})
+	}
+}
+
+func TestConfig_ExpandDiscovery(t *testing.T) {
+	cfg := &Config{
+		ListenerPort: 80,
+		Services: []ServiceDefinition{
+			NewServiceDefinition(&KubernetesDiscovery{
+				Namespaces: []string{"users"},
+				Tags:       []string{"users"},
+			}),
+			NewServiceDefinition(&KubernetesService{
+				Host:      "users-api.users.localhost",
+				Namespace: "users",
+				Service:   "users-api-v2",
+				Port:      8080,
+				Protocol:  "http",
+			}),
+			NewServiceDefinition(&KubernetesDiscovery{
+				Namespaces:   []string{"billing"},
+				HostTemplate: "{{.Service}}.localhost",
+				Protocol:     "grpc",
+			}),
+		},
+	}
+	found := map[string][]DiscoveredService{
+		"users": {
+			{Namespace: "users", Service: "users-api", Port: 8080, Protocol: "http"},
+			{Namespace: "users", Service: "Users-Grpc", Port: 9090, Protocol: "grpc"},
+			{Namespace: "users", Service: "users-batch", Port: 80},
+		},
+		"billing": {
+			{Namespace: "billing", Service: "invoices", Port: 8080, Protocol: "http"},
+			// 先のエントリで転送済みのポート
+			{Namespace: "users", Service: "users-batch", Port: 80},
+		},
+	}
+
+	expanded, skipped, err := cfg.ExpandDiscovery(func(d *KubernetesDiscovery) ([]DiscoveredService, error) {
+		return found[d.Namespaces[0]], nil
+	})
+	if err != nil {
+		t.Fatalf("ExpandDiscovery failed: %v", err)
+	}
+
+	var got []KubernetesService
+	for _, sd := range expanded.Services {
+		k8sSvc, ok := sd.AsKubernetes()
+		if !ok {
+			t.Fatalf("expected kubernetes entry, got %T", sd.Get())
+		}
+		got = append(got, *k8sSvc)
+	}
+	want := []KubernetesService{
+		{Host: "users-grpc.users.localhost", Namespace: "users", Service: "Users-Grpc", Port: 9090, Protocol: "grpc", Tags: []string{"users"}},
+		{Host: "users-batch.users.localhost", Namespace: "users", Service: "users-batch", Port: 80, Protocol: "http", Tags: []string{"users"}},
+		{Host: "users-api.users.localhost", Namespace: "users", Service: "users-api-v2", Port: 8080, Protocol: "http"},
+		{Host: "invoices.localhost", Namespace: "billing", Service: "invoices", Port: 8080, Protocol: "grpc"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expanded services:\n got %+v\nwant %+v", got, want)
+	}
+	wantSkipped := []string{
+		"users/users-api: host 'users-api.users.localhost' is already used",
+		"users/users-batch: port 80 is already forwarded",
+	}
+	if !reflect.DeepEqual(skipped, wantSkipped) {
+		t.Errorf("skipped = %q, want %q", skipped, wantSkipped)
+	}
+
+	// 元の設定は変更しない
+	if len(cfg.Services) != 3 {
+		t.Errorf("original config was modified: %d services", len(cfg.Services))
+	}
+}
+
+func TestConfig_ExpandDiscovery_PortNamesAndRoutes(t *testing.T) {
+	cfg := &Config{
+		ListenerPort: 80,
+		Services: []ServiceDefinition{
+			NewServiceDefinition(&KubernetesDiscovery{Namespaces: []string{"shop"}}),
+			NewServiceDefinition(&KubernetesService{
+				Host:      "web.localhost",
+				Namespace: "shop",
+				Service:   "web",
+				PortName:  "http",
+				Protocol:  "http",
+				Routes: []HTTPRoute{
+					{Prefix: "/cart", Service: "cart", Port: 9090},
+					{Prefix: "/admin", Namespace: "backoffice", Service: "admin", PortName: "http"},
+				},
+			}),
+			NewServiceDefinition(&KubernetesDiscovery{Namespaces: []string{"backoffice"}}),
+		},
+	}
+	found := map[string][]DiscoveredService{
+		"shop": {
+			// port_nameで指定したポート
+			{Namespace: "shop", Service: "web", Port: 80, PortName: "http", Protocol: "http"},
+			// routesの転送先のポート
+			{Namespace: "shop", Service: "cart", Port: 9090, PortName: "grpc", Protocol: "grpc"},
+			{Namespace: "shop", Service: "catalog", Port: 8080, PortName: "http", Protocol: "http"},
+		},
+		"backoffice": {
+			// routesのport_nameで指定したポート
+			{Namespace: "backoffice", Service: "admin", Port: 8080, PortName: "http", Protocol: "http"},
+		},
+	}
+
+	expanded, skipped, err := cfg.ExpandDiscovery(func(d *KubernetesDiscovery) ([]DiscoveredService, error) {
+		return found[d.Namespaces[0]], nil
+	})
+	if err != nil {
+		t.Fatalf("ExpandDiscovery failed: %v", err)
+	}
+
+	var hosts []string
+	for _, sd := range expanded.Services {
+		hosts = append(hosts, sd.Get().GetHost())
+	}
+	if want := []string{"catalog.shop.localhost", "web.localhost"}; !reflect.DeepEqual(hosts, want) {
+		t.Errorf("hosts = %q, want %q", hosts, want)
+	}
+	wantSkipped := []string{
+		"shop/web: port 80 is already forwarded",
+		"shop/cart: port 9090 is already forwarded",
+		"backoffice/admin: port 8080 is already forwarded",
+	}
+	if !reflect.DeepEqual(skipped, wantSkipped) {
+		t.Errorf("skipped = %q, want %q", skipped, wantSkipped)
+	}
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"regexp"
+	"strings"
+)
+
+// DNSConfig はup --dnsで起動するDNSサーバーの設定
+type DNSConfig struct {
+	// Listen はDNSサーバーがリスンするループバックアドレスとポート（デフォルト 127.0.0.1:15353）
+	Listen string `yaml:"listen,omitempty"`
+	// Upstreams は設定にない名前の問い合わせの転送先（省略時はNXDOMAINを返す）
+	Upstreams []string `yaml:"upstreams,omitempty"`
+	// ResolvedDomains はsystemd-resolvedがこのサーバーに問い合わせるドメイン（Linuxのみ、split DNS）
+	ResolvedDomains []string `yaml:"resolved_domains,omitempty"`
+}
+
+// DefaultDNSListen は、dns.listenのデフォルト
+const DefaultDNSListen = "127.0.0.1:15353"
+
+// domainPattern は、2つ以上のラベルからなるドメイン名（末尾のドットなし）。
+// "com"のようなトップレベルドメイン全体をsplit DNSで振り向けないようにする。
+var domainPattern = regexp.MustCompile(`^[a-z0-9_]([a-z0-9_-]*[a-z0-9_])?(\.[a-z0-9_]([a-z0-9_-]*[a-z0-9_])?)+$`)
+
+// IsWildcardHost reports whether host is a wildcard pattern like
+// "*.preview.localhost", which matches every name under the domain.
+func IsWildcardHost(host string) bool {
+	return strings.HasPrefix(host, "*.")
+}
+
+// validateHost は、ホスト名のワイルドカードの書式を検証する
+func validateHost(host string) error {
+	if !strings.Contains(host, "*") {
+		return nil
+	}
+	if !IsWildcardHost(host) || strings.Contains(host[2:], "*") || host[2:] == "" {
+		return fmt.Errorf("wildcard host must be '*.' followed by a domain, like '*.preview.localhost', got '%s'", host)
+	}
+	return nil
+}
+
+// setDefaults は、dnsの省略された値にデフォルト値を設定する
+func (d *DNSConfig) setDefaults() {
+	d.Listen = strings.TrimSpace(d.Listen)
+	if d.Listen == "" {
+		d.Listen = DefaultDNSListen
+	}
+	for i, u := range d.Upstreams {
+		u = strings.TrimSpace(u)
+		// ポートを省略した転送先は53番
+		if _, _, err := net.SplitHostPort(u); err != nil && net.ParseIP(u) != nil {
+			u = net.JoinHostPort(u, "53")
+		}
+		d.Upstreams[i] = u
+	}
+	for i, domain := range d.ResolvedDomains {
+		d.ResolvedDomains[i] = strings.ToLower(strings.Trim(strings.TrimSpace(domain), ".~"))
+	}
+}
+
+// validateDNS は、DNSサーバーの設定を検証する
+func (cfg *Config) validateDNS() error {
+	d := cfg.DNS
+	if d == nil {
+		return nil
+	}
+	addr, err := netip.ParseAddrPort(d.Listen)
+	if err != nil || !addr.Addr().IsLoopback() || addr.Port() == 0 {
+		return fmt.Errorf("dns.listen must be a loopback address and port like '%s', got '%s'", DefaultDNSListen, d.Listen)
+	}
+	for _, u := range d.Upstreams {
+		upstream, err := netip.ParseAddrPort(u)
+		if err != nil {
+			return fmt.Errorf("dns.upstreams must be IP addresses with an optional port, got '%s'", u)
+		}
+		if upstream == addr {
+			return fmt.Errorf("dns.upstreams must not contain dns.listen (%s)", d.Listen)
+		}
+	}
+	for _, domain := range d.ResolvedDomains {
+		if len(domain) > 253 || !domainPattern.MatchString(domain) {
+			return fmt.Errorf("dns.resolved_domains must be domain names of two or more labels like 'mesh.test', got '%s'", domain)
+		}
+	}
+	return nil
+}
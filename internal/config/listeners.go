@@ -0,0 +1,102 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// AutoLoopbackFirst and AutoLoopbackLast bound the loopback addresses assigned
+// automatically to TCP services. listen_address may not use this range.
+var (
+	AutoLoopbackFirst = netip.MustParseAddr("127.0.0.2")
+	AutoLoopbackLast  = netip.MustParseAddr("127.0.0.254")
+)
+
+// listenerAddr はローカルでリスンするアドレスとポート
+type listenerAddr struct {
+	index int    // サービスエントリのインデックス（HTTP/TLSリスナーは-1）
+	owner string // エラーメッセージで参照するリスナーの持ち主
+	// addrが無効な値の場合はホスト名ごとに自動で割り当てられるアドレス（他と重複しない）
+	addr netip.Addr
+	port int
+}
+
+// overlaps は、2つのリスナーが同時にbindできないかを返す
+func (a listenerAddr) overlaps(b listenerAddr) bool {
+	if a.port != b.port {
+		return false
+	}
+	// 0.0.0.0 / :: はすべてのアドレスと衝突する
+	if a.addr.IsUnspecified() || b.addr.IsUnspecified() {
+		return true
+	}
+	return a.addr.IsValid() && a.addr == b.addr
+}
+
+// conflict は、リスナーがotherと衝突することを表すConflictを返す
+func (a listenerAddr) conflict(other listenerAddr) Conflict {
+	return Conflict{
+		Index:   a.index,
+		Message: fmt.Sprintf("%s: port %d conflicts with %s", a.owner, a.port, other.owner),
+	}
+}
+
+// tcpListeners は、TCPサービスのリスナーを設定の順序で返す
+func (cfg *Config) tcpListeners() []listenerAddr {
+	var listeners []listenerAddr
+	for i := range cfg.Services {
+		owner := cfg.describeEntry(i)
+		switch s := cfg.Services[i].Get().(type) {
+		case *TCPService:
+			l := listenerAddr{index: i, owner: owner, port: s.EffectiveLocalPort()}
+			if s.ListenAddress != "" {
+				l.addr, _ = netip.ParseAddr(s.ListenAddress)
+			}
+			listeners = append(listeners, l)
+		case *KubernetesService:
+			if s.Protocol == "tcp" {
+				listeners = append(listeners, listenerAddr{index: i, owner: owner, port: s.ListenPort})
+			}
+		}
+	}
+	return listeners
+}
+
+// listenerConflicts は、TCPサービスのリスナーがHTTP/TLSリスナーや他のTCPサービスと衝突する箇所を返す
+func (cfg *Config) listenerConflicts() []Conflict {
+	// HTTP/TLSリスナーは全インターフェースでリスンする
+	reserved := []listenerAddr{
+		{index: -1, owner: "listener_port", addr: netip.IPv4Unspecified(), port: cfg.ListenerPort},
+	}
+	if cfg.TLS != nil {
+		reserved = append(reserved, listenerAddr{index: -1, owner: "tls.listener_port", addr: netip.IPv4Unspecified(), port: cfg.TLS.ListenerPort})
+	}
+
+	var conflicts []Conflict
+	listeners := cfg.tcpListeners()
+	for i, l := range listeners {
+		for _, r := range reserved {
+			if l.overlaps(r) {
+				conflicts = append(conflicts, l.conflict(r))
+			}
+		}
+		for _, other := range listeners[:i] {
+			if l.overlaps(other) {
+				conflicts = append(conflicts, l.conflict(other))
+			}
+		}
+	}
+	return conflicts
+}
+
+// validateListenAddress は、listen_addressを検証する
+func validateListenAddress(address string) error {
+	addr, err := netip.ParseAddr(address)
+	if err != nil {
+		return fmt.Errorf("listen_address must be an IP address, got '%s'", address)
+	}
+	if addr.Compare(AutoLoopbackFirst) >= 0 && addr.Compare(AutoLoopbackLast) <= 0 {
+		return fmt.Errorf("listen_address %s is reserved for automatic assignment (%s-%s)", address, AutoLoopbackFirst, AutoLoopbackLast)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// validateRewrites は、リクエストの書き換えとヘッダー操作の設定を検証する
+func (k *KubernetesService) validateRewrites() error {
+	if strings.ContainsAny(k.HostRewrite, " /") {
+		return fmt.Errorf("host_rewrite must be a host name, got '%s'", k.HostRewrite)
+	}
+	if k.PrefixRewrite != "" && !strings.HasPrefix(k.PrefixRewrite, "/") {
+		return fmt.Errorf("prefix_rewrite must start with '/', got '%s'", k.PrefixRewrite)
+	}
+
+	for _, h := range k.RequestHeadersToAdd {
+		if err := validateHeaderName("request_headers_to_add", h.Name); err != nil {
+			return err
+		}
+	}
+	for _, name := range k.RequestHeadersToRemove {
+		if err := validateHeaderName("request_headers_to_remove", name); err != nil {
+			return err
+		}
+	}
+	for _, h := range k.ResponseHeadersToAdd {
+		if err := validateHeaderName("response_headers_to_add", h.Name); err != nil {
+			return err
+		}
+	}
+	for _, name := range k.ResponseHeadersToRemove {
+		if err := validateHeaderName("response_headers_to_remove", name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateHeaderName は、操作対象のヘッダー名を検証する。
+// Envoyは疑似ヘッダーとHostの書き換えをヘッダー操作では受け付けない（Hostはhost_rewriteを使う）。
+func validateHeaderName(field, name string) error {
+	if name == "" {
+		return fmt.Errorf("header name is required in %s", field)
+	}
+	if strings.HasPrefix(name, ":") || strings.EqualFold(name, "host") {
+		return fmt.Errorf("header '%s' cannot be modified in %s", name, field)
+	}
+	if strings.ContainsAny(name, " \t:") {
+		return fmt.Errorf("invalid header name '%s' in %s", name, field)
+	}
+	return nil
+}
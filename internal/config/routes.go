@@ -0,0 +1,140 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// HTTPRoute はホスト内のパス・ヘッダーによる振り分け先。
+// routesは記述順に評価され、いずれにも一致しないリクエストはサービス自身へ転送される。
+type HTTPRoute struct {
+	// パスの条件（いずれか1つ。省略した場合はheadersのみで判定する）
+	Prefix string `yaml:"prefix,omitempty"`
+	Path   string `yaml:"path,omitempty"`  // 完全一致
+	Regex  string `yaml:"regex,omitempty"` // パス全体に一致するRE2の正規表現
+
+	Headers []HeaderMatch `yaml:"headers,omitempty"` // すべてに一致する必要がある
+
+	// 転送先のService（namespaceとupstream_protocolは省略時にサービスの値を引き継ぐ）
+	Namespace        string `yaml:"namespace,omitempty"`
+	Service          string `yaml:"service"`
+	PortName         string `yaml:"port_name,omitempty"`
+	Port             int    `yaml:"port,omitempty"`
+	UpstreamProtocol string `yaml:"upstream_protocol,omitempty"`
+}
+
+// HeaderMatch はリクエストヘッダーの条件。exact/prefix/regexを省略した場合はヘッダーの存在で判定する。
+type HeaderMatch struct {
+	Name   string `yaml:"name"`
+	Exact  string `yaml:"exact,omitempty"`
+	Prefix string `yaml:"prefix,omitempty"`
+	Regex  string `yaml:"regex,omitempty"`
+}
+
+// RouteNamespace returns the namespace of the route target, defaulting to the
+// namespace of the service.
+func (k *KubernetesService) RouteNamespace(r HTTPRoute) string {
+	if r.Namespace != "" {
+		return r.Namespace
+	}
+	return k.Namespace
+}
+
+// RouteUpstreamProtocol returns the upstream protocol of the route target,
+// defaulting to the effective upstream protocol of the service.
+func (k *KubernetesService) RouteUpstreamProtocol(r HTTPRoute) string {
+	if r.UpstreamProtocol != "" {
+		return r.UpstreamProtocol
+	}
+	return k.EffectiveUpstreamProtocol()
+}
+
+// validateRoutes は、routesの条件と転送先を検証する
+func (k *KubernetesService) validateRoutes() error {
+	for i, r := range k.Routes {
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("invalid route at index %d for kubernetes service '%s': %w", i, k.Host, err)
+		}
+	}
+	return nil
+}
+
+func (r *HTTPRoute) validate() error {
+	var pathMatches int
+	for _, m := range []string{r.Prefix, r.Path, r.Regex} {
+		if m != "" {
+			pathMatches++
+		}
+	}
+	if pathMatches > 1 {
+		return fmt.Errorf("only one of prefix, path or regex can be set")
+	}
+	if pathMatches == 0 && len(r.Headers) == 0 {
+		return fmt.Errorf("prefix, path, regex or headers is required")
+	}
+	if r.Prefix != "" && !strings.HasPrefix(r.Prefix, "/") {
+		return fmt.Errorf("prefix must start with '/', got '%s'", r.Prefix)
+	}
+	if r.Path != "" && !strings.HasPrefix(r.Path, "/") {
+		return fmt.Errorf("path must start with '/', got '%s'", r.Path)
+	}
+	if r.Regex != "" {
+		if _, err := regexp.Compile(r.Regex); err != nil {
+			return fmt.Errorf("invalid regex '%s': %w", r.Regex, err)
+		}
+	}
+
+	for _, h := range r.Headers {
+		if err := h.validate(); err != nil {
+			return err
+		}
+	}
+
+	if r.Service == "" {
+		return fmt.Errorf("service is required")
+	}
+	if r.UpstreamProtocol != "" && !slices.Contains(UpstreamProtocols, r.UpstreamProtocol) {
+		return fmt.Errorf("upstream_protocol must be one of %s, got '%s'",
+			strings.Join(UpstreamProtocols, ", "), r.UpstreamProtocol)
+	}
+	return nil
+}
+
+func (h *HeaderMatch) validate() error {
+	if h.Name == "" {
+		return fmt.Errorf("header name is required")
+	}
+	var matches int
+	for _, m := range []string{h.Exact, h.Prefix, h.Regex} {
+		if m != "" {
+			matches++
+		}
+	}
+	if matches > 1 {
+		return fmt.Errorf("only one of exact, prefix or regex can be set for header '%s'", h.Name)
+	}
+	if h.Regex != "" {
+		if _, err := regexp.Compile(h.Regex); err != nil {
+			return fmt.Errorf("invalid regex '%s' for header '%s': %w", h.Regex, h.Name, err)
+		}
+	}
+	return nil
+}
+
+// trimRoutes は、routesの文字列フィールドをトリム（正規表現と値は空白も意味を持つため対象外）
+func trimRoutes(routes []HTTPRoute) {
+	for i := range routes {
+		r := &routes[i]
+		r.Prefix = strings.TrimSpace(r.Prefix)
+		r.Path = strings.TrimSpace(r.Path)
+		r.Namespace = strings.TrimSpace(r.Namespace)
+		r.Service = strings.TrimSpace(r.Service)
+		r.PortName = strings.TrimSpace(r.PortName)
+		r.UpstreamProtocol = strings.TrimSpace(r.UpstreamProtocol)
+		for j := range r.Headers {
+			r.Headers[j].Name = strings.TrimSpace(r.Headers[j].Name)
+		}
+	}
+}
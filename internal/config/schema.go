@@ -0,0 +1,100 @@
+package config
+
+import (
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// schemaEnums はフィールドごとに指定できる値（キーは "型名.フィールド名"）
+var schemaEnums = map[string][]string{
+	"KubernetesService.Protocol":         {"http", "grpc", "tcp"},
+	"KubernetesService.UpstreamProtocol": UpstreamProtocols,
+	"KubernetesDiscovery.Protocol":       {"http", "grpc"},
+	"HTTPRoute.UpstreamProtocol":         UpstreamProtocols,
+}
+
+// schemaRequired は型ごとの必須フィールド
+var schemaRequired = map[reflect.Type][]string{
+	reflect.TypeFor[Config]():              {"services"},
+	reflect.TypeFor[SSHBastion]():          {"instance", "zone"},
+	reflect.TypeFor[KubernetesService]():   {"host", "namespace", "service"},
+	reflect.TypeFor[TCPService]():          {"host", "ssh_bastion", "target_host", "target_port"},
+	reflect.TypeFor[KubernetesDiscovery](): {"namespaces"},
+	reflect.TypeFor[HTTPRoute]():           {"service"},
+	reflect.TypeFor[HeaderMatch]():         {"name"},
+	reflect.TypeFor[HeaderValue]():         {"name", "value"},
+}
+
+// Schema returns a JSON Schema (draft 2020-12) for services.yaml. It is
+// generated from the configuration types, so it accepts the same fields as
+// Validate.
+func Schema() map[string]any {
+	s := typeSchema(reflect.TypeFor[Config]())
+	s["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	s["title"] = "kubectl-localmesh services.yaml"
+	return s
+}
+
+// typeSchema は、Goの型に対応するスキーマを返す
+func typeSchema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == serviceDefinitionType:
+		// kindで判別するタグ付きユニオン
+		var variants []any
+		for _, kind := range slices.Sorted(maps.Keys(serviceKinds)) {
+			s := structSchema(serviceKinds[kind])
+			s["properties"].(map[string]any)["kind"] = map[string]any{"const": kind}
+			s["required"] = append([]any{"kind"}, s["required"].([]any)...)
+			variants = append(variants, s)
+		}
+		return map[string]any{"oneOf": variants}
+	case t.Kind() == reflect.Struct:
+		return structSchema(t)
+	case t.Kind() == reflect.Slice:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem())}
+	case t.Kind() == reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case t.Kind() == reflect.Int:
+		return map[string]any{"type": "integer"}
+	case t.Kind() == reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	default:
+		return map[string]any{"type": "string"}
+	}
+}
+
+// structSchema は、構造体に対応するオブジェクトのスキーマを返す（未知のフィールドは許可しない）
+func structSchema(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	for _, f := range yamlFields(t) {
+		s := typeSchema(f.typ)
+		if values, ok := schemaEnums[t.Name()+"."+f.field.Name]; ok {
+			s["enum"] = toAnySlice(values)
+		}
+		if f.typ.Kind() == reflect.Int && strings.HasSuffix(f.name, "port") {
+			s["minimum"] = 1
+			s["maximum"] = 65535
+		}
+		properties[f.name] = s
+	}
+	return map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             toAnySlice(schemaRequired[t]),
+		"additionalProperties": false,
+	}
+}
+
+func toAnySlice(values []string) []any {
+	out := make([]any, len(values))
+	for i, v := range values {
+		out[i] = v
+	}
+	return out
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Profile is a named set of services started with up --profile. A service
+// is part of the profile when its host is listed in Hosts or it has one of
+// Tags.
+type Profile struct {
+	Hosts []string `yaml:"hosts,omitempty"`
+	Tags  []string `yaml:"tags,omitempty"`
+}
+
+// Selection selects the services to start. Values of Only and Exclude are
+// hosts or tags. The zero value selects all services.
+type Selection struct {
+	Profile string   // services of profiles[Profile]
+	Only    []string // keep only services matching any of these
+	Exclude []string // drop services matching any of these
+}
+
+// IsZero reports whether the selection selects all services.
+func (s Selection) IsZero() bool {
+	return s.Profile == "" && len(s.Only) == 0 && len(s.Exclude) == 0
+}
+
+// validateTags は、タグが空でなく --only / --exclude で指定できる文字列であるかを検証する
+func validateTags(tags []string) error {
+	for _, tag := range tags {
+		if tag == "" || strings.ContainsAny(tag, ", \t") {
+			return fmt.Errorf("invalid tag '%s': tags must be non-empty and must not contain commas or whitespace", tag)
+		}
+	}
+	return nil
+}
+
+// matches は、サービスがhostまたはタグのいずれかに一致するかを返す（hostは大文字小文字を区別しない）
+func matches(svc Service, hosts, tags []string) bool {
+	for _, h := range hosts {
+		if strings.EqualFold(h, svc.GetHost()) {
+			return true
+		}
+	}
+	for _, tag := range tags {
+		if slices.Contains(svc.GetTags(), tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// known は、valueが設定内のいずれかのサービスのhostまたはタグであるかを返す
+func (cfg *Config) known(value string) bool {
+	for i := range cfg.Services {
+		if matches(cfg.Services[i].Get(), []string{value}, []string{value}) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateProfiles は、プロファイルが存在するhostとタグのみを参照しているかを検証する
+func (cfg *Config) validateProfiles() error {
+	for _, name := range slices.Sorted(maps.Keys(cfg.Profiles)) {
+		p := cfg.Profiles[name]
+		if p == nil || (len(p.Hosts) == 0 && len(p.Tags) == 0) {
+			return fmt.Errorf("profile '%s' must have hosts or tags", name)
+		}
+		trimStrings(p.Hosts)
+		trimStrings(p.Tags)
+		for _, h := range p.Hosts {
+			if !slices.ContainsFunc(cfg.Services, func(sd ServiceDefinition) bool { return strings.EqualFold(sd.Get().GetHost(), h) }) {
+				return fmt.Errorf("host '%s' of profile '%s' not found in services", h, name)
+			}
+		}
+		for _, tag := range p.Tags {
+			if !slices.ContainsFunc(cfg.Services, func(sd ServiceDefinition) bool { return slices.Contains(sd.Get().GetTags(), tag) }) {
+				return fmt.Errorf("tag '%s' of profile '%s' is not used by any service", tag, name)
+			}
+		}
+	}
+	return nil
+}
+
+// selectServices は、選択されたサービスだけを残す
+func (cfg *Config) selectServices(sel Selection) error {
+	if sel.IsZero() {
+		return nil
+	}
+
+	var profile *Profile
+	if sel.Profile != "" {
+		profile = cfg.Profiles[sel.Profile]
+		if profile == nil {
+			names := slices.Sorted(maps.Keys(cfg.Profiles))
+			return fmt.Errorf("profile '%s' not found (available: %s)", sel.Profile, strings.Join(names, ", "))
+		}
+	}
+	// 打ち間違いで意図せず全サービスが選択・除外されないよう、未知の値はエラーにする
+	for _, v := range slices.Concat(sel.Only, sel.Exclude) {
+		if !cfg.known(v) {
+			return fmt.Errorf("'%s' is neither a host nor a tag of any service", v)
+		}
+	}
+
+	var selected []ServiceDefinition
+	for _, sd := range cfg.Services {
+		svc := sd.Get()
+		if profile != nil && !matches(svc, profile.Hosts, profile.Tags) {
+			continue
+		}
+		if len(sel.Only) > 0 && !matches(svc, sel.Only, sel.Only) {
+			continue
+		}
+		if matches(svc, sel.Exclude, sel.Exclude) {
+			continue
+		}
+		selected = append(selected, sd)
+	}
+	if len(selected) == 0 {
+		return fmt.Errorf("no services selected")
+	}
+	cfg.Services = selected
+	return nil
+}
@@ -0,0 +1,193 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const selectionConfig = `profiles:
+  backend:
+    tags: [backend]
+  users:
+    hosts: [users-api.localhost]
+    tags: [database]
+ssh_bastions:
+  primary:
+    instance: bastion
+    zone: asia-northeast1-a
+services:
+  - kind: kubernetes
+    host: users-api.localhost
+    namespace: users
+    service: users-api
+    port: 8080
+    protocol: http
+    tags: [backend]
+  - kind: kubernetes
+    host: billing-api.localhost
+    namespace: billing
+    service: billing-api
+    port: 8080
+    protocol: grpc
+    tags: [backend, billing]
+  - kind: kubernetes
+    host: web.localhost
+    namespace: web
+    service: web
+    port: 80
+    protocol: http
+    tags: [frontend]
+  - kind: tcp
+    host: users-db.localhost
+    ssh_bastion: primary
+    target_host: users-db.internal
+    target_port: 5432
+    tags: [database]
+`
+
+func TestLoadFiles_Selection(t *testing.T) {
+	tests := []struct {
+		name      string
+		selection Selection
+		want      []string
+		errMsg    string
+	}{
+		{
+			name: "no selection",
+			want: []string{"users-api.localhost", "billing-api.localhost", "web.localhost", "users-db.localhost"},
+		},
+		{
+			name:      "profile by tags",
+			selection: Selection{Profile: "backend"},
+			want:      []string{"users-api.localhost", "billing-api.localhost"},
+		},
+		{
+			name:      "profile by hosts and tags",
+			selection: Selection{Profile: "users"},
+			want:      []string{"users-api.localhost", "users-db.localhost"},
+		},
+		{
+			name:      "only hosts and tags",
+			selection: Selection{Only: []string{"WEB.localhost", "database"}},
+			want:      []string{"web.localhost", "users-db.localhost"},
+		},
+		{
+			name:      "exclude",
+			selection: Selection{Exclude: []string{"billing", "users-db.localhost"}},
+			want:      []string{"users-api.localhost", "web.localhost"},
+		},
+		{
+			name:      "profile with only and exclude",
+			selection: Selection{Profile: "backend", Only: []string{"backend"}, Exclude: []string{"billing"}},
+			want:      []string{"users-api.localhost"},
+		},
+		{
+			name:      "unknown profile",
+			selection: Selection{Profile: "frontend"},
+			errMsg:    "profile 'frontend' not found (available: backend, users)",
+		},
+		{
+			name:      "unknown only value",
+			selection: Selection{Only: []string{"databse"}},
+			errMsg:    "'databse' is neither a host nor a tag of any service",
+		},
+		{
+			name:      "unknown exclude value",
+			selection: Selection{Exclude: []string{"api.localhost"}},
+			errMsg:    "'api.localhost' is neither a host nor a tag of any service",
+		},
+		{
+			name:      "nothing selected",
+			selection: Selection{Profile: "backend", Exclude: []string{"backend"}},
+			errMsg:    "no services selected",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(selectionConfig), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := LoadFiles(LoadOptions{Selection: tt.selection}, configPath)
+			if tt.errMsg != "" {
+				if err == nil {
+					t.Fatalf("expected error containing '%s', got nil", tt.errMsg)
+				}
+				if !containsString(err.Error(), tt.errMsg) {
+					t.Errorf("expected error containing '%s', got '%s'", tt.errMsg, err.Error())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadFiles failed: %v", err)
+			}
+			var got []string
+			for _, sd := range cfg.Services {
+				got = append(got, sd.Get().GetHost())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selected services = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad_ProfilesAndTagsErrors(t *testing.T) {
+	service := `services:
+  - kind: kubernetes
+    host: app.localhost
+    namespace: default
+    service: app
+    port: 8080
+    protocol: http
+    tags: [backend]
+`
+	tests := []struct {
+		name    string
+		content string
+		errMsg  string
+	}{
+		{
+			name:    "empty profile",
+			content: "profiles:\n  empty: {}\n" + service,
+			errMsg:  "profile 'empty' must have hosts or tags",
+		},
+		{
+			name:    "unknown host in profile",
+			content: "profiles:\n  p:\n    hosts: [api.localhost]\n" + service,
+			errMsg:  "host 'api.localhost' of profile 'p' not found in services",
+		},
+		{
+			name:    "unused tag in profile",
+			content: "profiles:\n  p:\n    tags: [frontend]\n" + service,
+			errMsg:  "tag 'frontend' of profile 'p' is not used by any service",
+		},
+		{
+			name:    "tag with whitespace",
+			content: strings.Replace(service, "[backend]", "[backend, \"front end\"]", 1),
+			errMsg:  "invalid tag 'front end'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := Load(configPath)
+			if err == nil {
+				t.Fatalf("expected error containing '%s', got nil", tt.errMsg)
+			}
+			if !containsString(err.Error(), tt.errMsg) {
+				t.Errorf("expected error containing '%s', got '%s'", tt.errMsg, err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// source は読み込む設定ファイル1つ分
+type source struct {
+	path string
+	data []byte
+	doc  *yaml.Node // parseの結果
+}
+
+// parse は、ファイルの内容をYAMLのノードとして解析する
+func (s *source) parse() error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(s.data, &doc); err != nil {
+		return err
+	}
+	s.doc = &doc
+	return nil
+}
+
+// decode は、解析したノードをoutにデコードする（空のファイルの場合は何もしない）
+func (s *source) decode(out any) error {
+	if len(s.doc.Content) == 0 {
+		return nil
+	}
+	return s.doc.Decode(out)
+}
+
+// Sources returns the files read for paths, in merge order: each path is a
+// file or a directory (its *.yaml and *.yml files in name order), and files
+// listed in 'include:' come before the file that includes them. A file is
+// read only once, at its first position.
+func Sources(paths ...string) ([]string, error) {
+	sources, err := readSources(paths)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, len(sources))
+	for i, src := range sources {
+		files[i] = src.path
+	}
+	return files, nil
+}
+
+// readSources は、pathsとincludeを展開して設定ファイルをマージする順に読み込む
+func readSources(paths []string) ([]source, error) {
+	r := &sourceReader{seen: map[string]bool{}}
+	for _, p := range paths {
+		if err := r.readPath(p); err != nil {
+			return nil, err
+		}
+	}
+	return r.sources, nil
+}
+
+type sourceReader struct {
+	sources []source
+	seen    map[string]bool
+	stack   []string // include中のファイル（循環の検出用）
+}
+
+// readPath は、ファイルまたはディレクトリを読み込む
+func (r *sourceReader) readPath(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return r.readFile(path)
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		if err := r.readFile(filepath.Join(path, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readFile は、includeされたファイルを先に読み込んでから、ファイル自身を読み込む
+func (r *sourceReader) readFile(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(r.stack, abs) {
+		return fmt.Errorf("include cycle: %s -> %s", strings.Join(r.stack, " -> "), abs)
+	}
+	if r.seen[abs] {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// YAMLとして不正な場合はincludeをたどらず、読み込み時にエラーを報告する
+	var head struct {
+		Include []string `yaml:"include"`
+	}
+	_ = yaml.Unmarshal(data, &head)
+
+	r.stack = append(r.stack, abs)
+	for _, inc := range head.Include {
+		inc = strings.TrimSpace(inc)
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(filepath.Dir(path), inc)
+		}
+		if err := r.readPath(inc); err != nil {
+			return fmt.Errorf("include in %s: %w", path, err)
+		}
+	}
+	r.stack = r.stack[:len(r.stack)-1]
+
+	r.seen[abs] = true
+	r.sources = append(r.sources, source{path: path, data: data})
+	return nil
+}
+
+// merge は、後から読み込んだ設定ファイルotherをcfgに重ねる。
+// ssh_bastionsとprofilesは名前ごと、servicesはhostごとに置き換え（位置は先の定義のまま）、
+// それ以外の値は指定されたものだけを上書きする。
+// 同じファイル内のhostの重複は置き換えずに衝突として報告する。
+func (cfg *Config) merge(other *Config) {
+	if other.Name != "" {
+		cfg.Name = other.Name
+	}
+	if other.KubeContext != "" {
+		cfg.KubeContext = other.KubeContext
+	}
+	if other.DNS != nil {
+		if cfg.DNS == nil {
+			cfg.DNS = &DNSConfig{}
+		}
+		if other.DNS.Listen != "" {
+			cfg.DNS.Listen = other.DNS.Listen
+		}
+		if other.DNS.Upstreams != nil {
+			cfg.DNS.Upstreams = other.DNS.Upstreams
+		}
+		if other.DNS.ResolvedDomains != nil {
+			cfg.DNS.ResolvedDomains = other.DNS.ResolvedDomains
+		}
+	}
+	if other.Cluster != nil {
+		if cfg.Cluster == nil {
+			cfg.Cluster = &ClusterGuard{}
+		}
+		if other.Cluster.Context != "" {
+			cfg.Cluster.Context = other.Cluster.Context
+		}
+		if other.Cluster.Server != "" {
+			cfg.Cluster.Server = other.Cluster.Server
+		}
+		if other.Cluster.Namespace != "" {
+			cfg.Cluster.Namespace = other.Cluster.Namespace
+		}
+		if other.Cluster.NamespaceUID != "" {
+			cfg.Cluster.NamespaceUID = other.Cluster.NamespaceUID
+		}
+		if other.Cluster.CAFingerprint != "" {
+			cfg.Cluster.CAFingerprint = other.Cluster.CAFingerprint
+		}
+	}
+	if other.ListenerPort != 0 {
+		cfg.ListenerPort = other.ListenerPort
+	}
+	if other.TLS != nil {
+		if cfg.TLS == nil {
+			cfg.TLS = &TLSConfig{}
+		}
+		if other.TLS.ListenerPort != 0 {
+			cfg.TLS.ListenerPort = other.TLS.ListenerPort
+		}
+		if other.TLS.CADir != "" {
+			cfg.TLS.CADir = other.TLS.CADir
+		}
+	}
+	for name, b := range other.SSHBastions {
+		if cfg.SSHBastions == nil {
+			cfg.SSHBastions = map[string]*SSHBastion{}
+		}
+		cfg.SSHBastions[name] = b
+	}
+	for name, p := range other.Profiles {
+		if cfg.Profiles == nil {
+			cfg.Profiles = map[string]*Profile{}
+		}
+		cfg.Profiles[name] = p
+	}
+
+	merged := len(cfg.Services)
+	for _, sd := range other.Services {
+		if i := slices.IndexFunc(cfg.Services[:merged], func(prev ServiceDefinition) bool {
+			return sameHost(prev, sd)
+		}); i >= 0 {
+			cfg.Services[i] = sd
+			continue
+		}
+		cfg.Services = append(cfg.Services, sd)
+	}
+}
+
+// sameHost は、2つのサービスエントリのホスト名が同じかを返す（大文字小文字を区別しない）。
+// kubernetes-discoveryのエントリは置き換えずに追加する。
+func sameHost(a, b ServiceDefinition) bool {
+	if a.Get() == nil || b.Get() == nil {
+		return false
+	}
+	_, aDiscovery := a.Get().(*KubernetesDiscovery)
+	_, bDiscovery := b.Get().(*KubernetesDiscovery)
+	if aDiscovery || bDiscovery {
+		return false
+	}
+	return strings.EqualFold(strings.TrimSpace(a.Get().GetHost()), strings.TrimSpace(b.Get().GetHost()))
+}
+
+// setFile は、サービスエントリの読み込み元のファイルを記録する
+func (cfg *Config) setFile(path string) {
+	for i := range cfg.Services {
+		cfg.Services[i].file = path
+	}
+}
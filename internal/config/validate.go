@@ -0,0 +1,477 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Problem is a problem found in services.yaml and its position. File is
+// empty and Line and Column are 0 when the position is unknown.
+type Problem struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (p Problem) String() string {
+	var pos string
+	switch {
+	case p.Line == 0:
+	case p.Column == 0:
+		pos = fmt.Sprintf("%d: ", p.Line)
+	default:
+		pos = fmt.Sprintf("%d:%d: ", p.Line, p.Column)
+	}
+	if p.File != "" {
+		return fmt.Sprintf("%s:%s%s", p.File, pos, p.Message)
+	}
+	return pos + p.Message
+}
+
+// Validate checks the configuration files merged as LoadFiles does and
+// returns every problem found. Unlike LoadFiles, it also rejects fields that
+// are unknown for the kind of each entry. The returned error is non-nil only
+// when the files cannot be read.
+func Validate(opts LoadOptions, paths ...string) ([]Problem, error) {
+	sources, err := readSources(paths)
+	if err != nil {
+		return nil, err
+	}
+	return validateSources(sources, opts), nil
+}
+
+// serviceKinds はkindごとのサービスの型
+var serviceKinds = map[string]reflect.Type{
+	"kubernetes":           reflect.TypeFor[KubernetesService](),
+	"tcp":                  reflect.TypeFor[TCPService](),
+	"kubernetes-discovery": reflect.TypeFor[KubernetesDiscovery](),
+}
+
+// fieldOwners は、未知のフィールドのエラーメッセージで使う各型の呼び方
+var fieldOwners = map[reflect.Type]string{
+	reflect.TypeFor[Config]():              "the configuration",
+	reflect.TypeFor[ClusterGuard]():        "cluster",
+	reflect.TypeFor[DNSConfig]():           "dns",
+	reflect.TypeFor[TLSConfig]():           "tls",
+	reflect.TypeFor[SSHBastion]():          "ssh_bastions entries",
+	reflect.TypeFor[Profile]():             "profiles entries",
+	reflect.TypeFor[KubernetesService]():   "kind 'kubernetes'",
+	reflect.TypeFor[TCPService]():          "kind 'tcp'",
+	reflect.TypeFor[KubernetesDiscovery](): "kind 'kubernetes-discovery'",
+	reflect.TypeFor[HTTPRoute]():           "routes",
+	reflect.TypeFor[HeaderMatch]():         "header matches",
+	reflect.TypeFor[HeaderValue]():         "headers to add",
+}
+
+var serviceDefinitionType = reflect.TypeFor[ServiceDefinition]()
+
+// validator はYAMLの位置付きで問題を収集する
+type validator struct {
+	file     string         // 検証中のファイル
+	order    map[string]int // ファイルの読み込み順（問題の並び替え用）
+	problems []Problem
+}
+
+func (v *validator) add(node *yaml.Node, format string, args ...any) {
+	v.addAt(v.file, node.Line, node.Column, format, args...)
+}
+
+func (v *validator) addAt(file string, line, column int, format string, args ...any) {
+	v.problems = append(v.problems, Problem{File: file, Line: line, Column: column, Message: fmt.Sprintf(format, args...)})
+}
+
+// validateSources は、設定ファイルをマージした結果のすべての問題を返す
+func validateSources(sources []source, opts LoadOptions) []Problem {
+	v := &validator{order: map[string]int{}}
+
+	// 1. ファイルごとの構文
+	decoded := true
+	var parsed []source
+	for _, src := range sources {
+		v.file = src.path
+		v.order[src.path] = len(v.order)
+		if err := src.parse(); err != nil {
+			v.addDecodeError(err, &yaml.Node{}, &yaml.Node{})
+			decoded = false
+			continue
+		}
+		parsed = append(parsed, src)
+	}
+
+	// 2. 変数の展開
+	exp, errs := newExpander(parsed, opts.Set)
+	for _, src := range parsed {
+		errs = append(errs, exp.expandNode(src)...)
+	}
+	for _, e := range errs {
+		v.addAt(e.file, e.node.Line, e.node.Column, "%s", e.err)
+		decoded = false
+	}
+
+	// 3. ファイルごとの未知のフィールド・型の誤り
+	var cfg Config
+	var nameFile, tlsFile, clusterFile, dnsFile string
+	var nameNode, tlsNode, clusterNode, dnsNode *yaml.Node
+	for _, src := range parsed {
+		v.file = src.path
+		c, root, ok := v.parseFile(src.doc)
+		if !ok {
+			decoded = false
+		}
+		if c == nil {
+			continue
+		}
+		if c.Name != "" {
+			nameFile, nameNode = src.path, mappingValueOr(root, "name")
+		}
+		if c.TLS != nil {
+			tlsFile, tlsNode = src.path, mappingValueOr(root, "tls")
+		}
+		if c.Cluster != nil {
+			clusterFile, clusterNode = src.path, mappingValueOr(root, "cluster")
+		}
+		if c.DNS != nil {
+			dnsFile, dnsNode = src.path, mappingValueOr(root, "dns")
+		}
+		c.setFile(src.path)
+		cfg.merge(c)
+		cfg.files = append(cfg.files, src.path)
+	}
+	v.file = ""
+	cfg.Vars = exp.vars
+
+	// 4. マージした設定の値の検証
+	cfg.setDefaults()
+	if err := cfg.validateName(); err != nil {
+		v.addAt(nameFile, nameNode.Line, nameNode.Column, "%s", err)
+	}
+	if err := cfg.validateTLS(); err != nil {
+		v.addAt(tlsFile, tlsNode.Line, tlsNode.Column, "%s", err)
+	}
+	if err := cfg.validateCluster(); err != nil {
+		v.addAt(clusterFile, clusterNode.Line, clusterNode.Column, "%s", err)
+	}
+	if err := cfg.validateDNS(); err != nil {
+		v.addAt(dnsFile, dnsNode.Line, dnsNode.Column, "%s", err)
+	}
+	if len(cfg.Services) == 0 {
+		if decoded {
+			v.addAt("", 0, 0, "no services configured")
+		}
+		return v.sorted()
+	}
+	for i := range cfg.Services {
+		sd := &cfg.Services[i]
+		if sd.Get() == nil {
+			continue
+		}
+		if err := cfg.validateEntry(i); err != nil {
+			v.addAt(sd.file, sd.line, sd.column, "%s", err)
+		}
+	}
+
+	// 5. サービス間の衝突とプロファイルの参照（すべてのエントリを読み込めた場合のみ）
+	if decoded {
+		for _, c := range cfg.conflicts() {
+			sd := &cfg.Services[c.Index]
+			v.addAt(sd.file, sd.line, sd.column, "%s", c.Message)
+		}
+		if err := cfg.validateProfiles(); err != nil {
+			v.addAt("", 0, 0, "%s", err)
+		}
+	}
+	return v.sorted()
+}
+
+// parseFile は、設定ファイル1つを検証しながらデコードする。
+// サービスエントリはエントリごとにデコードして、すべてのエントリの問題を報告する
+// （デコードできなかったエントリはサービスがnilになる）。
+// すべてを読み込めた場合のみokを返し、ファイル全体を読み込めなかった場合はcfgがnilになる。
+func (v *validator) parseFile(doc *yaml.Node) (cfg *Config, root *yaml.Node, ok bool) {
+	cfg = &Config{}
+	if len(doc.Content) == 0 {
+		// 空のファイル
+		return cfg, doc, true
+	}
+	root = doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		v.add(root, "configuration must be a mapping")
+		return nil, nil, false
+	}
+
+	v.checkFields(root, reflect.TypeFor[Config]())
+
+	rest, services := splitServices(root)
+	if err := rest.Decode(cfg); err != nil {
+		v.addDecodeError(err, root, root)
+		return nil, nil, false
+	}
+	if services == nil {
+		return cfg, root, true
+	}
+	if services.Kind != yaml.SequenceNode {
+		v.add(services, "services must be a list")
+		return nil, nil, false
+	}
+	ok = true
+	for _, item := range services.Content {
+		var sd ServiceDefinition
+		if err := item.Decode(&sd); err != nil {
+			// kindの誤りはkindのキーの位置で報告する（kindがない場合はエントリの位置）
+			v.addDecodeError(err, item, mappingKeyOr(item, "kind"))
+			ok = false
+		}
+		cfg.Services = append(cfg.Services, sd)
+	}
+	return cfg, root, ok
+}
+
+// fileOrder は、ファイルの読み込み順を返す（ファイルに属さない問題は最後）
+func (v *validator) fileOrder(file string) int {
+	if i, ok := v.order[file]; ok {
+		return i
+	}
+	return len(v.order)
+}
+
+// sorted は、問題をファイル・位置の順に並べて返す
+func (v *validator) sorted() []Problem {
+	slices.SortStableFunc(v.problems, func(a, b Problem) int {
+		if a.File != b.File {
+			return v.fileOrder(a.File) - v.fileOrder(b.File)
+		}
+		if a.Line != b.Line {
+			return a.Line - b.Line
+		}
+		return a.Column - b.Column
+	})
+	return v.problems
+}
+
+// splitServices は、ルートのマッピングをservices以外とservicesの値に分ける
+func splitServices(root *yaml.Node) (*yaml.Node, *yaml.Node) {
+	rest := *root
+	rest.Content = nil
+	var services *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "services" {
+			services = root.Content[i+1]
+			continue
+		}
+		rest.Content = append(rest.Content, root.Content[i], root.Content[i+1])
+	}
+	return &rest, services
+}
+
+// mappingValueOr は、マッピングのキーに対応する値を返す（キーがなければマッピング自身）
+func mappingValueOr(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return node
+}
+
+// mappingKeyOr は、マッピングのキーのノードを返す（キーがなければマッピング自身）
+func mappingKeyOr(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i]
+		}
+	}
+	return node
+}
+
+// fieldAtLine は、値がlineの行にあるフィールドのキー（シーケンスの要素の場合は要素自身）を返す
+func fieldAtLine(node *yaml.Node, line int) *yaml.Node {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, n := range node.Content {
+			if f := fieldAtLine(n, line); f != nil {
+				return f
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if value.Kind == yaml.ScalarNode && value.Line == line {
+				return key
+			}
+			if f := fieldAtLine(value, line); f != nil {
+				return f
+			}
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			if item.Kind == yaml.ScalarNode && item.Line == line {
+				return item
+			}
+			if f := fieldAtLine(item, line); f != nil {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// yamlErrorLine はyaml.v3のエラーメッセージに含まれる行番号
+var yamlErrorLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// addDecodeError は、デコードのエラーを行番号付きの問題として追加する。
+// 型の誤りはnodeの中でその行にあるフィールドのキーの位置で報告し、
+// 行番号を含まないエラーはatの位置で報告する。
+func (v *validator) addDecodeError(err error, node, at *yaml.Node) {
+	var messages []string
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	} else {
+		messages = []string{err.Error()}
+	}
+	for _, msg := range messages {
+		if m := yamlErrorLine.FindStringSubmatch(msg); m != nil {
+			line, _ := strconv.Atoi(m[1])
+			if f := fieldAtLine(node, line); f != nil {
+				v.add(f, "%s", m[2])
+				continue
+			}
+			v.addAt(v.file, line, 0, "%s", m[2])
+			continue
+		}
+		v.add(at, "%s", msg)
+	}
+}
+
+// checkFields は、nodeにtの型で定義されていないフィールドがないかを再帰的に検証する
+func (v *validator) checkFields(node *yaml.Node, t reflect.Type) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == serviceDefinitionType:
+		// kindが不正な場合はデコード時に報告する
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		kind := mappingValueOr(node, "kind")
+		if st, ok := serviceKinds[kind.Value]; ok {
+			v.checkMapping(node, st, "kind")
+		}
+	case t.Kind() == reflect.Struct:
+		if node.Kind == yaml.MappingNode {
+			v.checkMapping(node, t)
+		}
+	case t.Kind() == reflect.Slice:
+		if node.Kind == yaml.SequenceNode {
+			for _, item := range node.Content {
+				v.checkFields(item, t.Elem())
+			}
+		}
+	case t.Kind() == reflect.Map:
+		if node.Kind == yaml.MappingNode {
+			for i := 1; i < len(node.Content); i += 2 {
+				v.checkFields(node.Content[i], t.Elem())
+			}
+		}
+	}
+}
+
+// checkMapping は、マッピングのキーがtのフィールド（またはextra）であるかを検証する
+func (v *validator) checkMapping(node *yaml.Node, t reflect.Type, extra ...string) {
+	fields := yamlFields(t)
+	names := slices.Clone(extra)
+	for _, f := range fields {
+		names = append(names, f.name)
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if slices.Contains(extra, key.Value) {
+			continue
+		}
+		idx := slices.IndexFunc(fields, func(f yamlField) bool { return f.name == key.Value })
+		if idx < 0 {
+			msg := fmt.Sprintf("unknown field '%s' for %s", key.Value, fieldOwners[t])
+			if s := suggest(key.Value, names); s != "" {
+				msg += fmt.Sprintf(", did you mean '%s'?", s)
+			}
+			v.add(key, "%s", msg)
+			continue
+		}
+		v.checkFields(value, fields[idx].typ)
+	}
+}
+
+// yamlField はYAMLにマッピングされる構造体のフィールド
+type yamlField struct {
+	name  string
+	typ   reflect.Type
+	field reflect.StructField
+}
+
+// yamlFields は、構造体のYAMLのフィールドを定義順に返す
+func yamlFields(t reflect.Type) []yamlField {
+	var fields []yamlField
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields = append(fields, yamlField{name: name, typ: f.Type, field: f})
+	}
+	return fields
+}
+
+// suggest は、nameに最も近い候補を返す（十分に近い候補がなければ空文字列）
+func suggest(name string, candidates []string) string {
+	best, bestDist := "", max(2, len(name)/3)+1
+	for _, c := range candidates {
+		if d := editDistance(name, c); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+// editDistance は、隣接文字の入れ替えを1回の操作とみなす編集距離を返す
+func editDistance(a, b string) int {
+	// d[i][j] は a[:i] と b[:j] の距離
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
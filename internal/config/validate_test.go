@@ -0,0 +1,323 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name: "valid",
+			content: `services:
+  - kind: kubernetes
+    host: app.localhost
+    namespace: default
+    service: web
+    port: 8080
+    protocol: http
+`,
+		},
+		{
+			name: "unknown fields with suggestions",
+			content: `listner_port: 8080
+services:
+  - kind: kubernetes
+    host: app.localhost
+    namespace: default
+    service: web
+    port_nmae: http
+    protocol: http
+    routes:
+      - prefx: /api
+        service: api
+        headers:
+          - name: x-canary
+            exact: "1"
+            foo: bar
+`,
+			want: []string{
+				"1:1: unknown field 'listner_port' for the configuration, did you mean 'listener_port'?",
+				"7:5: unknown field 'port_nmae' for kind 'kubernetes', did you mean 'port_name'?",
+				"10:9: unknown field 'prefx' for routes, did you mean 'prefix'?",
+				"15:13: unknown field 'foo' for header matches",
+			},
+		},
+		{
+			name: "fields of another kind",
+			content: `ssh_bastions:
+  primary:
+    instance: bastion
+    zone: zone
+services:
+  - kind: tcp
+    host: db.localhost
+    ssh_bastion: primary
+    target_host: 10.0.0.1
+    target_port: 5432
+    namespace: db
+`,
+			want: []string{
+				"11:5: unknown field 'namespace' for kind 'tcp'",
+			},
+		},
+		{
+			name: "every entry is reported",
+			content: `services:
+  - kind: kubernetes
+    host: a.localhost
+    service: web
+    port: 8080
+    protocol: http
+  - kind: kubernets
+    host: b.localhost
+  - host: c.localhost
+  - kind: kubernetes
+    host: d.localhost
+    namespace: default
+    service: web
+    port: http
+    protocol: http
+`,
+			want: []string{
+				"2:5: invalid service entry at index 0: namespace is required for kubernetes service 'a.localhost'",
+				"7:5: unknown service kind: kubernets (must be 'kubernetes', 'tcp' or 'kubernetes-discovery')",
+				"9:5: service must have 'kind' field",
+				"14:5: cannot unmarshal !!str `http` into int",
+			},
+		},
+		{
+			name: "errors at the field",
+			content: `services:
+  - host: a.localhost
+    kind: kubernets
+  - kind: kubernetes
+    host: b.localhost
+    namespace: default
+    service: web
+    port: 8080
+    protocol: http
+    routes:
+      - prefix: /api
+        service: api
+        port: api
+`,
+			want: []string{
+				"3:5: unknown service kind: kubernets (must be 'kubernetes', 'tcp' or 'kubernetes-discovery')",
+				"13:9: cannot unmarshal !!str `api` into int",
+			},
+		},
+		{
+			name: "mistyped top-level field",
+			content: `name: backend
+listener_port: abc
+`,
+			want: []string{
+				"2:1: cannot unmarshal !!str `abc` into int",
+			},
+		},
+		{
+			name: "conflicts",
+			content: `listener_port: 8080
+tls:
+  listener_port: 8080
+services:
+  - kind: kubernetes
+    host: app.localhost
+    namespace: default
+    service: web
+    port: 8080
+    protocol: http
+  - kind: kubernetes
+    host: app.localhost
+    namespace: default
+    service: api
+    port: 8080
+    protocol: http
+`,
+			want: []string{
+				"3:3: tls.listener_port must differ from listener_port (8080)",
+				"11:5: service entry at index 1 ('app.localhost', line 11): duplicate host, already used by service entry at index 0 ('app.localhost', line 5)",
+			},
+		},
+		{
+			name:    "syntax error",
+			content: "listener_port: 8080\nservices:\n\t- kind: kubernetes\n",
+			want: []string{
+				"3: found character that cannot start any token",
+			},
+		},
+		{
+			name: "undefined variables",
+			content: `services:
+  - kind: kubernetes
+    host: app-${LOCALMESH_UNDEFINED}.localhost
+    namespace: ${LOCALMESH_UNDEFINED_NS}
+    service: web
+    port: 8080
+    protocol: http
+`,
+			want: []string{
+				"3:11: undefined variable 'LOCALMESH_UNDEFINED' (define it in vars:, with --set LOCALMESH_UNDEFINED=... or as an environment variable)",
+				"4:16: undefined variable 'LOCALMESH_UNDEFINED_NS' (define it in vars:, with --set LOCALMESH_UNDEFINED_NS=... or as an environment variable)",
+			},
+		},
+		{
+			name:    "no services",
+			content: "listener_port: 8080\n",
+			want: []string{
+				"no services configured",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			problems, err := Validate(LoadOptions{}, configPath)
+			if err != nil {
+				t.Fatalf("Validate failed: %v", err)
+			}
+			var got []string
+			for _, p := range problems {
+				got = append(got, strings.TrimPrefix(p.String(), configPath+":"))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unexpected problems:\n got: %q\nwant: %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate_MultipleFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	// 個別には不完全なファイルでも、マージした結果で検証する
+	base := write("base.yaml", `ssh_bastions:
+  primary:
+    instance: bastion
+    zone: zone
+services:
+  - kind: tcp
+    host: db.localhost
+    ssh_bastion: primary
+    target_host: 10.0.0.1
+    target_port: 5432
+`)
+	local := write("local.yaml", `services:
+  - kind: tcp
+    host: db.localhost
+    ssh_bastion: secondary
+    target_host: 10.0.0.1
+    target_port: 5432
+  - kind: kubernetes
+    host: app.localhost
+    namespace: default
+    service: web
+    port: 8080
+    protocol: htp
+`)
+
+	problems, err := Validate(LoadOptions{}, base, local)
+	if err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	var got []string
+	for _, p := range problems {
+		got = append(got, p.String())
+	}
+	want := []string{
+		local + ":2:5: invalid service entry at index 0: ssh_bastion 'secondary' not found for service 'db.localhost'",
+		local + ":7:5: invalid service entry at index 1: protocol must be 'http', 'grpc' or 'tcp' for kubernetes service 'app.localhost', got 'htp'",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected problems:\n got: %q\nwant: %q", got, want)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"port", "port_name", "protocol", "namespace"}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "port_nmae", want: "port_name"},
+		{name: "prot", want: "port"},
+		{name: "protcol", want: "protocol"},
+		{name: "namespaces", want: "namespace"},
+		{name: "selector", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := suggest(tt.name, candidates); got != tt.want {
+			t.Errorf("suggest(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSchema(t *testing.T) {
+	s := Schema()
+	if s["$schema"] != "https://json-schema.org/draft/2020-12/schema" {
+		t.Errorf("unexpected $schema: %v", s["$schema"])
+	}
+
+	props := s["properties"].(map[string]any)
+	variants := props["services"].(map[string]any)["items"].(map[string]any)["oneOf"].([]any)
+	if len(variants) != len(serviceKinds) {
+		t.Fatalf("expected %d variants, got %d", len(serviceKinds), len(variants))
+	}
+
+	// kindごとに固有のフィールドだけを許可する
+	k8s := variants[0].(map[string]any)
+	k8sProps := k8s["properties"].(map[string]any)
+	if k8sProps["kind"].(map[string]any)["const"] != "kubernetes" {
+		t.Errorf("unexpected kind: %v", k8sProps["kind"])
+	}
+	if _, ok := k8sProps["port_name"]; !ok {
+		t.Error("expected port_name in kubernetes schema")
+	}
+	if _, ok := k8sProps["target_port"]; ok {
+		t.Error("unexpected target_port in kubernetes schema")
+	}
+	if k8s["additionalProperties"] != false {
+		t.Error("expected additionalProperties false")
+	}
+	if !reflect.DeepEqual(k8s["required"], []any{"kind", "host", "namespace", "service"}) {
+		t.Errorf("unexpected required: %v", k8s["required"])
+	}
+	if !reflect.DeepEqual(k8sProps["upstream_protocol"].(map[string]any)["enum"], toAnySlice(UpstreamProtocols)) {
+		t.Errorf("unexpected upstream_protocol enum: %v", k8sProps["upstream_protocol"])
+	}
+
+	routes := k8sProps["routes"].(map[string]any)["items"].(map[string]any)["properties"].(map[string]any)
+	if _, ok := routes["headers"]; !ok {
+		t.Error("expected headers in route schema")
+	}
+}
+
+func TestFieldOwners(t *testing.T) {
+	// 未知のフィールドを検証するすべての構造体にエラーメッセージ用の呼び方がある
+	for typ := range schemaRequired {
+		if _, ok := fieldOwners[typ]; !ok {
+			t.Errorf("missing field owner for %s", typ)
+		}
+	}
+}
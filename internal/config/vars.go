@@ -0,0 +1,193 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadOptions are options for LoadFiles and Validate.
+type LoadOptions struct {
+	// Set overrides variables of 'vars:' (up --set key=value).
+	Set map[string]string
+	// Selection selects the services of the loaded configuration. Validate
+	// ignores it.
+	Selection Selection
+}
+
+// varName は変数名として使える文字列
+var varName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// varReference は値の中の ${NAME}、${NAME:-default} とエスケープの $$
+var varReference = regexp.MustCompile(`\$\$|\$\{([^}:]*)(?::-([^}]*))?\}`)
+
+// ParseSet parses --set values in key=value form.
+func ParseSet(values []string) (map[string]string, error) {
+	set := map[string]string{}
+	for _, v := range values {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid --set value '%s': must be key=value", v)
+		}
+		if !varName.MatchString(key) {
+			return nil, fmt.Errorf("invalid --set value '%s': variable name must match %s", v, varName)
+		}
+		set[key] = value
+	}
+	return set, nil
+}
+
+// nodeError は位置付きのエラー
+type nodeError struct {
+	file string
+	node *yaml.Node
+	err  error
+}
+
+func (e nodeError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %v", e.file, e.node.Line, e.node.Column, e.err)
+}
+
+// expander は設定ファイルの値の中の変数を展開する。
+// 変数は --set、vars:、環境変数の順に解決する。
+type expander struct {
+	vars map[string]string
+}
+
+// newExpander は、すべての設定ファイルのvars:（後のファイルが優先）と --set から変数を集める。
+// vars:の値の中では --set と環境変数のみを参照できる。
+func newExpander(sources []source, set map[string]string) (*expander, []nodeError) {
+	base := &expander{vars: set}
+	vars := map[string]string{}
+	var errs []nodeError
+	for _, src := range sources {
+		block := varsBlock(src.doc)
+		if block == nil {
+			continue
+		}
+		if block.Kind != yaml.MappingNode {
+			errs = append(errs, nodeError{src.path, block, fmt.Errorf("vars must be a mapping")})
+			continue
+		}
+		for i := 0; i+1 < len(block.Content); i += 2 {
+			key, value := block.Content[i], block.Content[i+1]
+			if !varName.MatchString(key.Value) {
+				errs = append(errs, nodeError{src.path, key, fmt.Errorf("invalid variable name '%s'", key.Value)})
+				continue
+			}
+			if value.Kind != yaml.ScalarNode {
+				errs = append(errs, nodeError{src.path, value, fmt.Errorf("variable '%s' must be a string", key.Value)})
+				continue
+			}
+			expanded, err := base.expand(value.Value)
+			if err != nil {
+				errs = append(errs, nodeError{src.path, value, err})
+				continue
+			}
+			vars[key.Value] = expanded
+		}
+	}
+	maps.Copy(vars, set)
+	return &expander{vars: vars}, errs
+}
+
+// varsBlock は、ドキュメントのvars:の値を返す（なければnil）
+func varsBlock(doc *yaml.Node) *yaml.Node {
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "vars" {
+			return root.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// lookup は変数の値を返す
+func (e *expander) lookup(name string) (string, bool) {
+	if v, ok := e.vars[name]; ok {
+		return v, true
+	}
+	return os.LookupEnv(name)
+}
+
+// expand は、文字列の中の変数を展開する
+func (e *expander) expand(s string) (string, error) {
+	var firstErr error
+	out := varReference.ReplaceAllStringFunc(s, func(ref string) string {
+		if ref == "$$" {
+			return "$"
+		}
+		m := varReference.FindStringSubmatch(ref)
+		name, def, hasDefault := m[1], m[2], strings.Contains(ref, ":-")
+		if !varName.MatchString(name) {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("invalid variable reference '%s'", ref)
+			}
+			return ref
+		}
+		if v, ok := e.lookup(name); ok && (v != "" || !hasDefault) {
+			return v
+		}
+		if hasDefault {
+			return def
+		}
+		if firstErr == nil {
+			firstErr = fmt.Errorf("undefined variable '%s' (define it in vars:, with --set %s=... or as an environment variable)", name, name)
+		}
+		return ref
+	})
+	return out, firstErr
+}
+
+// expandNode は、ドキュメント内のすべてのスカラー値の変数を展開する（キーとvars:は対象外）。
+// 引用符なしの値は展開後の値で型を判定し直すため、port: ${PORT} のように数値にも使える。
+func (e *expander) expandNode(src source) []nodeError {
+	root := rootOf(src.doc)
+	var errs []nodeError
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		switch n.Kind {
+		case yaml.DocumentNode, yaml.SequenceNode:
+			for _, c := range n.Content {
+				walk(c)
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if n == root && n.Content[i].Value == "vars" {
+					continue
+				}
+				walk(n.Content[i+1])
+			}
+		case yaml.ScalarNode:
+			if !strings.Contains(n.Value, "$") {
+				return
+			}
+			expanded, err := e.expand(n.Value)
+			if err != nil {
+				errs = append(errs, nodeError{src.path, n, err})
+				return
+			}
+			if expanded != n.Value && n.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+				n.Tag = ""
+			}
+			n.Value = expanded
+		}
+	}
+	walk(src.doc)
+	return errs
+}
+
+// rootOf は、ドキュメントのルートのノードを返す
+func rootOf(doc *yaml.Node) *yaml.Node {
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		return doc.Content[0]
+	}
+	return doc
+}
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadFiles_Vars(t *testing.T) {
+	t.Setenv("PREVIEW_NS", "pr-1234")
+	t.Setenv("LOCALMESH_EMPTY", "")
+
+	content := `vars:
+  team: users
+  port: "8080"
+  suffix: ${LOCALMESH_SUFFIX:-local}
+services:
+  - kind: kubernetes
+    host: ${team}-${PREVIEW_NS}.${suffix}host
+    namespace: ${PREVIEW_NS}
+    service: ${team}-api
+    port: ${port}
+    protocol: ${PROTOCOL:-http}
+    request_headers_to_add:
+      - name: x-price
+        value: $$5 ${LOCALMESH_EMPTY:-none}
+`
+	tests := []struct {
+		name      string
+		set       map[string]string
+		wantHost  string
+		wantPort  int
+		wantProto string
+	}{
+		{
+			name:      "vars and environment",
+			wantHost:  "users-pr-1234.localhost",
+			wantPort:  8080,
+			wantProto: "http",
+		},
+		{
+			name:      "--set overrides vars and environment",
+			set:       map[string]string{"team": "billing", "PREVIEW_NS": "pr-42", "port": "9090", "PROTOCOL": "grpc"},
+			wantHost:  "billing-pr-42.localhost",
+			wantPort:  9090,
+			wantProto: "grpc",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := LoadFiles(LoadOptions{Set: tt.set}, configPath)
+			if err != nil {
+				t.Fatalf("LoadFiles failed: %v", err)
+			}
+			k8sSvc, _ := cfg.Services[0].AsKubernetes()
+			if k8sSvc.Host != tt.wantHost || k8sSvc.Port != tt.wantPort || k8sSvc.Protocol != tt.wantProto {
+				t.Errorf("unexpected service: host=%s port=%d protocol=%s", k8sSvc.Host, k8sSvc.Port, k8sSvc.Protocol)
+			}
+			if k8sSvc.Namespace != "pr-1234" && tt.set == nil {
+				t.Errorf("expected namespace from environment, got %s", k8sSvc.Namespace)
+			}
+			// $$ はエスケープ、空の変数には :- のデフォルト値を使う
+			if got := k8sSvc.RequestHeadersToAdd[0].Value; got != "$5 none" {
+				t.Errorf("unexpected header value: %q", got)
+			}
+		})
+	}
+}
+
+func TestLoadFiles_VarsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		errMsg  string
+	}{
+		{
+			name:    "undefined variable",
+			content: "services:\n  - kind: kubernetes\n    host: app.localhost\n    namespace: ${LOCALMESH_UNDEFINED}\n",
+			errMsg:  "config.yaml:4:16: undefined variable 'LOCALMESH_UNDEFINED'",
+		},
+		{
+			name:    "invalid reference",
+			content: "services:\n  - kind: kubernetes\n    host: ${not-a-name}\n",
+			errMsg:  "config.yaml:3:11: invalid variable reference '${not-a-name}'",
+		},
+		{
+			name:    "vars must be a mapping",
+			content: "vars: [a]\nservices: []\n",
+			errMsg:  "config.yaml:1:7: vars must be a mapping",
+		},
+		{
+			name:    "variables in vars refer only to --set and environment",
+			content: "vars:\n  a: x\n  b: ${a}\nservices: []\n",
+			errMsg:  "config.yaml:3:6: undefined variable 'a'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := LoadFiles(LoadOptions{}, configPath)
+			if err == nil {
+				t.Fatalf("expected error containing '%s', got nil", tt.errMsg)
+			}
+			if !containsString(err.Error(), tt.errMsg) {
+				t.Errorf("expected error containing '%s', got '%s'", tt.errMsg, err.Error())
+			}
+		})
+	}
+}
+
+func TestLoadFiles_VarsAcrossFiles(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "services.yaml")
+	local := filepath.Join(dir, "local.yaml")
+	if err := os.WriteFile(base, []byte(`vars:
+  ns: staging
+services:
+  - kind: kubernetes
+    host: app.localhost
+    namespace: ${ns}
+    service: web
+    port: 8080
+    protocol: http
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// 後のファイルのvars:は先のファイルの値の展開にも使われる
+	if err := os.WriteFile(local, []byte("vars:\n  ns: pr-7\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadFiles(LoadOptions{}, base, local)
+	if err != nil {
+		t.Fatalf("LoadFiles failed: %v", err)
+	}
+	k8sSvc, _ := cfg.Services[0].AsKubernetes()
+	if k8sSvc.Namespace != "pr-7" {
+		t.Errorf("expected namespace pr-7, got %s", k8sSvc.Namespace)
+	}
+	if !reflect.DeepEqual(cfg.Vars, map[string]string{"ns": "pr-7"}) {
+		t.Errorf("unexpected vars: %v", cfg.Vars)
+	}
+}
+
+func TestParseSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "key=value", values: []string{"PREVIEW_NS=pr-1", "empty=", "expr=a=b"}, want: map[string]string{"PREVIEW_NS": "pr-1", "empty": "", "expr": "a=b"}},
+		{name: "missing =", values: []string{"PREVIEW_NS"}, wantErr: true},
+		{name: "invalid name", values: []string{"preview-ns=pr-1"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSet(tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSet() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
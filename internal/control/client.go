@@ -0,0 +1,103 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/usadamasa/kubectl-localmesh/internal/state"
+)
+
+// clientTimeout は制御APIのリクエスト1回あたりのタイムアウト
+const clientTimeout = 10 * time.Second
+
+// Client calls the control API of a running instance over its Unix socket.
+type Client struct {
+	http *http.Client
+}
+
+// NewClient returns a Client connecting to the Unix socket at socketPath.
+func NewClient(socketPath string) *Client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socketPath)
+		},
+	}
+	return &Client{http: &http.Client{Transport: transport, Timeout: clientTimeout}}
+}
+
+// Services lists all services of the instance.
+func (c *Client) Services(ctx context.Context) ([]state.ServiceHealth, error) {
+	var services []state.ServiceHealth
+	if err := c.do(ctx, http.MethodGet, "/v1/services", &services); err != nil {
+		return nil, err
+	}
+	return services, nil
+}
+
+// Service returns a single service.
+func (c *Client) Service(ctx context.Context, host string) (*state.ServiceHealth, error) {
+	var svc state.ServiceHealth
+	if err := c.do(ctx, http.MethodGet, "/v1/services/"+url.PathEscape(host), &svc); err != nil {
+		return nil, err
+	}
+	return &svc, nil
+}
+
+// Reconnect forces the port-forward or SSH tunnel of host to reconnect.
+func (c *Client) Reconnect(ctx context.Context, host string) (*state.ServiceHealth, error) {
+	return c.action(ctx, host, "reconnect")
+}
+
+// SetEnabled enables or disables the service of host.
+func (c *Client) SetEnabled(ctx context.Context, host string, enabled bool) (*state.ServiceHealth, error) {
+	if enabled {
+		return c.action(ctx, host, "enable")
+	}
+	return c.action(ctx, host, "disable")
+}
+
+func (c *Client) action(ctx context.Context, host, action string) (*state.ServiceHealth, error) {
+	var svc state.ServiceHealth
+	if err := c.do(ctx, http.MethodPost, "/v1/services/"+url.PathEscape(host)+"/"+action, &svc); err != nil {
+		return nil, err
+	}
+	return &svc, nil
+}
+
+// do は、リクエストを送信してレスポンスのJSONをoutにデコードする
+func (c *Client) do(ctx context.Context, method, path string, out any) error {
+	// ホスト名はUnix socketへの接続では使われない
+	req, err := http.NewRequestWithContext(ctx, method, "http://localmesh"+path, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect to control socket: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		var e errorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Error == "" {
+			return fmt.Errorf("control API returned %s", resp.Status)
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			// サーバー側のメッセージにもErrServiceNotFoundの文言が含まれるため取り除く
+			host := strings.TrimPrefix(e.Error, ErrServiceNotFound.Error()+": ")
+			return fmt.Errorf("%w: %s", ErrServiceNotFound, host)
+		}
+		return errors.New(e.Error)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
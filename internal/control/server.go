@@ -0,0 +1,195 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/usadamasa/kubectl-localmesh/internal/state"
+)
+
+// ErrServiceNotFound is returned by a Controller when no service has the given host.
+var ErrServiceNotFound = errors.New("service not found")
+
+// Controller is the runtime operations exposed by the control API.
+type Controller interface {
+	// Services returns the forwarding state of all services in config order.
+	Services() ([]state.Service, error)
+	// Reconnect tears down and re-establishes the port-forward or SSH tunnel of host.
+	Reconnect(host string) error
+	// SetEnabled enables or disables the service of host at runtime.
+	SetEnabled(host string, enabled bool) error
+}
+
+// Server serves the control API on a Unix socket.
+type Server struct {
+	path string
+	ln   net.Listener
+	srv  *http.Server
+}
+
+// Listen creates the Unix socket at path and returns a Server bound to it.
+// A leftover socket file at path is replaced.
+func Listen(path string, ctrl Controller) (*Server, error) {
+	// 異常終了したプロセスのsocketが残っている場合は削除する
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove stale control socket %s: %w", path, err)
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on control socket %s: %w", path, err)
+	}
+	if err := restrictSocket(path); err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+
+	return &Server{
+		path: path,
+		ln:   ln,
+		srv:  &http.Server{Handler: NewHandler(ctrl)},
+	}, nil
+}
+
+// Path returns the socket path.
+func (s *Server) Path() string {
+	return s.path
+}
+
+// Serve accepts connections until Close is called.
+func (s *Server) Serve() error {
+	if err := s.srv.Serve(s.ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Close stops the server and removes the socket file.
+func (s *Server) Close() error {
+	err := s.srv.Close()
+	if rmErr := os.Remove(s.path); rmErr != nil && !errors.Is(rmErr, os.ErrNotExist) && err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// restrictSocket は、socketを起動ユーザーのみ操作できるようにする。
+// sudo経由で起動した場合は、sudoを実行した一般ユーザーにも操作を許可する。
+func restrictSocket(path string) error {
+	if err := os.Chmod(path, 0600); err != nil {
+		return fmt.Errorf("failed to set permission on control socket: %w", err)
+	}
+
+	uid, errUID := strconv.Atoi(os.Getenv("SUDO_UID"))
+	gid, errGID := strconv.Atoi(os.Getenv("SUDO_GID"))
+	if os.Geteuid() != 0 || errUID != nil || errGID != nil {
+		return nil
+	}
+	if err := os.Chown(path, uid, gid); err != nil {
+		return fmt.Errorf("failed to change owner of control socket: %w", err)
+	}
+	return nil
+}
+
+// NewHandler returns the HTTP handler of the control API.
+//
+//	GET  /v1/services                   list services with health
+//	GET  /v1/services/{host}            show a single service
+//	POST /v1/services/{host}/reconnect  reconnect the port-forward / SSH tunnel
+//	POST /v1/services/{host}/enable     enable the service
+//	POST /v1/services/{host}/disable    disable the service
+func NewHandler(ctrl Controller) http.Handler {
+	h := &handler{ctrl: ctrl}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/services", h.list)
+	mux.HandleFunc("GET /v1/services/{host}", h.show)
+	mux.HandleFunc("POST /v1/services/{host}/reconnect", h.reconnect)
+	mux.HandleFunc("POST /v1/services/{host}/enable", h.setEnabled(true))
+	mux.HandleFunc("POST /v1/services/{host}/disable", h.setEnabled(false))
+	return mux
+}
+
+type handler struct {
+	ctrl Controller
+}
+
+func (h *handler) list(w http.ResponseWriter, r *http.Request) {
+	services, err := h.ctrl.Services()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	healths := []state.ServiceHealth{}
+	for _, svc := range services {
+		healths = append(healths, state.CheckService(svc))
+	}
+	writeJSON(w, http.StatusOK, healths)
+}
+
+func (h *handler) show(w http.ResponseWriter, r *http.Request) {
+	svc, err := h.find(r.PathValue("host"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, state.CheckService(*svc))
+}
+
+func (h *handler) reconnect(w http.ResponseWriter, r *http.Request) {
+	host := r.PathValue("host")
+	if err := h.ctrl.Reconnect(host); err != nil {
+		writeError(w, err)
+		return
+	}
+	h.show(w, r)
+}
+
+func (h *handler) setEnabled(enabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := h.ctrl.SetEnabled(r.PathValue("host"), enabled); err != nil {
+			writeError(w, err)
+			return
+		}
+		h.show(w, r)
+	}
+}
+
+// find は、ホスト名に対応するサービスの状態を返す
+func (h *handler) find(host string) (*state.Service, error) {
+	services, err := h.ctrl.Services()
+	if err != nil {
+		return nil, err
+	}
+	for _, svc := range services {
+		if svc.Host == host {
+			return &svc, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrServiceNotFound, host)
+}
+
+// errorResponse はエラー時のレスポンスボディ
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, ErrServiceNotFound) {
+		status = http.StatusNotFound
+	}
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
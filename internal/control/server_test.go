@@ -0,0 +1,169 @@
+package control
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/usadamasa/kubectl-localmesh/internal/state"
+)
+
+// fakeController はテスト用のController
+type fakeController struct {
+	mu         sync.Mutex
+	services   []state.Service
+	reconnects []string
+}
+
+func (f *fakeController) Services() ([]state.Service, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]state.Service(nil), f.services...), nil
+}
+
+func (f *fakeController) Reconnect(host string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, svc := range f.services {
+		if svc.Host == host {
+			f.reconnects = append(f.reconnects, host)
+			return nil
+		}
+	}
+	return ErrServiceNotFound
+}
+
+func (f *fakeController) SetEnabled(host string, enabled bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.services {
+		if f.services[i].Host == host {
+			f.services[i].Disabled = !enabled
+			return nil
+		}
+	}
+	return ErrServiceNotFound
+}
+
+// startServer は、一時ディレクトリのUnix socketで制御APIを起動する
+func startServer(t *testing.T, ctrl Controller) string {
+	t.Helper()
+
+	// Unix socketのパス長制限（macOSでは104バイト）を避けるため短いパスを使う
+	dir, err := os.MkdirTemp("", "lm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "ctl.sock")
+	srv, err := Listen(path, ctrl)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	go func() { _ = srv.Serve() }()
+	t.Cleanup(func() { _ = srv.Close() })
+	return path
+}
+
+func TestServer(t *testing.T) {
+	ctrl := &fakeController{
+		services: []state.Service{
+			{Host: "users.localhost", Kind: "kubernetes", Protocol: "http", LocalPort: 1},
+			{Host: "billing.localhost", Kind: "kubernetes", Protocol: "http", LocalPort: 1},
+		},
+	}
+	path := startServer(t, ctrl)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("expected socket permission 0600, got %o", perm)
+	}
+
+	client := NewClient(path)
+	ctx := t.Context()
+
+	services, err := client.Services(ctx)
+	if err != nil {
+		t.Fatalf("Services failed: %v", err)
+	}
+	if len(services) != 2 || services[0].Host != "users.localhost" || services[0].Status != "down" {
+		t.Errorf("unexpected services: %+v", services)
+	}
+
+	svc, err := client.SetEnabled(ctx, "billing.localhost", false)
+	if err != nil {
+		t.Fatalf("SetEnabled failed: %v", err)
+	}
+	if !svc.Disabled || svc.Status != "disabled" {
+		t.Errorf("expected disabled service, got %+v", svc)
+	}
+
+	if _, err := client.Reconnect(ctx, "users.localhost"); err != nil {
+		t.Fatalf("Reconnect failed: %v", err)
+	}
+	if len(ctrl.reconnects) != 1 || ctrl.reconnects[0] != "users.localhost" {
+		t.Errorf("unexpected reconnects: %v", ctrl.reconnects)
+	}
+
+	svc, err = client.Service(ctx, "billing.localhost")
+	if err != nil {
+		t.Fatalf("Service failed: %v", err)
+	}
+	if !svc.Disabled {
+		t.Errorf("expected billing to stay disabled, got %+v", svc)
+	}
+}
+
+func TestServer_NotFound(t *testing.T) {
+	client := NewClient(startServer(t, &fakeController{}))
+	ctx := t.Context()
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"show", func() error { _, err := client.Service(ctx, "unknown.localhost"); return err }},
+		{"reconnect", func() error { _, err := client.Reconnect(ctx, "unknown.localhost"); return err }},
+		{"enable", func() error { _, err := client.SetEnabled(ctx, "unknown.localhost", true); return err }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			if !errors.Is(err, ErrServiceNotFound) {
+				t.Errorf("expected ErrServiceNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+func TestListen_ReplacesStaleSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "lm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	// 異常終了したプロセスが残したファイル
+	path := filepath.Join(dir, "ctl.sock")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := Listen(path, &fakeController{})
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	if err := srv.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected socket to be removed on Close, got %v", err)
+	}
+}
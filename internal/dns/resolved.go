@@ -0,0 +1,201 @@
+package dns
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// resolvedDir は、systemd-resolvedの設定のdrop-inディレクトリ（テストで差し替え可能）
+var resolvedDir = "/etc/systemd/resolved.conf.d"
+
+// resolvedRuntimeDir は、systemd-resolvedが実行中の場合に存在するディレクトリ
+const resolvedRuntimeDir = "/run/systemd/resolve"
+
+// reloadResolved は、systemd-resolvedに設定を再読み込みさせる（テストで差し替え可能）
+var reloadResolved = func() error {
+	if out, err := exec.Command("systemctl", "reload-or-restart", "systemd-resolved").CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to reload systemd-resolved: %w: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+var (
+	// namePattern は、drop-inファイル名に使うインスタンスの名前
+	namePattern = regexp.MustCompile(`^[0-9A-Za-z_-]{1,64}$`)
+	// domainPattern は、split DNSのドメイン名（小文字、末尾のドットなし、2つ以上のラベル）。
+	// helperはrootで実行されるため、"com"のようなトップレベルドメイン全体は振り向けない。
+	domainPattern = regexp.MustCompile(`^[a-z0-9_]([a-z0-9_-]*[a-z0-9_])?(\.[a-z0-9_]([a-z0-9_-]*[a-z0-9_])?)+$`)
+)
+
+// SplitDNS routes the queries for some domains to the DNS server of an
+// instance through systemd-resolved.
+type SplitDNS interface {
+	// Apply routes the queries for domains to server (a loopback host:port).
+	Apply(server string, domains []string) error
+	// Remove stops routing the queries to the server.
+	Remove() error
+}
+
+// NewSplitDNS returns a SplitDNS for the instance named name. It writes a
+// systemd-resolved drop-in directly when running as root, and otherwise runs
+// the privileged helper ("kubectl-localmesh dns apply|remove") through
+// "sudo -n", so that only the drop-in edit runs as root. It fails on
+// systems without systemd-resolved and if sudo would ask for a password.
+func NewSplitDNS(name string) (SplitDNS, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	if runtime.GOOS != "linux" {
+		return nil, errors.New("dns.resolved_domains requires systemd-resolved on Linux")
+	}
+	if _, err := os.Stat(resolvedRuntimeDir); err != nil {
+		return nil, errors.New("dns.resolved_domains requires systemd-resolved, which is not running")
+	}
+	if os.Geteuid() == 0 {
+		return fileSplitDNS{name: name}, nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate the kubectl-localmesh binary: %w", err)
+	}
+	h := &sudoHelper{exe: exe, name: name, run: runSudo}
+
+	// パスワードの入力なしで実行できるかを事前に確認する
+	args := h.args("remove")
+	if err := h.run(append([]string{"-l"}, args...)...); err != nil {
+		return nil, fmt.Errorf(
+			"cannot configure systemd-resolved: 'sudo -n %s' is not allowed without a password (%w)\n"+
+				"run 'sudo -v' first, add a sudoers rule for the helper (see README), or remove dns.resolved_domains",
+			strings.Join(args, " "), err)
+	}
+	return h, nil
+}
+
+// ApplyResolved writes the systemd-resolved drop-in of the instance named
+// name, which routes the queries for domains to server, and reloads
+// systemd-resolved. As the helper runs as root, every argument is validated
+// before anything is written.
+func ApplyResolved(name, server string, domains []string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddrPort(server)
+	if err != nil || !addr.Addr().IsLoopback() || addr.Port() == 0 {
+		return fmt.Errorf("server must be a loopback address and port, got '%s'", server)
+	}
+	if len(domains) == 0 {
+		return errors.New("at least one domain is required")
+	}
+	for _, d := range domains {
+		if len(d) > 253 || !domainPattern.MatchString(d) {
+			return fmt.Errorf("invalid domain '%s': must be a domain name of two or more labels", d)
+		}
+	}
+
+	if err := os.MkdirAll(resolvedDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", resolvedDir, err)
+	}
+	if err := os.WriteFile(dropInPath(name), []byte(dropIn(addr, domains)), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", dropInPath(name), err)
+	}
+	return reloadResolved()
+}
+
+// RemoveResolved removes the systemd-resolved drop-in of the instance named
+// name, if any, and reloads systemd-resolved.
+func RemoveResolved(name string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	if err := os.Remove(dropInPath(name)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to remove %s: %w", dropInPath(name), err)
+	}
+	return reloadResolved()
+}
+
+// dropInPath は、インスタンスのdrop-inファイルのパスを返す
+func dropInPath(name string) string {
+	return filepath.Join(resolvedDir, "kubectl-localmesh-"+name+".conf")
+}
+
+// dropIn は、ドメインの問い合わせをserverに送るdrop-inの内容を返す。
+// "~"を付けたドメインは検索ドメインにならず、問い合わせの振り分けだけに使われる。
+func dropIn(server netip.AddrPort, domains []string) string {
+	routes := make([]string, len(domains))
+	for i, d := range domains {
+		routes[i] = "~" + d
+	}
+	return fmt.Sprintf("# managed by kubectl-localmesh\n[Resolve]\nDNS=%s\nDomains=%s\n", server, strings.Join(routes, " "))
+}
+
+// validateName は、drop-inファイル名に使う名前を検証する
+func validateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid instance name '%s'", name)
+	}
+	return nil
+}
+
+// fileSplitDNS は、drop-inファイルを直接書き換える
+type fileSplitDNS struct {
+	name string
+}
+
+func (s fileSplitDNS) Apply(server string, domains []string) error {
+	return ApplyResolved(s.name, server, domains)
+}
+
+func (s fileSplitDNS) Remove() error { return RemoveResolved(s.name) }
+
+// sudoHelper は、sudo -n で実行したdnsサブコマンドでdrop-inファイルを書き換える
+type sudoHelper struct {
+	exe  string
+	name string
+	// run は sudo -n に引数を付けて実行する
+	run func(args ...string) error
+}
+
+// args は、名前を指定したdnsサブコマンドの引数を返す
+func (h *sudoHelper) args(subcommand string, extra ...string) []string {
+	return append([]string{h.exe, "dns", subcommand, "--name", h.name}, extra...)
+}
+
+func (h *sudoHelper) Apply(server string, domains []string) error {
+	extra := []string{"--server", server}
+	for _, d := range domains {
+		extra = append(extra, "--domain", d)
+	}
+	return h.run(h.args("apply", extra...)...)
+}
+
+func (h *sudoHelper) Remove() error {
+	return h.run(h.args("remove")...)
+}
+
+// runSudo は、sudo -n を実行し、失敗した場合は標準エラー出力をエラーに含める
+func runSudo(args ...string) error {
+	cmd := exec.Command("sudo", append([]string{"-n"}, args...)...)
+	cmd.Stdout = io.Discard
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("sudo -n %s: %s", strings.Join(args, " "), msg)
+		}
+		return fmt.Errorf("sudo -n %s: %w", strings.Join(args, " "), err)
+	}
+	return nil
+}
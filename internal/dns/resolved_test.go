@@ -0,0 +1,110 @@
+package dns
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// useResolvedDir は、テスト用の一時ディレクトリにdrop-inを書き込み、再読み込みの回数を数える
+func useResolvedDir(t *testing.T) (string, *int) {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "resolved.conf.d")
+	reloads := 0
+	origDir, origReload := resolvedDir, reloadResolved
+	resolvedDir = dir
+	reloadResolved = func() error {
+		reloads++
+		return nil
+	}
+	t.Cleanup(func() { resolvedDir, reloadResolved = origDir, origReload })
+	return dir, &reloads
+}
+
+func TestApplyResolved(t *testing.T) {
+	dir, reloads := useResolvedDir(t)
+
+	if err := ApplyResolved("backend", "127.0.0.1:15353", []string{"mesh.test", "preview.test"}); err != nil {
+		t.Fatalf("ApplyResolved failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "kubectl-localmesh-backend.conf"))
+	if err != nil {
+		t.Fatalf("failed to read drop-in: %v", err)
+	}
+	want := "# managed by kubectl-localmesh\n[Resolve]\nDNS=127.0.0.1:15353\nDomains=~mesh.test ~preview.test\n"
+	if string(data) != want {
+		t.Errorf("drop-in = %q, want %q", data, want)
+	}
+	if *reloads != 1 {
+		t.Errorf("reloads = %d, want 1", *reloads)
+	}
+
+	if err := RemoveResolved("backend"); err != nil {
+		t.Fatalf("RemoveResolved failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "kubectl-localmesh-backend.conf")); !os.IsNotExist(err) {
+		t.Errorf("drop-in still exists: %v", err)
+	}
+	// 存在しないdrop-inの削除では再読み込みしない
+	if err := RemoveResolved("backend"); err != nil {
+		t.Fatalf("RemoveResolved failed: %v", err)
+	}
+	if *reloads != 2 {
+		t.Errorf("reloads = %d, want 2", *reloads)
+	}
+}
+
+func TestApplyResolved_RejectsInvalidArguments(t *testing.T) {
+	dir, _ := useResolvedDir(t)
+
+	tests := []struct {
+		name    string
+		iname   string
+		server  string
+		domains []string
+		wantErr string
+	}{
+		{name: "path in name", iname: "../evil", server: "127.0.0.1:15353", domains: []string{"mesh.test"}, wantErr: "invalid instance name '../evil'"},
+		{name: "not loopback", iname: "backend", server: "192.0.2.1:53", domains: []string{"mesh.test"}, wantErr: "server must be a loopback address and port, got '192.0.2.1:53'"},
+		{name: "no port", iname: "backend", server: "127.0.0.1", domains: []string{"mesh.test"}, wantErr: "server must be a loopback address and port"},
+		{name: "no domains", iname: "backend", server: "127.0.0.1:15353", wantErr: "at least one domain is required"},
+		{name: "single label", iname: "backend", server: "127.0.0.1:15353", domains: []string{"mesh.test", "com"}, wantErr: "invalid domain 'com'"},
+		{name: "newline in domain", iname: "backend", server: "127.0.0.1:15353", domains: []string{"mesh.test\nDNS=192.0.2.1"}, wantErr: "invalid domain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ApplyResolved(tt.iname, tt.server, tt.domains)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("drop-in directory was created: %v", err)
+	}
+}
+
+func TestSudoHelper(t *testing.T) {
+	var calls [][]string
+	h := &sudoHelper{exe: "/usr/local/bin/kubectl-localmesh", name: "backend", run: func(args ...string) error {
+		calls = append(calls, args)
+		return nil
+	}}
+
+	if err := h.Apply("127.0.0.1:15353", []string{"mesh.test", "preview.test"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Remove(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{"/usr/local/bin/kubectl-localmesh", "dns", "apply", "--name", "backend", "--server", "127.0.0.1:15353", "--domain", "mesh.test", "--domain", "preview.test"},
+		{"/usr/local/bin/kubectl-localmesh", "dns", "remove", "--name", "backend"},
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %+v, want %+v", calls, want)
+	}
+}
@@ -0,0 +1,324 @@
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// ttl は応答のTTL（設定の再読み込みですぐに反映されるよう短くする）
+	ttl = 5
+	// forwardTimeout は転送先1つあたりの問い合わせのタイムアウト
+	forwardTimeout = 2 * time.Second
+	// tcpTimeout はTCP接続で次の問い合わせを待つ時間
+	tcpTimeout = 10 * time.Second
+	// maxUDPSize は受け付けるUDPの問い合わせの最大サイズ
+	maxUDPSize = 4096
+)
+
+// Record is an address a host resolves to. Host is a hostname or a wildcard
+// pattern like "*.preview.localhost".
+type Record struct {
+	Host string
+	Addr netip.Addr
+}
+
+// Server is a DNS server on a loopback address that answers A and AAAA
+// queries for the hosts of the mesh. Queries for other names are forwarded
+// to the upstreams, or answered with NXDOMAIN when there are none or the
+// name is under one of the local domains.
+type Server struct {
+	udp *net.UDPConn
+	tcp net.Listener
+
+	upstreams []string
+	local     []string // 転送しないドメイン（小文字、末尾のドットなし）
+
+	mu      sync.RWMutex
+	records map[string][]netip.Addr // キーは小文字のホスト名またはワイルドカード
+
+	wg sync.WaitGroup
+}
+
+// Listen binds a Server to address (host:port) over UDP and TCP.
+// localDomains are never forwarded, since the upstream may route them back
+// to this server (e.g. systemd-resolved with split DNS).
+func Listen(address string, upstreams, localDomains []string) (*Server, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNS listen address %s: %w", address, err)
+	}
+	udp, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s/udp: %w", address, err)
+	}
+	// ポート0の場合もUDPと同じポートでリスンする
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		_ = udp.Close()
+		return nil, fmt.Errorf("failed to listen on %s/tcp: %w", address, err)
+	}
+
+	var local []string
+	for _, d := range localDomains {
+		local = append(local, normalizeName(d))
+	}
+	return &Server{
+		udp:       udp,
+		tcp:       tcp,
+		upstreams: upstreams,
+		local:     local,
+		records:   map[string][]netip.Addr{},
+	}, nil
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() string {
+	return s.udp.LocalAddr().String()
+}
+
+// SetRecords replaces the records the server answers with.
+func (s *Server) SetRecords(records []Record) {
+	m := map[string][]netip.Addr{}
+	for _, r := range records {
+		name := normalizeName(r.Host)
+		m[name] = append(m[name], r.Addr)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = m
+}
+
+// Serve answers queries until Close is called.
+func (s *Server) Serve() error {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.serveTCP()
+	}()
+	s.serveUDP()
+	return nil
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	err := errors.Join(s.udp.Close(), s.tcp.Close())
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serveUDP() {
+	buf := make([]byte, maxUDPSize)
+	for {
+		n, addr, err := s.udp.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			// closeによる終了
+			return
+		}
+		query := append([]byte(nil), buf[:n]...)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			if resp := s.handle(query); resp != nil {
+				_, _ = s.udp.WriteToUDPAddrPort(resp, addr)
+			}
+		}()
+	}
+}
+
+func (s *Server) serveTCP() {
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			// closeによる終了
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handleTCP(conn)
+		}()
+	}
+}
+
+// handleTCP は、長さを前置したメッセージを接続が閉じられるまで処理する
+func (s *Server) handleTCP(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	for {
+		_ = conn.SetDeadline(time.Now().Add(tcpTimeout))
+		var size uint16
+		if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+			return
+		}
+		query := make([]byte, size)
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+		resp := s.handle(query)
+		if resp == nil {
+			return
+		}
+		if _, err := conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(resp)))); err != nil {
+			return
+		}
+		if _, err := conn.Write(resp); err != nil {
+			return
+		}
+	}
+}
+
+// handle は、問い合わせ1つ分の応答を返す（応答できないメッセージの場合はnil）
+func (s *Server) handle(query []byte) []byte {
+	var p dnsmessage.Parser
+	header, err := p.Start(query)
+	if err != nil || header.Response {
+		return nil
+	}
+	questions, err := p.AllQuestions()
+	if err != nil {
+		return reply(header, nil, dnsmessage.RCodeFormatError, false, nil)
+	}
+	if header.OpCode != 0 {
+		return reply(header, questions, dnsmessage.RCodeNotImplemented, false, nil)
+	}
+	if len(questions) != 1 {
+		return reply(header, questions, dnsmessage.RCodeFormatError, false, nil)
+	}
+
+	q := questions[0]
+	addrs, found := s.lookup(q.Name.String())
+	if found {
+		return reply(header, questions, dnsmessage.RCodeSuccess, true, answers(q, addrs))
+	}
+	if len(s.upstreams) == 0 || s.isLocal(q.Name.String()) {
+		return reply(header, questions, dnsmessage.RCodeNameError, true, nil)
+	}
+	resp, err := s.forward(query)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dns: failed to forward %s: %v\n", q.Name, err)
+		return reply(header, questions, dnsmessage.RCodeServerFailure, false, nil)
+	}
+	return resp
+}
+
+// lookup は、名前のアドレスを返す。
+// Envoyのvirtual hostと同様に完全一致を優先し、次に最も長いワイルドカードに一致させる。
+func (s *Server) lookup(name string) ([]netip.Addr, bool) {
+	name = normalizeName(name)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if addrs, ok := s.records[name]; ok {
+		return addrs, true
+	}
+	for rest := name; ; {
+		i := strings.IndexByte(rest, '.')
+		if i < 0 {
+			return nil, false
+		}
+		rest = rest[i+1:]
+		if addrs, ok := s.records["*."+rest]; ok {
+			return addrs, true
+		}
+	}
+}
+
+// isLocal は、転送しないドメインの名前かを返す
+func (s *Server) isLocal(name string) bool {
+	name = normalizeName(name)
+	for _, d := range s.local {
+		if name == d || strings.HasSuffix(name, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// forward は、問い合わせを転送先に順に送り、最初に得られた応答を返す
+func (s *Server) forward(query []byte) ([]byte, error) {
+	var errs []error
+	for _, upstream := range s.upstreams {
+		resp, err := exchange(upstream, query)
+		if err == nil {
+			return resp, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// exchange は、UDPで問い合わせを送り応答を受け取る
+func exchange(upstream string, query []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("udp", upstream, forwardTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(forwardTimeout))
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, maxUDPSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// answers は、質問の種類に一致するアドレスの応答を返す。
+// 名前は存在するが種類に一致するアドレスがない場合は応答なし（NODATA）となる。
+func answers(q dnsmessage.Question, addrs []netip.Addr) []dnsmessage.Resource {
+	var rrs []dnsmessage.Resource
+	for _, addr := range addrs {
+		h := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: ttl}
+		switch {
+		case addr.Is4() && (q.Type == dnsmessage.TypeA || q.Type == dnsmessage.TypeALL):
+			h.Type = dnsmessage.TypeA
+			rrs = append(rrs, dnsmessage.Resource{Header: h, Body: &dnsmessage.AResource{A: addr.As4()}})
+		case addr.Is6() && (q.Type == dnsmessage.TypeAAAA || q.Type == dnsmessage.TypeALL):
+			h.Type = dnsmessage.TypeAAAA
+			rrs = append(rrs, dnsmessage.Resource{Header: h, Body: &dnsmessage.AAAAResource{AAAA: addr.As16()}})
+		}
+	}
+	return rrs
+}
+
+// reply は、問い合わせへの応答を組み立てる
+func reply(query dnsmessage.Header, questions []dnsmessage.Question, rcode dnsmessage.RCode, authoritative bool, rrs []dnsmessage.Resource) []byte {
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:               query.ID,
+			Response:         true,
+			OpCode:           query.OpCode,
+			Authoritative:    authoritative,
+			RecursionDesired: query.RecursionDesired,
+			RCode:            rcode,
+		},
+		Questions: questions,
+		Answers:   rrs,
+	}
+	resp, err := msg.Pack()
+	if err != nil {
+		return nil
+	}
+	return resp
+}
+
+// normalizeName は、名前を小文字にして末尾のドットを取り除く
+func normalizeName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
@@ -0,0 +1,222 @@
+package dns
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// startServer は、テスト用にランダムなポートでサーバーを起動する
+func startServer(t *testing.T, upstreams, localDomains []string) *Server {
+	t.Helper()
+	s, err := Listen("127.0.0.1:0", upstreams, localDomains)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	go func() { _ = s.Serve() }()
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+// query は、問い合わせのメッセージを返す
+func query(t *testing.T, name string, qtype dnsmessage.Type) []byte {
+	t.Helper()
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: 42, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName(name),
+			Type:  qtype,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	b, err := msg.Pack()
+	if err != nil {
+		t.Fatalf("Pack failed: %v", err)
+	}
+	return b
+}
+
+// exchangeUDP は、UDPで問い合わせて応答を返す
+func exchangeUDP(t *testing.T, addr string, q []byte) dnsmessage.Message {
+	t.Helper()
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+	// 転送のタイムアウトより長く待つ
+	_ = conn.SetDeadline(time.Now().Add(2 * forwardTimeout))
+
+	if _, err := conn.Write(q); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	resp := make([]byte, maxUDPSize)
+	n, err := conn.Read(resp)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	resp = resp[:n]
+	var msg dnsmessage.Message
+	if err := msg.Unpack(resp); err != nil {
+		t.Fatalf("Unpack failed: %v", err)
+	}
+	return msg
+}
+
+// exchangeTCP は、TCPで問い合わせて応答を返す
+func exchangeTCP(t *testing.T, addr string, q []byte) dnsmessage.Message {
+	t.Helper()
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	if _, err := conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(q))), q...)); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	var size uint16
+	if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	resp := make([]byte, size)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	var msg dnsmessage.Message
+	if err := msg.Unpack(resp); err != nil {
+		t.Fatalf("Unpack failed: %v", err)
+	}
+	return msg
+}
+
+// answerAddrs は、応答のA/AAAAのアドレスを返す
+func answerAddrs(msg dnsmessage.Message) []netip.Addr {
+	var addrs []netip.Addr
+	for _, rr := range msg.Answers {
+		switch body := rr.Body.(type) {
+		case *dnsmessage.AResource:
+			addrs = append(addrs, netip.AddrFrom4(body.A))
+		case *dnsmessage.AAAAResource:
+			addrs = append(addrs, netip.AddrFrom16(body.AAAA))
+		}
+	}
+	return addrs
+}
+
+func TestServer_Answers(t *testing.T) {
+	s := startServer(t, nil, nil)
+	s.SetRecords([]Record{
+		{Host: "users-api.localhost", Addr: netip.MustParseAddr("127.0.0.2")},
+		{Host: "users-api.localhost", Addr: netip.MustParseAddr("::1")},
+		{Host: "*.preview.localhost", Addr: netip.MustParseAddr("127.0.0.3")},
+		{Host: "*.pr-1.preview.localhost", Addr: netip.MustParseAddr("127.0.0.4")},
+		{Host: "main.preview.localhost", Addr: netip.MustParseAddr("127.0.0.5")},
+	})
+
+	tests := []struct {
+		name  string
+		qname string
+		qtype dnsmessage.Type
+		rcode dnsmessage.RCode
+		want  []netip.Addr
+	}{
+		{name: "A", qname: "users-api.localhost.", qtype: dnsmessage.TypeA, want: []netip.Addr{netip.MustParseAddr("127.0.0.2")}},
+		{name: "AAAA", qname: "users-api.localhost.", qtype: dnsmessage.TypeAAAA, want: []netip.Addr{netip.MustParseAddr("::1")}},
+		{name: "case insensitive", qname: "Users-API.LocalHost.", qtype: dnsmessage.TypeA, want: []netip.Addr{netip.MustParseAddr("127.0.0.2")}},
+		{name: "wildcard", qname: "feature-x.preview.localhost.", qtype: dnsmessage.TypeA, want: []netip.Addr{netip.MustParseAddr("127.0.0.3")}},
+		{name: "wildcard deeper", qname: "a.b.preview.localhost.", qtype: dnsmessage.TypeA, want: []netip.Addr{netip.MustParseAddr("127.0.0.3")}},
+		{name: "longest wildcard", qname: "web.pr-1.preview.localhost.", qtype: dnsmessage.TypeA, want: []netip.Addr{netip.MustParseAddr("127.0.0.4")}},
+		{name: "exact over wildcard", qname: "main.preview.localhost.", qtype: dnsmessage.TypeA, want: []netip.Addr{netip.MustParseAddr("127.0.0.5")}},
+		{name: "wildcard does not match the domain itself", qname: "preview.localhost.", qtype: dnsmessage.TypeA, rcode: dnsmessage.RCodeNameError},
+		{name: "no data", qname: "feature-x.preview.localhost.", qtype: dnsmessage.TypeAAAA},
+		{name: "unknown name without upstreams", qname: "example.com.", qtype: dnsmessage.TypeA, rcode: dnsmessage.RCodeNameError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for proto, exchange := range map[string]func(*testing.T, string, []byte) dnsmessage.Message{
+				"udp": exchangeUDP,
+				"tcp": exchangeTCP,
+			} {
+				msg := exchange(t, s.Addr(), query(t, tt.qname, tt.qtype))
+				if msg.ID != 42 || !msg.Response {
+					t.Errorf("%s: header = %+v, want a response with ID 42", proto, msg.Header)
+				}
+				if msg.RCode != tt.rcode {
+					t.Errorf("%s: rcode = %v, want %v", proto, msg.RCode, tt.rcode)
+				}
+				if got := answerAddrs(msg); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("%s: answers = %v, want %v", proto, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_SetRecordsReplaces(t *testing.T) {
+	s := startServer(t, nil, nil)
+	s.SetRecords([]Record{{Host: "old.localhost", Addr: netip.MustParseAddr("127.0.0.2")}})
+	s.SetRecords([]Record{{Host: "new.localhost", Addr: netip.MustParseAddr("127.0.0.3")}})
+
+	if msg := exchangeUDP(t, s.Addr(), query(t, "old.localhost.", dnsmessage.TypeA)); msg.RCode != dnsmessage.RCodeNameError {
+		t.Errorf("old.localhost rcode = %v, want NXDOMAIN", msg.RCode)
+	}
+	if msg := exchangeUDP(t, s.Addr(), query(t, "new.localhost.", dnsmessage.TypeA)); len(msg.Answers) != 1 {
+		t.Errorf("new.localhost answers = %v, want 1", msg.Answers)
+	}
+}
+
+func TestServer_Forward(t *testing.T) {
+	// 転送先はexample.comに192.0.2.1を返すサーバー
+	upstream := startServer(t, nil, nil)
+	upstream.SetRecords([]Record{{Host: "example.com", Addr: netip.MustParseAddr("192.0.2.1")}})
+
+	s := startServer(t, []string{upstream.Addr()}, []string{"mesh.test"})
+	s.SetRecords([]Record{{Host: "web.mesh.test", Addr: netip.MustParseAddr("127.0.0.2")}})
+
+	tests := []struct {
+		name  string
+		qname string
+		rcode dnsmessage.RCode
+		want  []netip.Addr
+	}{
+		{name: "local", qname: "web.mesh.test.", want: []netip.Addr{netip.MustParseAddr("127.0.0.2")}},
+		{name: "forwarded", qname: "example.com.", want: []netip.Addr{netip.MustParseAddr("192.0.2.1")}},
+		{name: "forwarded nxdomain", qname: "missing.example.com.", rcode: dnsmessage.RCodeNameError},
+		{name: "local domain is not forwarded", qname: "other.mesh.test.", rcode: dnsmessage.RCodeNameError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := exchangeUDP(t, s.Addr(), query(t, tt.qname, dnsmessage.TypeA))
+			if msg.RCode != tt.rcode {
+				t.Errorf("rcode = %v, want %v", msg.RCode, tt.rcode)
+			}
+			if got := answerAddrs(msg); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("answers = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_ForwardFailure(t *testing.T) {
+	// 応答しない転送先
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket failed: %v", err)
+	}
+	defer func() { _ = silent.Close() }()
+
+	s := startServer(t, []string{silent.LocalAddr().String()}, nil)
+	msg := exchangeUDP(t, s.Addr(), query(t, "example.com.", dnsmessage.TypeA))
+	if msg.RCode != dnsmessage.RCodeServerFailure {
+		t.Errorf("rcode = %v, want SERVFAIL", msg.RCode)
+	}
+}
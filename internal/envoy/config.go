@@ -1,14 +1,323 @@
 package envoy
 
+import "strings"
+
 type Route struct {
 	Host        string
 	LocalPort   int
 	ClusterName string
 	Type        string // "http" or "tcp"
 	ListenPort  int    // TCP用のリスンポート（Type="tcp"の場合のみ使用）
+	// ListenAddress はTCPリスナーのアドレス（Type="tcp"の場合のみ使用。空の場合は0.0.0.0）
+	ListenAddress string
+	// UpstreamProtocol はupstreamへのHTTPプロトコル
+	// （"http1", "h2c", "auto", "http1-tls", "h2-tls", "auto-tls"。空の場合はTypeから決定）
+	UpstreamProtocol string
+	UpstreamSNI      string // TLSでupstreamへ接続する場合のSNI
+	// Paths はホスト内のパス・ヘッダーによる振り分け（記述順に評価し、
+	// いずれにも一致しないリクエストはこのルートのクラスタへ転送する）
+	Paths []PathRoute
+
+	// このルートのクラスタへ転送するリクエストの書き換え
+	HostRewrite   string
+	PrefixRewrite string
+	// ホスト内のすべてのリクエスト・レスポンスに対するヘッダーの追加（上書き）と削除
+	RequestHeadersToAdd     []HeaderValue
+	RequestHeadersToRemove  []string
+	ResponseHeadersToAdd    []HeaderValue
+	ResponseHeadersToRemove []string
+}
+
+// HeaderValue は追加するヘッダー
+type HeaderValue struct {
+	Name  string
+	Value string
+}
+
+// PathRoute はホスト内でパス・ヘッダーに一致したリクエストの転送先
+type PathRoute struct {
+	Prefix  string
+	Path    string // 完全一致
+	Regex   string // パス全体に一致する正規表現
+	Headers []HeaderMatch
+
+	LocalPort        int
+	ClusterName      string
+	UpstreamProtocol string
+	UpstreamSNI      string
+}
+
+// HeaderMatch はリクエストヘッダーの条件（Exact/Prefix/Regexが空の場合は存在のみ判定）
+type HeaderMatch struct {
+	Name   string
+	Exact  string
+	Prefix string
+	Regex  string
+}
+
+// Backends returns the route itself followed by PathBackend for each path
+// route. Targets sharing a cluster name are returned once.
+func (r Route) Backends() []Route {
+	backends := []Route{r}
+	seen := map[string]bool{r.ClusterName: true}
+	for _, p := range r.Paths {
+		if seen[p.ClusterName] {
+			continue
+		}
+		seen[p.ClusterName] = true
+		backends = append(backends, r.PathBackend(p))
+	}
+	return backends
+}
+
+// PathBackend returns the target of the path route p as a route with the
+// host, type and header manipulation of r. Host and prefix rewrites only apply
+// to r itself and are not inherited.
+func (r Route) PathBackend(p PathRoute) Route {
+	return Route{
+		Host:             r.Host,
+		LocalPort:        p.LocalPort,
+		ClusterName:      p.ClusterName,
+		Type:             r.Type,
+		UpstreamProtocol: p.UpstreamProtocol,
+		UpstreamSNI:      p.UpstreamSNI,
+		// ヘッダー操作はホスト単位のため転送先でも同じ
+		RequestHeadersToAdd:     r.RequestHeadersToAdd,
+		RequestHeadersToRemove:  r.RequestHeadersToRemove,
+		ResponseHeadersToAdd:    r.ResponseHeadersToAdd,
+		ResponseHeadersToRemove: r.ResponseHeadersToRemove,
+	}
+}
+
+// EffectiveUpstreamProtocol returns the upstream HTTP protocol of the route.
+// When UpstreamProtocol is empty, gRPC routes use h2c and HTTP routes HTTP/1.1.
+func (r Route) EffectiveUpstreamProtocol() string {
+	if r.UpstreamProtocol != "" {
+		return r.UpstreamProtocol
+	}
+	if r.Type == "grpc" {
+		return "h2c"
+	}
+	return "http1"
 }
 
-func BuildConfig(listenerPort int, routes []Route) map[string]any {
+// UpstreamTLS reports whether the route connects to its upstream over TLS.
+func (r Route) UpstreamTLS() bool {
+	return strings.HasSuffix(r.EffectiveUpstreamProtocol(), "-tls")
+}
+
+// TLSListener はローカルCAの証明書でTLS終端するリスナーの設定
+type TLSListener struct {
+	Port  int
+	Certs []HostCert // ホストごとのサーバー証明書（SNIで選択される）
+}
+
+// HostCert はホスト1つ分のサーバー証明書と秘密鍵のファイル
+type HostCert struct {
+	Host     string
+	CertFile string
+	KeyFile  string
+}
+
+// addUpstreamProtocolOptions は、クラスタにupstreamのHTTPプロトコルとTLSの設定を追加する
+func addUpstreamProtocolOptions(cluster map[string]any, r Route) {
+	options := map[string]any{
+		"@type": "type.googleapis.com/envoy.extensions.upstreams.http.v3.HttpProtocolOptions",
+	}
+	var alpn []any
+
+	switch r.EffectiveUpstreamProtocol() {
+	case "h2c":
+		options["explicit_http_config"] = map[string]any{"http2_protocol_options": map[string]any{}}
+	case "h2-tls":
+		options["explicit_http_config"] = map[string]any{"http2_protocol_options": map[string]any{}}
+		alpn = []any{"h2"}
+	case "auto":
+		// 平文ではALPNが使えないため、クライアントと同じプロトコルで接続する
+		options["use_downstream_protocol_config"] = map[string]any{
+			"http_protocol_options":  map[string]any{},
+			"http2_protocol_options": map[string]any{},
+		}
+	case "auto-tls":
+		options["auto_config"] = map[string]any{
+			"http_protocol_options":  map[string]any{},
+			"http2_protocol_options": map[string]any{},
+		}
+		alpn = []any{"h2", "http/1.1"}
+	case "http1-tls":
+		options["explicit_http_config"] = map[string]any{"http_protocol_options": map[string]any{}}
+		alpn = []any{"http/1.1"}
+	default:
+		options["explicit_http_config"] = map[string]any{"http_protocol_options": map[string]any{}}
+	}
+
+	cluster["typed_extension_protocol_options"] = map[string]any{
+		"envoy.extensions.upstreams.http.v3.HttpProtocolOptions": options,
+	}
+
+	if r.UpstreamTLS() {
+		// port-forward先はクラスタ内の証明書を使うため検証は行わない
+		tlsContext := map[string]any{
+			"@type": "type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.UpstreamTlsContext",
+			"common_tls_context": map[string]any{
+				"alpn_protocols": alpn,
+			},
+		}
+		if r.UpstreamSNI != "" {
+			tlsContext["sni"] = r.UpstreamSNI
+		}
+		cluster["transport_socket"] = map[string]any{
+			"name":         "envoy.transport_sockets.tls",
+			"typed_config": tlsContext,
+		}
+	}
+}
+
+// buildCluster は、ルート1つ分のクラスタを生成する
+func buildCluster(r Route) map[string]any {
+	cluster := map[string]any{
+		"name":            r.ClusterName,
+		"type":            "STATIC",
+		"connect_timeout": "1s",
+		"load_assignment": map[string]any{
+			"cluster_name": r.ClusterName,
+			"endpoints": []any{
+				map[string]any{
+					"lb_endpoints": []any{
+						map[string]any{
+							"endpoint": map[string]any{
+								"address": map[string]any{
+									"socket_address": map[string]any{
+										"address":    "127.0.0.1",
+										"port_value": r.LocalPort,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	// HTTP/gRPCの場合はupstreamのプロトコルに応じたオプションを追加
+	if r.Type != "tcp" {
+		addUpstreamProtocolOptions(cluster, r)
+	}
+	return cluster
+}
+
+// buildVirtualHost は、ホスト1つ分のvirtual hostを生成する
+func buildVirtualHost(r Route) map[string]any {
+	vhost := map[string]any{
+		"name":    r.ClusterName,
+		"domains": []any{r.Host},
+		"routes":  buildVirtualHostRoutes(r),
+	}
+	if len(r.RequestHeadersToAdd) > 0 {
+		vhost["request_headers_to_add"] = buildHeaderValueOptions(r.RequestHeadersToAdd)
+	}
+	if len(r.RequestHeadersToRemove) > 0 {
+		vhost["request_headers_to_remove"] = toAnySlice(r.RequestHeadersToRemove)
+	}
+	if len(r.ResponseHeadersToAdd) > 0 {
+		vhost["response_headers_to_add"] = buildHeaderValueOptions(r.ResponseHeadersToAdd)
+	}
+	if len(r.ResponseHeadersToRemove) > 0 {
+		vhost["response_headers_to_remove"] = toAnySlice(r.ResponseHeadersToRemove)
+	}
+	return vhost
+}
+
+// buildHeaderValueOptions は、追加するヘッダーをEnvoyのHeaderValueOptionに変換する（既存の値は上書き）
+func buildHeaderValueOptions(headers []HeaderValue) []any {
+	var options []any
+	for _, h := range headers {
+		options = append(options, map[string]any{
+			"header":        map[string]any{"key": h.Name, "value": h.Value},
+			"append_action": "OVERWRITE_IF_EXISTS_OR_ADD",
+		})
+	}
+	return options
+}
+
+func toAnySlice(values []string) []any {
+	out := make([]any, 0, len(values))
+	for _, v := range values {
+		out = append(out, v)
+	}
+	return out
+}
+
+// buildVirtualHostRoutes は、virtual hostのルートを評価順に生成する。
+// パスごとの振り分けを先に並べ、最後にすべてのリクエストに一致するルートを置く。
+func buildVirtualHostRoutes(r Route) []any {
+	var routes []any
+	for _, p := range r.Paths {
+		routes = append(routes, map[string]any{
+			"match": buildRouteMatch(p),
+			"route": map[string]any{
+				"cluster": p.ClusterName,
+				"timeout": "0s",
+			},
+		})
+	}
+	action := map[string]any{
+		"cluster": r.ClusterName,
+		"timeout": "0s",
+	}
+	if r.HostRewrite != "" {
+		action["host_rewrite_literal"] = r.HostRewrite
+	}
+	if r.PrefixRewrite != "" {
+		action["prefix_rewrite"] = r.PrefixRewrite
+	}
+	return append(routes, map[string]any{
+		"match": map[string]any{"prefix": "/"},
+		"route": action,
+	})
+}
+
+// buildRouteMatch は、PathRouteの条件をEnvoyのRouteMatchに変換する
+func buildRouteMatch(p PathRoute) map[string]any {
+	match := map[string]any{}
+	switch {
+	case p.Path != "":
+		match["path"] = p.Path
+	case p.Regex != "":
+		match["safe_regex"] = map[string]any{"regex": p.Regex}
+	case p.Prefix != "":
+		match["prefix"] = p.Prefix
+	default:
+		// ヘッダーのみで判定する
+		match["prefix"] = "/"
+	}
+
+	if len(p.Headers) > 0 {
+		var headers []any
+		for _, h := range p.Headers {
+			header := map[string]any{"name": h.Name}
+			switch {
+			case h.Exact != "":
+				header["string_match"] = map[string]any{"exact": h.Exact}
+			case h.Prefix != "":
+				header["string_match"] = map[string]any{"prefix": h.Prefix}
+			case h.Regex != "":
+				header["string_match"] = map[string]any{"safe_regex": map[string]any{"regex": h.Regex}}
+			default:
+				header["present_match"] = true
+			}
+			headers = append(headers, header)
+		}
+		match["headers"] = headers
+	}
+	return match
+}
+
+// BuildConfig builds a static Envoy config for routes. When tls is not nil, an
+// additional TLS listener serving the HTTP routes is generated with one filter
+// chain per certificate, selected by SNI.
+func BuildConfig(listenerPort int, routes []Route, tls *TLSListener) map[string]any {
 	var clusters []any
 	var vhosts []any
 	var listeners []any
@@ -26,64 +335,23 @@ func BuildConfig(listenerPort int, routes []Route) map[string]any {
 		}
 	}
 
-	// すべてのルート用のクラスタを生成
+	// すべてのルート（パスごとの転送先を含む）用のクラスタを生成
+	// 複数のホストやroutesが同じService・ポートを参照する場合は、最初の定義のクラスタを共有する
+	seenClusters := map[string]bool{}
 	for _, r := range routes {
-		cluster := map[string]any{
-			"name":            r.ClusterName,
-			"type":            "STATIC",
-			"connect_timeout": "1s",
-			"load_assignment": map[string]any{
-				"cluster_name": r.ClusterName,
-				"endpoints": []any{
-					map[string]any{
-						"lb_endpoints": []any{
-							map[string]any{
-								"endpoint": map[string]any{
-									"address": map[string]any{
-										"socket_address": map[string]any{
-											"address":    "127.0.0.1",
-											"port_value": r.LocalPort,
-										},
-									},
-								},
-							},
-						},
-					},
-				},
-			},
-		}
-
-		// HTTP/gRPCの場合はHTTP/2プロトコルオプションを追加
-		if r.Type != "tcp" {
-			cluster["typed_extension_protocol_options"] = map[string]any{
-				"envoy.extensions.upstreams.http.v3.HttpProtocolOptions": map[string]any{
-					"@type": "type.googleapis.com/envoy.extensions.upstreams.http.v3.HttpProtocolOptions",
-					"explicit_http_config": map[string]any{
-						"http2_protocol_options": map[string]any{},
-					},
-				},
+		for _, b := range r.Backends() {
+			if seenClusters[b.ClusterName] {
+				continue
 			}
+			seenClusters[b.ClusterName] = true
+			clusters = append(clusters, buildCluster(b))
 		}
-
-		clusters = append(clusters, cluster)
 	}
 
 	// HTTPリスナーの生成（HTTPルートが存在する場合）
 	if len(httpRoutes) > 0 {
 		for _, r := range httpRoutes {
-			vhosts = append(vhosts, map[string]any{
-				"name":    r.ClusterName,
-				"domains": []any{r.Host},
-				"routes": []any{
-					map[string]any{
-						"match": map[string]any{"prefix": "/"},
-						"route": map[string]any{
-							"cluster": r.ClusterName,
-							"timeout": "0s",
-						},
-					},
-				},
-			})
+			vhosts = append(vhosts, buildVirtualHost(r))
 		}
 
 		httpListener := map[string]any{
@@ -97,32 +365,17 @@ func BuildConfig(listenerPort int, routes []Route) map[string]any {
 			"filter_chains": []any{
 				map[string]any{
 					"filters": []any{
-						map[string]any{
-							"name": "envoy.filters.network.http_connection_manager",
-							"typed_config": map[string]any{
-								"@type":                  "type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager",
-								"stat_prefix":            "ingress_http",
-								"codec_type":             "AUTO",
-								"http2_protocol_options": map[string]any{},
-								"route_config": map[string]any{
-									"name":          "local_route",
-									"virtual_hosts": vhosts,
-								},
-								"http_filters": []any{
-									map[string]any{
-										"name": "envoy.filters.http.router",
-										"typed_config": map[string]any{
-											"@type": "type.googleapis.com/envoy.extensions.filters.http.router.v3.Router",
-										},
-									},
-								},
-							},
-						},
+						httpConnectionManager("ingress_http", vhosts),
 					},
 				},
 			},
 		}
 		listeners = append(listeners, httpListener)
+
+		// TLSリスナーの生成（証明書ごとにSNIで選択されるフィルタチェーン）
+		if tls != nil && len(tls.Certs) > 0 {
+			listeners = append(listeners, buildTLSListener(tls, vhosts))
+		}
 	}
 
 	// TCPリスナーの生成（TCPルートごとに独立したリスナー）
@@ -131,7 +384,7 @@ func BuildConfig(listenerPort int, routes []Route) map[string]any {
 			"name": "listener_tcp_" + r.ClusterName,
 			"address": map[string]any{
 				"socket_address": map[string]any{
-					"address":    "0.0.0.0",
+					"address":    r.TCPListenAddress(),
 					"port_value": r.ListenPort,
 				},
 			},
@@ -160,3 +413,87 @@ func BuildConfig(listenerPort int, routes []Route) map[string]any {
 		},
 	}
 }
+
+// TCPListenAddress returns the address the TCP listener of the route binds to.
+func (r Route) TCPListenAddress() string {
+	if r.ListenAddress != "" {
+		return r.ListenAddress
+	}
+	return "0.0.0.0"
+}
+
+// httpConnectionManager は、vhostsでルーティングするHTTP connection managerフィルタを生成する
+func httpConnectionManager(statPrefix string, vhosts []any) map[string]any {
+	return map[string]any{
+		"name": "envoy.filters.network.http_connection_manager",
+		"typed_config": map[string]any{
+			"@type":                  "type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager",
+			"stat_prefix":            statPrefix,
+			"codec_type":             "AUTO",
+			"http2_protocol_options": map[string]any{},
+			"route_config": map[string]any{
+				"name":          "local_route",
+				"virtual_hosts": vhosts,
+			},
+			"http_filters": []any{
+				map[string]any{
+					"name": "envoy.filters.http.router",
+					"typed_config": map[string]any{
+						"@type": "type.googleapis.com/envoy.extensions.filters.http.router.v3.Router",
+					},
+				},
+			},
+		},
+	}
+}
+
+// buildTLSListener は、HTTPリスナーと同じルートをTLSで提供するリスナーを生成する
+func buildTLSListener(tls *TLSListener, vhosts []any) map[string]any {
+	var filterChains []any
+	for _, c := range tls.Certs {
+		filterChains = append(filterChains, map[string]any{
+			"filter_chain_match": map[string]any{
+				"server_names": []any{c.Host},
+			},
+			"transport_socket": map[string]any{
+				"name": "envoy.transport_sockets.tls",
+				"typed_config": map[string]any{
+					"@type": "type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.DownstreamTlsContext",
+					"common_tls_context": map[string]any{
+						// HTTP/2（gRPC）とHTTP/1.1をALPNで選択する
+						"alpn_protocols": []any{"h2", "http/1.1"},
+						"tls_certificates": []any{
+							map[string]any{
+								"certificate_chain": map[string]any{"filename": c.CertFile},
+								"private_key":       map[string]any{"filename": c.KeyFile},
+							},
+						},
+					},
+				},
+			},
+			"filters": []any{
+				httpConnectionManager("ingress_https", vhosts),
+			},
+		})
+	}
+
+	return map[string]any{
+		"name": "listener_https",
+		"address": map[string]any{
+			"socket_address": map[string]any{
+				"address":    "0.0.0.0",
+				"port_value": tls.Port,
+			},
+		},
+		// SNIでフィルタチェーンを選択するためにClientHelloを検査する
+		"listener_filters": []any{
+			map[string]any{
+				"name": "envoy.filters.listener.tls_inspector",
+				"typed_config": map[string]any{
+					"@type": "type.googleapis.com/envoy.extensions.filters.listener.tls_inspector.v3.TlsInspector",
+				},
+			},
+		},
+		"filter_chains": filterChains,
+	}
+}
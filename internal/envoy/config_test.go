@@ -1,6 +1,7 @@
 package envoy
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -15,7 +16,7 @@ func TestBuildConfig_HTTPOnly(t *testing.T) {
 		},
 	}
 
-	cfg := BuildConfig(80, routes)
+	cfg := BuildConfig(80, routes, nil)
 
 	// static_resourcesの存在確認
 	staticRes, ok := cfg["static_resources"].(map[string]any)
@@ -44,6 +45,325 @@ func TestBuildConfig_HTTPOnly(t *testing.T) {
 	}
 }
 
+func TestBuildConfig_UpstreamProtocol(t *testing.T) {
+	tests := []struct {
+		name       string
+		route      Route
+		wantOption string // HttpProtocolOptionsのキー
+		wantHTTP1  bool
+		wantHTTP2  bool
+		wantALPN   []any // nilの場合はtransport_socketなし
+		wantSNI    string
+	}{
+		{name: "httpのデフォルト", route: Route{Type: "http"}, wantOption: "explicit_http_config", wantHTTP1: true},
+		{name: "grpcのデフォルト", route: Route{Type: "grpc"}, wantOption: "explicit_http_config", wantHTTP2: true},
+		{name: "http1", route: Route{Type: "grpc", UpstreamProtocol: "http1"}, wantOption: "explicit_http_config", wantHTTP1: true},
+		{name: "h2c", route: Route{Type: "http", UpstreamProtocol: "h2c"}, wantOption: "explicit_http_config", wantHTTP2: true},
+		{name: "auto", route: Route{Type: "http", UpstreamProtocol: "auto"}, wantOption: "use_downstream_protocol_config", wantHTTP1: true, wantHTTP2: true},
+		{
+			name:       "http1-tls",
+			route:      Route{Type: "http", UpstreamProtocol: "http1-tls", UpstreamSNI: "api.default.svc"},
+			wantOption: "explicit_http_config", wantHTTP1: true,
+			wantALPN: []any{"http/1.1"}, wantSNI: "api.default.svc",
+		},
+		{
+			name:       "h2-tls",
+			route:      Route{Type: "grpc", UpstreamProtocol: "h2-tls", UpstreamSNI: "api.default.svc"},
+			wantOption: "explicit_http_config", wantHTTP2: true,
+			wantALPN: []any{"h2"}, wantSNI: "api.default.svc",
+		},
+		{
+			name:       "auto-tls",
+			route:      Route{Type: "http", UpstreamProtocol: "auto-tls"},
+			wantOption: "auto_config", wantHTTP1: true, wantHTTP2: true,
+			wantALPN: []any{"h2", "http/1.1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.route.Host = "api.localhost"
+			tt.route.LocalPort = 10001
+			tt.route.ClusterName = "api_cluster"
+
+			cfg := BuildConfig(80, []Route{tt.route}, nil)
+			cluster := cfg["static_resources"].(map[string]any)["clusters"].([]any)[0].(map[string]any)
+
+			options := cluster["typed_extension_protocol_options"].(map[string]any)["envoy.extensions.upstreams.http.v3.HttpProtocolOptions"].(map[string]any)
+			protocolConfig, ok := options[tt.wantOption].(map[string]any)
+			if !ok {
+				t.Fatalf("expected %s, got %v", tt.wantOption, options)
+			}
+			if _, ok := protocolConfig["http_protocol_options"]; ok != tt.wantHTTP1 {
+				t.Errorf("http_protocol_options: expected %v, got %v", tt.wantHTTP1, ok)
+			}
+			if _, ok := protocolConfig["http2_protocol_options"]; ok != tt.wantHTTP2 {
+				t.Errorf("http2_protocol_options: expected %v, got %v", tt.wantHTTP2, ok)
+			}
+
+			socket, ok := cluster["transport_socket"].(map[string]any)
+			if tt.wantALPN == nil {
+				if ok {
+					t.Errorf("expected no transport_socket, got %v", socket)
+				}
+				return
+			}
+			if !ok {
+				t.Fatal("expected transport_socket")
+			}
+			tlsContext := socket["typed_config"].(map[string]any)
+			alpn := tlsContext["common_tls_context"].(map[string]any)["alpn_protocols"]
+			if !reflect.DeepEqual(alpn, tt.wantALPN) {
+				t.Errorf("expected alpn_protocols %v, got %v", tt.wantALPN, alpn)
+			}
+			if sni, _ := tlsContext["sni"].(string); sni != tt.wantSNI {
+				t.Errorf("expected sni %q, got %q", tt.wantSNI, sni)
+			}
+		})
+	}
+}
+
+func TestBuildConfig_PathRoutes(t *testing.T) {
+	routes := []Route{
+		{
+			Host:        "app.localhost",
+			LocalPort:   10001,
+			ClusterName: "default_web_8080",
+			Type:        "http",
+			Paths: []PathRoute{
+				{Prefix: "/api", LocalPort: 10002, ClusterName: "default_api_8080"},
+				{Path: "/healthz", LocalPort: 10001, ClusterName: "default_web_8080"},
+				{Regex: "/v[0-9]+/.*", LocalPort: 10002, ClusterName: "default_api_8080"},
+				{
+					LocalPort: 10003, ClusterName: "default_canary_8080",
+					Headers: []HeaderMatch{
+						{Name: "x-canary"},
+						{Name: "x-version", Exact: "2"},
+						{Name: "user-agent", Prefix: "curl/"},
+						{Name: "x-tenant", Regex: "team-.*"},
+					},
+				},
+			},
+		},
+	}
+
+	cfg := BuildConfig(80, routes, nil)
+	staticRes := cfg["static_resources"].(map[string]any)
+
+	// 転送先ごとにクラスタが1つ生成される
+	var clusterNames []string
+	for _, c := range staticRes["clusters"].([]any) {
+		clusterNames = append(clusterNames, c.(map[string]any)["name"].(string))
+	}
+	wantClusters := []string{"default_web_8080", "default_api_8080", "default_canary_8080"}
+	if !reflect.DeepEqual(clusterNames, wantClusters) {
+		t.Errorf("expected clusters %v, got %v", wantClusters, clusterNames)
+	}
+
+	listener := staticRes["listeners"].([]any)[0].(map[string]any)
+	hcm := listener["filter_chains"].([]any)[0].(map[string]any)["filters"].([]any)[0].(map[string]any)["typed_config"].(map[string]any)
+	vhosts := hcm["route_config"].(map[string]any)["virtual_hosts"].([]any)
+	if len(vhosts) != 1 {
+		t.Fatalf("expected 1 virtual host, got %d", len(vhosts))
+	}
+	vhostRoutes := vhosts[0].(map[string]any)["routes"].([]any)
+
+	tests := []struct {
+		name        string
+		wantMatch   map[string]any
+		wantCluster string
+	}{
+		{"prefix", map[string]any{"prefix": "/api"}, "default_api_8080"},
+		{"path", map[string]any{"path": "/healthz"}, "default_web_8080"},
+		{"regex", map[string]any{"safe_regex": map[string]any{"regex": "/v[0-9]+/.*"}}, "default_api_8080"},
+		{
+			"headers",
+			map[string]any{
+				"prefix": "/",
+				"headers": []any{
+					map[string]any{"name": "x-canary", "present_match": true},
+					map[string]any{"name": "x-version", "string_match": map[string]any{"exact": "2"}},
+					map[string]any{"name": "user-agent", "string_match": map[string]any{"prefix": "curl/"}},
+					map[string]any{"name": "x-tenant", "string_match": map[string]any{"safe_regex": map[string]any{"regex": "team-.*"}}},
+				},
+			},
+			"default_canary_8080",
+		},
+		// いずれにも一致しないリクエストはサービス自身へ転送される
+		{"default", map[string]any{"prefix": "/"}, "default_web_8080"},
+	}
+
+	if len(vhostRoutes) != len(tests) {
+		t.Fatalf("expected %d routes, got %d", len(tests), len(vhostRoutes))
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := vhostRoutes[i].(map[string]any)
+			if !reflect.DeepEqual(route["match"], tt.wantMatch) {
+				t.Errorf("expected match %v, got %v", tt.wantMatch, route["match"])
+			}
+			if cluster := route["route"].(map[string]any)["cluster"]; cluster != tt.wantCluster {
+				t.Errorf("expected cluster %s, got %v", tt.wantCluster, cluster)
+			}
+		})
+	}
+}
+
+func TestBuildConfig_SharedClusters(t *testing.T) {
+	// auth.localhost自身の転送先をapp.localhostとadmin.localhostのroutesも参照する
+	routes := []Route{
+		{Host: "auth.localhost", LocalPort: 10001, ClusterName: "default_auth_80", Type: "http"},
+		{
+			Host: "app.localhost", LocalPort: 10002, ClusterName: "default_web_8080", Type: "http",
+			Paths: []PathRoute{
+				{Prefix: "/auth", LocalPort: 10001, ClusterName: "default_auth_80"},
+				{Prefix: "/api", LocalPort: 10003, ClusterName: "default_api_8080"},
+			},
+		},
+		{
+			Host: "admin.localhost", LocalPort: 10004, ClusterName: "default_admin_8080", Type: "http",
+			Paths: []PathRoute{
+				{Prefix: "/auth", LocalPort: 10001, ClusterName: "default_auth_80"},
+				{Prefix: "/api", LocalPort: 10003, ClusterName: "default_api_8080"},
+			},
+		},
+	}
+
+	// Envoyは同じ名前のクラスタを拒否するため、クラスタは名前ごとに1つだけ生成される
+	wantClusters := []string{"default_auth_80", "default_web_8080", "default_api_8080", "default_admin_8080"}
+
+	cfg := BuildConfig(80, routes, nil)
+	var clusterNames []string
+	for _, c := range cfg["static_resources"].(map[string]any)["clusters"].([]any) {
+		clusterNames = append(clusterNames, c.(map[string]any)["name"].(string))
+	}
+	if !reflect.DeepEqual(clusterNames, wantClusters) {
+		t.Errorf("expected clusters %v, got %v", wantClusters, clusterNames)
+	}
+
+	_, cds, _ := BuildDynamicResources(cfg, NewDynamicPaths("/tmp/mesh"))
+	clusterNames = nil
+	for _, c := range cds["resources"].([]any) {
+		clusterNames = append(clusterNames, c.(map[string]any)["name"].(string))
+	}
+	if !reflect.DeepEqual(clusterNames, wantClusters) {
+		t.Errorf("expected CDS clusters %v, got %v", wantClusters, clusterNames)
+	}
+}
+
+func TestBuildConfig_Rewrites(t *testing.T) {
+	tests := []struct {
+		name        string
+		route       Route
+		wantAction  map[string]any // サービス自身へのルートのアクション
+		wantVHost   map[string]any // virtual hostに追加されるキー
+		wantNoVHost []string       // virtual hostに存在しないキー
+	}{
+		{
+			name:        "書き換えなし",
+			route:       Route{},
+			wantAction:  map[string]any{"cluster": "api_cluster", "timeout": "0s"},
+			wantNoVHost: []string{"request_headers_to_add", "request_headers_to_remove", "response_headers_to_add", "response_headers_to_remove"},
+		},
+		{
+			name:  "host_rewrite",
+			route: Route{HostRewrite: "users-api.users.svc.cluster.local"},
+			wantAction: map[string]any{
+				"cluster": "api_cluster", "timeout": "0s",
+				"host_rewrite_literal": "users-api.users.svc.cluster.local",
+			},
+		},
+		{
+			name:       "prefix_rewrite",
+			route:      Route{PrefixRewrite: "/users/"},
+			wantAction: map[string]any{"cluster": "api_cluster", "timeout": "0s", "prefix_rewrite": "/users/"},
+		},
+		{
+			name: "リクエストヘッダー",
+			route: Route{
+				RequestHeadersToAdd:    []HeaderValue{{Name: "x-env", Value: "local"}, {Name: "authorization", Value: "Bearer dev"}},
+				RequestHeadersToRemove: []string{"cookie"},
+			},
+			wantAction: map[string]any{"cluster": "api_cluster", "timeout": "0s"},
+			wantVHost: map[string]any{
+				"request_headers_to_add": []any{
+					map[string]any{"header": map[string]any{"key": "x-env", "value": "local"}, "append_action": "OVERWRITE_IF_EXISTS_OR_ADD"},
+					map[string]any{"header": map[string]any{"key": "authorization", "value": "Bearer dev"}, "append_action": "OVERWRITE_IF_EXISTS_OR_ADD"},
+				},
+				"request_headers_to_remove": []any{"cookie"},
+			},
+			wantNoVHost: []string{"response_headers_to_add", "response_headers_to_remove"},
+		},
+		{
+			name: "レスポンスヘッダー",
+			route: Route{
+				ResponseHeadersToAdd:    []HeaderValue{{Name: "access-control-allow-origin", Value: "*"}},
+				ResponseHeadersToRemove: []string{"server", "x-powered-by"},
+			},
+			wantAction: map[string]any{"cluster": "api_cluster", "timeout": "0s"},
+			wantVHost: map[string]any{
+				"response_headers_to_add": []any{
+					map[string]any{"header": map[string]any{"key": "access-control-allow-origin", "value": "*"}, "append_action": "OVERWRITE_IF_EXISTS_OR_ADD"},
+				},
+				"response_headers_to_remove": []any{"server", "x-powered-by"},
+			},
+			wantNoVHost: []string{"request_headers_to_add", "request_headers_to_remove"},
+		},
+		{
+			name: "パスごとの振り分けには書き換えを適用しない",
+			route: Route{
+				HostRewrite:   "web.internal",
+				PrefixRewrite: "/web/",
+				Paths:         []PathRoute{{Prefix: "/api", LocalPort: 10002, ClusterName: "api_cluster"}},
+			},
+			wantAction: map[string]any{
+				"cluster": "api_cluster", "timeout": "0s",
+				"host_rewrite_literal": "web.internal", "prefix_rewrite": "/web/",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.route.Host = "api.localhost"
+			tt.route.LocalPort = 10001
+			tt.route.ClusterName = "api_cluster"
+			tt.route.Type = "http"
+
+			cfg := BuildConfig(80, []Route{tt.route}, nil)
+			listener := cfg["static_resources"].(map[string]any)["listeners"].([]any)[0].(map[string]any)
+			hcm := listener["filter_chains"].([]any)[0].(map[string]any)["filters"].([]any)[0].(map[string]any)["typed_config"].(map[string]any)
+			vhost := hcm["route_config"].(map[string]any)["virtual_hosts"].([]any)[0].(map[string]any)
+
+			vhostRoutes := vhost["routes"].([]any)
+			for _, r := range vhostRoutes[:len(vhostRoutes)-1] {
+				action := r.(map[string]any)["route"].(map[string]any)
+				if _, ok := action["host_rewrite_literal"]; ok {
+					t.Errorf("unexpected host_rewrite_literal on path route: %v", action)
+				}
+				if _, ok := action["prefix_rewrite"]; ok {
+					t.Errorf("unexpected prefix_rewrite on path route: %v", action)
+				}
+			}
+			action := vhostRoutes[len(vhostRoutes)-1].(map[string]any)["route"]
+			if !reflect.DeepEqual(action, tt.wantAction) {
+				t.Errorf("expected route action %v, got %v", tt.wantAction, action)
+			}
+
+			for key, want := range tt.wantVHost {
+				if !reflect.DeepEqual(vhost[key], want) {
+					t.Errorf("%s: expected %v, got %v", key, want, vhost[key])
+				}
+			}
+			for _, key := range tt.wantNoVHost {
+				if _, ok := vhost[key]; ok {
+					t.Errorf("unexpected %s: %v", key, vhost[key])
+				}
+			}
+		})
+	}
+}
+
 func TestBuildConfig_TCPOnly(t *testing.T) {
 	// TCPのみの設定
 	routes := []Route{
@@ -56,7 +376,7 @@ func TestBuildConfig_TCPOnly(t *testing.T) {
 		},
 	}
 
-	cfg := BuildConfig(80, routes)
+	cfg := BuildConfig(80, routes, nil)
 
 	staticRes, ok := cfg["static_resources"].(map[string]any)
 	if !ok {
@@ -117,7 +437,7 @@ func TestBuildConfig_MixedHTTPAndTCP(t *testing.T) {
 		},
 	}
 
-	cfg := BuildConfig(80, routes)
+	cfg := BuildConfig(80, routes, nil)
 
 	staticRes, ok := cfg["static_resources"].(map[string]any)
 	if !ok {
@@ -164,7 +484,7 @@ func TestBuildConfig_MultipleTCPSamePort(t *testing.T) {
 	}
 
 	// 現時点ではエラーチェックなし（将来的に追加する可能性）
-	cfg := BuildConfig(80, routes)
+	cfg := BuildConfig(80, routes, nil)
 
 	staticRes, ok := cfg["static_resources"].(map[string]any)
 	if !ok {
@@ -181,3 +501,108 @@ func TestBuildConfig_MultipleTCPSamePort(t *testing.T) {
 		t.Errorf("expected 2 listeners, got %d", len(listeners))
 	}
 }
+
+func TestBuildConfig_TCPListenAddress(t *testing.T) {
+	// ホスト名ごとのループバックアドレスで同じポートを共有する
+	routes := []Route{
+		{Host: "users-db.localhost", LocalPort: 10002, ClusterName: "users_db", Type: "tcp", ListenPort: 5432, ListenAddress: "127.0.0.2"},
+		{Host: "billing-db.localhost", LocalPort: 10003, ClusterName: "billing_db", Type: "tcp", ListenPort: 5432, ListenAddress: "127.0.0.3"},
+		{Host: "legacy-db.localhost", LocalPort: 10004, ClusterName: "legacy_db", Type: "tcp", ListenPort: 3306},
+	}
+
+	cfg := BuildConfig(80, routes, nil)
+	listeners := cfg["static_resources"].(map[string]any)["listeners"].([]any)
+
+	want := []string{"127.0.0.2", "127.0.0.3", "0.0.0.0"}
+	if len(listeners) != len(want) {
+		t.Fatalf("expected %d listeners, got %d", len(want), len(listeners))
+	}
+	for i, l := range listeners {
+		addr := l.(map[string]any)["address"].(map[string]any)["socket_address"].(map[string]any)
+		if addr["address"] != want[i] {
+			t.Errorf("listener %d: expected address %s, got %v", i, want[i], addr["address"])
+		}
+	}
+}
+
+func TestBuildConfig_TLSListener(t *testing.T) {
+	routes := []Route{
+		{Host: "users.localhost", LocalPort: 10001, ClusterName: "users_cluster", Type: "http"},
+		{Host: "billing.localhost", LocalPort: 10002, ClusterName: "billing_cluster", Type: "grpc"},
+		{Host: "db.localhost", LocalPort: 10003, ClusterName: "db_cluster", Type: "tcp", ListenPort: 5432},
+	}
+	tls := &TLSListener{
+		Port: 443,
+		Certs: []HostCert{
+			{Host: "users.localhost", CertFile: "/ca/hosts/users.localhost.crt", KeyFile: "/ca/hosts/users.localhost.key"},
+			{Host: "billing.localhost", CertFile: "/ca/hosts/billing.localhost.crt", KeyFile: "/ca/hosts/billing.localhost.key"},
+		},
+	}
+
+	cfg := BuildConfig(80, routes, tls)
+	listeners := cfg["static_resources"].(map[string]any)["listeners"].([]any)
+
+	// HTTP、TLS、TCPの3リスナー
+	if len(listeners) != 3 {
+		t.Fatalf("expected 3 listeners, got %d", len(listeners))
+	}
+	tlsListener := listeners[1].(map[string]any)
+	if tlsListener["name"] != "listener_https" {
+		t.Fatalf("expected listener_https, got %v", tlsListener["name"])
+	}
+
+	port := tlsListener["address"].(map[string]any)["socket_address"].(map[string]any)["port_value"]
+	if port != 443 {
+		t.Errorf("expected port 443, got %v", port)
+	}
+
+	listenerFilters := tlsListener["listener_filters"].([]any)
+	if len(listenerFilters) != 1 || listenerFilters[0].(map[string]any)["name"] != "envoy.filters.listener.tls_inspector" {
+		t.Errorf("expected tls_inspector listener filter, got %v", listenerFilters)
+	}
+
+	// 証明書ごとにSNIで選択されるフィルタチェーン
+	chains := tlsListener["filter_chains"].([]any)
+	if len(chains) != 2 {
+		t.Fatalf("expected 2 filter chains, got %d", len(chains))
+	}
+	for i, want := range tls.Certs {
+		chain := chains[i].(map[string]any)
+
+		serverNames := chain["filter_chain_match"].(map[string]any)["server_names"].([]any)
+		if len(serverNames) != 1 || serverNames[0] != want.Host {
+			t.Errorf("chain %d: expected server_names [%s], got %v", i, want.Host, serverNames)
+		}
+
+		tlsCtx := chain["transport_socket"].(map[string]any)["typed_config"].(map[string]any)["common_tls_context"].(map[string]any)
+		cert := tlsCtx["tls_certificates"].([]any)[0].(map[string]any)
+		if cert["certificate_chain"].(map[string]any)["filename"] != want.CertFile {
+			t.Errorf("chain %d: unexpected certificate_chain %v", i, cert["certificate_chain"])
+		}
+		if cert["private_key"].(map[string]any)["filename"] != want.KeyFile {
+			t.Errorf("chain %d: unexpected private_key %v", i, cert["private_key"])
+		}
+
+		// HTTPリスナーと同じvirtual hostでルーティングする
+		hcm := chain["filters"].([]any)[0].(map[string]any)["typed_config"].(map[string]any)
+		vhosts := hcm["route_config"].(map[string]any)["virtual_hosts"].([]any)
+		if len(vhosts) != 2 {
+			t.Errorf("chain %d: expected 2 virtual hosts, got %d", i, len(vhosts))
+		}
+	}
+}
+
+func TestBuildConfig_TLSListenerWithoutHTTPRoutes(t *testing.T) {
+	routes := []Route{
+		{Host: "db.localhost", LocalPort: 10003, ClusterName: "db_cluster", Type: "tcp", ListenPort: 5432},
+	}
+	tls := &TLSListener{Port: 443}
+
+	cfg := BuildConfig(80, routes, tls)
+	listeners := cfg["static_resources"].(map[string]any)["listeners"].([]any)
+
+	// HTTPルートがない場合はTLSリスナーも生成しない
+	if len(listeners) != 1 {
+		t.Fatalf("expected only the TCP listener, got %d listeners", len(listeners))
+	}
+}
@@ -0,0 +1,164 @@
+package envoy
+
+import "path/filepath"
+
+const (
+	listenerTypeURL    = "type.googleapis.com/envoy.config.listener.v3.Listener"
+	clusterTypeURL     = "type.googleapis.com/envoy.config.cluster.v3.Cluster"
+	routeConfigTypeURL = "type.googleapis.com/envoy.config.route.v3.RouteConfiguration"
+)
+
+// DynamicPaths はファイルベースxDSで使用するファイルのパス
+type DynamicPaths struct {
+	Dir string // Envoyが監視するディレクトリ
+	LDS string
+	CDS string
+	RDS string
+}
+
+// NewDynamicPaths は、dir配下にファイルベースxDS用のパスを割り当てる
+func NewDynamicPaths(dir string) DynamicPaths {
+	return DynamicPaths{
+		Dir: dir,
+		LDS: filepath.Join(dir, "lds.yaml"),
+		CDS: filepath.Join(dir, "cds.yaml"),
+		RDS: filepath.Join(dir, "rds.yaml"),
+	}
+}
+
+// BuildBootstrap builds an Envoy bootstrap config that reads listeners, clusters
+// and routes from the files in paths. Envoy reloads them whenever a file is
+// atomically moved into paths.Dir, so the mesh can be updated without a restart.
+// adminPort が0より大きい場合は 127.0.0.1 で admin インターフェースを公開する。
+func BuildBootstrap(paths DynamicPaths, adminPort int) map[string]any {
+	bootstrap := map[string]any{
+		"node": map[string]any{
+			"id":      "kubectl-localmesh",
+			"cluster": "kubectl-localmesh",
+		},
+		"dynamic_resources": map[string]any{
+			"lds_config": pathConfigSource(paths.LDS, paths.Dir),
+			"cds_config": pathConfigSource(paths.CDS, paths.Dir),
+		},
+	}
+
+	if adminPort > 0 {
+		bootstrap["admin"] = map[string]any{
+			"address": map[string]any{
+				"socket_address": map[string]any{
+					"address":    "127.0.0.1",
+					"port_value": adminPort,
+				},
+			},
+		}
+	}
+
+	return bootstrap
+}
+
+// BuildDynamicResources converts the output of BuildConfig into the LDS, CDS and
+// RDS resource files referenced by BuildBootstrap.
+// route_configはRDSに分離するため、ルートの変更だけではリスナーが再作成されず
+// 既存の接続は維持される。
+func BuildDynamicResources(cfg map[string]any, paths DynamicPaths) (lds, cds, rds map[string]any) {
+	// 入力を書き換えないようにコピーしてから変換する
+	staticRes, _ := deepCopy(cfg["static_resources"]).(map[string]any)
+	listeners, _ := staticRes["listeners"].([]any)
+	clusters, _ := staticRes["clusters"].([]any)
+
+	var listenerResources []any
+	var clusterResources []any
+	var routeResources []any
+	seenRoutes := map[any]bool{}
+
+	for _, l := range listeners {
+		listener := withType(l.(map[string]any), listenerTypeURL)
+		for _, fc := range listener["filter_chains"].([]any) {
+			for _, f := range fc.(map[string]any)["filters"].([]any) {
+				typedConfig, _ := f.(map[string]any)["typed_config"].(map[string]any)
+				routeConfig, ok := typedConfig["route_config"].(map[string]any)
+				if !ok {
+					continue
+				}
+				// inlineのroute_configをRDS参照に置き換える
+				delete(typedConfig, "route_config")
+				typedConfig["rds"] = map[string]any{
+					"route_config_name": routeConfig["name"],
+					"config_source":     pathConfigSource(paths.RDS, paths.Dir),
+				}
+				// HTTPリスナーとTLSリスナーのフィルタチェーンは同じroute_configを共有する
+				if !seenRoutes[routeConfig["name"]] {
+					seenRoutes[routeConfig["name"]] = true
+					routeResources = append(routeResources, withType(routeConfig, routeConfigTypeURL))
+				}
+			}
+		}
+		listenerResources = append(listenerResources, listener)
+	}
+
+	// CDSのリソース名は一意である必要があるため、同じ名前のクラスタは最初の定義だけを使う
+	seenClusters := map[any]bool{}
+	for _, c := range clusters {
+		cluster := c.(map[string]any)
+		if seenClusters[cluster["name"]] {
+			continue
+		}
+		seenClusters[cluster["name"]] = true
+		clusterResources = append(clusterResources, withType(cluster, clusterTypeURL))
+	}
+
+	return map[string]any{"resources": nonNil(listenerResources)},
+		map[string]any{"resources": nonNil(clusterResources)},
+		map[string]any{"resources": nonNil(routeResources)}
+}
+
+// pathConfigSource は、ファイルベースのxDS config sourceを生成する
+func pathConfigSource(path, dir string) map[string]any {
+	return map[string]any{
+		"resource_api_version": "V3",
+		"path_config_source": map[string]any{
+			"path": path,
+			"watched_directory": map[string]any{
+				"path": dir,
+			},
+		},
+	}
+}
+
+// withType は、@typeを付与したリソースのコピーを返す
+func withType(resource map[string]any, typeURL string) map[string]any {
+	out := make(map[string]any, len(resource)+1)
+	for k, v := range resource {
+		out[k] = v
+	}
+	out["@type"] = typeURL
+	return out
+}
+
+// deepCopy は、map[string]anyと[]anyで構成された値を再帰的にコピーする
+func deepCopy(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, e := range t {
+			out[k] = deepCopy(e)
+		}
+		return out
+	case []any:
+		out := make([]any, len(t))
+		for i, e := range t {
+			out[i] = deepCopy(e)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// nonNil は、リソースが空の場合でも空配列としてシリアライズされるようにする
+func nonNil(resources []any) []any {
+	if resources == nil {
+		return []any{}
+	}
+	return resources
+}
@@ -0,0 +1,159 @@
+package envoy
+
+import (
+	"testing"
+)
+
+func TestBuildBootstrap(t *testing.T) {
+	paths := NewDynamicPaths("/tmp/mesh")
+
+	cfg := BuildBootstrap(paths, 0)
+
+	if _, ok := cfg["admin"]; ok {
+		t.Error("expected no admin when adminPort is 0")
+	}
+
+	dynRes, ok := cfg["dynamic_resources"].(map[string]any)
+	if !ok {
+		t.Fatal("dynamic_resources not found")
+	}
+
+	for key, path := range map[string]string{"lds_config": paths.LDS, "cds_config": paths.CDS} {
+		source, ok := dynRes[key].(map[string]any)
+		if !ok {
+			t.Fatalf("%s not found", key)
+		}
+		pathSource := source["path_config_source"].(map[string]any)
+		if pathSource["path"] != path {
+			t.Errorf("%s: expected path %q, got %v", key, path, pathSource["path"])
+		}
+		watched := pathSource["watched_directory"].(map[string]any)
+		if watched["path"] != paths.Dir {
+			t.Errorf("%s: expected watched_directory %q, got %v", key, paths.Dir, watched["path"])
+		}
+	}
+}
+
+func TestBuildBootstrap_Admin(t *testing.T) {
+	cfg := BuildBootstrap(NewDynamicPaths("/tmp/mesh"), 19000)
+
+	admin, ok := cfg["admin"].(map[string]any)
+	if !ok {
+		t.Fatal("admin not found")
+	}
+	socketAddr := admin["address"].(map[string]any)["socket_address"].(map[string]any)
+	if socketAddr["address"] != "127.0.0.1" {
+		t.Errorf("expected admin address 127.0.0.1, got %v", socketAddr["address"])
+	}
+	if socketAddr["port_value"] != 19000 {
+		t.Errorf("expected admin port 19000, got %v", socketAddr["port_value"])
+	}
+}
+
+func TestBuildDynamicResources(t *testing.T) {
+	routes := []Route{
+		{
+			Host:        "api.localhost",
+			LocalPort:   10001,
+			ClusterName: "api_cluster",
+			Type:        "http",
+		},
+		{
+			Host:        "db.localhost",
+			LocalPort:   10002,
+			ClusterName: "db_cluster",
+			Type:        "tcp",
+			ListenPort:  5432,
+		},
+	}
+	paths := NewDynamicPaths("/tmp/mesh")
+	cfg := BuildConfig(80, routes, nil)
+
+	lds, cds, rds := BuildDynamicResources(cfg, paths)
+
+	listeners := lds["resources"].([]any)
+	if len(listeners) != 2 {
+		t.Fatalf("expected 2 listeners, got %d", len(listeners))
+	}
+	for _, l := range listeners {
+		if l.(map[string]any)["@type"] != listenerTypeURL {
+			t.Errorf("expected @type %q, got %v", listenerTypeURL, l.(map[string]any)["@type"])
+		}
+	}
+
+	clusters := cds["resources"].([]any)
+	if len(clusters) != 2 {
+		t.Fatalf("expected 2 clusters, got %d", len(clusters))
+	}
+	if clusters[0].(map[string]any)["@type"] != clusterTypeURL {
+		t.Errorf("expected @type %q, got %v", clusterTypeURL, clusters[0].(map[string]any)["@type"])
+	}
+
+	routeConfigs := rds["resources"].([]any)
+	if len(routeConfigs) != 1 {
+		t.Fatalf("expected 1 route config, got %d", len(routeConfigs))
+	}
+	routeConfig := routeConfigs[0].(map[string]any)
+	if routeConfig["name"] != "local_route" {
+		t.Errorf("expected route config name 'local_route', got %v", routeConfig["name"])
+	}
+
+	// HTTPリスナーのroute_configがRDS参照に置き換わっていること
+	httpListener := listeners[0].(map[string]any)
+	filter := httpListener["filter_chains"].([]any)[0].(map[string]any)["filters"].([]any)[0].(map[string]any)
+	typedConfig := filter["typed_config"].(map[string]any)
+	if _, ok := typedConfig["route_config"]; ok {
+		t.Error("expected inline route_config to be removed")
+	}
+	rdsRef, ok := typedConfig["rds"].(map[string]any)
+	if !ok {
+		t.Fatal("rds not found in http_connection_manager")
+	}
+	if rdsRef["route_config_name"] != "local_route" {
+		t.Errorf("expected route_config_name 'local_route', got %v", rdsRef["route_config_name"])
+	}
+
+	// 入力の設定は書き換えられないこと
+	origListener := cfg["static_resources"].(map[string]any)["listeners"].([]any)[0].(map[string]any)
+	origFilter := origListener["filter_chains"].([]any)[0].(map[string]any)["filters"].([]any)[0].(map[string]any)
+	if _, ok := origFilter["typed_config"].(map[string]any)["route_config"]; !ok {
+		t.Error("expected original config to keep inline route_config")
+	}
+	if _, ok := origListener["@type"]; ok {
+		t.Error("expected original listener not to have @type")
+	}
+}
+
+func TestBuildDynamicResources_Empty(t *testing.T) {
+	lds, cds, rds := BuildDynamicResources(BuildConfig(80, nil, nil), NewDynamicPaths("/tmp/mesh"))
+
+	for name, res := range map[string]map[string]any{"lds": lds, "cds": cds, "rds": rds} {
+		resources, ok := res["resources"].([]any)
+		if !ok {
+			t.Fatalf("%s: resources not found", name)
+		}
+		if len(resources) != 0 {
+			t.Errorf("%s: expected no resources, got %d", name, len(resources))
+		}
+	}
+}
+
+func TestBuildDynamicResources_SharedRouteConfig(t *testing.T) {
+	routes := []Route{
+		{Host: "users.localhost", LocalPort: 10001, ClusterName: "users_cluster", Type: "http"},
+	}
+	tls := &TLSListener{
+		Port:  443,
+		Certs: []HostCert{{Host: "users.localhost", CertFile: "users.crt", KeyFile: "users.key"}},
+	}
+
+	lds, _, rds := BuildDynamicResources(BuildConfig(80, routes, tls), NewDynamicPaths("/tmp/mesh"))
+
+	if listeners := lds["resources"].([]any); len(listeners) != 2 {
+		t.Fatalf("expected 2 listeners, got %d", len(listeners))
+	}
+	// HTTPリスナーとTLSリスナーは同じRDSリソースを参照する
+	if routeConfigs := rds["resources"].([]any); len(routeConfigs) != 1 {
+		t.Errorf("expected 1 shared route config, got %d", len(routeConfigs))
+	}
+}
@@ -21,6 +21,20 @@ func StartGCPSSHTunnel(
 	targetHost string,
 	targetPort int,
 	logLevel string,
+) error {
+	return StartGCPSSHTunnelWithHook(ctx, bastion, localPort, targetHost, targetPort, logLevel, nil)
+}
+
+// StartGCPSSHTunnelWithHook は StartGCPSSHTunnel と同様にSSH tunnelを維持し、
+// gcloudプロセスを起動するたびにそのPIDでonStartを呼び出します（nilの場合は呼び出しません）。
+func StartGCPSSHTunnelWithHook(
+	ctx context.Context,
+	bastion *config.SSHBastion,
+	localPort int,
+	targetHost string,
+	targetPort int,
+	logLevel string,
+	onStart func(pid int),
 ) error {
 	// パラメータのバリデーション
 	if bastion == nil {
@@ -51,7 +65,7 @@ func StartGCPSSHTunnel(
 		}
 
 		// SSH tunnel確立を試行
-		err := startSingleSSHTunnel(ctx, bastion, localPort, targetHost, targetPort, logLevel)
+		err := startSingleSSHTunnel(ctx, bastion, localPort, targetHost, targetPort, logLevel, onStart)
 
 		// contextキャンセル時は正常終了
 		if ctx.Err() != nil {
@@ -98,6 +112,7 @@ func startSingleSSHTunnel(
 	targetHost string,
 	targetPort int,
 	logLevel string,
+	onStart func(pid int),
 ) error {
 	// 1. gcloudコマンドのパスを取得
 	gcloudPath, err := exec.LookPath("gcloud")
@@ -120,6 +135,14 @@ func startSingleSSHTunnel(
 		cmd.Stderr = os.Stderr
 	}
 
-	// 5. 実行（ブロッキング、contextキャンセル時に自動終了）
-	return cmd.Run()
+	// 5. 起動してPIDを通知
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if onStart != nil {
+		onStart(cmd.Process.Pid)
+	}
+
+	// 6. 終了待ち（ブロッキング、contextキャンセル時に自動終了）
+	return cmd.Wait()
 }
@@ -0,0 +1,344 @@
+package hosts
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/usadamasa/kubectl-localmesh/internal/proc"
+)
+
+// Owner identifies the kubectl-localmesh instance that wrote a block. It is
+// recorded in the start marker, so that the block of a process that is gone
+// can be told apart from the block of a running one, and the blocks of
+// instances running side by side from each other.
+type Owner struct {
+	Name string // インスタンスの名前（name: または --name）
+	ID   string // インスタンスごとにランダムなID
+	PID  int    // up のプロセスID
+	// Start は up のプロセスの開始時刻（Unix秒）。PIDが別のプロセスに再利用されていないかの確認に使う
+	// （以前のバージョンのマーカーでは0）
+	Start int64
+	// UID は up を実行したユーザー（sudo経由の場合はsudoを実行したユーザー）。
+	// sudoのhelperで他のユーザーのブロックを書き換えないために使う（以前のバージョンのマーカーでは-1）
+	UID int
+}
+
+// ownerPattern は、開始マーカーに記録できるインスタンスの名前とID
+var ownerPattern = regexp.MustCompile(`^[0-9A-Za-z_-]{1,64}$`)
+
+// NewOwner returns the owner of the block written by the instance named name
+// with id and pid, whose process started at start (Unix seconds, 0 if
+// unknown). name may be empty; name and id must be 1-64 letters, digits, '-'
+// or '_'. The owner is the invoking user (the user who ran sudo under sudo).
+func NewOwner(name, id string, pid int, start int64) (Owner, error) {
+	if name != "" && !ownerPattern.MatchString(name) {
+		return Owner{}, fmt.Errorf("invalid instance name '%s'", name)
+	}
+	if !ownerPattern.MatchString(id) {
+		return Owner{}, fmt.Errorf("invalid instance id '%s'", id)
+	}
+	if pid <= 0 {
+		return Owner{}, fmt.Errorf("invalid pid %d", pid)
+	}
+	if start < 0 {
+		return Owner{}, fmt.Errorf("invalid start time %d", start)
+	}
+	return Owner{Name: name, ID: id, PID: pid, Start: start, UID: proc.InvokingUID()}, nil
+}
+
+// VerifyProcess checks that the owner process is run by the owner user, so
+// that the sudo helper does not record a block for a process of another
+// user. It is not checked for root.
+func (o Owner) VerifyProcess() error {
+	if o.UID == 0 {
+		return nil
+	}
+	uid, err := processUID(o.PID)
+	if err != nil {
+		return fmt.Errorf("pid %d: %w", o.PID, err)
+	}
+	if uid != o.UID {
+		return fmt.Errorf("pid %d is not a process of uid %d", o.PID, o.UID)
+	}
+	return nil
+}
+
+// Known reports whether the owner was recorded. Blocks written by older
+// versions have a start marker without the owner.
+func (o Owner) Known() bool {
+	return o.ID != "" && o.PID > 0
+}
+
+// Alive reports whether the owner process is still running. Unknown owners
+// are reported as alive, since they cannot be checked.
+func (o Owner) Alive() bool {
+	if !o.Known() {
+		return true
+	}
+	return processRunning(o.PID, o.Start)
+}
+
+func (o Owner) String() string {
+	if !o.Known() {
+		return "owner unknown"
+	}
+	return strings.TrimPrefix(o.fields(), " ")
+}
+
+// fields は、開始マーカーに記録する" key=value"の並び
+func (o Owner) fields() string {
+	var sb strings.Builder
+	if o.Name != "" {
+		fmt.Fprintf(&sb, " name=%s", o.Name)
+	}
+	fmt.Fprintf(&sb, " id=%s pid=%d", o.ID, o.PID)
+	if o.Start != 0 {
+		fmt.Fprintf(&sb, " start=%d", o.Start)
+	}
+	if o.UID >= 0 {
+		fmt.Fprintf(&sb, " uid=%d", o.UID)
+	}
+	return sb.String()
+}
+
+// marker は、ownerを記録した開始マーカーを返す
+func (o Owner) marker() string {
+	return markerStart + o.fields()
+}
+
+// parseStartMarker は、開始マーカーの行であればその所有者を返す
+// （以前のバージョンのマーカーは所有者なし、未知のキーは無視する）
+func parseStartMarker(line string) (Owner, bool) {
+	line = strings.TrimSpace(line)
+	if line == markerStart {
+		return Owner{UID: -1}, true
+	}
+	rest, ok := strings.CutPrefix(line, markerStart+" ")
+	if !ok {
+		return Owner{}, false
+	}
+	o := Owner{UID: -1}
+	for _, field := range strings.Fields(rest) {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "name":
+			o.Name = value
+		case "id":
+			o.ID = value
+		case "pid":
+			o.PID, _ = strconv.Atoi(value)
+		case "start":
+			o.Start, _ = strconv.ParseInt(value, 10, 64)
+		case "uid":
+			if uid, err := strconv.Atoi(value); err == nil && uid >= 0 {
+				o.UID = uid
+			}
+		}
+	}
+	return o, true
+}
+
+// processRunning は、pidのプロセスがstartに開始したまま実行中かを返す（テストで差し替え可能）
+var processRunning = func(pid int, start int64) bool {
+	// 別ユーザーのプロセスの場合はEPERMになるが、存在はしている
+	if err := syscall.Kill(pid, 0); err != nil && err != syscall.EPERM {
+		return false
+	}
+	// 再起動などでPIDが別のプロセスに再利用されていないかを開始時刻で確認する
+	// （開始時刻を記録していない以前のバージョンのマーカーや、開始時刻を取得できない場合は実行中とみなす）
+	if start == 0 {
+		return true
+	}
+	actual, err := proc.StartTime(pid)
+	return err != nil || proc.SameStart(start, actual)
+}
+
+// processUID は、pidのプロセスを実行しているユーザーを返す（テストで差し替え可能）
+var processUID = proc.UID
+
+// Block is a kubectl-localmesh block found in /etc/hosts.
+type Block struct {
+	Owner   Owner
+	Line    int // 開始マーカーの行番号（1始まり）
+	Entries []Entry
+	Closed  bool // 終了マーカーがあるか
+
+	start, end int // 開始マーカーとブロックの最後の行のインデックス
+}
+
+// Status returns "running", "stopped" or "unknown" for the owner of the block.
+func (b Block) Status() string {
+	switch {
+	case !b.Owner.Known():
+		return "unknown"
+	case b.Owner.Alive():
+		return "running"
+	default:
+		return "stopped"
+	}
+}
+
+// hint は、ブロックを取り除く方法を返す
+func (b Block) hint() string {
+	if b.Status() == "running" {
+		return fmt.Sprintf("stop it with 'kubectl-localmesh down --pid %d'", b.Owner.PID)
+	}
+	return "remove it with 'sudo kubectl-localmesh hosts clean'"
+}
+
+// checkConflicts は、ownerのentriesと他のインスタンスのブロックとの
+// 名前とホスト名（大文字小文字を区別しない）の衝突を返す
+func checkConflicts(others []Block, owner Owner, entries []Entry) error {
+	hostnames := map[string]bool{}
+	for _, e := range entries {
+		hostnames[strings.ToLower(e.Hostname)] = true
+	}
+
+	var errs []error
+	for _, b := range others {
+		if owner.Name != "" && b.Owner.Name == owner.Name {
+			errs = append(errs, fmt.Errorf("a kubectl-localmesh named '%s' already has a block in /etc/hosts (line %d, %s, %s): %s, or choose another name with --name",
+				owner.Name, b.Line, b.Owner, b.Status(), b.hint()))
+			continue
+		}
+		for _, e := range b.Entries {
+			if hostnames[strings.ToLower(e.Hostname)] {
+				errs = append(errs, fmt.Errorf("hostname '%s' is already in the /etc/hosts block of another kubectl-localmesh (line %d, %s, %s): %s, or leave it out with --exclude",
+					e.Hostname, b.Line, b.Owner, b.Status(), b.hint()))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// scanResult は、hostsファイルの管理ブロックと壊れたマーカーの位置
+type scanResult struct {
+	blocks     []Block
+	orphanEnds []int // 開始マーカーのない終了マーカーのインデックス
+}
+
+// broken は、壊れたマーカーがあるかを返す
+func (r scanResult) broken() bool {
+	if len(r.orphanEnds) > 0 {
+		return true
+	}
+	for _, b := range r.blocks {
+		if !b.Closed {
+			return true
+		}
+	}
+	return false
+}
+
+// scanBlocks は、行から管理ブロックを探す。
+// 終了マーカーのないブロックは、開始マーカーに続くエントリの行までとする。
+func scanBlocks(lines []string) scanResult {
+	var r scanResult
+	for i := 0; i < len(lines); i++ {
+		owner, ok := parseStartMarker(lines[i])
+		if !ok {
+			if strings.TrimSpace(lines[i]) == markerEnd {
+				r.orphanEnds = append(r.orphanEnds, i)
+			}
+			continue
+		}
+
+		b := Block{Owner: owner, Line: i + 1, start: i, end: i}
+		// 次のマーカーが終了マーカーであれば、そこまでがブロック
+		next := i + 1
+		for next < len(lines) && !isMarker(lines[next]) {
+			next++
+		}
+		if next < len(lines) && strings.TrimSpace(lines[next]) == markerEnd {
+			b.Closed, b.end = true, next
+		} else {
+			for b.end+1 < len(lines) {
+				if _, ok := parseEntryLine(lines[b.end+1]); !ok {
+					break
+				}
+				b.end++
+			}
+		}
+		for _, line := range lines[b.start+1 : b.end+1] {
+			if e, ok := parseEntryLine(line); ok {
+				b.Entries = append(b.Entries, e)
+			}
+		}
+		r.blocks = append(r.blocks, b)
+		i = b.end
+	}
+	return r
+}
+
+// isMarker は、開始マーカーまたは終了マーカーの行かを返す
+func isMarker(line string) bool {
+	_, ok := parseStartMarker(line)
+	return ok || strings.TrimSpace(line) == markerEnd
+}
+
+// parseEntryLine は、"IP hostname"の行をエントリとして返す
+func parseEntryLine(line string) (Entry, bool) {
+	fields := strings.Fields(line)
+	if len(fields) != 2 || net.ParseIP(fields[0]) == nil {
+		return Entry{}, false
+	}
+	return Entry{IP: fields[0], Hostname: fields[1]}, true
+}
+
+// removeBlocks は、removeがtrueのブロックと壊れたマーカーの行を取り除く
+// （ブロックの直前の空行も取り除く）
+func removeBlocks(lines []string, r scanResult, remove func(Block) bool, orphanEnds bool) []string {
+	drop := make([]bool, len(lines))
+	for _, b := range r.blocks {
+		if !remove(b) {
+			continue
+		}
+		for i := b.start; i <= b.end; i++ {
+			drop[i] = true
+		}
+		if b.start > 0 && lines[b.start-1] == "" {
+			drop[b.start-1] = true
+		}
+	}
+	if orphanEnds {
+		for _, i := range r.orphanEnds {
+			drop[i] = true
+		}
+	}
+
+	var out []string
+	for i, line := range lines {
+		if !drop[i] {
+			out = append(out, line)
+		}
+	}
+	return out
+}
+
+// ownedBy は、uidのユーザーがブロックを書き換えてよいかを返す。
+// rootはすべてのブロック、それ以外は自分のブロックだけを書き換えられる。
+// ユーザーを記録していない以前のバージョンのブロックは所有プロセスのユーザーで判定する
+// （所有プロセスが終了したブロックは、次の up でも取り除かれるため誰でも書き換えられる）。
+func (b Block) ownedBy(uid int) bool {
+	if uid == 0 {
+		return true
+	}
+	if b.Owner.UID >= 0 {
+		return b.Owner.UID == uid
+	}
+	if !b.Owner.Known() || !b.Owner.Alive() {
+		return true
+	}
+	actual, err := processUID(b.Owner.PID)
+	return err == nil && actual == uid
+}
+
+// notOwnedError は、他のユーザーのブロックを書き換えようとした場合のエラーを返す
+func (b Block) notOwnedError() error {
+	return fmt.Errorf("the /etc/hosts block at line %d (%s) belongs to another user", b.Line, b.Owner)
+}
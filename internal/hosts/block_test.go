@@ -0,0 +1,403 @@
+package hosts
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/usadamasa/kubectl-localmesh/internal/proc"
+)
+
+func TestParseStartMarker(t *testing.T) {
+	tests := []struct {
+		line      string
+		wantOwner Owner
+		wantOK    bool
+	}{
+		{line: markerStart, wantOwner: Owner{UID: -1}, wantOK: true},
+		{line: "  " + markerStart + "  ", wantOwner: Owner{UID: -1}, wantOK: true},
+		{line: markerStart + " id=0123abcd pid=4242", wantOwner: Owner{ID: "0123abcd", PID: 4242, UID: -1}, wantOK: true},
+		{line: markerStart + " pid=4242 future=1 id=0123abcd", wantOwner: Owner{ID: "0123abcd", PID: 4242, UID: -1}, wantOK: true},
+		{line: markerStart + " name=backend id=0123abcd pid=4242", wantOwner: Owner{Name: "backend", ID: "0123abcd", PID: 4242, UID: -1}, wantOK: true},
+		{line: markerStart + " name=backend id=0123abcd pid=4242 start=1767225600", wantOwner: Owner{Name: "backend", ID: "0123abcd", PID: 4242, Start: 1767225600, UID: -1}, wantOK: true},
+		{line: markerStart + " name=backend id=0123abcd pid=4242 start=1767225600 uid=1000", wantOwner: testOwner, wantOK: true},
+		{line: markerStart + "-other"},
+		{line: markerEnd},
+		{line: "127.0.0.1 localhost"},
+	}
+	for _, tt := range tests {
+		owner, ok := parseStartMarker(tt.line)
+		if owner != tt.wantOwner || ok != tt.wantOK {
+			t.Errorf("parseStartMarker(%q) = %+v, %v, want %+v, %v", tt.line, owner, ok, tt.wantOwner, tt.wantOK)
+		}
+	}
+}
+
+func TestProcessRunning(t *testing.T) {
+	start, err := proc.StartTime(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !processRunning(os.Getpid(), start) {
+		t.Error("expected the current process to be running")
+	}
+	// btimeのずれや切り捨てで開始時刻が1秒ずれても同じプロセスとみなす
+	if !processRunning(os.Getpid(), start-1) {
+		t.Error("expected the current process to be running with a start time off by one second")
+	}
+	// PIDが別のプロセスに再利用された（開始時刻が異なる）場合は実行中とみなさない
+	if processRunning(os.Getpid(), start-60) {
+		t.Error("expected a process with another start time not to be running")
+	}
+	// 開始時刻を記録していない以前のバージョンのマーカーはPIDだけで判定する
+	if !processRunning(os.Getpid(), 0) {
+		t.Error("expected the current process to be running without a start time")
+	}
+
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if processRunning(cmd.Process.Pid, 0) {
+		t.Error("expected an exited process not to be running")
+	}
+}
+
+// writeTestHostsFile は、テスト用のhostsファイルを作成する
+func writeTestHostsFile(t *testing.T, content string) string {
+	t.Helper()
+	testFile := filepath.Join(t.TempDir(), "hosts")
+	setTestHostsFile(t, testFile)
+	if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+	return testFile
+}
+
+func readTestHostsFile(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read test file: %v", err)
+	}
+	return string(content)
+}
+
+var (
+	runningOwner = Owner{Name: "data", ID: "running1", PID: 100, UID: -1}
+	stoppedOwner = Owner{Name: "backend", ID: "stopped1", PID: 200, UID: -1}
+)
+
+func TestReclaimStale(t *testing.T) {
+	setProcessRunning(t, func(pid int, _ int64) bool { return pid == runningOwner.PID })
+
+	t.Run("stopped owner", func(t *testing.T) {
+		testFile := writeTestHostsFile(t, "127.0.0.1 localhost\n\n"+
+			stoppedOwner.marker()+"\n127.0.0.1 old.localhost\n"+markerEnd+"\n")
+
+		reclaimed, err := ReclaimStale()
+		if err != nil {
+			t.Fatalf("ReclaimStale failed: %v", err)
+		}
+		if len(reclaimed) != 1 || reclaimed[0].Owner != stoppedOwner || reclaimed[0].Line != 3 {
+			t.Errorf("unexpected reclaimed blocks: %+v", reclaimed)
+		}
+		if got := readTestHostsFile(t, testFile); got != "127.0.0.1 localhost\n" {
+			t.Errorf("unexpected content: %q", got)
+		}
+
+		// 回収した後は追加できる
+		if err := AddEntries(testOwner, LoopbackEntries([]string{"new.localhost"})); err != nil {
+			t.Fatalf("AddEntries failed: %v", err)
+		}
+	})
+
+	keep := []struct {
+		name    string
+		content string
+	}{
+		{name: "running owner", content: runningOwner.marker() + "\n127.0.0.1 a.localhost\n" + markerEnd + "\n"},
+		{name: "unknown owner", content: markerStart + "\n127.0.0.1 a.localhost\n" + markerEnd + "\n"},
+		{name: "broken marker", content: stoppedOwner.marker() + "\n127.0.0.1 a.localhost\n" + markerEnd + "\n" + markerEnd + "\n"},
+	}
+	for _, tt := range keep {
+		t.Run(tt.name, func(t *testing.T) {
+			testFile := writeTestHostsFile(t, tt.content)
+			reclaimed, err := ReclaimStale()
+			if err != nil {
+				t.Fatalf("ReclaimStale failed: %v", err)
+			}
+			if len(reclaimed) != 0 {
+				t.Errorf("expected nothing reclaimed, got %+v", reclaimed)
+			}
+			if got := readTestHostsFile(t, testFile); got != tt.content {
+				t.Errorf("content changed: %q", got)
+			}
+		})
+	}
+}
+
+func TestClaim(t *testing.T) {
+	setProcessRunning(t, func(int, int64) bool { return false })
+	testFile := writeTestHostsFile(t, stoppedOwner.marker()+"\n127.0.0.1 old.localhost\n"+markerEnd+"\n")
+
+	var out bytes.Buffer
+	if err := Claim(&out, testOwner, LoopbackEntries([]string{"new.localhost"})); err != nil {
+		t.Fatalf("Claim failed: %v", err)
+	}
+	if got, want := out.String(), "reclaimed /etc/hosts entries of stopped kubectl-localmesh (name=backend id=stopped1 pid=200)\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+	want := testOwner.marker() + "\n127.0.0.1 new.localhost\n" + markerEnd + "\n"
+	if got := readTestHostsFile(t, testFile); got != want {
+		t.Errorf("unexpected content:\ngot:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestClaim_OtherInstances(t *testing.T) {
+	setProcessRunning(t, func(int, int64) bool { return true })
+	other := runningOwner.marker() + "\n127.0.0.1 api.localhost\n127.0.0.2 db.localhost\n" + markerEnd + "\n"
+
+	tests := []struct {
+		name    string
+		content string
+		entries []Entry
+		wantErr string
+	}{
+		{
+			name:    "separate hostnames",
+			content: other,
+			entries: LoopbackEntries([]string{"web.localhost"}),
+		},
+		{
+			name:    "same name",
+			content: Owner{Name: "backend", ID: "running2", PID: 300, UID: -1}.marker() + "\n127.0.0.1 other.localhost\n" + markerEnd + "\n",
+			entries: LoopbackEntries([]string{"web.localhost"}),
+			wantErr: "a kubectl-localmesh named 'backend' already has a block in /etc/hosts (line 1, name=backend id=running2 pid=300, running): stop it with 'kubectl-localmesh down --pid 300'",
+		},
+		{
+			name:    "same hostname",
+			content: other,
+			entries: []Entry{{IP: "127.0.0.1", Hostname: "web.localhost"}, {IP: "127.0.0.3", Hostname: "DB.localhost"}},
+			wantErr: "hostname 'db.localhost' is already in the /etc/hosts block of another kubectl-localmesh (line 1, name=data id=running1 pid=100, running)",
+		},
+		{
+			name:    "hostname in a block of an older version",
+			content: markerStart + "\n127.0.0.1 web.localhost\n" + markerEnd + "\n",
+			entries: LoopbackEntries([]string{"web.localhost"}),
+			wantErr: "(line 1, owner unknown, unknown): remove it with 'sudo kubectl-localmesh hosts clean'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testFile := writeTestHostsFile(t, tt.content)
+			err := Claim(&bytes.Buffer{}, testOwner, tt.entries)
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				if got := readTestHostsFile(t, testFile); got != tt.content {
+					t.Errorf("content changed: %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Claim failed: %v", err)
+			}
+			want := tt.content + "\n" + testOwner.marker() + "\n" + FormatEntries(tt.entries) + markerEnd + "\n"
+			if got := readTestHostsFile(t, testFile); got != want {
+				t.Errorf("unexpected content:\ngot:\n%q\nwant:\n%q", got, want)
+			}
+		})
+	}
+}
+
+func TestUpdateEntries_KeepsOtherBlocks(t *testing.T) {
+	setProcessRunning(t, func(int, int64) bool { return true })
+	other := runningOwner.marker() + "\n127.0.0.1 other.localhost\n" + markerEnd + "\n"
+	testFile := writeTestHostsFile(t, "127.0.0.1 localhost\n\n"+
+		testOwner.marker()+"\n127.0.0.1 mine.localhost\n"+markerEnd+"\n\n"+other)
+
+	// 他のインスタンスのホスト名には置き換えない
+	if err := UpdateEntries(testOwner, LoopbackEntries([]string{"other.localhost"})); err == nil {
+		t.Fatal("expected error for a hostname of another instance, got nil")
+	}
+
+	// 自身のブロックはその位置で置き換える
+	if err := UpdateEntries(testOwner, LoopbackEntries([]string{"mine.localhost", "new.localhost"})); err != nil {
+		t.Fatalf("UpdateEntries failed: %v", err)
+	}
+	want := "127.0.0.1 localhost\n\n" +
+		testOwner.marker() + "\n127.0.0.1 mine.localhost\n127.0.0.1 new.localhost\n" + markerEnd + "\n\n" + other
+	if got := readTestHostsFile(t, testFile); got != want {
+		t.Errorf("unexpected content:\ngot:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestRemoveEntries_KeepsOtherBlocks(t *testing.T) {
+	other := runningOwner.marker() + "\n127.0.0.1 other.localhost\n" + markerEnd + "\n"
+	testFile := writeTestHostsFile(t, "127.0.0.1 localhost\n\n"+other+"\n"+
+		testOwner.marker()+"\n127.0.0.1 mine.localhost\n"+markerEnd+"\n")
+
+	if err := RemoveEntries(testOwner); err != nil {
+		t.Fatalf("RemoveEntries failed: %v", err)
+	}
+	if got, want := readTestHostsFile(t, testFile), "127.0.0.1 localhost\n\n"+other; got != want {
+		t.Errorf("unexpected content:\ngot:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestEntries_OtherUser(t *testing.T) {
+	setProcessRunning(t, func(int, int64) bool { return true })
+	setProcessUID(t, func(int) (int, error) { return 1000, nil })
+	// 同じIDでも別のユーザーが書き込んだブロックは、sudoのhelperから書き換えない
+	intruder := testOwner
+	intruder.UID = 2000
+	content := "127.0.0.1 localhost\n\n" + testOwner.marker() + "\n127.0.0.1 mine.localhost\n" + markerEnd + "\n"
+	testFile := writeTestHostsFile(t, content)
+
+	if err := RemoveEntries(intruder); err == nil || !strings.Contains(err.Error(), "belongs to another user") {
+		t.Errorf("expected RemoveEntries to fail for another user, got %v", err)
+	}
+	if err := UpdateEntries(intruder, LoopbackEntries([]string{"evil.localhost"})); err == nil || !strings.Contains(err.Error(), "belongs to another user") {
+		t.Errorf("expected UpdateEntries to fail for another user, got %v", err)
+	}
+	if got := readTestHostsFile(t, testFile); got != content {
+		t.Errorf("expected the block to be kept, got:\n%q", got)
+	}
+
+	// rootはすべてのブロックを書き換えられる
+	root := testOwner
+	root.UID = 0
+	if err := RemoveEntries(root); err != nil {
+		t.Fatalf("RemoveEntries as root failed: %v", err)
+	}
+}
+
+func TestBlock_OwnedBy(t *testing.T) {
+	setProcessUID(t, func(pid int) (int, error) {
+		if pid == runningOwner.PID {
+			return 1000, nil
+		}
+		return 0, errors.New("no such process")
+	})
+	setProcessRunning(t, func(pid int, _ int64) bool { return pid == runningOwner.PID })
+
+	tests := []struct {
+		name  string
+		owner Owner
+		uid   int
+		want  bool
+	}{
+		{name: "own block", owner: testOwner, uid: 1000, want: true},
+		{name: "block of another user", owner: testOwner, uid: 2000, want: false},
+		{name: "root", owner: testOwner, uid: 0, want: true},
+		// ユーザーを記録していない以前のバージョンのブロックは所有プロセスのユーザーで判定する
+		{name: "running owner of the user", owner: runningOwner, uid: 1000, want: true},
+		{name: "running owner of another user", owner: runningOwner, uid: 2000, want: false},
+		{name: "stopped owner", owner: stoppedOwner, uid: 2000, want: true},
+		{name: "unknown owner", owner: Owner{UID: -1}, uid: 2000, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Block{Owner: tt.owner}).ownedBy(tt.uid); got != tt.want {
+				t.Errorf("ownedBy(%d) = %v, want %v", tt.uid, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOwner_VerifyProcess(t *testing.T) {
+	setProcessUID(t, func(pid int) (int, error) {
+		if pid == testOwner.PID {
+			return 1000, nil
+		}
+		return 0, errors.New("no such process")
+	})
+
+	if err := testOwner.VerifyProcess(); err != nil {
+		t.Errorf("expected the process of the owner to be accepted, got %v", err)
+	}
+	other := testOwner
+	other.UID = 2000
+	if err := other.VerifyProcess(); err == nil || !strings.Contains(err.Error(), "pid 4242 is not a process of uid 2000") {
+		t.Errorf("expected an error for a process of another user, got %v", err)
+	}
+	missing := testOwner
+	missing.PID = 1
+	if err := missing.VerifyProcess(); err == nil {
+		t.Error("expected an error for a missing process")
+	}
+	root := other
+	root.UID = 0
+	if err := root.VerifyProcess(); err != nil {
+		t.Errorf("expected root to be accepted, got %v", err)
+	}
+}
+
+func TestClean(t *testing.T) {
+	setProcessRunning(t, func(pid int, _ int64) bool { return pid == runningOwner.PID })
+	running := runningOwner.marker() + "\n127.0.0.1 running.localhost\n" + markerEnd
+	testFile := writeTestHostsFile(t, "127.0.0.1 localhost\n\n"+
+		stoppedOwner.marker()+"\n127.0.0.1 stopped.localhost\n"+markerEnd+"\n\n"+
+		markerStart+"\n127.0.0.1 legacy.localhost\n"+markerEnd+"\n\n"+
+		running+"\n"+
+		markerEnd+"\n"+
+		"\n"+Owner{ID: "crashed1", PID: 300, UID: -1}.marker()+"\n127.0.0.1 crashed.localhost\n"+
+		"# added by hand after the crash\n"+
+		"10.0.0.1 db.internal\n")
+
+	removed, orphanEnds, err := Clean()
+	if err != nil {
+		t.Fatalf("Clean failed: %v", err)
+	}
+	var owners []string
+	for _, b := range removed {
+		owners = append(owners, b.Owner.String())
+	}
+	if want := []string{"name=backend id=stopped1 pid=200", "owner unknown", "id=crashed1 pid=300"}; !reflect.DeepEqual(owners, want) {
+		t.Errorf("removed = %v, want %v", owners, want)
+	}
+	if orphanEnds != 1 {
+		t.Errorf("expected 1 orphan end marker, got %d", orphanEnds)
+	}
+
+	// 終了マーカーのないブロックは、続くエントリの行までを取り除く
+	want := "127.0.0.1 localhost\n\n" + running + "\n" +
+		"# added by hand after the crash\n" +
+		"10.0.0.1 db.internal\n"
+	if got := readTestHostsFile(t, testFile); got != want {
+		t.Errorf("unexpected content:\ngot:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	writeTestHostsFile(t, "127.0.0.1 localhost\n"+
+		testOwner.marker()+"\n127.0.0.1 a.localhost\n127.0.0.2 db.localhost\n"+markerEnd+"\n"+
+		markerEnd+"\n"+
+		markerStart+"\n127.0.0.1 b.localhost\n")
+
+	blocks, orphanEnds, err := Inspect()
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	if len(blocks) != 2 {
+		t.Fatalf("expected 2 blocks, got %+v", blocks)
+	}
+	if blocks[0].Owner != testOwner || blocks[0].Line != 2 || !blocks[0].Closed ||
+		!reflect.DeepEqual(blocks[0].Entries, []Entry{{IP: "127.0.0.1", Hostname: "a.localhost"}, {IP: "127.0.0.2", Hostname: "db.localhost"}}) {
+		t.Errorf("unexpected first block: %+v", blocks[0])
+	}
+	if blocks[1].Owner.Known() || blocks[1].Line != 7 || blocks[1].Closed || len(blocks[1].Entries) != 1 {
+		t.Errorf("unexpected second block: %+v", blocks[1])
+	}
+	if !reflect.DeepEqual(orphanEnds, []int{6}) {
+		t.Errorf("orphan end markers = %v, want [6]", orphanEnds)
+	}
+}
@@ -0,0 +1,173 @@
+package hosts
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Editor edits the kubectl-localmesh block of an instance in /etc/hosts.
+type Editor interface {
+	// Add adds the block after removing the blocks of stopped instances.
+	// It fails if the name or a hostname is in the block of another instance.
+	Add(entries []Entry) error
+	// Update replaces the entries of the block written by Add.
+	Update(entries []Entry) error
+	// Remove removes the block. Blocks of other instances are kept.
+	Remove() error
+}
+
+// NewEditor returns an Editor for the block of owner. It writes /etc/hosts
+// directly when the process has permission, and otherwise runs the
+// privileged helper ("kubectl-localmesh hosts apply|remove") through
+// "sudo -n", so that only the /etc/hosts edit runs as root. It fails if sudo
+// would ask for a password.
+func NewEditor(owner Owner) (Editor, error) {
+	if HasPermission() {
+		return fileEditor{owner: owner}, nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate the kubectl-localmesh binary: %w", err)
+	}
+	h := &sudoHelper{exe: exe, owner: owner, run: runSudo}
+
+	// パスワードの入力なしで実行できるかを事前に確認する
+	args := h.args("apply")
+	if err := h.run(nil, nil, append([]string{"-l"}, args...)...); err != nil {
+		return nil, fmt.Errorf(
+			"cannot edit %s: 'sudo -n %s' is not allowed without a password (%w)\n"+
+				"run 'sudo -v' first, add a sudoers rule for the helper (see README), or use --no-edit-hosts",
+			hostsFile, strings.Join(args, " "), err)
+	}
+	return h, nil
+}
+
+// Claim removes the blocks of stopped instances, reporting each of them to w,
+// and adds entries as the block of owner.
+func Claim(w io.Writer, owner Owner, entries []Entry) error {
+	reclaimed, err := ReclaimStale()
+	if err != nil {
+		return err
+	}
+	for _, b := range reclaimed {
+		fmt.Fprintf(w, "reclaimed /etc/hosts entries of stopped kubectl-localmesh (%s)\n", b.Owner)
+	}
+	return AddEntries(owner, entries)
+}
+
+// fileEditor は、/etc/hostsを直接書き換える
+type fileEditor struct {
+	owner Owner
+}
+
+func (e fileEditor) Add(entries []Entry) error    { return Claim(os.Stdout, e.owner, entries) }
+func (e fileEditor) Update(entries []Entry) error { return UpdateEntries(e.owner, entries) }
+func (e fileEditor) Remove() error                { return RemoveEntries(e.owner) }
+
+// sudoHelper は、sudo -n で実行したhostsサブコマンドで/etc/hostsを書き換える
+type sudoHelper struct {
+	exe   string
+	owner Owner
+	// run は sudo -n に引数を付けて実行する（stdin・stdoutはnil可）
+	run func(stdin io.Reader, stdout io.Writer, args ...string) error
+}
+
+// args は、ownerを指定したhostsサブコマンドの引数を返す
+func (h *sudoHelper) args(subcommand string, extra ...string) []string {
+	args := []string{h.exe, "hosts", subcommand, "--id", h.owner.ID}
+	if subcommand == "apply" {
+		if h.owner.Name != "" {
+			args = append(args, "--name", h.owner.Name)
+		}
+		args = append(args, "--pid", strconv.Itoa(h.owner.PID))
+		if h.owner.Start != 0 {
+			args = append(args, "--start", strconv.FormatInt(h.owner.Start, 10))
+		}
+	}
+	return append(args, extra...)
+}
+
+func (h *sudoHelper) Add(entries []Entry) error {
+	return h.run(strings.NewReader(FormatEntries(entries)), os.Stdout, h.args("apply")...)
+}
+
+func (h *sudoHelper) Update(entries []Entry) error {
+	return h.run(strings.NewReader(FormatEntries(entries)), os.Stdout, h.args("apply", "--replace")...)
+}
+
+func (h *sudoHelper) Remove() error {
+	return h.run(nil, os.Stdout, h.args("remove")...)
+}
+
+// runSudo は、sudo -n を実行し、失敗した場合は標準エラー出力をエラーに含める
+func runSudo(stdin io.Reader, stdout io.Writer, args ...string) error {
+	cmd := exec.Command("sudo", append([]string{"-n"}, args...)...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("sudo -n %s: %s", strings.Join(args, " "), msg)
+		}
+		return fmt.Errorf("sudo -n %s: %w", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// FormatEntries returns entries as "IP hostname" lines, the input format of
+// ParseEntries.
+func FormatEntries(entries []Entry) string {
+	var sb strings.Builder
+	for _, e := range entries {
+		fmt.Fprintf(&sb, "%s %s\n", e.IP, e.Hostname)
+	}
+	return sb.String()
+}
+
+// hostnamePattern は、/etc/hostsに書き込めるホスト名
+var hostnamePattern = regexp.MustCompile(`^[A-Za-z0-9_]([A-Za-z0-9_-]*[A-Za-z0-9_])?(\.[A-Za-z0-9_]([A-Za-z0-9_-]*[A-Za-z0-9_])?)*$`)
+
+// ParseEntries reads "IP hostname" lines written by FormatEntries. Blank
+// lines are ignored. As the helper runs as root, every address and hostname
+// is validated before anything is written to /etc/hosts. Only loopback
+// addresses are accepted, so that the helper cannot point a hostname at
+// another machine.
+func ParseEntries(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected 'IP hostname', got '%s'", n, line)
+		}
+		ip := net.ParseIP(fields[0])
+		if ip == nil {
+			return nil, fmt.Errorf("line %d: invalid IP address '%s'", n, fields[0])
+		}
+		if !ip.IsLoopback() {
+			return nil, fmt.Errorf("line %d: '%s' is not a loopback address", n, fields[0])
+		}
+		if len(fields[1]) > 253 || !hostnamePattern.MatchString(fields[1]) {
+			return nil, fmt.Errorf("line %d: invalid hostname '%s'", n, fields[1])
+		}
+		entries = append(entries, Entry{IP: fields[0], Hostname: fields[1]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,133 @@
+package hosts
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []Entry
+		wantErr string
+	}{
+		{
+			name:  "entries",
+			input: "127.0.0.1 users-api.localhost\n\n127.0.0.2\tusers_db.localhost\n::1 api.localhost\n",
+			want: []Entry{
+				{IP: "127.0.0.1", Hostname: "users-api.localhost"},
+				{IP: "127.0.0.2", Hostname: "users_db.localhost"},
+				{IP: "::1", Hostname: "api.localhost"},
+			},
+		},
+		{
+			name:  "empty",
+			input: "",
+		},
+		{
+			name:    "missing hostname",
+			input:   "127.0.0.1\n",
+			wantErr: "line 1: expected 'IP hostname', got '127.0.0.1'",
+		},
+		{
+			name:    "extra hostnames",
+			input:   "127.0.0.1 a.localhost b.localhost\n",
+			wantErr: "line 1: expected 'IP hostname'",
+		},
+		{
+			name:    "invalid IP",
+			input:   "127.0.0.1 a.localhost\nlocalhost b.localhost\n",
+			wantErr: "line 2: invalid IP address 'localhost'",
+		},
+		{
+			name:    "not a loopback address",
+			input:   "127.0.0.1 a.localhost\n140.82.112.3 github.com\n",
+			wantErr: "line 2: '140.82.112.3' is not a loopback address",
+		},
+		{
+			name:    "invalid hostname",
+			input:   "127.0.0.1 -a.localhost\n",
+			wantErr: "line 1: invalid hostname '-a.localhost'",
+		},
+		{
+			name:    "comment is not a hostname",
+			input:   "127.0.0.1 #a\n",
+			wantErr: "invalid hostname '#a'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseEntries(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseEntries failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseEntries() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatEntries_RoundTrip(t *testing.T) {
+	entries := []Entry{
+		{IP: "127.0.0.1", Hostname: "users-api.localhost"},
+		{IP: "127.0.0.2", Hostname: "users-db.localhost"},
+	}
+	got, err := ParseEntries(strings.NewReader(FormatEntries(entries)))
+	if err != nil {
+		t.Fatalf("ParseEntries failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, entries) {
+		t.Errorf("round trip = %+v, want %+v", got, entries)
+	}
+}
+
+func TestSudoHelper(t *testing.T) {
+	type call struct {
+		args  []string
+		stdin string
+	}
+	var calls []call
+	h := &sudoHelper{exe: "/usr/local/bin/kubectl-localmesh", owner: testOwner, run: func(stdin io.Reader, _ io.Writer, args ...string) error {
+		c := call{args: args}
+		if stdin != nil {
+			data, err := io.ReadAll(stdin)
+			if err != nil {
+				return err
+			}
+			c.stdin = string(data)
+		}
+		calls = append(calls, c)
+		return nil
+	}}
+
+	entries := []Entry{{IP: "127.0.0.1", Hostname: "users-api.localhost"}}
+	if err := h.Add(entries); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Update(entries); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Remove(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []call{
+		{args: []string{"/usr/local/bin/kubectl-localmesh", "hosts", "apply", "--id", "0123abcd", "--name", "backend", "--pid", "4242", "--start", "1767225600"}, stdin: "127.0.0.1 users-api.localhost\n"},
+		{args: []string{"/usr/local/bin/kubectl-localmesh", "hosts", "apply", "--id", "0123abcd", "--name", "backend", "--pid", "4242", "--start", "1767225600", "--replace"}, stdin: "127.0.0.1 users-api.localhost\n"},
+		{args: []string{"/usr/local/bin/kubectl-localmesh", "hosts", "remove", "--id", "0123abcd"}},
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %+v, want %+v", calls, want)
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"bufio"
 	"fmt"
 	"os"
-	"strings"
+	"path/filepath"
+	"slices"
+	"syscall"
 )
 
 var hostsFile = "/etc/hosts"
@@ -23,95 +25,245 @@ func HasPermission() bool {
 	return true
 }
 
-// AddEntries adds hostname entries to /etc/hosts
-func AddEntries(hostnames []string) error {
-	// 1. ファイル状態を検証
+// Entry is a hostname and the address it resolves to in /etc/hosts.
+type Entry struct {
+	IP       string
+	Hostname string
+}
+
+// LoopbackEntries returns entries resolving each hostname to 127.0.0.1.
+func LoopbackEntries(hostnames []string) []Entry {
+	entries := make([]Entry, 0, len(hostnames))
+	for _, hostname := range hostnames {
+		entries = append(entries, Entry{IP: "127.0.0.1", Hostname: hostname})
+	}
+	return entries
+}
+
+// AddEntries adds hostname entries to /etc/hosts as the block of owner.
+// Blocks of other instances are kept. It fails if a marker is broken, if
+// another block has the same instance name, or if one of the hostnames is in
+// another block (see ReclaimStale for the blocks of stopped instances).
+func AddEntries(owner Owner, entries []Entry) error {
+	return withLock(func() error { return writeBlock(owner, entries, false) })
+}
+
+// UpdateEntries replaces the hostname entries of the block of owner in /etc/hosts.
+// It is used on config reload, when the block written by AddEntries is owned by this process.
+func UpdateEntries(owner Owner, entries []Entry) error {
+	return withLock(func() error { return writeBlock(owner, entries, true) })
+}
+
+// writeBlock は、ownerの管理ブロックを書き込む。
+// replaceがtrueの場合は同じIDのブロックをその位置で置き換え、それ以外は末尾に追加する。
+func writeBlock(owner Owner, entries []Entry, replace bool) error {
+	// 1. ファイル状態を検証（壊れたマーカーがある場合はどのブロックも特定できない）
 	state, err := validateHostsFile()
 	if err != nil {
 		return fmt.Errorf("failed to validate /etc/hosts: %w", err)
 	}
-
-	// 2. 無効状態の場合はエラーを返す
 	if !state.isValid {
 		return newHostsFileCorruptedError(state)
 	}
 
-	// 3. 現在のファイル内容を読み込み、正規化
+	// 2. 現在のファイル内容を読み込み、正規化
 	lines, err := readAndNormalizeFile()
 	if err != nil {
 		return err
 	}
 
-	// ファイルが空でない場合、1行の空行で区切る
-	if len(lines) > 0 {
-		lines = append(lines, "")
+	// 3. 他のインスタンスのブロックとの衝突を確認
+	var own *Block
+	var others []Block
+	for _, b := range scanBlocks(lines).blocks {
+		if replace && own == nil && b.Owner.ID == owner.ID {
+			if !b.ownedBy(owner.UID) {
+				return b.notOwnedError()
+			}
+			own = &b
+			continue
+		}
+		others = append(others, b)
+	}
+	if err := checkConflicts(others, owner, entries); err != nil {
+		return err
+	}
+
+	// 4. 管理ブロックを置き換えるか末尾に追加して1回で書き込む
+	if own == nil {
+		return writeLinesToFile(appendManagedBlock(lines, owner, entries))
 	}
+	replaced := slices.Concat(lines[:own.start], managedBlock(owner, entries), lines[own.end+1:])
+	return writeLinesToFile(replaced)
+}
 
-	// マーカー開始（直接追加、先頭に改行を入れない）
-	lines = append(lines, markerStart)
+// managedBlock は、マーカーで囲んだホスト名エントリの行を返す
+func managedBlock(owner Owner, entries []Entry) []string {
+	// マーカー開始
+	lines := []string{owner.marker()}
 
 	// 各ホスト名のエントリを追加
-	for _, hostname := range hostnames {
-		entry := fmt.Sprintf("127.0.0.1 %s", hostname)
-		lines = append(lines, entry)
+	for _, e := range entries {
+		lines = append(lines, fmt.Sprintf("%s %s", e.IP, e.Hostname))
 	}
 
 	// マーカー終了
-	lines = append(lines, markerEnd)
+	return append(lines, markerEnd)
+}
+
+// appendManagedBlock は、管理ブロックを行の末尾に追加する
+func appendManagedBlock(lines []string, owner Owner, entries []Entry) []string {
+	// ファイルが空でない場合、1行の空行で区切る
+	if len(lines) > 0 {
+		lines = append(lines, "")
+	}
+	return append(lines, managedBlock(owner, entries)...)
+}
 
-	// ファイルに書き込み
-	return writeLinesToFile(lines)
+// RemoveEntries removes the block of owner from /etc/hosts. Blocks of other
+// instances are left as they are.
+func RemoveEntries(owner Owner) error {
+	return withLock(func() error { return removeEntries(owner) })
 }
 
-// RemoveEntries removes kubectl-localmesh entries from /etc/hosts
-func RemoveEntries() error {
-	// /etc/hostsを読み込む
-	f, err := os.Open(hostsFile)
-	if err != nil {
-		// ファイルが存在しない場合は何もしない（エラーではない）
-		if os.IsNotExist(err) {
-			return nil
+// removeEntries は、ownerのブロックを取り除く（ロックを保持して呼び出す）
+func removeEntries(owner Owner) error {
+	lines, err := readLines()
+	if err != nil || lines == nil {
+		return err
+	}
+
+	scanned := scanBlocks(lines)
+	remove := func(b Block) bool { return b.Closed && b.Owner.ID == owner.ID }
+	if !slices.ContainsFunc(scanned.blocks, remove) {
+		return nil
+	}
+	for _, b := range scanned.blocks {
+		if remove(b) && !b.ownedBy(owner.UID) {
+			return b.notOwnedError()
 		}
-		return fmt.Errorf("failed to open %s: %w", hostsFile, err)
 	}
-	defer func() { _ = f.Close() }()
 
-	var lines []string
-	scanner := bufio.NewScanner(f)
-	inManagedBlock := false
+	// 末尾の空行を正規化してファイルに書き戻す
+	return writeLinesToFile(normalizeFileEnding(removeBlocks(lines, scanned, remove, false)))
+}
 
-	for scanner.Scan() {
-		line := scanner.Text()
+// ReclaimStale removes the blocks whose owner process is no longer running,
+// e.g. after up was killed or the machine crashed, and returns them. Blocks
+// of running or unknown owners are kept, and nothing is changed if a marker
+// is broken.
+func ReclaimStale() (stale []Block, err error) {
+	err = withLock(func() error {
+		stale, err = reclaimStale()
+		return err
+	})
+	return stale, err
+}
 
-		if strings.TrimSpace(line) == markerStart {
-			inManagedBlock = true
-			// マーカー開始の直前の空行を削除
-			if len(lines) > 0 && lines[len(lines)-1] == "" {
-				lines = lines[:len(lines)-1]
-			}
-			continue
-		}
+// reclaimStale は、所有プロセスが終了したブロックを取り除く（ロックを保持して呼び出す）
+func reclaimStale() ([]Block, error) {
+	lines, err := readLines()
+	if err != nil || lines == nil {
+		return nil, err
+	}
 
-		if strings.TrimSpace(line) == markerEnd {
-			inManagedBlock = false
-			continue
+	scanned := scanBlocks(lines)
+	if scanned.broken() {
+		return nil, nil
+	}
+	var stale []Block
+	for _, b := range scanned.blocks {
+		if b.Status() == "stopped" {
+			stale = append(stale, b)
 		}
+	}
+	if len(stale) == 0 {
+		return nil, nil
+	}
 
-		// 管理対象ブロック外の行のみ保持
-		if !inManagedBlock {
-			lines = append(lines, line)
-		}
+	remove := func(b Block) bool {
+		return slices.ContainsFunc(stale, func(s Block) bool { return s.start == b.start })
+	}
+	if err := writeLinesToFile(normalizeFileEnding(removeBlocks(lines, scanned, remove, false))); err != nil {
+		return nil, err
 	}
+	return stale, nil
+}
 
-	if err := scanner.Err(); err != nil {
+// Clean removes every block that is not owned by a running instance
+// (including blocks written by older versions and blocks without an end
+// marker) and end markers without a start marker. It returns the removed
+// blocks and the number of removed end markers.
+func Clean() (removed []Block, orphanEnds int, err error) {
+	err = withLock(func() error {
+		removed, orphanEnds, err = clean()
 		return err
+	})
+	return removed, orphanEnds, err
+}
+
+// clean は、実行中のインスタンス以外のブロックを取り除く（ロックを保持して呼び出す）
+func clean() ([]Block, int, error) {
+	lines, err := readLines()
+	if err != nil || lines == nil {
+		return nil, 0, err
+	}
+
+	scanned := scanBlocks(lines)
+	var removed []Block
+	for _, b := range scanned.blocks {
+		if b.Status() != "running" {
+			removed = append(removed, b)
+		}
+	}
+	if len(removed) == 0 && len(scanned.orphanEnds) == 0 {
+		return nil, 0, nil
+	}
+
+	remove := func(b Block) bool { return b.Status() != "running" }
+	if err := writeLinesToFile(normalizeFileEnding(removeBlocks(lines, scanned, remove, true))); err != nil {
+		return nil, 0, err
+	}
+	return removed, len(scanned.orphanEnds), nil
+}
+
+// Inspect returns the kubectl-localmesh blocks in /etc/hosts and the line
+// numbers of end markers without a start marker.
+func Inspect() ([]Block, []int, error) {
+	lines, err := readLines()
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// 末尾の空行を正規化
-	lines = normalizeFileEnding(lines)
+	scanned := scanBlocks(lines)
+	var orphanEnds []int
+	for _, i := range scanned.orphanEnds {
+		orphanEnds = append(orphanEnds, i+1)
+	}
+	return scanned.blocks, orphanEnds, nil
+}
+
+// readLines は、hostsファイルの行を読み込む（ファイルが存在しない場合はnil）
+func readLines() ([]string, error) {
+	f, err := os.Open(hostsFile)
+	if err != nil {
+		// ファイルが存在しない場合は何もしない（エラーではない）
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open %s: %w", hostsFile, err)
+	}
+	defer func() { _ = f.Close() }()
 
-	// ファイルに書き戻す
-	return writeLinesToFile(lines)
+	lines := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
 }
 
 // trimTrailingEmptyLines は、スライスの末尾にある全ての空行を削除する
@@ -130,35 +282,46 @@ func normalizeFileEnding(lines []string) []string {
 
 // readAndNormalizeFile は、hostsファイルを読み込み、末尾を正規化する
 func readAndNormalizeFile() ([]string, error) {
-	f, err := os.Open(hostsFile)
+	lines, err := readLines()
 	if err != nil {
-		if os.IsNotExist(err) {
-			return []string{}, nil
-		}
-		return nil, fmt.Errorf("failed to open %s: %w", hostsFile, err)
+		return nil, err
 	}
-	defer func() { _ = f.Close() }()
-
-	var lines []string
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
+	if lines == nil {
+		return []string{}, nil
 	}
+	return normalizeFileEnding(lines), nil
+}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+// lockPath は、hostsファイルの読み込みから書き込みまでを排他するロックファイルのパスを返す。
+// hostsファイル自体は置き換えるため、同じディレクトリの別のファイルをロックする。
+func lockPath() string {
+	return filepath.Join(filepath.Dir(hostsFile), ".kubectl-localmesh-hosts.lock")
+}
+
+// withLock は、ロックファイルの排他ロックを保持してfnを実行する。
+// 複数のインスタンスやhelperが同時にブロックを書き換えても、互いの変更を失わないようにする。
+func withLock(fn func() error) error {
+	f, err := os.OpenFile(lockPath(), os.O_RDWR|os.O_CREATE|syscall.O_NOFOLLOW, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open lock file: %w", err)
 	}
+	defer func() { _ = f.Close() }()
 
-	return normalizeFileEnding(lines), nil
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("failed to lock %s: %w", lockPath(), err)
+	}
+	defer func() { _ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN) }()
+	return fn()
 }
 
 // writeLinesToFile は、行のスライスをhostsファイルにアトミックに書き込む
 func writeLinesToFile(lines []string) error {
-	tmpFile := hostsFile + ".tmp"
-	out, err := os.Create(tmpFile)
+	// 一時ファイルは推測できない名前で同じディレクトリに作成する（renameをアトミックにするため）
+	out, err := os.CreateTemp(filepath.Dir(hostsFile), ".hosts.tmp-")
 	if err != nil {
 		return fmt.Errorf("failed to create temp file: %w", err)
 	}
+	tmpFile := out.Name()
 	defer func() { _ = os.Remove(tmpFile) }()
 
 	for _, line := range lines {
@@ -172,6 +335,15 @@ func writeLinesToFile(lines []string) error {
 		return err
 	}
 
+	// CreateTempは0600で作成するため、元のファイルのパーミッションに合わせる
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(hostsFile); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	if err := os.Chmod(tmpFile, mode); err != nil {
+		return err
+	}
+
 	if err := os.Rename(tmpFile, hostsFile); err != nil {
 		return fmt.Errorf("failed to replace %s: %w", hostsFile, err)
 	}
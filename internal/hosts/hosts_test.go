@@ -1,9 +1,11 @@
 package hosts
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -17,6 +19,29 @@ func setTestHostsFile(t *testing.T, path string) {
 	})
 }
 
+// testOwner は、テストで書き込むブロックの所有者
+var testOwner = Owner{Name: "backend", ID: "0123abcd", PID: 4242, Start: 1767225600, UID: 1000}
+
+// setProcessRunning は、所有者のプロセスが実行中かの判定を差し替え、テスト終了時に元に戻す
+func setProcessRunning(t *testing.T, running func(pid int, start int64) bool) {
+	t.Helper()
+	original := processRunning
+	processRunning = running
+	t.Cleanup(func() {
+		processRunning = original
+	})
+}
+
+// setProcessUID は、プロセスのユーザーの取得を差し替え、テスト終了時に元に戻す
+func setProcessUID(t *testing.T, uid func(pid int) (int, error)) {
+	t.Helper()
+	original := processUID
+	processUID = uid
+	t.Cleanup(func() {
+		processUID = original
+	})
+}
+
 // TestAddEntries_EmptyFile は、空ファイルへの初回追加をテストする
 func TestAddEntries_EmptyFile(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -30,7 +55,7 @@ func TestAddEntries_EmptyFile(t *testing.T) {
 
 	hostnames := []string{"test.localhost", "api.localhost"}
 
-	if err := AddEntries(hostnames); err != nil {
+	if err := AddEntries(testOwner, LoopbackEntries(hostnames)); err != nil {
 		t.Fatalf("AddEntries failed: %v", err)
 	}
 
@@ -40,13 +65,13 @@ func TestAddEntries_EmptyFile(t *testing.T) {
 	}
 
 	// 期待される内容:
-	// # kubectl-localmesh: managed by kubectl-localmesh
+	// # kubectl-localmesh: managed by kubectl-localmesh name=backend id=0123abcd pid=4242 start=1767225600
 	// 127.0.0.1 test.localhost
 	// 127.0.0.1 api.localhost
 	// # kubectl-localmesh: end
 	// (最後に1つの改行)
 
-	expected := markerStart + "\n" +
+	expected := testOwner.marker() + "\n" +
 		"127.0.0.1 test.localhost\n" +
 		"127.0.0.1 api.localhost\n" +
 		markerEnd + "\n"
@@ -70,7 +95,7 @@ func TestAddEntries_ExistingContent(t *testing.T) {
 
 	hostnames := []string{"test.localhost"}
 
-	if err := AddEntries(hostnames); err != nil {
+	if err := AddEntries(testOwner, LoopbackEntries(hostnames)); err != nil {
 		t.Fatalf("AddEntries failed: %v", err)
 	}
 
@@ -83,7 +108,7 @@ func TestAddEntries_ExistingContent(t *testing.T) {
 	// 127.0.0.1 localhost
 	// ::1 localhost
 	// (空行)
-	// # kubectl-localmesh: managed by kubectl-localmesh
+	// # kubectl-localmesh: managed by kubectl-localmesh name=backend id=0123abcd pid=4242
 	// 127.0.0.1 test.localhost
 	// # kubectl-localmesh: end
 	// (最後に1つの改行)
@@ -91,7 +116,7 @@ func TestAddEntries_ExistingContent(t *testing.T) {
 	expected := "127.0.0.1 localhost\n" +
 		"::1 localhost\n" +
 		"\n" +
-		markerStart + "\n" +
+		testOwner.marker() + "\n" +
 		"127.0.0.1 test.localhost\n" +
 		markerEnd + "\n"
 
@@ -110,7 +135,7 @@ func TestRemoveEntries_CleanRemoval(t *testing.T) {
 	initialContent := "127.0.0.1 localhost\n" +
 		"::1 localhost\n" +
 		"\n" +
-		markerStart + "\n" +
+		testOwner.marker() + "\n" +
 		"127.0.0.1 test.localhost\n" +
 		markerEnd + "\n"
 
@@ -118,7 +143,7 @@ func TestRemoveEntries_CleanRemoval(t *testing.T) {
 		t.Fatalf("failed to create test file: %v", err)
 	}
 
-	if err := RemoveEntries(); err != nil {
+	if err := RemoveEntries(testOwner); err != nil {
 		t.Fatalf("RemoveEntries failed: %v", err)
 	}
 
@@ -152,12 +177,12 @@ func TestAddRemoveMultipleTimes(t *testing.T) {
 	// 3回繰り返し
 	for i := 0; i < 3; i++ {
 		// 追加
-		if err := AddEntries(hostnames); err != nil {
+		if err := AddEntries(testOwner, LoopbackEntries(hostnames)); err != nil {
 			t.Fatalf("iteration %d: AddEntries failed: %v", i, err)
 		}
 
 		// 削除
-		if err := RemoveEntries(); err != nil {
+		if err := RemoveEntries(testOwner); err != nil {
 			t.Fatalf("iteration %d: RemoveEntries failed: %v", i, err)
 		}
 
@@ -188,6 +213,156 @@ func TestAddRemoveMultipleTimes(t *testing.T) {
 	}
 }
 
+// TestUpdateEntries_ReplacesBlock は、既存の管理ブロックが置き換えられることをテストする
+func TestUpdateEntries_ReplacesBlock(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "hosts")
+	setTestHostsFile(t, testFile)
+
+	initialContent := "127.0.0.1 localhost\n::1 localhost\n"
+	if err := os.WriteFile(testFile, []byte(initialContent), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+
+	if err := AddEntries(testOwner, LoopbackEntries([]string{"test.localhost", "api.localhost"})); err != nil {
+		t.Fatalf("AddEntries failed: %v", err)
+	}
+
+	if err := UpdateEntries(testOwner, LoopbackEntries([]string{"api.localhost", "new.localhost"})); err != nil {
+		t.Fatalf("UpdateEntries failed: %v", err)
+	}
+
+	content, err := os.ReadFile(testFile)
+	if err != nil {
+		t.Fatalf("failed to read test file: %v", err)
+	}
+
+	expected := initialContent +
+		"\n" +
+		testOwner.marker() + "\n" +
+		"127.0.0.1 api.localhost\n" +
+		"127.0.0.1 new.localhost\n" +
+		markerEnd + "\n"
+
+	if string(content) != expected {
+		t.Errorf("unexpected content:\ngot:\n%q\nwant:\n%q", string(content), expected)
+	}
+
+	// 削除後は初期内容に戻る
+	if err := RemoveEntries(testOwner); err != nil {
+		t.Fatalf("RemoveEntries failed: %v", err)
+	}
+	content, err = os.ReadFile(testFile)
+	if err != nil {
+		t.Fatalf("failed to read test file: %v", err)
+	}
+	if string(content) != initialContent {
+		t.Errorf("unexpected content after remove:\ngot:\n%q\nwant:\n%q", string(content), initialContent)
+	}
+}
+
+// TestAddEntries_PerEntryAddress は、エントリごとのアドレスで書き込まれることをテストする
+func TestAddEntries_PerEntryAddress(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "hosts")
+	setTestHostsFile(t, testFile)
+
+	entries := []Entry{
+		{IP: "127.0.0.1", Hostname: "api.localhost"},
+		{IP: "127.0.0.2", Hostname: "users-db.localhost"},
+		{IP: "127.0.0.3", Hostname: "billing-db.localhost"},
+	}
+	if err := AddEntries(testOwner, entries); err != nil {
+		t.Fatalf("AddEntries failed: %v", err)
+	}
+
+	content, err := os.ReadFile(testFile)
+	if err != nil {
+		t.Fatalf("failed to read test file: %v", err)
+	}
+	expected := testOwner.marker() + "\n" +
+		"127.0.0.1 api.localhost\n" +
+		"127.0.0.2 users-db.localhost\n" +
+		"127.0.0.3 billing-db.localhost\n" +
+		markerEnd + "\n"
+	if string(content) != expected {
+		t.Errorf("unexpected content:\ngot:\n%q\nwant:\n%q", string(content), expected)
+	}
+}
+
+// TestUpdateEntries_RejectsCorruptedFile は、壊れた状態のファイルを更新しないことをテストする
+func TestUpdateEntries_RejectsCorruptedFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "hosts")
+	setTestHostsFile(t, testFile)
+
+	initialContent := "127.0.0.1 localhost\n" +
+		testOwner.marker() + "\n" +
+		"127.0.0.1 test.localhost\n"
+	if err := os.WriteFile(testFile, []byte(initialContent), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+
+	err := UpdateEntries(testOwner, LoopbackEntries([]string{"api.localhost"}))
+	if err == nil {
+		t.Fatal("expected error for unclosed block, got nil")
+	}
+	if _, ok := err.(*hostsFileCorruptedError); !ok {
+		t.Errorf("expected *hostsFileCorruptedError, got %T", err)
+	}
+}
+
+// TestAddEntries_Concurrent は、複数のインスタンスが同時に書き込んでもブロックが失われないことをテストする
+func TestAddEntries_Concurrent(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "hosts")
+	setTestHostsFile(t, testFile)
+	setProcessRunning(t, func(int, int64) bool { return true })
+
+	if err := os.WriteFile(testFile, []byte("127.0.0.1 localhost\n"), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := range n {
+		wg.Go(func() {
+			owner := Owner{Name: fmt.Sprintf("instance%d", i), ID: fmt.Sprintf("%08x", i), PID: 1000 + i}
+			errs <- AddEntries(owner, LoopbackEntries([]string{fmt.Sprintf("app%d.localhost", i)}))
+		})
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("AddEntries failed: %v", err)
+		}
+	}
+
+	blocks, _, err := Inspect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != n {
+		t.Errorf("expected %d blocks, got %d", n, len(blocks))
+	}
+
+	// 一時ファイルを残さず、元のファイルのパーミッションを保つ
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.Contains(e.Name(), ".tmp") {
+			t.Errorf("unexpected temp file %s", e.Name())
+		}
+	}
+	if fi, err := os.Stat(testFile); err != nil || fi.Mode().Perm() != 0644 {
+		t.Errorf("expected mode 0644, got %v, %v", fi.Mode(), err)
+	}
+}
+
 // TestNormalizeFileEnding は、normalizeFileEnding関数のユニットテスト
 func TestNormalizeFileEnding(t *testing.T) {
 	tests := []struct {
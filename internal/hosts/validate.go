@@ -8,7 +8,7 @@ import (
 
 // hostsFileState は /etc/hosts ファイルの状態を表す
 type hostsFileState struct {
-	isValid          bool     // ファイルが有効な状態か（マーカーが存在しない）
+	isValid          bool     // ファイルが有効な状態か（すべてのマーカーが対応している）
 	markerBlockCount int      // マーカーブロックの数
 	hasUnclosedBlock bool     // 開始マーカーのみで終了マーカーがない
 	hasOrphanEnd     bool     // 終了マーカーのみで開始マーカーがない
@@ -37,9 +37,11 @@ func (e *hostsFileCorruptedError) Error() string {
 	sb.WriteString(e.state.fileContent)
 	sb.WriteString("---\n")
 	sb.WriteString("\nTo fix:\n")
-	sb.WriteString("1. Manually edit /etc/hosts with sudo, like `sudo vim -u NONE /etc/hosts`\n")
-	sb.WriteString("2. Remove all lines between and including:\n")
-	sb.WriteString(fmt.Sprintf("     %s\n", markerStart))
+	sb.WriteString("1. Run `sudo kubectl-localmesh hosts clean` to remove the entries of stopped instances and broken markers\n")
+	sb.WriteString("   (`kubectl-localmesh hosts show` lists the blocks and their owners)\n")
+	sb.WriteString("2. Or manually edit /etc/hosts with sudo, like `sudo vim -u NONE /etc/hosts`,\n")
+	sb.WriteString("   and remove the lines of the broken block between and including:\n")
+	sb.WriteString(fmt.Sprintf("     %s ...\n", markerStart))
 	sb.WriteString(fmt.Sprintf("     %s\n", markerEnd))
 	sb.WriteString("3. Run kubectl-localmesh again\n")
 
@@ -80,8 +82,9 @@ func validateHostsFile() (*hostsFileState, error) {
 		trimmed := strings.TrimSpace(line)
 		lineNum := i + 1 // 1-indexed for user display
 
-		switch trimmed {
-		case markerStart:
+		_, isStart := parseStartMarker(trimmed)
+		switch {
+		case isStart:
 			if inBlock {
 				// ネストした開始マーカー
 				state.hasNestedMarkers = true
@@ -91,7 +94,7 @@ func validateHostsFile() (*hostsFileState, error) {
 			inBlock = true
 			startLineNumber = lineNum
 			blockCount++
-		case markerEnd:
+		case trimmed == markerEnd:
 			if !inBlock {
 				// 孤立した終了マーカー
 				state.hasOrphanEnd = true
@@ -111,23 +114,8 @@ func validateHostsFile() (*hostsFileState, error) {
 
 	state.markerBlockCount = blockCount
 
-	// マーカーブロックが存在する場合は無効（ユーザー要件）
-	if blockCount >= 1 {
-		if blockCount == 1 && !state.hasUnclosedBlock && !state.hasOrphanEnd && !state.hasNestedMarkers {
-			// 正常なブロック1つ = 前回のクリーンアップ失敗
-			state.problems = append([]string{
-				fmt.Sprintf("Existing kubectl-localmesh entries found (%d block). Clean shutdown may have failed.", blockCount),
-			}, state.problems...)
-		} else if blockCount > 1 {
-			// 複数ブロック
-			state.problems = append([]string{
-				fmt.Sprintf("Multiple marker blocks found (%d blocks). Only one is expected.", blockCount),
-			}, state.problems...)
-		}
-	}
-
-	// 有効性判定
-	if blockCount > 0 || state.hasUnclosedBlock || state.hasOrphanEnd || state.hasNestedMarkers {
+	// 有効性判定（インスタンスごとの正常なブロックは複数あってもよい）
+	if state.hasUnclosedBlock || state.hasOrphanEnd || state.hasNestedMarkers {
 		state.isValid = false
 	}
 
@@ -61,52 +61,18 @@ func TestValidateHostsFile_Valid_NoMarkers(t *testing.T) {
 	}
 }
 
-// TestValidateHostsFile_Invalid_SingleBlock は、正常なマーカーブロック1つが無効と判定されることをテストする
-func TestValidateHostsFile_Invalid_SingleBlock(t *testing.T) {
+// TestValidateHostsFile_Valid_Blocks は、正常なマーカーブロックが複数あっても有効と判定されることをテストする
+func TestValidateHostsFile_Valid_Blocks(t *testing.T) {
 	tmpDir := t.TempDir()
 	testFile := filepath.Join(tmpDir, "hosts")
 	setTestHostsFile(t, testFile)
 
 	content := "127.0.0.1 localhost\n\n" +
-		markerStart + "\n" +
-		"127.0.0.1 test.localhost\n" +
-		markerEnd + "\n"
-	if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
-		t.Fatalf("failed to create test file: %v", err)
-	}
-
-	state, err := validateHostsFile()
-	if err != nil {
-		t.Fatalf("validateHostsFile failed: %v", err)
-	}
-
-	if state.isValid {
-		t.Errorf("expected isValid=false, got true")
-	}
-	if state.markerBlockCount != 1 {
-		t.Errorf("expected markerBlockCount=1, got %d", state.markerBlockCount)
-	}
-	if len(state.problems) == 0 {
-		t.Errorf("expected problems, got none")
-	}
-	// 問題メッセージに "Existing kubectl-localmesh entries found" が含まれることを確認
-	if !strings.Contains(state.problems[0], "Existing kubectl-localmesh entries found") {
-		t.Errorf("expected problem about existing entries, got %s", state.problems[0])
-	}
-}
-
-// TestValidateHostsFile_Invalid_MultipleBlocks は、複数のマーカーブロックが無効と判定されることをテストする
-func TestValidateHostsFile_Invalid_MultipleBlocks(t *testing.T) {
-	tmpDir := t.TempDir()
-	testFile := filepath.Join(tmpDir, "hosts")
-	setTestHostsFile(t, testFile)
-
-	content := "127.0.0.1 localhost\n\n" +
-		markerStart + "\n" +
-		"127.0.0.1 old.localhost\n" +
+		markerStart + " name=backend id=0123abcd pid=100\n" +
+		"127.0.0.1 api.localhost\n" +
 		markerEnd + "\n\n" +
-		markerStart + "\n" +
-		"127.0.0.1 test.localhost\n" +
+		markerStart + " name=data id=4567cdef pid=200\n" +
+		"127.0.0.2 db.localhost\n" +
 		markerEnd + "\n"
 	if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
 		t.Fatalf("failed to create test file: %v", err)
@@ -117,18 +83,14 @@ func TestValidateHostsFile_Invalid_MultipleBlocks(t *testing.T) {
 		t.Fatalf("validateHostsFile failed: %v", err)
 	}
 
-	if state.isValid {
-		t.Errorf("expected isValid=false, got true")
+	if !state.isValid {
+		t.Errorf("expected isValid=true, got false")
 	}
 	if state.markerBlockCount != 2 {
 		t.Errorf("expected markerBlockCount=2, got %d", state.markerBlockCount)
 	}
-	if len(state.problems) == 0 {
-		t.Errorf("expected problems, got none")
-	}
-	// 問題メッセージに "Multiple marker blocks found" が含まれることを確認
-	if !strings.Contains(state.problems[0], "Multiple marker blocks found") {
-		t.Errorf("expected problem about multiple blocks, got %s", state.problems[0])
+	if len(state.problems) != 0 {
+		t.Errorf("expected no problems, got %v", state.problems)
 	}
 }
 
@@ -276,9 +238,9 @@ func TestValidateHostsFile_Invalid_Combined(t *testing.T) {
 	if !state.hasUnclosedBlock {
 		t.Errorf("expected hasUnclosedBlock=true, got false")
 	}
-	// 複数の問題が報告されることを確認
-	if len(state.problems) < 2 {
-		t.Errorf("expected at least 2 problems, got %d", len(state.problems))
+	// 未完結のブロックのみが問題として報告されることを確認
+	if len(state.problems) != 1 || !strings.Contains(state.problems[0], "Unclosed block") {
+		t.Errorf("expected a problem about the unclosed block, got %v", state.problems)
 	}
 }
 
@@ -288,11 +250,10 @@ func TestAddEntries_RejectsInvalidState(t *testing.T) {
 	testFile := filepath.Join(tmpDir, "hosts")
 	setTestHostsFile(t, testFile)
 
-	// 既存のマーカーブロックを作成
+	// 終了マーカーのないブロックを作成
 	content := "127.0.0.1 localhost\n\n" +
 		markerStart + "\n" +
-		"127.0.0.1 old.localhost\n" +
-		markerEnd + "\n"
+		"127.0.0.1 old.localhost\n"
 	if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
 		t.Fatalf("failed to create test file: %v", err)
 	}
@@ -300,7 +261,7 @@ func TestAddEntries_RejectsInvalidState(t *testing.T) {
 	hostnames := []string{"new.localhost"}
 
 	// AddEntries()はエラーを返すべき
-	err := AddEntries(hostnames)
+	err := AddEntries(testOwner, LoopbackEntries(hostnames))
 	if err == nil {
 		t.Fatalf("expected error, got nil")
 	}
@@ -317,13 +278,13 @@ func TestHostsFileCorruptedError_Message(t *testing.T) {
 	state := &hostsFileState{
 		isValid:          false,
 		markerBlockCount: 1,
+		hasUnclosedBlock: true,
 		problems: []string{
-			"Existing kubectl-localmesh entries found (1 block). Clean shutdown may have failed.",
+			"Unclosed block: start marker at line 3 has no matching end marker",
 		},
 		fileContent: "127.0.0.1 localhost\n\n" +
 			markerStart + "\n" +
-			"127.0.0.1 test.localhost\n" +
-			markerEnd + "\n",
+			"127.0.0.1 test.localhost\n",
 	}
 
 	err := newHostsFileCorruptedError(state)
@@ -332,11 +293,12 @@ func TestHostsFileCorruptedError_Message(t *testing.T) {
 	// エラーメッセージに必要な情報が含まれることを確認
 	requiredStrings := []string{
 		"/etc/hosts is in an invalid state",
-		"Existing kubectl-localmesh entries found",
+		"Unclosed block",
 		"Current /etc/hosts content:",
 		"To fix:",
 		markerStart,
 		markerEnd,
+		"hosts clean",
 	}
 
 	for _, required := range requiredStrings {
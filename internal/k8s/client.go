@@ -1,30 +1,39 @@
 package k8s
 
 import (
+	"fmt"
+
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
+// ClientOptions are the kubectl flags that select the kubeconfig, cluster and
+// user. The zero value uses the current-context of the default kubeconfig.
+type ClientOptions struct {
+	Kubeconfig     string   // --kubeconfig
+	Context        string   // --context
+	Cluster        string   // --cluster
+	User           string   // --user
+	As             string   // --as
+	AsGroups       []string // --as-group
+	RequestTimeout string   // --request-timeout (e.g. "30s", "0" for no timeout)
+}
+
 // NewClient creates a new Kubernetes client using the default kubeconfig rules.
 // It follows the same discovery order as kubectl:
-// 1. $KUBECONFIG environment variable
-// 2. ~/.kube/config
-// Uses the current-context from the kubeconfig.
-func NewClient() (*kubernetes.Clientset, *rest.Config, error) {
-	// kubeconfigのロードルール
-	// clientcmd.NewDefaultClientConfigLoadingRules() は以下の順序で検索:
-	// 1. $KUBECONFIG環境変数で指定されたパス
-	// 2. ~/.kube/config（デフォルト）
-	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
-
-	// current-contextを使用してRESTConfigを作成
-	configOverrides := &clientcmd.ConfigOverrides{}
+// 1. opts.Kubeconfig (--kubeconfig)
+// 2. $KUBECONFIG environment variable
+// 3. ~/.kube/config
+// Uses opts.Context, or the current-context from the kubeconfig when it is
+// empty. The other options override the context like the kubectl flags.
+func NewClient(opts ClientOptions) (*kubernetes.Clientset, *rest.Config, error) {
+	if len(opts.AsGroups) > 0 && opts.As == "" {
+		return nil, nil, fmt.Errorf("--as-group requires --as")
+	}
 
-	kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
-		loadingRules,
-		configOverrides,
-	)
+	kubeConfig := clientConfig(opts)
 
 	// RESTConfig取得
 	restConfig, err := kubeConfig.ClientConfig()
@@ -40,3 +49,46 @@ func NewClient() (*kubernetes.Clientset, *rest.Config, error) {
 
 	return clientset, restConfig, nil
 }
+
+// CurrentContext returns the name of the kubeconfig context that NewClient
+// uses for opts.
+func CurrentContext(opts ClientOptions) (string, error) {
+	if opts.Context != "" {
+		return opts.Context, nil
+	}
+	raw, err := clientConfig(opts).RawConfig()
+	if err != nil {
+		return "", err
+	}
+	return raw.CurrentContext, nil
+}
+
+// clientConfig は、kubectlと同じ規則でkubeconfigを読み込むClientConfigを返す
+func clientConfig(opts ClientOptions) clientcmd.ClientConfig {
+	// kubeconfigのロードルール
+	// clientcmd.NewDefaultClientConfigLoadingRules() は以下の順序で検索:
+	// 1. $KUBECONFIG環境変数で指定されたパス
+	// 2. ~/.kube/config（デフォルト）
+	// ExplicitPathを指定した場合はそのファイルのみを使用する
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = opts.Kubeconfig
+
+	// 空の値は上書きしない（current-contextとその設定を使用する）
+	configOverrides := &clientcmd.ConfigOverrides{
+		CurrentContext: opts.Context,
+		Context: clientcmdapi.Context{
+			Cluster:  opts.Cluster,
+			AuthInfo: opts.User,
+		},
+		AuthInfo: clientcmdapi.AuthInfo{
+			Impersonate:       opts.As,
+			ImpersonateGroups: opts.AsGroups,
+		},
+		Timeout: opts.RequestTimeout,
+	}
+
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		loadingRules,
+		configOverrides,
+	)
+}
@@ -3,7 +3,10 @@ package k8s
 import (
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewClient_ValidKubeconfig(t *testing.T) {
@@ -40,7 +43,7 @@ users:
 	t.Setenv("KUBECONFIG", kubeconfigPath)
 
 	// テスト実行
-	clientset, restConfig, err := NewClient()
+	clientset, restConfig, err := NewClient(ClientOptions{})
 
 	// アサーション
 	if err != nil {
@@ -71,7 +74,7 @@ func TestNewClient_InvalidKubeconfig(t *testing.T) {
 
 	t.Setenv("KUBECONFIG", invalidKubeconfigPath)
 
-	_, _, err = NewClient()
+	_, _, err = NewClient(ClientOptions{})
 	if err == nil {
 		t.Fatal("expected error for invalid kubeconfig, got nil")
 	}
@@ -85,8 +88,165 @@ func TestNewClient_NoKubeconfig(t *testing.T) {
 	t.Setenv("KUBECONFIG", nonExistentPath)
 	t.Setenv("HOME", tmpDir) // ~/.kube/configも存在しないようにする
 
-	_, _, err := NewClient()
+	_, _, err := NewClient(ClientOptions{})
 	if err == nil {
 		t.Fatal("expected error for non-existent kubeconfig, got nil")
 	}
 }
+
+func TestNewClient_Options(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	kubeconfigContent := `apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    server: https://127.0.0.1:6443
+  name: dev-cluster
+- cluster:
+    server: https://10.0.0.1:6443
+  name: prod-cluster
+contexts:
+- context:
+    cluster: dev-cluster
+    user: dev-user
+  name: dev
+- context:
+    cluster: prod-cluster
+    user: prod-user
+  name: prod
+current-context: prod
+users:
+- name: dev-user
+  user:
+    token: dev-token
+- name: prod-user
+  user:
+    token: prod-token
+`
+	kubeconfigPath := filepath.Join(tmpDir, "kubeconfig")
+	if err := os.WriteFile(kubeconfigPath, []byte(kubeconfigContent), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// --kubeconfigが$KUBECONFIGより優先される
+	t.Setenv("KUBECONFIG", filepath.Join(tmpDir, "nonexistent-kubeconfig"))
+
+	tests := []struct {
+		name        string
+		opts        ClientOptions
+		wantHost    string
+		wantToken   string
+		wantAs      string
+		wantGroups  []string
+		wantTimeout time.Duration
+		wantErr     string
+	}{
+		{
+			name:      "current-context",
+			opts:      ClientOptions{Kubeconfig: kubeconfigPath},
+			wantHost:  "https://10.0.0.1:6443",
+			wantToken: "prod-token",
+		},
+		{
+			name:      "context",
+			opts:      ClientOptions{Kubeconfig: kubeconfigPath, Context: "dev"},
+			wantHost:  "https://127.0.0.1:6443",
+			wantToken: "dev-token",
+		},
+		{
+			name:      "cluster and user override the context",
+			opts:      ClientOptions{Kubeconfig: kubeconfigPath, Context: "prod", Cluster: "dev-cluster", User: "dev-user"},
+			wantHost:  "https://127.0.0.1:6443",
+			wantToken: "dev-token",
+		},
+		{
+			name:        "impersonation and request timeout",
+			opts:        ClientOptions{Kubeconfig: kubeconfigPath, Context: "dev", As: "jane", AsGroups: []string{"developers", "viewers"}, RequestTimeout: "30s"},
+			wantHost:    "https://127.0.0.1:6443",
+			wantToken:   "dev-token",
+			wantAs:      "jane",
+			wantGroups:  []string{"developers", "viewers"},
+			wantTimeout: 30 * time.Second,
+		},
+		{
+			name:    "unknown context",
+			opts:    ClientOptions{Kubeconfig: kubeconfigPath, Context: "staging"},
+			wantErr: `context "staging" does not exist`,
+		},
+		{
+			name:    "as-group without as",
+			opts:    ClientOptions{Kubeconfig: kubeconfigPath, AsGroups: []string{"developers"}},
+			wantErr: "--as-group requires --as",
+		},
+		{
+			name:    "invalid request timeout",
+			opts:    ClientOptions{Kubeconfig: kubeconfigPath, RequestTimeout: "soon"},
+			wantErr: "Invalid timeout value",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, restConfig, err := NewClient(tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if restConfig.Host != tt.wantHost || restConfig.BearerToken != tt.wantToken {
+				t.Errorf("got host %q token %q, want %q %q", restConfig.Host, restConfig.BearerToken, tt.wantHost, tt.wantToken)
+			}
+			if restConfig.Impersonate.UserName != tt.wantAs || !reflect.DeepEqual(restConfig.Impersonate.Groups, tt.wantGroups) {
+				t.Errorf("unexpected impersonation: %+v", restConfig.Impersonate)
+			}
+			if restConfig.Timeout != tt.wantTimeout {
+				t.Errorf("expected timeout %s, got %s", tt.wantTimeout, restConfig.Timeout)
+			}
+		})
+	}
+}
+
+func TestCurrentContext(t *testing.T) {
+	kubeconfigContent := `apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    server: https://127.0.0.1:6443
+  name: dev-cluster
+contexts:
+- context:
+    cluster: dev-cluster
+    user: dev-user
+  name: dev
+current-context: dev
+users:
+- name: dev-user
+  user:
+    token: dev-token
+`
+	kubeconfigPath := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(kubeconfigPath, []byte(kubeconfigContent), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		opts ClientOptions
+		want string
+	}{
+		{opts: ClientOptions{Kubeconfig: kubeconfigPath}, want: "dev"},
+		{opts: ClientOptions{Kubeconfig: kubeconfigPath, Context: "staging"}, want: "staging"},
+	}
+	for _, tt := range tests {
+		got, err := CurrentContext(tt.opts)
+		if err != nil {
+			t.Fatalf("CurrentContext failed: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("CurrentContext(%+v) = %q, want %q", tt.opts, got, tt.want)
+		}
+	}
+}
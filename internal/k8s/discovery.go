@@ -0,0 +1,46 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DiscoverServices lists the Services in namespace that match the label
+// selector and returns the port named portName of each, or the first port
+// when portName is empty. Services that cannot be port-forwarded (without a
+// pod selector or of type ExternalName) and Services without the port are
+// skipped. The result is sorted by Service name.
+func DiscoverServices(
+	ctx context.Context,
+	clientset kubernetes.Interface,
+	namespace, selector, portName string,
+) ([]ServicePort, error) {
+	list, err := clientset.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services in %s: %w", namespace, err)
+	}
+
+	var ports []ServicePort
+	for _, svc := range list.Items {
+		// port-forwardの転送先のPodを選択できないServiceは対象外
+		if svc.Spec.Type == corev1.ServiceTypeExternalName || len(svc.Spec.Selector) == 0 {
+			continue
+		}
+		for _, p := range svc.Spec.Ports {
+			if portName != "" && p.Name != portName {
+				continue
+			}
+			ports = append(ports, servicePort(svc.Name, p))
+			break
+		}
+	}
+	// fakeのclientsetやAPIサーバーの実装によらず同じ順序にする
+	slices.SortFunc(ports, func(a, b ServicePort) int { return strings.Compare(a.Service, b.Service) })
+	return ports, nil
+}
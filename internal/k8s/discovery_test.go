@@ -0,0 +1,124 @@
+package k8s
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDiscoverServices(t *testing.T) {
+	service := func(name string, labels map[string]string, ports ...corev1.ServicePort) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "shop", Labels: labels},
+			Spec: corev1.ServiceSpec{
+				Selector: map[string]string{"app": name},
+				Ports:    ports,
+			},
+		}
+	}
+	shop := map[string]string{"part-of": "shop"}
+
+	externalName := service("payments", shop, corev1.ServicePort{Name: "http", Port: 80})
+	externalName.Spec.Type = corev1.ServiceTypeExternalName
+	withoutSelector := service("legacy", shop, corev1.ServicePort{Name: "http", Port: 80})
+	withoutSelector.Spec.Selector = nil
+
+	clientset := fake.NewClientset(
+		service("web", shop, corev1.ServicePort{Name: "http", Port: 80}),
+		service("cart", shop,
+			corev1.ServicePort{Name: "metrics", Port: 9100},
+			corev1.ServicePort{Name: "grpc", Port: 9090},
+		),
+		service("admin", map[string]string{"part-of": "backoffice"}, corev1.ServicePort{Name: "http", Port: 8080}),
+		externalName,
+		withoutSelector,
+	)
+
+	tests := []struct {
+		name     string
+		selector string
+		portName string
+		want     []ServicePort
+	}{
+		{
+			name:     "selector and first port",
+			selector: "part-of=shop",
+			want: []ServicePort{
+				{Service: "cart", Port: 9100, Name: "metrics"},
+				{Service: "web", Port: 80, Name: "http", Protocol: "http", InferredFrom: "port name 'http'"},
+			},
+		},
+		{
+			name:     "port name",
+			selector: "part-of=shop",
+			portName: "grpc",
+			want:     []ServicePort{{Service: "cart", Port: 9090, Name: "grpc", Protocol: "grpc", InferredFrom: "port name 'grpc'"}},
+		},
+		{
+			name: "empty selector",
+			want: []ServicePort{
+				{Service: "admin", Port: 8080, Name: "http", Protocol: "http", InferredFrom: "port name 'http'"},
+				{Service: "cart", Port: 9100, Name: "metrics"},
+				{Service: "web", Port: 80, Name: "http", Protocol: "http", InferredFrom: "port name 'http'"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DiscoverServices(context.Background(), clientset, "shop", tt.selector, tt.portName)
+			if err != nil {
+				t.Fatalf("DiscoverServices failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiscoverServices() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInferProtocol(t *testing.T) {
+	tests := []struct {
+		portName     string
+		appProtocol  string
+		want         string
+		wantUpstream string
+	}{
+		{portName: "grpc", want: "grpc"},
+		{portName: "grpc-api", want: "grpc"},
+		{portName: "GRPC-API", want: "grpc"},
+		{portName: "http2-api", want: "grpc"},
+		{portName: "grpc-web", want: "http"},
+		{portName: "grpc-web-api", want: "http"},
+		{portName: "grpcweb", want: ""},
+		{portName: "http", want: "http"},
+		{portName: "http-web", want: "http"},
+		{portName: "metrics", want: ""},
+		{portName: "", want: ""},
+		{portName: "http", appProtocol: "kubernetes.io/h2c", want: "grpc"},
+		{portName: "grpc", appProtocol: "http", want: "http"},
+		{portName: "api", appProtocol: "GRPC", want: "grpc"},
+		{portName: "grpc", appProtocol: "example.com/custom", want: "grpc"},
+		// TLSのポートは上流にTLSで接続する
+		{portName: "web", appProtocol: "https", want: "http", wantUpstream: "auto-tls"},
+		{portName: "web", appProtocol: "kubernetes.io/wss", want: "http", wantUpstream: "http1-tls"},
+		{portName: "https-web", want: "http", wantUpstream: "auto-tls"},
+		{portName: "https", appProtocol: "http", want: "http"},
+	}
+	for _, tt := range tests {
+		p := corev1.ServicePort{Name: tt.portName}
+		if tt.appProtocol != "" {
+			p.AppProtocol = &tt.appProtocol
+		}
+		if got, _ := InferProtocol(p); got != tt.want {
+			t.Errorf("InferProtocol(name=%q, appProtocol=%q) = %q, want %q", tt.portName, tt.appProtocol, got, tt.want)
+		}
+		if got := InferUpstreamProtocol(p); got != tt.wantUpstream {
+			t.Errorf("InferUpstreamProtocol(name=%q, appProtocol=%q) = %q, want %q", tt.portName, tt.appProtocol, got, tt.wantUpstream)
+		}
+	}
+}
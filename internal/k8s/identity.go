@@ -0,0 +1,55 @@
+package k8s
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// NamespaceUID returns the UID of namespace. The UID of kube-system is
+// assigned when the cluster is created, so it identifies the cluster even
+// when its API server URL or credentials change.
+func NamespaceUID(ctx context.Context, clientset kubernetes.Interface, namespace string) (string, error) {
+	ns, err := clientset.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get namespace %s: %w", namespace, err)
+	}
+	return string(ns.UID), nil
+}
+
+// CAFingerprint returns the SHA-256 fingerprint of the first CA certificate
+// that restConfig trusts, as "sha256:<hex>". It returns "" when restConfig
+// does not specify a CA (the system roots are used).
+func CAFingerprint(restConfig *rest.Config) (string, error) {
+	data := restConfig.CAData
+	if len(data) == 0 && restConfig.CAFile != "" {
+		var err error
+		data, err = os.ReadFile(restConfig.CAFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read CA file: %w", err)
+		}
+	}
+	if len(data) == 0 {
+		return "", nil
+	}
+
+	// 先頭の証明書（DER）のハッシュを使う
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return "", fmt.Errorf("no CA certificate found in the kubeconfig")
+		}
+		if block.Type == "CERTIFICATE" {
+			sum := sha256.Sum256(block.Bytes)
+			return "sha256:" + hex.EncodeToString(sum[:]), nil
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package k8s
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+
+	"github.com/usadamasa/kubectl-localmesh/internal/certs"
+)
+
+func TestNamespaceUID(t *testing.T) {
+	clientset := fake.NewClientset(&corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "4f0c6c1e-0000-4000-8000-000000000001"},
+	})
+
+	uid, err := NamespaceUID(context.Background(), clientset, "kube-system")
+	if err != nil {
+		t.Fatalf("NamespaceUID failed: %v", err)
+	}
+	if uid != "4f0c6c1e-0000-4000-8000-000000000001" {
+		t.Errorf("unexpected uid: %s", uid)
+	}
+
+	if _, err := NamespaceUID(context.Background(), clientset, "missing"); err == nil {
+		t.Error("expected error for missing namespace")
+	}
+}
+
+func TestCAFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := certs.LoadOrCreateCA(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPEM := ca.CertPEM()
+	block, _ := pem.Decode(caPEM)
+	sum := sha256.Sum256(block.Bytes)
+	want := "sha256:" + hex.EncodeToString(sum[:])
+
+	// 証明書以外のブロックは読み飛ばす
+	withKey := append(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: []byte("key")}), caPEM...)
+	caFile := filepath.Join(dir, "cluster-ca.crt")
+	if err := os.WriteFile(caFile, caPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		config  *rest.Config
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "ca data",
+			config: &rest.Config{TLSClientConfig: rest.TLSClientConfig{CAData: withKey}},
+			want:   want,
+		},
+		{
+			name:   "ca file",
+			config: &rest.Config{TLSClientConfig: rest.TLSClientConfig{CAFile: caFile}},
+			want:   want,
+		},
+		{
+			name:   "no ca",
+			config: &rest.Config{},
+			want:   "",
+		},
+		{
+			name:    "no certificate",
+			config:  &rest.Config{TLSClientConfig: rest.TLSClientConfig{CAData: []byte("not a certificate")}},
+			wantErr: "no CA certificate found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CAFingerprint(tt.config)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CAFingerprint failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("CAFingerprint() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
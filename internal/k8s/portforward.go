@@ -10,6 +10,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/portforward"
@@ -89,19 +90,21 @@ func (f *websocketPortForwarderFactory) CreatePortForwarder(
 }
 
 // StartPortForwardLoop starts port-forwarding with automatic reconnection.
-// It continuously forwards localPort to remotePort on the specified service,
+// It continuously forwards localPort to servicePort on the specified service,
 // retrying every 300ms on disconnection or error.
+// servicePort is translated to the container port of the selected pod
+// (see resolveTargetPort), the same way as `kubectl port-forward svc/...`.
 // The loop exits when ctx is cancelled.
 func StartPortForwardLoop(
 	ctx context.Context,
 	config *rest.Config,
 	clientset kubernetes.Interface,
 	namespace, serviceName string,
-	localPort, remotePort int,
+	localPort, servicePort int,
 ) error {
 	factory := NewWebSocketPortForwarderFactory(config)
 	return StartPortForwardLoopWithFactory(
-		ctx, factory, clientset, namespace, serviceName, localPort, remotePort,
+		ctx, factory, clientset, namespace, serviceName, localPort, servicePort,
 	)
 }
 
@@ -112,7 +115,7 @@ func StartPortForwardLoopWithFactory(
 	factory PortForwarderFactory,
 	clientset kubernetes.Interface,
 	namespace, serviceName string,
-	localPort, remotePort int,
+	localPort, servicePort int,
 ) error {
 	for {
 		select {
@@ -121,8 +124,17 @@ func StartPortForwardLoopWithFactory(
 		default:
 		}
 
-		// Pod名を取得
-		podName, err := selectPodForService(ctx, clientset, namespace, serviceName)
+		// Service と Pod を取得
+		svc, pod, err := selectPod(ctx, clientset, namespace, serviceName)
+		if err != nil {
+			// エラー時は0.3秒待って再試行
+			time.Sleep(300 * time.Millisecond)
+			continue
+		}
+
+		// Serviceのポートを選択したPodのコンテナポートに変換
+		// Podが切り替わった場合もここで毎回再解決される
+		targetPort, err := resolveTargetPort(svc, pod, servicePort)
 		if err != nil {
 			// エラー時は0.3秒待って再試行
 			time.Sleep(300 * time.Millisecond)
@@ -130,7 +142,7 @@ func StartPortForwardLoopWithFactory(
 		}
 
 		// PortForwarder作成
-		pf, err := factory.CreatePortForwarder(ctx, namespace, podName, localPort, remotePort)
+		pf, err := factory.CreatePortForwarder(ctx, namespace, pod.Name, localPort, targetPort)
 		if err != nil {
 			// エラー時は0.3秒待って再試行
 			time.Sleep(300 * time.Millisecond)
@@ -151,13 +163,51 @@ func StartPortForwardLoopWithFactory(
 	}
 }
 
-// selectPodForService は、Serviceのselectorに基づいてReady状態のPodを選択する。
-// kubectl port-forward svc/xxxと同じロジックを実装。
-func selectPodForService(
+// resolveTargetPort は、Serviceのポート番号を選択したPodのコンテナポート番号に変換する。
+// kubectl port-forward svc/xxx と同じ規則に従う:
+// 1. spec.ports[].port が一致するエントリの targetPort を使用
+// 2. targetPort が名前の場合は Pod のコンテナポート名から番号を検索
+// 3. targetPort が未設定（0）の場合は Service のポート番号をそのまま使用
+// Serviceに一致するポートが定義されていない場合は、後方互換のため
+// 指定されたポート番号をそのままPodのポートとして扱う。
+func resolveTargetPort(svc *corev1.Service, pod *corev1.Pod, servicePort int) (int, error) {
+	for _, p := range svc.Spec.Ports {
+		if int(p.Port) != servicePort {
+			continue
+		}
+
+		switch {
+		case p.TargetPort.Type == intstr.String && p.TargetPort.StrVal != "":
+			return lookupContainerPortByName(pod, p.TargetPort.StrVal)
+		case p.TargetPort.IntVal != 0:
+			return int(p.TargetPort.IntVal), nil
+		default:
+			return servicePort, nil
+		}
+	}
+
+	return servicePort, nil
+}
+
+// lookupContainerPortByName は、Podのコンテナから名前付きポートを検索する。
+func lookupContainerPortByName(pod *corev1.Pod, name string) (int, error) {
+	for _, c := range pod.Spec.Containers {
+		for _, cp := range c.Ports {
+			if cp.Name == name {
+				return int(cp.ContainerPort), nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("pod %s/%s has no container port named '%s'", pod.Namespace, pod.Name, name)
+}
+
+// selectPod は、Serviceとそのselectorに基づいて選択したPodを返す。
+// targetPortの解決にService定義とPodのコンテナポートが必要なため、両方を返す。
+func selectPod(
 	ctx context.Context,
 	clientset kubernetes.Interface,
 	namespace, serviceName string,
-) (string, error) {
+) (*corev1.Service, *corev1.Pod, error) {
 	// 1. Serviceを取得してselectorを取得
 	svc, err := clientset.CoreV1().Services(namespace).Get(
 		ctx,
@@ -165,12 +215,12 @@ func selectPodForService(
 		metav1.GetOptions{},
 	)
 	if err != nil {
-		return "", fmt.Errorf("failed to get service %s/%s: %w", namespace, serviceName, err)
+		return nil, nil, fmt.Errorf("failed to get service %s/%s: %w", namespace, serviceName, err)
 	}
 
 	// 2. selectorが空の場合はエラー
 	if len(svc.Spec.Selector) == 0 {
-		return "", fmt.Errorf("service %s/%s has no selector", namespace, serviceName)
+		return nil, nil, fmt.Errorf("service %s/%s has no selector", namespace, serviceName)
 	}
 
 	// 3. selectorをラベルセレクタに変換
@@ -184,24 +234,24 @@ func selectPodForService(
 		},
 	)
 	if err != nil {
-		return "", fmt.Errorf("failed to list pods for service %s/%s: %w", namespace, serviceName, err)
+		return nil, nil, fmt.Errorf("failed to list pods for service %s/%s: %w", namespace, serviceName, err)
 	}
 
 	// 5. Podが見つからない場合はエラー
 	if len(pods.Items) == 0 {
-		return "", fmt.Errorf("no pods found for service %s/%s with selector %v",
+		return nil, nil, fmt.Errorf("no pods found for service %s/%s with selector %v",
 			namespace, serviceName, svc.Spec.Selector)
 	}
 
 	// 6. Ready状態のPodを優先的に選択
-	for _, pod := range pods.Items {
-		if isPodReady(&pod) {
-			return pod.Name, nil
+	for i := range pods.Items {
+		if isPodReady(&pods.Items[i]) {
+			return svc, &pods.Items[i], nil
 		}
 	}
 
 	// 7. Ready状態のPodがない場合は最初のPodを返す（kubectlの動作と同じ）
-	return pods.Items[0].Name, nil
+	return svc, &pods.Items[0], nil
 }
 
 // isPodReady は、PodがReady状態かどうかを判定する。
@@ -9,11 +9,12 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/rest"
 )
 
-func TestSelectPodForService_ReadyPod(t *testing.T) {
+func TestSelectPod_ReadyPod(t *testing.T) {
 	// fake clientset作成
 	clientset := fake.NewClientset()
 	ctx := context.Background()
@@ -59,11 +60,15 @@ func TestSelectPodForService_ReadyPod(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	// selectPodForService実行
-	podName, err := selectPodForService(ctx, clientset, "default", "test-svc")
+	// selectPod実行
+	gotSvc, gotPod, err := selectPod(ctx, clientset, "default", "test-svc")
 	if err != nil {
-		t.Fatalf("selectPodForService failed: %v", err)
+		t.Fatalf("selectPod failed: %v", err)
 	}
+	if gotSvc.Name != "test-svc" {
+		t.Errorf("expected service %q, got %q", "test-svc", gotSvc.Name)
+	}
+	podName := gotPod.Name
 
 	// 期待値の検証
 	expectedPodName := "test-pod-1"
@@ -72,7 +77,7 @@ func TestSelectPodForService_ReadyPod(t *testing.T) {
 	}
 }
 
-func TestSelectPodForService_NoReadyPod(t *testing.T) {
+func TestSelectPod_NoReadyPod(t *testing.T) {
 	// fake clientset作成
 	clientset := fake.NewClientset()
 	ctx := context.Background()
@@ -118,11 +123,15 @@ func TestSelectPodForService_NoReadyPod(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	// selectPodForService実行
-	podName, err := selectPodForService(ctx, clientset, "default", "test-svc")
+	// selectPod実行
+	gotSvc, gotPod, err := selectPod(ctx, clientset, "default", "test-svc")
 	if err != nil {
-		t.Fatalf("selectPodForService failed: %v", err)
+		t.Fatalf("selectPod failed: %v", err)
+	}
+	if gotSvc.Name != "test-svc" {
+		t.Errorf("expected service %q, got %q", "test-svc", gotSvc.Name)
 	}
+	podName := gotPod.Name
 
 	// Ready状態のPodがない場合、最初のPodを選択
 	expectedPodName := "test-pod-1"
@@ -131,7 +140,7 @@ func TestSelectPodForService_NoReadyPod(t *testing.T) {
 	}
 }
 
-func TestSelectPodForService_NoPods(t *testing.T) {
+func TestSelectPod_NoPods(t *testing.T) {
 	// fake clientset作成
 	clientset := fake.NewClientset()
 	ctx := context.Background()
@@ -153,8 +162,8 @@ func TestSelectPodForService_NoPods(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	// selectPodForService実行
-	_, err = selectPodForService(ctx, clientset, "default", "test-svc")
+	// selectPod実行
+	_, _, err = selectPod(ctx, clientset, "default", "test-svc")
 
 	// Podが見つからない場合、エラーを返す
 	if err == nil {
@@ -162,7 +171,7 @@ func TestSelectPodForService_NoPods(t *testing.T) {
 	}
 }
 
-func TestSelectPodForService_NoSelector(t *testing.T) {
+func TestSelectPod_NoSelector(t *testing.T) {
 	// fake clientset作成
 	clientset := fake.NewClientset()
 	ctx := context.Background()
@@ -182,8 +191,8 @@ func TestSelectPodForService_NoSelector(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	// selectPodForService実行
-	_, err = selectPodForService(ctx, clientset, "default", "test-svc")
+	// selectPod実行
+	_, _, err = selectPod(ctx, clientset, "default", "test-svc")
 
 	// Serviceにselectorがない場合、エラーを返す
 	if err == nil {
@@ -300,7 +309,7 @@ func TestStartPortForwardLoop_NoPodRetry(t *testing.T) {
 	ctx, cancel := context.WithTimeout(t.Context(), 500*time.Millisecond)
 	defer cancel()
 
-	// ServiceだけでPodなし（selectPodForServiceが常に失敗する）
+	// ServiceだけでPodなし（selectPodが常に失敗する）
 	svc := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "test-svc",
@@ -704,3 +713,221 @@ func TestStartPortForwardLoopWithFactory_ForwardPortsError(t *testing.T) {
 		t.Errorf("expected at least 3 ForwardPorts calls, got %d", forwardCallCount)
 	}
 }
+
+func TestResolveTargetPort(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-pod",
+			Namespace: "default",
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name: "app",
+					Ports: []corev1.ContainerPort{
+						{Name: "http", ContainerPort: 8080},
+					},
+				},
+				{
+					Name: "sidecar",
+					Ports: []corev1.ContainerPort{
+						{Name: "admin", ContainerPort: 15000},
+					},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		ports         []corev1.ServicePort
+		servicePort   int
+		expectedPort  int
+		expectedError string
+	}{
+		{
+			name: "数値のtargetPort",
+			ports: []corev1.ServicePort{
+				{Name: "http", Port: 80, TargetPort: intstr.FromInt32(8080)},
+			},
+			servicePort:  80,
+			expectedPort: 8080,
+		},
+		{
+			name: "名前付きtargetPort",
+			ports: []corev1.ServicePort{
+				{Name: "web", Port: 80, TargetPort: intstr.FromString("http")},
+			},
+			servicePort:  80,
+			expectedPort: 8080,
+		},
+		{
+			name: "名前付きtargetPort - サイドカーコンテナ",
+			ports: []corev1.ServicePort{
+				{Name: "http", Port: 80, TargetPort: intstr.FromString("http")},
+				{Name: "admin", Port: 9901, TargetPort: intstr.FromString("admin")},
+			},
+			servicePort:  9901,
+			expectedPort: 15000,
+		},
+		{
+			name: "targetPort未設定の場合はServiceのポート",
+			ports: []corev1.ServicePort{
+				{Name: "http", Port: 8080},
+			},
+			servicePort:  8080,
+			expectedPort: 8080,
+		},
+		{
+			name: "Serviceに存在しないポートはそのまま使用",
+			ports: []corev1.ServicePort{
+				{Name: "http", Port: 80, TargetPort: intstr.FromInt32(8080)},
+			},
+			servicePort:  9090,
+			expectedPort: 9090,
+		},
+		{
+			name: "エラー: 名前付きtargetPortがPodに存在しない",
+			ports: []corev1.ServicePort{
+				{Name: "grpc", Port: 50051, TargetPort: intstr.FromString("grpc")},
+			},
+			servicePort:   50051,
+			expectedError: "has no container port named 'grpc'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-svc",
+					Namespace: "default",
+				},
+				Spec: corev1.ServiceSpec{
+					Ports: tt.ports,
+				},
+			}
+
+			port, err := resolveTargetPort(svc, pod, tt.servicePort)
+
+			if tt.expectedError != "" {
+				if err == nil {
+					t.Fatalf("expected error containing %q, got nil", tt.expectedError)
+				}
+				if !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %q", tt.expectedError, err.Error())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if port != tt.expectedPort {
+				t.Errorf("expected port %d, got %d", tt.expectedPort, port)
+			}
+		})
+	}
+}
+
+func TestStartPortForwardLoopWithFactory_ResolvesTargetPortPerPod(t *testing.T) {
+	clientset := fake.NewClientset()
+	ctx, cancel := context.WithTimeout(t.Context(), 2*time.Second)
+	defer cancel()
+
+	// targetPortが名前付きのService
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-svc",
+			Namespace: "default",
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"app": "test"},
+			Ports: []corev1.ServicePort{
+				{Name: "http", Port: 80, TargetPort: intstr.FromString("http")},
+			},
+		},
+	}
+	if _, err := clientset.CoreV1().Services("default").Create(
+		t.Context(), svc, metav1.CreateOptions{},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	newPod := func(name string, containerPort int32) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    map[string]string{"app": "test"},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name: "app",
+						Ports: []corev1.ContainerPort{
+							{Name: "http", ContainerPort: containerPort},
+						},
+					},
+				},
+			},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodRunning,
+				Conditions: []corev1.PodCondition{
+					{Type: corev1.PodReady, Status: corev1.ConditionTrue},
+				},
+			},
+		}
+	}
+
+	if _, err := clientset.CoreV1().Pods("default").Create(
+		t.Context(), newPod("pod-v1", 8080), metav1.CreateOptions{},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	type call struct {
+		podName    string
+		remotePort int
+	}
+	var calls []call
+
+	mockFactory := &mockPortForwarderFactory{
+		createFunc: func(ctx context.Context, namespace, podName string,
+			localPort, remotePort int) (PortForwarder, error) {
+			calls = append(calls, call{podName: podName, remotePort: remotePort})
+			return &mockPortForwarder{
+				forwardFunc: func() error {
+					if len(calls) == 1 {
+						// 1回目の接続後にPodを入れ替える（ロールアウト相当）
+						_ = clientset.CoreV1().Pods("default").Delete(
+							context.Background(), "pod-v1", metav1.DeleteOptions{},
+						)
+						_, _ = clientset.CoreV1().Pods("default").Create(
+							context.Background(), newPod("pod-v2", 9090), metav1.CreateOptions{},
+						)
+						return fmt.Errorf("pod terminated")
+					}
+					<-ctx.Done()
+					return nil
+				},
+			}, nil
+		},
+	}
+
+	err := StartPortForwardLoopWithFactory(
+		ctx, mockFactory, clientset, "default", "test-svc", 10080, 80,
+	)
+	if err != nil {
+		t.Errorf("expected nil error, got: %v", err)
+	}
+
+	if len(calls) < 2 {
+		t.Fatalf("expected at least 2 connections, got %d", len(calls))
+	}
+	if calls[0] != (call{podName: "pod-v1", remotePort: 8080}) {
+		t.Errorf("unexpected first connection: %+v", calls[0])
+	}
+	if calls[1] != (call{podName: "pod-v2", remotePort: 9090}) {
+		t.Errorf("unexpected second connection: %+v", calls[1])
+	}
+}
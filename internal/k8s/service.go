@@ -5,24 +5,49 @@ import (
 	"fmt"
 	"strings"
 
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
+// ServicePort is a resolved port of a Service.
+type ServicePort struct {
+	Service string
+	Port    int    // Service port (spec.ports[].port)
+	Name    string // name of the port (spec.ports[].name), empty when the Service was not fetched
+	// Protocol is the configured protocol, or http or grpc as inferred by
+	// InferProtocol. It is empty when the port does not tell the protocol.
+	Protocol string
+	// InferredFrom describes what Protocol was inferred from, e.g.
+	// "appProtocol 'kubernetes.io/h2c'" or "port name 'grpc-api'".
+	InferredFrom string
+	// UpstreamProtocol is the upstream protocol inferred with Protocol when
+	// the port serves TLS (see InferUpstreamProtocol), and empty otherwise.
+	UpstreamProtocol string
+}
+
 // ResolveServicePort resolves the service port based on the provided parameters.
 // Priority:
 // 1. If port is explicitly specified (non-zero), return it
 // 2. If portName is specified, find the port by name in service.Spec.Ports
 // 3. Otherwise, return the first port (service.Spec.Ports[0])
+//
+// The returned port is the Service port (spec.ports[].port), not the targetPort.
+// StartPortForwardLoop translates it to the container port of the selected pod.
+//
+// protocol is the configured protocol. When it is empty, the protocol is
+// inferred from the matching entry of service.Spec.Ports (see InferProtocol),
+// so the Service is fetched even when port is specified.
 func ResolveServicePort(
 	ctx context.Context,
 	clientset kubernetes.Interface,
 	namespace, serviceName, portName string,
 	port int,
-) (int, error) {
-	// 明示的なport指定があればそれを返す
-	if port != 0 {
-		return port, nil
+	protocol string,
+) (ServicePort, error) {
+	// プロトコルもポートも指定されていればServiceを取得しない
+	if port != 0 && protocol != "" {
+		return ServicePort{Service: serviceName, Port: port, Protocol: protocol}, nil
 	}
 
 	// Serviceを取得
@@ -32,25 +57,116 @@ func ResolveServicePort(
 		metav1.GetOptions{},
 	)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get service %s/%s: %w", namespace, serviceName, err)
+		return ServicePort{}, fmt.Errorf("failed to get service %s/%s: %w", namespace, serviceName, err)
+	}
+
+	// 明示的なport指定があればそれを返す（同じポート番号の定義からプロトコルを推測する）
+	if port != 0 {
+		for _, p := range svc.Spec.Ports {
+			if int(p.Port) == port {
+				return withProtocol(servicePort(serviceName, p), protocol), nil
+			}
+		}
+		return ServicePort{Service: serviceName, Port: port, Protocol: protocol}, nil
 	}
 
 	// Serviceにポートが定義されていない場合
 	if len(svc.Spec.Ports) == 0 {
-		return 0, fmt.Errorf("service %s/%s has no ports defined", namespace, serviceName)
+		return ServicePort{}, fmt.Errorf("service %s/%s has no ports defined", namespace, serviceName)
 	}
 
 	// portName指定がある場合: svc.Spec.Portsから該当するポートを検索
 	if strings.TrimSpace(portName) != "" {
 		for _, p := range svc.Spec.Ports {
 			if p.Name == portName {
-				return int(p.Port), nil
+				return withProtocol(servicePort(serviceName, p), protocol), nil
 			}
 		}
 		// 該当するポートが見つからない場合
-		return 0, fmt.Errorf("service %s/%s has no port named '%s'", namespace, serviceName, portName)
+		return ServicePort{}, fmt.Errorf("service %s/%s has no port named '%s'", namespace, serviceName, portName)
 	}
 
 	// portName指定がない場合: svc.Spec.Ports[0]を返す
-	return int(svc.Spec.Ports[0].Port), nil
+	return withProtocol(servicePort(serviceName, svc.Spec.Ports[0]), protocol), nil
+}
+
+// withProtocol は、指定されたプロトコルがあれば推測したプロトコルの代わりに使う
+func withProtocol(p ServicePort, protocol string) ServicePort {
+	if protocol != "" {
+		p.Protocol, p.InferredFrom, p.UpstreamProtocol = protocol, "", ""
+	}
+	return p
+}
+
+// servicePort は、Serviceのポート定義からプロトコルを推測したServicePortを返す
+func servicePort(service string, p corev1.ServicePort) ServicePort {
+	protocol, from := InferProtocol(p)
+	return ServicePort{
+		Service:          service,
+		Port:             int(p.Port),
+		Name:             p.Name,
+		Protocol:         protocol,
+		InferredFrom:     from,
+		UpstreamProtocol: InferUpstreamProtocol(p),
+	}
+}
+
+// InferProtocol returns the protocol of a Service port, http or grpc, and
+// what it was inferred from. appProtocol is used first ("grpc",
+// "kubernetes.io/h2c" and "http2" are grpc; "http", "https", "grpc-web",
+// "kubernetes.io/ws" and "kubernetes.io/wss" are http). Otherwise the
+// Istio-style name prefix is used: "grpc", "grpc-api" and "http2-*" are grpc,
+// "http-web", "https-web" and "grpc-web" are http. Both results are empty when
+// neither tells the protocol.
+func InferProtocol(p corev1.ServicePort) (protocol, inferredFrom string) {
+	key, from := protocolKey(p)
+	return protocolOf(key), from
+}
+
+// InferUpstreamProtocol returns the upstream protocol of a Service port that
+// serves TLS, as inferred by InferProtocol: auto-tls for "https" (ALPN
+// selects HTTP/2 or HTTP/1.1) and http1-tls for "kubernetes.io/wss"
+// (WebSocket needs HTTP/1.1). It is empty for plaintext ports, which use the
+// default upstream protocol of the inferred protocol.
+func InferUpstreamProtocol(p corev1.ServicePort) string {
+	key, _ := protocolKey(p)
+	switch key {
+	case "https":
+		return "auto-tls" // config.UpstreamAutoTLS
+	case "kubernetes.io/wss":
+		return "http1-tls" // config.UpstreamHTTP1TLS
+	default:
+		return ""
+	}
+}
+
+// protocolKey は、プロトコルを推測できるappProtocolまたはポート名の接頭辞（小文字）と、その根拠を返す
+func protocolKey(p corev1.ServicePort) (key, inferredFrom string) {
+	if p.AppProtocol != nil {
+		if key := strings.ToLower(*p.AppProtocol); protocolOf(key) != "" {
+			return key, fmt.Sprintf("appProtocol '%s'", *p.AppProtocol)
+		}
+	}
+
+	name := strings.ToLower(p.Name)
+	prefix, _, _ := strings.Cut(name, "-")
+	if strings.HasPrefix(name, "grpc-web") {
+		prefix = "grpc-web"
+	}
+	if protocolOf(prefix) != "" {
+		return prefix, fmt.Sprintf("port name '%s'", p.Name)
+	}
+	return "", ""
+}
+
+// protocolOf は、appProtocolまたはポート名の接頭辞に対応するプロトコルを返す
+func protocolOf(s string) string {
+	switch s {
+	case "grpc", "h2c", "http2", "kubernetes.io/h2c":
+		return "grpc"
+	case "http", "https", "http1", "grpc-web", "kubernetes.io/ws", "kubernetes.io/wss":
+		return "http"
+	default:
+		return ""
+	}
 }
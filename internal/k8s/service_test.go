@@ -16,6 +16,7 @@ func TestResolveServicePort(t *testing.T) {
 		serviceName   string
 		portName      string
 		port          int
+		protocol      string
 		service       *corev1.Service
 		expectedPort  int
 		expectedError string
@@ -25,6 +26,7 @@ func TestResolveServicePort(t *testing.T) {
 			namespace:    "default",
 			serviceName:  "test-svc",
 			port:         8080,
+			protocol:     "http",
 			expectedPort: 8080,
 		},
 		{
@@ -188,6 +190,7 @@ func TestResolveServicePort(t *testing.T) {
 				tt.serviceName,
 				tt.portName,
 				tt.port,
+				tt.protocol,
 			)
 
 			// アサーション
@@ -202,10 +205,52 @@ func TestResolveServicePort(t *testing.T) {
 				if err != nil {
 					t.Fatalf("unexpected error: %v", err)
 				}
-				if port != tt.expectedPort {
-					t.Errorf("expected port %d, got %d", tt.expectedPort, port)
+				if port.Port != tt.expectedPort {
+					t.Errorf("expected port %d, got %d", tt.expectedPort, port.Port)
 				}
 			}
 		})
 	}
 }
+
+func TestResolveServicePort_Protocol(t *testing.T) {
+	h2c := "kubernetes.io/h2c"
+	clientset := fake.NewClientset(&corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "users-api", Namespace: "users"},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
+				{Name: "api", Port: 8080, AppProtocol: &h2c},
+				{Name: "http-web", Port: 80},
+				{Name: "metrics", Port: 9100},
+			},
+		},
+	})
+
+	tests := []struct {
+		name         string
+		portName     string
+		port         int
+		protocol     string
+		wantProtocol string
+		wantFrom     string
+	}{
+		{name: "appProtocol", portName: "api", wantProtocol: "grpc", wantFrom: "appProtocol 'kubernetes.io/h2c'"},
+		{name: "port name prefix", portName: "http-web", wantProtocol: "http", wantFrom: "port name 'http-web'"},
+		{name: "explicit port", port: 8080, wantProtocol: "grpc", wantFrom: "appProtocol 'kubernetes.io/h2c'"},
+		{name: "unknown", portName: "metrics"},
+		{name: "explicit port not in spec", port: 5000},
+		{name: "configured protocol", portName: "api", protocol: "http", wantProtocol: "http"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveServicePort(t.Context(), clientset, "users", "users-api", tt.portName, tt.port, tt.protocol)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Protocol != tt.wantProtocol || got.InferredFrom != tt.wantFrom {
+				t.Errorf("got protocol %q from %q, want %q from %q", got.Protocol, got.InferredFrom, tt.wantProtocol, tt.wantFrom)
+			}
+		})
+	}
+}
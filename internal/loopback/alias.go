@@ -0,0 +1,101 @@
+package loopback
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// loopbackPrefix は、エイリアスとして追加できるアドレスの範囲
+var loopbackPrefix = netip.MustParsePrefix("127.0.0.0/8")
+
+// primaryAddr は、lo0に常に割り当てられているアドレス（削除するとループバックが使えなくなる）
+var primaryAddr = netip.MustParseAddr("127.0.0.1")
+
+// ifconfig は、ifconfigを実行する（テストで差し替え可能）
+var ifconfig = func(args ...string) error {
+	if out, err := exec.Command("ifconfig", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("ifconfig %s: %w: %s", strings.Join(args, " "), err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// runSudo は、sudo -n を実行する（テストで差し替え可能）
+var runSudo = func(args ...string) error {
+	cmd := exec.Command("sudo", append([]string{"-n"}, args...)...)
+	cmd.Stdout = io.Discard
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("sudo -n %s: %s", strings.Join(args, " "), msg)
+		}
+		return fmt.Errorf("sudo -n %s: %w", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// Add adds addr as an alias of the loopback interface lo0 (macOS). It runs
+// ifconfig directly when running as root, and otherwise runs the privileged
+// helper ("kubectl-localmesh loopback apply") through "sudo -n", so that
+// only the alias edit runs as root.
+func Add(addr string) error {
+	if os.Geteuid() == 0 {
+		return ApplyAlias(addr)
+	}
+	if err := runHelper("apply", addr); err != nil {
+		return fmt.Errorf("failed to add %s to lo0: %w\n"+
+			"run 'sudo -v' first or add a sudoers rule for the helper (see README)", addr, err)
+	}
+	return nil
+}
+
+// Remove removes an alias added by Add.
+func Remove(addr string) error {
+	if os.Geteuid() == 0 {
+		return RemoveAlias(addr)
+	}
+	return runHelper("remove", addr)
+}
+
+// runHelper は、sudo -n でloopbackサブコマンドを実行する
+func runHelper(subcommand, addr string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate the kubectl-localmesh binary: %w", err)
+	}
+	return runSudo(exe, "loopback", subcommand, addr)
+}
+
+// ApplyAlias adds addr as an alias of lo0. As the helper runs as root, addr
+// must be an address in 127.0.0.0/8 other than 127.0.0.1.
+func ApplyAlias(addr string) error {
+	a, err := validateAddr(addr)
+	if err != nil {
+		return err
+	}
+	return ifconfig("lo0", "alias", a.String(), "up")
+}
+
+// RemoveAlias removes the alias addr from lo0. It accepts the same addresses
+// as ApplyAlias, so 127.0.0.1 is never removed.
+func RemoveAlias(addr string) error {
+	a, err := validateAddr(addr)
+	if err != nil {
+		return err
+	}
+	return ifconfig("lo0", "-alias", a.String())
+}
+
+// validateAddr は、エイリアスとして追加・削除できるアドレスかを検証する
+func validateAddr(addr string) (netip.Addr, error) {
+	a, err := netip.ParseAddr(addr)
+	if err != nil || !a.Is4() || !loopbackPrefix.Contains(a) || a == primaryAddr {
+		return netip.Addr{}, fmt.Errorf("address must be in %s and not %s, got '%s'", loopbackPrefix, primaryAddr, addr)
+	}
+	return a, nil
+}
@@ -0,0 +1,85 @@
+package loopback
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+// recordCommands は、ifconfigとsudo -nの実行を記録する
+func recordCommands(t *testing.T) (ifconfigCalls, sudoCalls *[][]string) {
+	t.Helper()
+	ifconfigCalls, sudoCalls = &[][]string{}, &[][]string{}
+	origIfconfig, origSudo := ifconfig, runSudo
+	ifconfig = func(args ...string) error {
+		*ifconfigCalls = append(*ifconfigCalls, args)
+		return nil
+	}
+	runSudo = func(args ...string) error {
+		*sudoCalls = append(*sudoCalls, args)
+		return nil
+	}
+	t.Cleanup(func() { ifconfig, runSudo = origIfconfig, origSudo })
+	return ifconfigCalls, sudoCalls
+}
+
+func TestApplyAlias(t *testing.T) {
+	calls, _ := recordCommands(t)
+
+	if err := ApplyAlias("127.0.0.2"); err != nil {
+		t.Fatalf("ApplyAlias failed: %v", err)
+	}
+	if err := RemoveAlias("127.0.0.2"); err != nil {
+		t.Fatalf("RemoveAlias failed: %v", err)
+	}
+
+	want := [][]string{
+		{"lo0", "alias", "127.0.0.2", "up"},
+		{"lo0", "-alias", "127.0.0.2"},
+	}
+	if !reflect.DeepEqual(*calls, want) {
+		t.Errorf("calls = %+v, want %+v", *calls, want)
+	}
+}
+
+func TestApplyAlias_RejectsInvalidAddresses(t *testing.T) {
+	calls, _ := recordCommands(t)
+
+	for _, addr := range []string{"", "127.0.0.1", "10.0.0.1", "::1", "127.0.0.2 up", "-alias", "lo0"} {
+		if err := ApplyAlias(addr); err == nil {
+			t.Errorf("expected ApplyAlias to reject '%s'", addr)
+		}
+		if err := RemoveAlias(addr); err == nil {
+			t.Errorf("expected RemoveAlias to reject '%s'", addr)
+		}
+	}
+	if len(*calls) != 0 {
+		t.Errorf("expected ifconfig not to run, got %+v", *calls)
+	}
+}
+
+func TestAdd_SudoHelper(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root runs ifconfig directly")
+	}
+	_, calls := recordCommands(t)
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Add("127.0.0.2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Remove("127.0.0.2"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{exe, "loopback", "apply", "127.0.0.2"},
+		{exe, "loopback", "remove", "127.0.0.2"},
+	}
+	if !reflect.DeepEqual(*calls, want) {
+		t.Errorf("calls = %+v, want %+v", *calls, want)
+	}
+}
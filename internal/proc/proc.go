@@ -0,0 +1,133 @@
+package proc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// clockTicks は、/proc/<pid>/stat の開始時刻の単位（LinuxのUSER_HZは常に100）
+const clockTicks = 100
+
+// startTolerance は、同じプロセスとみなす開始時刻の誤差（秒）。
+// Linuxの開始時刻はシステムの起動時刻（btime）から求めるため、NTPによる時刻の補正や
+// サスペンドからの復帰でbtimeがずれ、秒未満の切り捨てでも1秒ずれることがある。
+const startTolerance = 2
+
+// StartTime returns when the process pid started, in Unix seconds. Together
+// with the PID it identifies a process, since a PID reused by another
+// process has a different start time.
+func StartTime(pid int) (int64, error) {
+	if pid <= 0 {
+		return 0, fmt.Errorf("invalid pid %d", pid)
+	}
+	if runtime.GOOS == "linux" {
+		return linuxStartTime(pid)
+	}
+	return psStartTime(pid)
+}
+
+// SameStart reports whether the start times recorded and actual, as returned
+// by StartTime, are of the same process. They may differ by a few seconds
+// when the system clock is adjusted.
+func SameStart(recorded, actual int64) bool {
+	return actual >= recorded-startTolerance && actual <= recorded+startTolerance
+}
+
+// linuxStartTime は、/proc/<pid>/stat の起動からの経過時間とシステムの起動時刻から開始時刻を求める
+func linuxStartTime(pid int) (int64, error) {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	// コマンド名は空白や括弧を含みうるため、最後の ')' 以降のフィールドを使う
+	// （3番目のstateから始まり、22番目がstarttime）
+	s := string(b)
+	fields := strings.Fields(s[strings.LastIndexByte(s, ')')+1:])
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("unexpected format of /proc/%d/stat", pid)
+	}
+	ticks, err := strconv.ParseInt(fields[19], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected format of /proc/%d/stat: %w", pid, err)
+	}
+	boot, err := bootTime()
+	if err != nil {
+		return 0, err
+	}
+	return boot + ticks/clockTicks, nil
+}
+
+// bootTime は、/proc/stat のbtime（システムの起動時刻）を返す
+func bootTime() (int64, error) {
+	b, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return 0, err
+	}
+	for line := range strings.Lines(string(b)) {
+		if value, ok := strings.CutPrefix(line, "btime "); ok {
+			return strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		}
+	}
+	return 0, errors.New("btime not found in /proc/stat")
+}
+
+// psStartTime は、psの開始時刻（例: "Fri Oct 16 10:00:00 2026"）を返す
+func psStartTime(pid int) (int64, error) {
+	out, err := exec.Command("ps", "-p", strconv.Itoa(pid), "-o", "lstart=").Output()
+	if err != nil {
+		return 0, fmt.Errorf("process %d not found: %w", pid, err)
+	}
+	// 1桁の日の前の空白の数は環境によって異なるため、空白をまとめてから解釈する
+	lstart := strings.Join(strings.Fields(string(out)), " ")
+	t, err := time.ParseInLocation("Mon Jan 2 15:04:05 2006", lstart, time.Local)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected start time of process %d: %q", pid, lstart)
+	}
+	return t.Unix(), nil
+}
+
+// SudoUID returns the uid of the user who ran the process with sudo (from
+// SUDO_UID). ok is false unless the process runs as root through sudo.
+func SudoUID() (uid int, ok bool) {
+	if os.Geteuid() != 0 {
+		return 0, false
+	}
+	uid, err := strconv.Atoi(os.Getenv("SUDO_UID"))
+	return uid, err == nil
+}
+
+// InvokingUID returns the uid of the user who ran the process: the user who
+// ran sudo under sudo, and the effective uid otherwise.
+func InvokingUID() int {
+	if uid, ok := SudoUID(); ok {
+		return uid
+	}
+	return os.Geteuid()
+}
+
+// UID returns the uid of the user running the process pid.
+func UID(pid int) (int, error) {
+	if pid <= 0 {
+		return 0, fmt.Errorf("invalid pid %d", pid)
+	}
+	if runtime.GOOS == "linux" {
+		// /proc/<pid>の所有者はプロセスの実効UID
+		fi, err := os.Stat(fmt.Sprintf("/proc/%d", pid))
+		if err != nil {
+			return 0, err
+		}
+		return int(fi.Sys().(*syscall.Stat_t).Uid), nil
+	}
+	out, err := exec.Command("ps", "-p", strconv.Itoa(pid), "-o", "uid=").Output()
+	if err != nil {
+		return 0, fmt.Errorf("process %d not found: %w", pid, err)
+	}
+	return strconv.Atoi(strings.TrimSpace(string(out)))
+}
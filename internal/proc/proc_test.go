@@ -0,0 +1,87 @@
+package proc
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestStartTime(t *testing.T) {
+	start, err := StartTime(os.Getpid())
+	if err != nil {
+		t.Fatalf("StartTime failed: %v", err)
+	}
+	// テストプロセスは少し前に起動している
+	if now := time.Now().Unix(); start > now || start < now-3600 {
+		t.Errorf("unexpected start time %d (now %d)", start, now)
+	}
+	// 同じプロセスの開始時刻は常に同じ
+	if again, err := StartTime(os.Getpid()); err != nil || again != start {
+		t.Errorf("expected the same start time %d, got %d, %v", start, again, err)
+	}
+
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := StartTime(cmd.Process.Pid); err == nil {
+		t.Error("expected an error for an exited process")
+	}
+	if _, err := StartTime(0); err == nil {
+		t.Error("expected an error for pid 0")
+	}
+}
+
+func TestUID(t *testing.T) {
+	uid, err := UID(os.Getpid())
+	if err != nil {
+		t.Fatalf("UID failed: %v", err)
+	}
+	if uid != os.Geteuid() {
+		t.Errorf("expected uid %d, got %d", os.Geteuid(), uid)
+	}
+	if _, err := UID(0); err == nil {
+		t.Error("expected an error for pid 0")
+	}
+}
+
+func TestSameStart(t *testing.T) {
+	tests := []struct {
+		actual int64
+		want   bool
+	}{
+		{actual: 1767225600, want: true},
+		// 時刻の補正や切り捨てによる誤差
+		{actual: 1767225601, want: true},
+		{actual: 1767225599, want: true},
+		{actual: 1767225602, want: true},
+		{actual: 1767225598, want: true},
+		// 別のプロセス
+		{actual: 1767225603, want: false},
+		{actual: 1767225540, want: false},
+	}
+	for _, tt := range tests {
+		if got := SameStart(1767225600, tt.actual); got != tt.want {
+			t.Errorf("SameStart(1767225600, %d) = %v, want %v", tt.actual, got, tt.want)
+		}
+	}
+}
+
+func TestPSStartTime(t *testing.T) {
+	if _, err := exec.LookPath("ps"); err != nil {
+		t.Skip("ps is not available")
+	}
+	want, err := StartTime(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := psStartTime(os.Getpid())
+	if err != nil {
+		t.Skipf("ps does not support lstart: %v", err)
+	}
+	// /proc の値は切り捨てのため誤差を許容する
+	if !SameStart(want, got) {
+		t.Errorf("expected start time %d, got %d", want, got)
+	}
+}
@@ -0,0 +1,134 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// httpListener は、Hostヘッダー（HTTP/2では:authority）でルーティングするリスナー
+type httpListener struct {
+	port int
+	srv  *http.Server
+
+	mu    sync.RWMutex
+	hosts map[string]http.Handler     // キーは小文字のホスト名
+	certs map[string]*tls.Certificate // TLSリスナーの場合のみ。キーは小文字のホスト名
+}
+
+// listenHTTP は、全インターフェースのportでHTTP/1.1とh2cを受け付けるリスナーを開く
+func listenHTTP(port int) (*httpListener, error) {
+	ln, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", port))
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on port %d: %w", port, err)
+	}
+
+	// EnvoyのHCMのcodec_type: AUTOに相当する
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+
+	l := &httpListener{port: port}
+	l.srv = &http.Server{Handler: l, Protocols: &protocols}
+
+	go func() {
+		if err := l.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Fprintf(os.Stderr, "builtin proxy: listener on port %d stopped: %v\n", port, err)
+		}
+	}()
+	return l, nil
+}
+
+// listenHTTPS は、全インターフェースのportでTLS終端するリスナーを開く。
+// 証明書はSNIで選択し、ALPNでHTTP/2とHTTP/1.1を切り替える。
+func listenHTTPS(port int) (*httpListener, error) {
+	ln, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", port))
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on port %d: %w", port, err)
+	}
+
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+
+	l := &httpListener{port: port}
+	l.srv = &http.Server{
+		Handler:   l,
+		Protocols: &protocols,
+		TLSConfig: &tls.Config{GetCertificate: l.getCertificate},
+	}
+
+	go func() {
+		if err := l.srv.ServeTLS(ln, "", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Fprintf(os.Stderr, "builtin proxy: TLS listener on port %d stopped: %v\n", port, err)
+		}
+	}()
+	return l, nil
+}
+
+func (l *httpListener) setCerts(certs map[string]*tls.Certificate) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.certs = certs
+}
+
+// getCertificate は、SNIのホスト名に対応する証明書を返す。
+// Envoyと同様に、一致するフィルタチェーン（証明書）がない場合はハンドシェイクを失敗させる。
+func (l *httpListener) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	cert, ok := lookupHost(l.certs, hello.ServerName)
+	if !ok {
+		return nil, fmt.Errorf("no certificate for server name %q", hello.ServerName)
+	}
+	return cert, nil
+}
+
+func (l *httpListener) setHosts(hosts map[string]http.Handler) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hosts = hosts
+}
+
+func (l *httpListener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.mu.RLock()
+	h, ok := lookupHost(l.hosts, r.Host)
+	l.mu.RUnlock()
+
+	// Envoyと同様に、一致するvirtual hostがない場合は404を返す
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	h.ServeHTTP(w, r)
+}
+
+// lookupHost は、ホスト名の値を返す。
+// Envoyのvirtual hostと同様に完全一致を優先し、次に最も長い"*."のワイルドカードに一致させる。
+func lookupHost[T any](m map[string]T, host string) (T, bool) {
+	host = strings.ToLower(host)
+	if v, ok := m[host]; ok {
+		return v, true
+	}
+	for rest := host; ; {
+		i := strings.IndexByte(rest, '.')
+		if i < 0 {
+			var zero T
+			return zero, false
+		}
+		rest = rest[i+1:]
+		if v, ok := m["*."+rest]; ok {
+			return v, true
+		}
+	}
+}
+
+func (l *httpListener) close() {
+	_ = l.srv.Close()
+}
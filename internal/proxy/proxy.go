@@ -0,0 +1,331 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/usadamasa/kubectl-localmesh/internal/envoy"
+)
+
+// connectTimeout はupstreamへの接続タイムアウト（Envoyクラスタのconnect_timeoutと同じ）
+const connectTimeout = time.Second
+
+// Server is a pure-Go data plane with the same routing semantics as the
+// Envoy config built by envoy.BuildConfig: HTTP/1.1 and h2c requests on the
+// listener port are routed by Host / :authority and then by path and
+// headers, the same routes are served
+// over TLS when a TLS listener is configured, and every TCP route gets its own
+// listener that forwards raw connections.
+type Server struct {
+	mu         sync.Mutex
+	transports map[upstreamKey]*http.Transport // upstreamのプロトコルごとに共有する
+	http       *httpListener
+	https      *httpListener
+	tcp        map[string]*tcpListener // キーはクラスタ名（Envoyのリスナー名に相当）
+	closed     bool
+}
+
+// New returns a Server with no listeners. Call Update to apply routes.
+func New() *Server {
+	return &Server{
+		transports: map[upstreamKey]*http.Transport{},
+		tcp:        map[string]*tcpListener{},
+	}
+}
+
+// upstreamKey は、Transportを共有できるupstreamの接続方法
+type upstreamKey struct {
+	protocol string
+	sni      string
+}
+
+// transport は、upstreamKeyに対応するTransportを返す（s.muを保持して呼び出す）。
+// Envoyのクラスタのtyped_extension_protocol_optionsとtransport_socketに相当する。
+func (s *Server) transport(key upstreamKey) *http.Transport {
+	if t, ok := s.transports[key]; ok {
+		return t
+	}
+
+	var protocols http.Protocols
+	t := &http.Transport{
+		DialContext: (&net.Dialer{Timeout: connectTimeout}).DialContext,
+		Protocols:   &protocols,
+	}
+	switch key.protocol {
+	case "h2c":
+		protocols.SetUnencryptedHTTP2(true)
+	case "h2-tls":
+		protocols.SetHTTP2(true)
+	case "auto-tls":
+		// ALPNでupstreamが選択する
+		protocols.SetHTTP1(true)
+		protocols.SetHTTP2(true)
+	default:
+		protocols.SetHTTP1(true)
+	}
+	if strings.HasSuffix(key.protocol, "-tls") {
+		// port-forward先はクラスタ内の証明書を使うため検証は行わない（Envoyと同じ）
+		t.TLSClientConfig = &tls.Config{ServerName: key.sni, InsecureSkipVerify: true}
+	}
+
+	s.transports[key] = t
+	return t
+}
+
+// roundTripper は、ルートのupstreamプロトコルに応じたRoundTripperを返す（s.muを保持して呼び出す）
+func (s *Server) roundTripper(r envoy.Route) http.RoundTripper {
+	protocol := r.EffectiveUpstreamProtocol()
+	if protocol == "auto" {
+		return &downstreamProtocolTransport{
+			http1: s.transport(upstreamKey{protocol: "http1"}),
+			h2c:   s.transport(upstreamKey{protocol: "h2c"}),
+		}
+	}
+
+	key := upstreamKey{protocol: protocol}
+	if r.UpstreamTLS() {
+		key.sni = r.UpstreamSNI
+	}
+	return s.transport(key)
+}
+
+// downstreamProtocolTransport は、クライアントと同じHTTPバージョンでupstreamへ接続する。
+// Envoyのuse_downstream_protocol_configに相当する。
+type downstreamProtocolTransport struct {
+	http1 *http.Transport
+	h2c   *http.Transport
+}
+
+func (t *downstreamProtocolTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.ProtoMajor == 2 {
+		return t.h2c.RoundTrip(req)
+	}
+	return t.http1.RoundTrip(req)
+}
+
+// Update reconfigures the listeners to serve routes. Listeners that are no
+// longer needed are closed, and existing listeners keep accepting
+// connections while their upstreams are swapped. tlsListener may be nil.
+func (s *Server) Update(listenerPort int, routes []envoy.Route, tlsListener *envoy.TLSListener) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return errors.New("proxy is closed")
+	}
+
+	// HTTPルートとTCPルートを分離（envoy.BuildConfigと同じ規則）
+	var httpRoutes []envoy.Route
+	tcpRoutes := map[string]envoy.Route{}
+	for _, r := range routes {
+		if r.Type == "tcp" {
+			tcpRoutes[r.ClusterName] = r
+		} else {
+			httpRoutes = append(httpRoutes, r)
+		}
+	}
+
+	if err := s.updateHTTP(listenerPort, httpRoutes, tlsListener); err != nil {
+		return err
+	}
+	return s.updateTCP(tcpRoutes)
+}
+
+// updateHTTP は、HTTPリスナーとTLSリスナーを更新する（s.muを保持して呼び出す）。
+// Envoyと同様に、HTTPルートが存在する場合のみリスナーを開く。
+func (s *Server) updateHTTP(listenerPort int, routes []envoy.Route, tlsListener *envoy.TLSListener) error {
+	if len(routes) == 0 {
+		if s.http != nil {
+			s.http.close()
+			s.http = nil
+		}
+		s.closeHTTPS()
+		return nil
+	}
+
+	hosts, err := s.buildHostTable(routes)
+	if err != nil {
+		return err
+	}
+
+	if s.http != nil && s.http.port != listenerPort {
+		s.http.close()
+		s.http = nil
+	}
+	if s.http == nil {
+		l, err := listenHTTP(listenerPort)
+		if err != nil {
+			return err
+		}
+		s.http = l
+	}
+	s.http.setHosts(hosts)
+
+	if tlsListener == nil || len(tlsListener.Certs) == 0 {
+		s.closeHTTPS()
+		return nil
+	}
+	return s.updateHTTPS(tlsListener, hosts)
+}
+
+// updateHTTPS は、TLSリスナーを更新する（s.muを保持して呼び出す）
+func (s *Server) updateHTTPS(tlsListener *envoy.TLSListener, hosts map[string]http.Handler) error {
+	// 証明書は再発行されている可能性があるため毎回読み込み直す
+	certs := map[string]*tls.Certificate{}
+	for _, c := range tlsListener.Certs {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load certificate for %s: %w", c.Host, err)
+		}
+		certs[strings.ToLower(c.Host)] = &cert
+	}
+
+	if s.https != nil && s.https.port != tlsListener.Port {
+		s.closeHTTPS()
+	}
+	if s.https == nil {
+		l, err := listenHTTPS(tlsListener.Port)
+		if err != nil {
+			return err
+		}
+		s.https = l
+	}
+	s.https.setCerts(certs)
+	s.https.setHosts(hosts)
+	return nil
+}
+
+// closeHTTPS は、TLSリスナーが開いていれば閉じる（s.muを保持して呼び出す）
+func (s *Server) closeHTTPS() {
+	if s.https != nil {
+		s.https.close()
+		s.https = nil
+	}
+}
+
+// buildHostTable は、ホスト名ごとのハンドラーを生成する
+func (s *Server) buildHostTable(routes []envoy.Route) (map[string]http.Handler, error) {
+	hosts := map[string]http.Handler{}
+	for _, r := range routes {
+		// Envoyもvirtual host間でドメインが重複する設定は受け付けない
+		host := strings.ToLower(r.Host)
+		if _, ok := hosts[host]; ok {
+			return nil, fmt.Errorf("duplicate host '%s'", r.Host)
+		}
+		handler, err := s.newHostHandler(r)
+		if err != nil {
+			return nil, err
+		}
+		hosts[host] = handler
+	}
+	return hosts, nil
+}
+
+// newReverseProxy は、ルート1つ分のリバースプロキシを返す
+func (s *Server) newReverseProxy(r envoy.Route) http.Handler {
+	scheme := "http"
+	if r.UpstreamTLS() {
+		scheme = "https"
+	}
+	target := &url.URL{Scheme: scheme, Host: fmt.Sprintf("127.0.0.1:%d", r.LocalPort)}
+
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			// Envoyと同様にHostヘッダーはクライアントの値を維持する（host_rewrite指定時を除く）
+			pr.Out.Host = pr.In.Host
+			if r.HostRewrite != "" {
+				pr.Out.Host = r.HostRewrite
+			}
+			if r.PrefixRewrite != "" {
+				rewritePrefix(pr.Out.URL, r.PrefixRewrite)
+			}
+			pr.SetXForwarded()
+			// Envoyと同様に削除してから追加する
+			for _, name := range r.RequestHeadersToRemove {
+				pr.Out.Header.Del(name)
+			}
+			for _, h := range r.RequestHeadersToAdd {
+				pr.Out.Header.Set(h.Name, h.Value)
+			}
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			for _, name := range r.ResponseHeadersToRemove {
+				resp.Header.Del(name)
+			}
+			for _, h := range r.ResponseHeadersToAdd {
+				resp.Header.Set(h.Name, h.Value)
+			}
+			return nil
+		},
+		Transport: s.roundTripper(r),
+		// gRPCのストリーミングに対応するため即座にフラッシュする
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			fmt.Fprintf(os.Stderr, "builtin proxy: %s: %v\n", r.Host, err)
+			http.Error(w, "upstream connect error or disconnect/reset before headers", http.StatusServiceUnavailable)
+		},
+	}
+}
+
+// rewritePrefix は、一致したプレフィックス（サービス自身へのルートでは"/"）をprefixに置き換える
+func rewritePrefix(u *url.URL, prefix string) {
+	u.Path = prefix + strings.TrimPrefix(u.Path, "/")
+	if u.RawPath != "" {
+		u.RawPath = prefix + strings.TrimPrefix(u.RawPath, "/")
+	}
+}
+
+// updateTCP は、TCPルートごとのリスナーを更新する（s.muを保持して呼び出す）
+func (s *Server) updateTCP(routes map[string]envoy.Route) error {
+	// 不要になったリスナー、リスンアドレスが変わったリスナーを閉じる
+	for name, l := range s.tcp {
+		if r, ok := routes[name]; !ok || r.ListenPort != l.port || r.TCPListenAddress() != l.address {
+			l.close()
+			delete(s.tcp, name)
+		}
+	}
+
+	for name, r := range routes {
+		if l, ok := s.tcp[name]; ok {
+			l.setUpstream(r.LocalPort)
+			continue
+		}
+		l, err := listenTCP(r.TCPListenAddress(), r.ListenPort, r.LocalPort)
+		if err != nil {
+			return err
+		}
+		s.tcp[name] = l
+	}
+	return nil
+}
+
+// Close closes all listeners and active connections.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	if s.http != nil {
+		s.http.close()
+		s.http = nil
+	}
+	s.closeHTTPS()
+	for name, l := range s.tcp {
+		l.close()
+		delete(s.tcp, name)
+	}
+	for _, t := range s.transports {
+		t.CloseIdleConnections()
+	}
+	return nil
+}
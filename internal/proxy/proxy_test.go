@@ -0,0 +1,703 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/usadamasa/kubectl-localmesh/internal/certs"
+	"github.com/usadamasa/kubectl-localmesh/internal/envoy"
+	"github.com/usadamasa/kubectl-localmesh/internal/pf"
+)
+
+// newUpstream は、h2cとHTTP/1.1を受け付けるupstreamを起動する。
+// レスポンスボディとして name と受け取ったHostヘッダー、プロトコルを返す。
+func newUpstream(t *testing.T, name string) (*httptest.Server, int) {
+	t.Helper()
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "Grpc-Status")
+		_, _ = fmt.Fprintf(w, "%s %s %s", name, r.Host, r.Proto)
+		w.Header().Set("Grpc-Status", "0")
+	}))
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+	srv.Config.Protocols = &protocols
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	return srv, srv.Listener.Addr().(*net.TCPAddr).Port
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	port, err := pf.FreeLocalPort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return port
+}
+
+// h2cClient は、HTTP/2 prior knowledgeで接続するクライアント（gRPCクライアントと同じ）
+func h2cClient() *http.Client {
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	return &http.Client{Transport: &http.Transport{Protocols: &protocols}, Timeout: 5 * time.Second}
+}
+
+func get(t *testing.T, client *http.Client, port int, host string) (*http.Response, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/", port), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = host
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request to %s failed: %v", host, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(b)
+}
+
+func TestServer_RoutesByHost(t *testing.T) {
+	_, usersPort := newUpstream(t, "users")
+	_, billingPort := newUpstream(t, "billing")
+	listenerPort := freePort(t)
+
+	s := New()
+	defer func() { _ = s.Close() }()
+
+	routes := []envoy.Route{
+		{Host: "users.localhost", LocalPort: usersPort, ClusterName: "default_users_8080", Type: "http"},
+		{Host: "billing.localhost", LocalPort: billingPort, ClusterName: "default_billing_50051", Type: "grpc"},
+	}
+	if err := s.Update(listenerPort, routes, nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		client   *http.Client
+		host     string
+		wantCode int
+		wantBody string
+	}{
+		{"HTTP/1.1", &http.Client{Timeout: 5 * time.Second}, "users.localhost", http.StatusOK, "users users.localhost HTTP/1.1"},
+		{"h2c", h2cClient(), "billing.localhost", http.StatusOK, "billing billing.localhost HTTP/2.0"},
+		{"大文字のホスト名", &http.Client{Timeout: 5 * time.Second}, "Users.Localhost", http.StatusOK, "users Users.Localhost HTTP/1.1"},
+		{"未定義のホスト", &http.Client{Timeout: 5 * time.Second}, "unknown.localhost", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := get(t, tt.client, listenerPort, tt.host)
+			if resp.StatusCode != tt.wantCode {
+				t.Fatalf("expected status %d, got %d", tt.wantCode, resp.StatusCode)
+			}
+			if body != tt.wantBody {
+				t.Errorf("expected body %q, got %q", tt.wantBody, body)
+			}
+		})
+	}
+
+	// gRPCのステータスはtrailerで返されるため、h2cで中継されること
+	resp, _ := get(t, h2cClient(), listenerPort, "billing.localhost")
+	if got := resp.Trailer.Get("Grpc-Status"); got != "0" {
+		t.Errorf("expected Grpc-Status trailer 0, got %q", got)
+	}
+}
+
+func TestServer_WildcardHost(t *testing.T) {
+	_, previewPort := newUpstream(t, "preview")
+	_, pr1Port := newUpstream(t, "pr-1")
+	_, mainPort := newUpstream(t, "main")
+	listenerPort := freePort(t)
+
+	s := New()
+	defer func() { _ = s.Close() }()
+
+	routes := []envoy.Route{
+		{Host: "*.preview.localhost", LocalPort: previewPort, ClusterName: "preview_web_80", Type: "http"},
+		{Host: "*.pr-1.preview.localhost", LocalPort: pr1Port, ClusterName: "pr-1_web_80", Type: "http"},
+		{Host: "main.preview.localhost", LocalPort: mainPort, ClusterName: "main_web_80", Type: "http"},
+	}
+	if err := s.Update(listenerPort, routes, nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	tests := []struct {
+		host     string
+		wantCode int
+		wantName string
+	}{
+		{"feature-x.preview.localhost", http.StatusOK, "preview"},
+		{"a.b.preview.localhost", http.StatusOK, "preview"},
+		{"web.pr-1.preview.localhost", http.StatusOK, "pr-1"},
+		{"main.preview.localhost", http.StatusOK, "main"},
+		{"preview.localhost", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			resp, body := get(t, client, listenerPort, tt.host)
+			if resp.StatusCode != tt.wantCode {
+				t.Fatalf("expected status %d, got %d", tt.wantCode, resp.StatusCode)
+			}
+			if name, _, _ := strings.Cut(body, " "); name != tt.wantName {
+				t.Errorf("expected upstream %q, got %q", tt.wantName, name)
+			}
+		})
+	}
+}
+
+// newTLSUpstream は、TLSでHTTP/1.1（http2の場合はHTTP/2も）を受け付けるupstreamを起動する。
+// レスポンスボディとしてクライアントが送信したSNIとプロトコルを返す。
+func newTLSUpstream(t *testing.T, http2 bool) int {
+	t.Helper()
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "%s %s", r.TLS.ServerName, r.Proto)
+	}))
+	srv.EnableHTTP2 = http2
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	return srv.Listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestServer_UpstreamProtocol(t *testing.T) {
+	_, plainPort := newUpstream(t, "plain")
+	tlsPort := newTLSUpstream(t, true)
+	tlsHTTP1Port := newTLSUpstream(t, false)
+	listenerPort := freePort(t)
+
+	tests := []struct {
+		name     string
+		route    envoy.Route
+		client   *http.Client
+		wantBody string
+	}{
+		{
+			name:     "httpのデフォルトはHTTP/1.1",
+			route:    envoy.Route{LocalPort: plainPort, Type: "http"},
+			client:   h2cClient(),
+			wantBody: "plain upstream.localhost HTTP/1.1",
+		},
+		{
+			name:     "grpcのデフォルトはh2c",
+			route:    envoy.Route{LocalPort: plainPort, Type: "grpc"},
+			client:   &http.Client{Timeout: 5 * time.Second},
+			wantBody: "plain upstream.localhost HTTP/2.0",
+		},
+		{
+			name:     "h2cを指定",
+			route:    envoy.Route{LocalPort: plainPort, Type: "http", UpstreamProtocol: "h2c"},
+			client:   &http.Client{Timeout: 5 * time.Second},
+			wantBody: "plain upstream.localhost HTTP/2.0",
+		},
+		{
+			name:     "autoはHTTP/1.1のクライアントに合わせる",
+			route:    envoy.Route{LocalPort: plainPort, Type: "http", UpstreamProtocol: "auto"},
+			client:   &http.Client{Timeout: 5 * time.Second},
+			wantBody: "plain upstream.localhost HTTP/1.1",
+		},
+		{
+			name:     "autoはh2cのクライアントに合わせる",
+			route:    envoy.Route{LocalPort: plainPort, Type: "http", UpstreamProtocol: "auto"},
+			client:   h2cClient(),
+			wantBody: "plain upstream.localhost HTTP/2.0",
+		},
+		{
+			name:     "http1-tls",
+			route:    envoy.Route{LocalPort: tlsPort, Type: "http", UpstreamProtocol: "http1-tls", UpstreamSNI: "users.default.svc"},
+			client:   h2cClient(),
+			wantBody: "users.default.svc HTTP/1.1",
+		},
+		{
+			name:     "h2-tls",
+			route:    envoy.Route{LocalPort: tlsPort, Type: "grpc", UpstreamProtocol: "h2-tls", UpstreamSNI: "users.default.svc"},
+			client:   &http.Client{Timeout: 5 * time.Second},
+			wantBody: "users.default.svc HTTP/2.0",
+		},
+		{
+			name:     "auto-tlsはALPNでHTTP/2を選択",
+			route:    envoy.Route{LocalPort: tlsPort, Type: "http", UpstreamProtocol: "auto-tls", UpstreamSNI: "users.default.svc"},
+			client:   &http.Client{Timeout: 5 * time.Second},
+			wantBody: "users.default.svc HTTP/2.0",
+		},
+		{
+			name:     "auto-tlsはALPNでHTTP/1.1を選択",
+			route:    envoy.Route{LocalPort: tlsHTTP1Port, Type: "http", UpstreamProtocol: "auto-tls", UpstreamSNI: "users.default.svc"},
+			client:   h2cClient(),
+			wantBody: "users.default.svc HTTP/1.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New()
+			defer func() { _ = s.Close() }()
+
+			tt.route.Host = "upstream.localhost"
+			tt.route.ClusterName = "upstream"
+			if err := s.Update(listenerPort, []envoy.Route{tt.route}, nil); err != nil {
+				t.Fatalf("Update failed: %v", err)
+			}
+
+			resp, body := get(t, tt.client, listenerPort, tt.route.Host)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected status 200, got %d (%s)", resp.StatusCode, body)
+			}
+			if body != tt.wantBody {
+				t.Errorf("expected body %q, got %q", tt.wantBody, body)
+			}
+		})
+	}
+}
+
+func TestServer_PathRoutes(t *testing.T) {
+	_, webPort := newUpstream(t, "web")
+	_, apiPort := newUpstream(t, "api")
+	_, canaryPort := newUpstream(t, "canary")
+	listenerPort := freePort(t)
+
+	s := New()
+	defer func() { _ = s.Close() }()
+
+	routes := []envoy.Route{
+		{
+			Host: "app.localhost", LocalPort: webPort, ClusterName: "default_web_8080", Type: "http",
+			Paths: []envoy.PathRoute{
+				{Prefix: "/api", LocalPort: apiPort, ClusterName: "default_api_8080"},
+				{Path: "/healthz", LocalPort: webPort, ClusterName: "default_web_8080"},
+				{Regex: "/v[0-9]+/.*", LocalPort: apiPort, ClusterName: "default_api_8080"},
+				{
+					LocalPort: canaryPort, ClusterName: "default_canary_8080",
+					Headers: []envoy.HeaderMatch{{Name: "x-canary"}, {Name: "x-version", Regex: "2|3"}},
+				},
+			},
+		},
+	}
+	if err := s.Update(listenerPort, routes, nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		header   http.Header
+		wantName string
+	}{
+		{"prefix", "/api/users", nil, "api"},
+		{"prefixは文字列の前方一致", "/apis", nil, "api"},
+		{"path", "/healthz?verbose=1", nil, "web"},
+		{"pathは完全一致", "/healthz/live", nil, "web"},
+		{"regexはパス全体に一致", "/v2/users", nil, "api"},
+		{"regexの部分一致は対象外", "/x/v2/users", nil, "web"},
+		{"headers", "/", http.Header{"X-Canary": {"1"}, "X-Version": {"3"}}, "canary"},
+		{"headersはすべて一致する必要がある", "/", http.Header{"X-Canary": {"1"}, "X-Version": {"4"}}, "web"},
+		{"先に記述したルートが優先", "/api", http.Header{"X-Canary": {"1"}, "X-Version": {"2"}}, "api"},
+		{"デフォルト", "/", nil, "web"},
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d%s", listenerPort, tt.path), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Host = "app.localhost"
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, _ := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+
+			if got, _, _ := strings.Cut(string(b), " "); got != tt.wantName {
+				t.Errorf("expected upstream %s, got %q", tt.wantName, string(b))
+			}
+		})
+	}
+}
+
+func TestServer_Rewrites(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "upstream")
+		w.Header().Set("X-Upstream", "1")
+		_, _ = fmt.Fprintf(w, "%s %s env=%s cookie=%s", r.Host, r.URL.RequestURI(), r.Header.Get("X-Env"), r.Header.Get("Cookie"))
+	}))
+	t.Cleanup(upstream.Close)
+	upstreamPort := upstream.Listener.Addr().(*net.TCPAddr).Port
+	listenerPort := freePort(t)
+
+	s := New()
+	defer func() { _ = s.Close() }()
+
+	routes := []envoy.Route{
+		{
+			Host: "users.localhost", LocalPort: upstreamPort, ClusterName: "users_users_api_8080", Type: "http",
+			HostRewrite:             "users-api.users.svc",
+			PrefixRewrite:           "/users/",
+			RequestHeadersToAdd:     []envoy.HeaderValue{{Name: "x-env", Value: "local"}},
+			RequestHeadersToRemove:  []string{"cookie"},
+			ResponseHeadersToAdd:    []envoy.HeaderValue{{Name: "x-upstream", Value: "localmesh"}},
+			ResponseHeadersToRemove: []string{"server"},
+			Paths: []envoy.PathRoute{
+				{Prefix: "/raw", LocalPort: upstreamPort, ClusterName: "users_users_api_8080"},
+			},
+		},
+	}
+	if err := s.Update(listenerPort, routes, nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		wantBody string
+	}{
+		{"サービス自身へのルート", "/list?page=2", "users-api.users.svc /users/list?page=2 env=local cookie="},
+		// パスごとの振り分けでは書き換えず、ヘッダー操作のみ適用する
+		{"パスごとの振り分け", "/raw/list", "users.localhost /raw/list env=local cookie="},
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d%s", listenerPort, tt.path), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Host = "users.localhost"
+			req.Header.Set("Cookie", "session=secret")
+			req.Header.Set("X-Env", "prod")
+
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, _ := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+
+			if string(b) != tt.wantBody {
+				t.Errorf("expected body %q, got %q", tt.wantBody, string(b))
+			}
+			if got := resp.Header.Get("X-Upstream"); got != "localmesh" {
+				t.Errorf("expected X-Upstream to be overwritten, got %q", got)
+			}
+			if got := resp.Header.Get("Server"); got != "" {
+				t.Errorf("expected Server header to be removed, got %q", got)
+			}
+		})
+	}
+}
+
+func TestServer_UpstreamDown(t *testing.T) {
+	listenerPort := freePort(t)
+
+	s := New()
+	defer func() { _ = s.Close() }()
+
+	routes := []envoy.Route{
+		{Host: "users.localhost", LocalPort: freePort(t), ClusterName: "default_users_8080", Type: "http"},
+	}
+	if err := s.Update(listenerPort, routes, nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	// port-forward切断中はEnvoyと同様に503を返す
+	resp, _ := get(t, &http.Client{Timeout: 5 * time.Second}, listenerPort, "users.localhost")
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", resp.StatusCode)
+	}
+}
+
+func TestServer_DuplicateHost(t *testing.T) {
+	s := New()
+	defer func() { _ = s.Close() }()
+
+	routes := []envoy.Route{
+		{Host: "users.localhost", LocalPort: 1, ClusterName: "a", Type: "http"},
+		{Host: "users.localhost", LocalPort: 2, ClusterName: "b", Type: "http"},
+	}
+	err := s.Update(freePort(t), routes, nil)
+	if err == nil || !strings.Contains(err.Error(), "duplicate host") {
+		t.Errorf("expected duplicate host error, got %v", err)
+	}
+}
+
+// newEchoServer は、受け取ったデータをそのまま返すTCPサーバーを起動する
+func newEchoServer(t *testing.T) int {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func echo(t *testing.T, port int, msg string) error {
+	t.Helper()
+
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), time.Second)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := fmt.Fprintln(conn, msg); err != nil {
+		return err
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if got := strings.TrimSpace(line); got != msg {
+		return fmt.Errorf("expected echo %q, got %q", msg, got)
+	}
+	return nil
+}
+
+func TestServer_TCP(t *testing.T) {
+	upstreamPort := newEchoServer(t)
+	listenPort := freePort(t)
+
+	s := New()
+	defer func() { _ = s.Close() }()
+
+	route := envoy.Route{
+		Host:        "db.localhost",
+		LocalPort:   upstreamPort,
+		ClusterName: "tcp_bastion_db_5432",
+		Type:        "tcp",
+		ListenPort:  listenPort,
+	}
+	if err := s.Update(80, []envoy.Route{route}, nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if s.http != nil {
+		t.Error("expected no HTTP listener without HTTP routes")
+	}
+
+	if err := echo(t, listenPort, "hello"); err != nil {
+		t.Fatalf("echo through proxy failed: %v", err)
+	}
+
+	// upstreamのポートが変わっても同じリスナーで中継される
+	route.LocalPort = newEchoServer(t)
+	if err := s.Update(80, []envoy.Route{route}, nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := echo(t, listenPort, "again"); err != nil {
+		t.Fatalf("echo after upstream change failed: %v", err)
+	}
+
+	// ルートが削除されるとリスナーも閉じられる
+	if err := s.Update(80, nil, nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := echo(t, listenPort, "closed"); err == nil {
+		t.Error("expected listener to be closed after route removal")
+	}
+}
+
+// TestServer_MatchesEnvoyConfig は、同じルートからenvoy.BuildConfigが生成する
+// ドメイン→クラスタ→エンドポイント、およびTCPリスナーの対応と同じように転送されることを確認する。
+func TestServer_MatchesEnvoyConfig(t *testing.T) {
+	_, usersPort := newUpstream(t, "users")
+	_, billingPort := newUpstream(t, "billing")
+	dbPort := newEchoServer(t)
+	listenerPort := freePort(t)
+
+	routes := []envoy.Route{
+		{Host: "users.localhost", LocalPort: usersPort, ClusterName: "default_users_8080", Type: "http"},
+		{Host: "billing.localhost", LocalPort: billingPort, ClusterName: "default_billing_50051", Type: "grpc"},
+		{Host: "db.localhost", LocalPort: dbPort, ClusterName: "tcp_bastion_db_5432", Type: "tcp", ListenPort: freePort(t)},
+	}
+
+	s := New()
+	defer func() { _ = s.Close() }()
+	if err := s.Update(listenerPort, routes, nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	domains, tcpListeners := envoyForwarding(t, envoy.BuildConfig(listenerPort, routes, nil))
+	if len(domains) != 2 || len(tcpListeners) != 1 {
+		t.Fatalf("unexpected envoy config: domains=%v tcp=%v", domains, tcpListeners)
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	for domain, upstreamPort := range domains {
+		_, body := get(t, client, listenerPort, domain)
+		want := "users"
+		if upstreamPort == billingPort {
+			want = "billing"
+		}
+		if !strings.HasPrefix(body, want+" ") {
+			t.Errorf("%s: envoy routes to port %d (%s), builtin returned %q", domain, upstreamPort, want, body)
+		}
+	}
+
+	for listenPort, upstreamPort := range tcpListeners {
+		if upstreamPort != dbPort {
+			t.Errorf("envoy forwards port %d to %d, expected %d", listenPort, upstreamPort, dbPort)
+		}
+		if err := echo(t, listenPort, "ping"); err != nil {
+			t.Errorf("builtin TCP listener on port %d: %v", listenPort, err)
+		}
+	}
+}
+
+// envoyForwarding は、Envoyの設定からドメイン→upstreamポートと、TCPリスナーのポート→upstreamポートを取り出す
+func envoyForwarding(t *testing.T, cfg map[string]any) (map[string]int, map[int]int) {
+	t.Helper()
+
+	static := cfg["static_resources"].(map[string]any)
+
+	endpoints := map[string]int{}
+	for _, c := range static["clusters"].([]any) {
+		cluster := c.(map[string]any)
+		la := cluster["load_assignment"].(map[string]any)
+		ep := la["endpoints"].([]any)[0].(map[string]any)["lb_endpoints"].([]any)[0].(map[string]any)
+		addr := ep["endpoint"].(map[string]any)["address"].(map[string]any)["socket_address"].(map[string]any)
+		endpoints[cluster["name"].(string)] = addr["port_value"].(int)
+	}
+
+	domains := map[string]int{}
+	tcpListeners := map[int]int{}
+	for _, l := range static["listeners"].([]any) {
+		listener := l.(map[string]any)
+		port := listener["address"].(map[string]any)["socket_address"].(map[string]any)["port_value"].(int)
+		filter := listener["filter_chains"].([]any)[0].(map[string]any)["filters"].([]any)[0].(map[string]any)
+		typed := filter["typed_config"].(map[string]any)
+
+		switch filter["name"] {
+		case "envoy.filters.network.http_connection_manager":
+			rc := typed["route_config"].(map[string]any)
+			for _, v := range rc["virtual_hosts"].([]any) {
+				vh := v.(map[string]any)
+				route := vh["routes"].([]any)[0].(map[string]any)["route"].(map[string]any)
+				for _, d := range vh["domains"].([]any) {
+					domains[d.(string)] = endpoints[route["cluster"].(string)]
+				}
+			}
+		case "envoy.filters.network.tcp_proxy":
+			tcpListeners[port] = endpoints[typed["cluster"].(string)]
+		}
+	}
+	return domains, tcpListeners
+}
+
+func TestServer_TLS(t *testing.T) {
+	_, usersPort := newUpstream(t, "users")
+	listenerPort := freePort(t)
+	tlsPort := freePort(t)
+
+	ca, err := certs.LoadOrCreateCA(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hc, err := ca.EnsureHostCert("users.localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := New()
+	defer func() { _ = s.Close() }()
+
+	routes := []envoy.Route{
+		{Host: "users.localhost", LocalPort: usersPort, ClusterName: "default_users_8080", Type: "http"},
+	}
+	tlsListener := &envoy.TLSListener{
+		Port:  tlsPort,
+		Certs: []envoy.HostCert{{Host: hc.Host, CertFile: hc.CertFile, KeyFile: hc.KeyFile}},
+	}
+	if err := s.Update(listenerPort, routes, tlsListener); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca.CertPEM())
+	newClient := func(serverName string) *http.Client {
+		return &http.Client{
+			Timeout: 5 * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig:   &tls.Config{RootCAs: roots, ServerName: serverName},
+				ForceAttemptHTTP2: true,
+			},
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://127.0.0.1:%d/", tlsPort), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = "users.localhost"
+
+	resp, err := newClient("users.localhost").Do(req)
+	if err != nil {
+		t.Fatalf("TLS request failed: %v", err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	// ALPNでHTTP/2が選択され、HTTPリスナーと同じルートで転送される
+	if resp.ProtoMajor != 2 {
+		t.Errorf("expected HTTP/2 over TLS, got %s", resp.Proto)
+	}
+	if string(b) != "users users.localhost HTTP/1.1" {
+		t.Errorf("unexpected body %q", string(b))
+	}
+
+	// 証明書のないSNIはハンドシェイクで拒否される
+	if _, err := newClient("unknown.localhost").Do(req); err == nil {
+		t.Error("expected TLS handshake to fail for unknown server name")
+	}
+
+	// TLS設定を外すとTLSリスナーは閉じられる
+	if err := s.Update(listenerPort, routes, nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if s.https != nil {
+		t.Error("expected TLS listener to be closed")
+	}
+}
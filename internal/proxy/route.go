@@ -0,0 +1,139 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/usadamasa/kubectl-localmesh/internal/envoy"
+)
+
+// pathRouter は、ホスト内のリクエストをパス・ヘッダーで振り分ける。
+// Envoyのvirtual hostと同様に、記述順に評価して最初に一致したルートへ転送する。
+type pathRouter struct {
+	routes   []pathHandler
+	fallback http.Handler
+}
+
+type pathHandler struct {
+	match   requestMatcher
+	handler http.Handler
+}
+
+func (p *pathRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	for _, r := range p.routes {
+		if r.match.matches(req) {
+			r.handler.ServeHTTP(w, req)
+			return
+		}
+	}
+	p.fallback.ServeHTTP(w, req)
+}
+
+// newHostHandler は、ホスト1つ分のハンドラーを返す（s.muを保持して呼び出す）
+func (s *Server) newHostHandler(r envoy.Route) (http.Handler, error) {
+	fallback := s.newReverseProxy(r)
+	if len(r.Paths) == 0 {
+		return fallback, nil
+	}
+
+	router := &pathRouter{fallback: fallback}
+	for _, p := range r.Paths {
+		m, err := newRequestMatcher(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route for host '%s': %w", r.Host, err)
+		}
+		// 書き換えはサービス自身へのルートのみのため、同じ転送先でも別のプロキシを使う
+		router.routes = append(router.routes, pathHandler{match: m, handler: s.newReverseProxy(r.PathBackend(p))})
+	}
+	return router, nil
+}
+
+// requestMatcher は、envoy.PathRouteの条件（EnvoyのRouteMatchと同じ意味）
+type requestMatcher struct {
+	prefix  string
+	path    string
+	regex   *regexp.Regexp
+	headers []headerMatcher
+}
+
+type headerMatcher struct {
+	name   string
+	exact  string
+	prefix string
+	regex  *regexp.Regexp
+}
+
+func newRequestMatcher(p envoy.PathRoute) (requestMatcher, error) {
+	m := requestMatcher{prefix: p.Prefix, path: p.Path}
+	if p.Regex != "" {
+		re, err := compileFullMatch(p.Regex)
+		if err != nil {
+			return m, err
+		}
+		m.regex = re
+	}
+	for _, h := range p.Headers {
+		hm := headerMatcher{name: h.Name, exact: h.Exact, prefix: h.Prefix}
+		if h.Regex != "" {
+			re, err := compileFullMatch(h.Regex)
+			if err != nil {
+				return m, err
+			}
+			hm.regex = re
+		}
+		m.headers = append(m.headers, hm)
+	}
+	return m, nil
+}
+
+// compileFullMatch は、値全体に一致する正規表現をコンパイルする（Envoyのsafe_regexと同じ）
+func compileFullMatch(expr string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + expr + ")$")
+}
+
+func (m requestMatcher) matches(req *http.Request) bool {
+	// Envoyと同様にクエリ文字列を除いたパスで判定する
+	path := req.URL.Path
+	switch {
+	case m.path != "":
+		if path != m.path {
+			return false
+		}
+	case m.regex != nil:
+		if !m.regex.MatchString(path) {
+			return false
+		}
+	case m.prefix != "":
+		if !strings.HasPrefix(path, m.prefix) {
+			return false
+		}
+	}
+
+	for _, h := range m.headers {
+		if !h.matches(req.Header) {
+			return false
+		}
+	}
+	return true
+}
+
+func (h headerMatcher) matches(header http.Header) bool {
+	values, ok := header[http.CanonicalHeaderKey(h.name)]
+	if !ok {
+		return false
+	}
+	// 複数の値はEnvoyと同様にカンマで連結して判定する
+	value := strings.Join(values, ",")
+	switch {
+	case h.exact != "":
+		return value == h.exact
+	case h.prefix != "":
+		return strings.HasPrefix(value, h.prefix)
+	case h.regex != nil:
+		return h.regex.MatchString(value)
+	default:
+		return true
+	}
+}
@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// tcpListener は、受け付けた接続をそのままupstreamへ中継するリスナー。
+// Envoyのtcp_proxyフィルタに相当する。
+type tcpListener struct {
+	address string
+	port    int
+	ln      net.Listener
+
+	mu       sync.Mutex
+	upstream string
+	conns    map[net.Conn]struct{}
+	closed   bool
+}
+
+// listenTCP は、address:portで接続を受け付け、127.0.0.1:localPortへ中継する
+func listenTCP(address string, port, localPort int) (*tcpListener, error) {
+	ln, err := net.Listen("tcp", net.JoinHostPort(address, strconv.Itoa(port)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s:%d: %w", address, port, err)
+	}
+
+	l := &tcpListener{address: address, port: port, ln: ln, conns: map[net.Conn]struct{}{}}
+	l.setUpstream(localPort)
+	go l.serve()
+	return l, nil
+}
+
+func (l *tcpListener) setUpstream(localPort int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.upstream = fmt.Sprintf("127.0.0.1:%d", localPort)
+}
+
+func (l *tcpListener) serve() {
+	for {
+		conn, err := l.ln.Accept()
+		if err != nil {
+			// closeによるリスナーの終了
+			return
+		}
+		go l.handle(conn)
+	}
+}
+
+// handle は、接続1つ分をupstreamへ中継する
+func (l *tcpListener) handle(downstream net.Conn) {
+	l.mu.Lock()
+	upstreamAddr := l.upstream
+	l.mu.Unlock()
+
+	upstream, err := net.DialTimeout("tcp", upstreamAddr, connectTimeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "builtin proxy: port %d: %v\n", l.port, err)
+		_ = downstream.Close()
+		return
+	}
+
+	if !l.track(downstream, upstream) {
+		_ = downstream.Close()
+		_ = upstream.Close()
+		return
+	}
+	defer l.untrack(downstream, upstream)
+
+	pipe(downstream, upstream)
+}
+
+// track は、close時に切断できるよう接続を記録する。close済みの場合はfalseを返す。
+func (l *tcpListener) track(conns ...net.Conn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return false
+	}
+	for _, c := range conns {
+		l.conns[c] = struct{}{}
+	}
+	return true
+}
+
+func (l *tcpListener) untrack(conns ...net.Conn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, c := range conns {
+		delete(l.conns, c)
+	}
+}
+
+// close は、リスナーと中継中の接続をすべて閉じる
+func (l *tcpListener) close() {
+	_ = l.ln.Close()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	for c := range l.conns {
+		_ = c.Close()
+	}
+}
+
+// pipe は、双方向にデータを中継し、両方向が終了するまでブロックする。
+// 片方向がEOFになった場合は相手側の書き込みを閉じ（half-close）、もう片方向の終了を待つ。
+func pipe(a, b net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		copyAndCloseWrite(b, a)
+	}()
+	go func() {
+		defer wg.Done()
+		copyAndCloseWrite(a, b)
+	}()
+	wg.Wait()
+
+	_ = a.Close()
+	_ = b.Close()
+}
+
+func copyAndCloseWrite(dst, src net.Conn) {
+	_, _ = io.Copy(dst, src)
+	if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+		_ = cw.CloseWrite()
+	} else {
+		_ = dst.Close()
+	}
+}
@@ -0,0 +1,86 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/usadamasa/kubectl-localmesh/internal/config"
+	"github.com/usadamasa/kubectl-localmesh/internal/k8s"
+)
+
+// verifyCluster は、接続先のクラスタがcluster:の値と一致するかを確認する。
+// 一致しない場合はエラーを返す（forceがtrueの場合は警告のみ）。
+func verifyCluster(
+	ctx context.Context,
+	guard *config.ClusterGuard,
+	kube k8s.ClientOptions,
+	clientset kubernetes.Interface,
+	restConfig *rest.Config,
+	force bool,
+) error {
+	if guard == nil {
+		return nil
+	}
+
+	kubeContext, err := k8s.CurrentContext(kube)
+	if err != nil {
+		return fmt.Errorf("failed to read kubeconfig: %w", err)
+	}
+	mismatches := clusterMismatches(ctx, guard, kubeContext, clientset, restConfig)
+	if len(mismatches) == 0 {
+		return nil
+	}
+
+	msg := fmt.Sprintf("connected cluster does not match 'cluster:' in the config:\n  - %s", strings.Join(mismatches, "\n  - "))
+	if force {
+		fmt.Fprintf(os.Stderr, "warning: %s\n(ignored by --force-cluster)\n", msg)
+		return nil
+	}
+	return fmt.Errorf("%s\nrefusing to start: check --context / kube_context, or use --force-cluster", msg)
+}
+
+// clusterMismatches は、cluster:に指定された値のうち接続先と一致しないものを返す
+// （確認できなかった値も一致しないものとして扱う）
+func clusterMismatches(
+	ctx context.Context,
+	guard *config.ClusterGuard,
+	kubeContext string,
+	clientset kubernetes.Interface,
+	restConfig *rest.Config,
+) []string {
+	var mismatches []string
+	if guard.Context != "" && guard.Context != kubeContext {
+		mismatches = append(mismatches, fmt.Sprintf("context is '%s', expected '%s'", kubeContext, guard.Context))
+	}
+	if guard.Server != "" {
+		if server := strings.TrimSuffix(restConfig.Host, "/"); !strings.EqualFold(server, guard.Server) {
+			mismatches = append(mismatches, fmt.Sprintf("server is '%s', expected '%s'", server, guard.Server))
+		}
+	}
+	if guard.CAFingerprint != "" {
+		fingerprint, err := k8s.CAFingerprint(restConfig)
+		if err != nil {
+			mismatches = append(mismatches, fmt.Sprintf("CA fingerprint cannot be verified: %v", err))
+		} else if fingerprint != guard.CAFingerprint {
+			if fingerprint == "" {
+				fingerprint = "(none)"
+			}
+			mismatches = append(mismatches, fmt.Sprintf("CA fingerprint is '%s', expected '%s'", fingerprint, guard.CAFingerprint))
+		}
+	}
+	// APIサーバーへの問い合わせは最後に行う
+	if guard.NamespaceUID != "" {
+		uid, err := k8s.NamespaceUID(ctx, clientset, guard.Namespace)
+		if err != nil {
+			mismatches = append(mismatches, fmt.Sprintf("namespace UID cannot be verified: %v", err))
+		} else if uid != guard.NamespaceUID {
+			mismatches = append(mismatches, fmt.Sprintf("namespace %s has UID '%s', expected '%s'", guard.Namespace, uid, guard.NamespaceUID))
+		}
+	}
+	return mismatches
+}
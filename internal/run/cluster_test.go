@@ -0,0 +1,93 @@
+package run
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+
+	"github.com/usadamasa/kubectl-localmesh/internal/config"
+	"github.com/usadamasa/kubectl-localmesh/internal/k8s"
+)
+
+func TestVerifyCluster(t *testing.T) {
+	clientset := fake.NewClientset(&corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "uid-staging"},
+	})
+	restConfig := &rest.Config{Host: "https://staging.example.com:6443/"}
+	kube := k8s.ClientOptions{Context: "staging"}
+
+	tests := []struct {
+		name    string
+		guard   *config.ClusterGuard
+		force   bool
+		wantErr []string
+	}{
+		{
+			name: "no guard",
+		},
+		{
+			name: "match",
+			guard: &config.ClusterGuard{
+				Context:      "staging",
+				Server:       "https://Staging.example.com:6443",
+				Namespace:    "kube-system",
+				NamespaceUID: "uid-staging",
+			},
+		},
+		{
+			name: "mismatch",
+			guard: &config.ClusterGuard{
+				Context:      "production",
+				Server:       "https://production.example.com:6443",
+				Namespace:    "kube-system",
+				NamespaceUID: "uid-production",
+			},
+			wantErr: []string{
+				"context is 'staging', expected 'production'",
+				"server is 'https://staging.example.com:6443', expected 'https://production.example.com:6443'",
+				"namespace kube-system has UID 'uid-staging', expected 'uid-production'",
+				"--force-cluster",
+			},
+		},
+		{
+			name:    "cannot be verified",
+			guard:   &config.ClusterGuard{Namespace: "missing", NamespaceUID: "uid-staging"},
+			wantErr: []string{"namespace UID cannot be verified"},
+		},
+		{
+			name:    "no CA",
+			guard:   &config.ClusterGuard{CAFingerprint: "sha256:" + strings.Repeat("0", 64)},
+			wantErr: []string{"CA fingerprint is '(none)'"},
+		},
+		{
+			name:  "force",
+			guard: &config.ClusterGuard{Context: "production"},
+			force: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyCluster(context.Background(), tt.guard, kube, clientset, restConfig, tt.force)
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("expected no error, got: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected error containing %q, got:\n%v", want, err)
+				}
+			}
+		})
+	}
+}
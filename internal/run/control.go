@@ -0,0 +1,45 @@
+package run
+
+import (
+	"fmt"
+
+	"github.com/usadamasa/kubectl-localmesh/internal/state"
+)
+
+// meshController は、制御APIからmeshを操作するためのcontrol.Controllerの実装
+type meshController struct {
+	m *mesh
+	// publish はEnvoyの設定と状態ファイルをmeshの現在の状態に合わせて更新する
+	publish func() error
+}
+
+func (c *meshController) Services() ([]state.Service, error) {
+	return c.m.serviceStates()
+}
+
+func (c *meshController) Reconnect(host string) error {
+	if err := c.m.reconnect(host); err != nil {
+		return err
+	}
+	fmt.Printf("service %s: reconnecting\n", host)
+	return nil
+}
+
+func (c *meshController) SetEnabled(host string, enabled bool) error {
+	changed, err := c.m.setEnabled(host, enabled)
+	if err != nil || !changed {
+		return err
+	}
+
+	// ルートの追加・削除をEnvoyに反映する
+	if err := c.publish(); err != nil {
+		return fmt.Errorf("failed to update envoy config: %w", err)
+	}
+
+	if enabled {
+		fmt.Printf("service %s: enabled\n", host)
+	} else {
+		fmt.Printf("service %s: disabled\n", host)
+	}
+	return nil
+}
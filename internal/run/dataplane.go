@@ -0,0 +1,153 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/usadamasa/kubectl-localmesh/internal/envoy"
+	"github.com/usadamasa/kubectl-localmesh/internal/proxy"
+)
+
+// プロキシの実装（up --proxy）
+const (
+	ProxyEnvoy   = "envoy"
+	ProxyBuiltin = "builtin"
+)
+
+// dataPlane は、meshのルートに従ってトラフィックを転送するプロキシ。
+// どちらの実装もenvoy.Routeを入力とするため、相互に置き換えられる。
+type dataPlane interface {
+	// update は、ルートを反映する（実行中に何度でも呼び出せる）。tlsはnil可
+	update(listenerPort int, routes []envoy.Route, tls *envoy.TLSListener) error
+	// run は、ctxがキャンセルされるかプロキシが終了するまでブロックする
+	run(ctx context.Context) error
+	// close は、プロキシが使用したリソースを解放する
+	close()
+}
+
+// envoyDataPlane は、ファイルベースのxDSで設定を読み込むEnvoyプロセス
+type envoyDataPlane struct {
+	logLevel  string
+	dir       string
+	paths     envoy.DynamicPaths
+	bootstrap string
+}
+
+// newEnvoyDataPlane は、一時ディレクトリにEnvoyのbootstrap設定を書き出す
+func newEnvoyDataPlane(logLevel string, adminPort int) (*envoyDataPlane, error) {
+	dir, err := os.MkdirTemp("", "kubectl-localmesh-")
+	if err != nil {
+		return nil, err
+	}
+
+	// Envoyはファイルベースのxdsで設定を読み込み、ファイルの置き換えで再設定される
+	d := &envoyDataPlane{
+		logLevel:  logLevel,
+		dir:       dir,
+		paths:     envoy.NewDynamicPaths(dir),
+		bootstrap: filepath.Join(dir, "envoy.yaml"),
+	}
+	if err := writeYAMLFile(d.bootstrap, envoy.BuildBootstrap(d.paths, adminPort)); err != nil {
+		d.close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// update は、EnvoyのLDS/CDS/RDSファイルを書き出す。
+// クラスタ追加後にルートとリスナーが参照するよう、CDS→RDS→LDSの順で置き換える。
+func (d *envoyDataPlane) update(listenerPort int, routes []envoy.Route, tls *envoy.TLSListener) error {
+	envoyCfg := envoy.BuildConfig(listenerPort, routes, tls)
+	lds, cds, rds := envoy.BuildDynamicResources(envoyCfg, d.paths)
+
+	if err := writeYAMLFile(d.paths.CDS, cds); err != nil {
+		return err
+	}
+	if err := writeYAMLFile(d.paths.RDS, rds); err != nil {
+		return err
+	}
+	return writeYAMLFile(d.paths.LDS, lds)
+}
+
+func (d *envoyDataPlane) run(ctx context.Context) error {
+	envoyCmd := exec.CommandContext(
+		ctx,
+		"envoy",
+		"-c", d.bootstrap,
+		"-l", d.logLevel,
+	)
+	envoyCmd.Stdout = os.Stdout
+	envoyCmd.Stderr = os.Stderr
+
+	// Envoy実行（contextキャンセル時に自動終了）
+	return envoyCmd.Run()
+}
+
+func (d *envoyDataPlane) close() {
+	_ = os.RemoveAll(d.dir)
+}
+
+// builtinDataPlane は、Envoyを使わずにプロセス内で転送するプロキシ
+type builtinDataPlane struct {
+	srv *proxy.Server
+}
+
+func newBuiltinDataPlane() *builtinDataPlane {
+	return &builtinDataPlane{srv: proxy.New()}
+}
+
+func (d *builtinDataPlane) update(listenerPort int, routes []envoy.Route, tls *envoy.TLSListener) error {
+	return d.srv.Update(listenerPort, routes, tls)
+}
+
+func (d *builtinDataPlane) run(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (d *builtinDataPlane) close() {
+	_ = d.srv.Close()
+}
+
+// writeYAMLFile は、vをYAMLとして同じディレクトリの一時ファイル経由でアトミックに書き込む。
+// Envoyのwatched_directoryはファイルの移動で変更を検出する。
+func writeYAMLFile(path string, v any) error {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// checkProxy は、up --proxy の値を検証する
+func checkProxy(name string) error {
+	switch name {
+	case ProxyEnvoy, ProxyBuiltin:
+		return nil
+	default:
+		return fmt.Errorf("proxy must be '%s' or '%s', got '%s'", ProxyEnvoy, ProxyBuiltin, name)
+	}
+}
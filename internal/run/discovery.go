@@ -0,0 +1,179 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/usadamasa/kubectl-localmesh/internal/config"
+	"github.com/usadamasa/kubectl-localmesh/internal/k8s"
+)
+
+// discoveryInterval はwatch: trueのkubernetes-discoveryでServiceを再探索する間隔
+const discoveryInterval = 10 * time.Second
+
+// discoverFunc は、kubernetes-discoveryのエントリに一致するServiceを返す
+type discoverFunc func(ctx context.Context, d *config.KubernetesDiscovery) ([]config.DiscoveredService, error)
+
+// clusterDiscovery は、client-goでServiceを列挙するdiscoverFuncを返す
+func clusterDiscovery(clientset kubernetes.Interface) discoverFunc {
+	return func(ctx context.Context, d *config.KubernetesDiscovery) ([]config.DiscoveredService, error) {
+		var found []config.DiscoveredService
+		for _, ns := range d.Namespaces {
+			ports, err := k8s.DiscoverServices(ctx, clientset, ns, d.Selector, d.PortName)
+			if err != nil {
+				return nil, err
+			}
+			for _, p := range ports {
+				found = append(found, config.DiscoveredService{
+					Namespace:        ns,
+					Service:          p.Service,
+					Port:             p.Port,
+					PortName:         p.Name,
+					Protocol:         p.Protocol,
+					UpstreamProtocol: p.UpstreamProtocol,
+				})
+			}
+		}
+		return found, nil
+	}
+}
+
+// mockDiscovery は、モック設定のlabelsでServiceを探すdiscoverFuncを返す
+// （同じServiceのモックが複数ある場合は最初に一致したものを使う）
+func mockDiscovery(mockCfg *config.MockConfig) discoverFunc {
+	return func(_ context.Context, d *config.KubernetesDiscovery) ([]config.DiscoveredService, error) {
+		selector, err := labels.Parse(d.Selector)
+		if err != nil {
+			return nil, err
+		}
+		var found []config.DiscoveredService
+		for _, ns := range d.Namespaces {
+			seen := map[string]bool{}
+			for _, m := range mockCfg.Mocks {
+				if m.Namespace != ns || seen[m.Service] || !selector.Matches(labels.Set(m.Labels)) {
+					continue
+				}
+				if d.PortName != "" && m.PortName != d.PortName {
+					continue
+				}
+				seen[m.Service] = true
+				p := mockPort(m)
+				found = append(found, config.DiscoveredService{
+					Namespace:        ns,
+					Service:          m.Service,
+					Port:             p.Port,
+					PortName:         p.Name,
+					Protocol:         p.Protocol,
+					UpstreamProtocol: p.UpstreamProtocol,
+				})
+			}
+		}
+		return found, nil
+	}
+}
+
+// discovery は、kubernetes-discoveryのエントリを見つかったServiceのエントリに展開する。
+// watch: falseのエントリは設定を読み込んだときだけServiceを探し、その結果を使い続ける。
+type discovery struct {
+	discover discoverFunc
+
+	cfg    *config.Config                                             // 展開前の設定
+	found  map[*config.KubernetesDiscovery][]config.DiscoveredService // エントリごとに見つかったService
+	warned map[string]bool                                            // 警告を出力済みの除外したService
+}
+
+func newDiscovery(discover discoverFunc) *discovery {
+	return &discovery{discover: discover, warned: map[string]bool{}}
+}
+
+// load は、新しく読み込んだ設定のすべてのエントリでServiceを探して展開する
+func (d *discovery) load(ctx context.Context, cfg *config.Config) (*config.Config, error) {
+	found := map[*config.KubernetesDiscovery][]config.DiscoveredService{}
+	expanded, err := d.expand(ctx, cfg, found, func(*config.KubernetesDiscovery) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	d.cfg, d.found = cfg, found
+	return expanded, nil
+}
+
+// refresh は、現在の設定のwatch: trueのエントリでServiceを探し直して展開する
+func (d *discovery) refresh(ctx context.Context) (*config.Config, error) {
+	found := maps.Clone(d.found)
+	expanded, err := d.expand(ctx, d.cfg, found, func(entry *config.KubernetesDiscovery) bool { return entry.Watch })
+	if err != nil {
+		return nil, err
+	}
+	d.found = found
+	return expanded, nil
+}
+
+// watching は、現在の設定にwatch: trueのエントリがあるかを返す
+func (d *discovery) watching() bool {
+	if d.cfg == nil {
+		return false
+	}
+	for i := range d.cfg.Services {
+		if entry, ok := d.cfg.Services[i].Get().(*config.KubernetesDiscovery); ok && entry.Watch {
+			return true
+		}
+	}
+	return false
+}
+
+// expand は、listがtrueのエントリでServiceを探し、それ以外はfoundの結果を使って展開する
+func (d *discovery) expand(
+	ctx context.Context,
+	cfg *config.Config,
+	found map[*config.KubernetesDiscovery][]config.DiscoveredService,
+	list func(*config.KubernetesDiscovery) bool,
+) (*config.Config, error) {
+	if !cfg.HasDiscovery() {
+		return cfg, nil
+	}
+
+	expanded, skipped, err := cfg.ExpandDiscovery(func(entry *config.KubernetesDiscovery) ([]config.DiscoveredService, error) {
+		if services, ok := found[entry]; ok && !list(entry) {
+			return services, nil
+		}
+		services, err := d.discover(ctx, entry)
+		if err != nil {
+			return nil, fmt.Errorf("kubernetes-discovery '%s': %w", entry.EffectiveHostTemplate(), err)
+		}
+		found[entry] = services
+		return services, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 同じ理由の警告は一度だけ出力する
+	for _, s := range skipped {
+		if !d.warned[s] {
+			d.warned[s] = true
+			fmt.Fprintf(os.Stderr, "warning: kubernetes-discovery skipped %s\n", s)
+		}
+	}
+	return expanded, nil
+}
+
+// watchDiscovery は、intervalごとにonTickを呼び出す。contextがキャンセルされるまでブロックする。
+func watchDiscovery(ctx context.Context, interval time.Duration, onTick func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			onTick()
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package run
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/usadamasa/kubectl-localmesh/internal/config"
+)
+
+func TestDiscovery_RefreshOnlyWatchedEntries(t *testing.T) {
+	watched := &config.KubernetesDiscovery{Namespaces: []string{"users"}, Watch: true}
+	static := &config.KubernetesDiscovery{Namespaces: []string{"billing"}}
+	cfg := &config.Config{Services: []config.ServiceDefinition{
+		config.NewServiceDefinition(watched),
+		config.NewServiceDefinition(static),
+	}}
+
+	// 呼び出しのたびにnamespaceのServiceが1つ増える
+	calls := map[string]int{}
+	d := newDiscovery(func(_ context.Context, entry *config.KubernetesDiscovery) ([]config.DiscoveredService, error) {
+		ns := entry.Namespaces[0]
+		calls[ns]++
+		var found []config.DiscoveredService
+		for i := range calls[ns] {
+			found = append(found, config.DiscoveredService{Namespace: ns, Service: string(rune('a' + i)), Port: 80})
+		}
+		return found, nil
+	})
+
+	hostsOf := func(c *config.Config) []string {
+		var hosts []string
+		for _, sd := range c.Services {
+			hosts = append(hosts, sd.Get().GetHost())
+		}
+		return hosts
+	}
+
+	expanded, err := d.load(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if got, want := hostsOf(expanded), []string{"a.users.localhost", "a.billing.localhost"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after load: %v, want %v", got, want)
+	}
+	if !d.watching() {
+		t.Error("expected watching() to be true")
+	}
+
+	// watch: falseのエントリは読み込み時の結果を使い続ける
+	expanded, err = d.refresh(context.Background())
+	if err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if got, want := hostsOf(expanded), []string{"a.users.localhost", "b.users.localhost", "a.billing.localhost"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after refresh: %v, want %v", got, want)
+	}
+	if calls["billing"] != 1 {
+		t.Errorf("expected billing to be listed once, got %d", calls["billing"])
+	}
+}
+
+func TestMockDiscovery(t *testing.T) {
+	mockCfg := &config.MockConfig{Mocks: []config.MockService{
+		{Namespace: "shop", Service: "web", PortName: "http", ResolvedPort: 80, Labels: map[string]string{"part-of": "shop"}},
+		{Namespace: "shop", Service: "cart", PortName: "grpc", ResolvedPort: 9090, Labels: map[string]string{"part-of": "shop"}},
+		{Namespace: "shop", Service: "cart", PortName: "metrics", ResolvedPort: 9100, Labels: map[string]string{"part-of": "shop"}},
+		{Namespace: "shop", Service: "admin", PortName: "http", ResolvedPort: 8080, Labels: map[string]string{"part-of": "backoffice"}},
+		{Namespace: "other", Service: "web", PortName: "http", ResolvedPort: 80, Labels: map[string]string{"part-of": "shop"}},
+	}}
+
+	found, err := mockDiscovery(mockCfg)(context.Background(), &config.KubernetesDiscovery{
+		Namespaces: []string{"shop"},
+		Selector:   "part-of=shop",
+	})
+	if err != nil {
+		t.Fatalf("mockDiscovery failed: %v", err)
+	}
+	want := []config.DiscoveredService{
+		{Namespace: "shop", Service: "web", Port: 80, PortName: "http", Protocol: "http"},
+		{Namespace: "shop", Service: "cart", Port: 9090, PortName: "grpc", Protocol: "grpc"},
+	}
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("mockDiscovery() = %+v, want %+v", found, want)
+	}
+}
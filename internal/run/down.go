@@ -0,0 +1,134 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/usadamasa/kubectl-localmesh/internal/hosts"
+	"github.com/usadamasa/kubectl-localmesh/internal/state"
+)
+
+// Down stops running up instances recorded in the runtime state directory.
+// pid or name selects a single instance; when neither is given and all is
+// false, exactly one instance must exist. Instances whose process already
+// exited are cleaned up (managed /etc/hosts block and state file).
+func Down(pid int, name string, all bool, timeout time.Duration) error {
+	instances, err := state.List()
+	if err != nil {
+		return fmt.Errorf("failed to read runtime state: %w", err)
+	}
+
+	targets, err := selectInstances(instances, pid, name, all)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, inst := range targets {
+		if err := stopInstance(inst, timeout); err != nil {
+			errs = append(errs, fmt.Errorf("pid %d: %w", inst.PID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// selectInstances は、down の対象インスタンスを選択する
+func selectInstances(instances []*state.Instance, pid int, name string, all bool) ([]*state.Instance, error) {
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("no running kubectl-localmesh instances")
+	}
+
+	if pid != 0 {
+		for _, inst := range instances {
+			if inst.PID == pid {
+				return []*state.Instance{inst}, nil
+			}
+		}
+		return nil, fmt.Errorf("no kubectl-localmesh instance with pid %d", pid)
+	}
+	if name != "" {
+		// 実行中の同じ名前のインスタンスは1つだが、異常終了したインスタンスの状態が残っている場合がある
+		var named []*state.Instance
+		for _, inst := range instances {
+			if instanceName(inst) == name {
+				named = append(named, inst)
+			}
+		}
+		if len(named) == 0 {
+			return nil, fmt.Errorf("no kubectl-localmesh instance named '%s'", name)
+		}
+		return named, nil
+	}
+
+	if all || len(instances) == 1 {
+		return instances, nil
+	}
+
+	msg := fmt.Sprintf("%d instances are running; use --name, --pid or --all:", len(instances))
+	for _, inst := range instances {
+		msg += fmt.Sprintf("\n  %s: pid %d (%s)", instanceName(inst), inst.PID, inst.ConfigPath)
+	}
+	return nil, errors.New(msg)
+}
+
+// stopInstance は、インスタンスにSIGTERMを送り終了を待つ。
+// up は SIGTERM を受けると /etc/hosts と状態ファイルを自身でクリーンアップする。
+// PIDが別のプロセスに再利用されている（開始時刻が記録と異なる）場合はシグナルを送らず、異常終了したものとして扱う。
+func stopInstance(inst *state.Instance, timeout time.Duration) error {
+	if inst.Alive() {
+		if err := syscall.Kill(inst.PID, syscall.SIGTERM); err != nil {
+			if errors.Is(err, syscall.EPERM) {
+				return fmt.Errorf("permission denied: try 'sudo kubectl-localmesh down'")
+			}
+			return fmt.Errorf("failed to send SIGTERM: %w", err)
+		}
+
+		deadline := time.Now().Add(timeout)
+		for inst.Alive() {
+			if time.Now().After(deadline) {
+				return fmt.Errorf("did not stop within %s", timeout)
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	// 正常終了していれば状態ファイルは削除済み
+	if _, err := state.Load(inst.PID); errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("stopped kubectl-localmesh (pid %d)\n", inst.PID)
+		return nil
+	}
+
+	// プロセスが異常終了していた場合は残ったエントリを片付ける
+	if inst.HostsUpdated {
+		if err := removeHostsEntries(inst); err != nil {
+			return fmt.Errorf("failed to clean up /etc/hosts: %w", err)
+		}
+	}
+	if err := state.Remove(inst.PID); err != nil {
+		return fmt.Errorf("failed to remove runtime state: %w", err)
+	}
+	fmt.Printf("cleaned up stale kubectl-localmesh instance (pid %d)\n", inst.PID)
+	return nil
+}
+
+// removeHostsEntries は、異常終了したインスタンスの/etc/hostsの管理ブロックを取り除く
+func removeHostsEntries(inst *state.Instance) error {
+	owner, err := hosts.NewOwner(inst.Name, inst.ID, inst.PID, inst.ProcessStart)
+	if err != nil {
+		// インスタンスIDを記録していない以前のバージョンのブロックは特定できない
+		fmt.Println("run 'sudo kubectl-localmesh hosts clean' to remove its /etc/hosts entries")
+		return nil
+	}
+	editor, err := hosts.NewEditor(owner)
+	if err != nil {
+		return err
+	}
+	if err := editor.Remove(); err != nil {
+		return err
+	}
+	fmt.Println("/etc/hosts cleaned up")
+	return nil
+}
@@ -0,0 +1,167 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/usadamasa/kubectl-localmesh/internal/config"
+	"github.com/usadamasa/kubectl-localmesh/internal/envoy"
+	"github.com/usadamasa/kubectl-localmesh/internal/k8s"
+	"github.com/usadamasa/kubectl-localmesh/internal/pf"
+)
+
+// sharedForward は、同じクラスタ（Service・ポート）を参照するサービスとroutesで共有するport-forward。
+// 1つのクラスタには1つのローカルポートだけを割り当て、Envoyのクラスタも1つにする。
+type sharedForward struct {
+	namespace string
+	service   string
+	localPort int
+	remote    int
+
+	parent context.Context
+	run    func(ctx context.Context)
+
+	// 以下はmesh.muで保護される
+	users  map[*runningService]bool // 転送中（有効）のサービス
+	cancel context.CancelFunc       // 停止中はnil
+	pod    string
+}
+
+// forwardFor は、クラスタ名とそのport-forwardを返す。同じクラスタのport-forwardが既にあれば
+// 共有し（sharedがtrue）、なければローカルポートを割り当てて作成する（起動はstartForwardで行う）。
+// m.muを保持して呼び出す。
+func (m *mesh) forwardFor(ctx context.Context, namespace, service string, remotePort int) (name string, f *sharedForward, shared bool, err error) {
+	name = config.KubernetesClusterName(namespace, service, remotePort)
+	if f, ok := m.forwards[name]; ok {
+		return name, f, true, nil
+	}
+
+	localPort, err := pf.FreeLocalPort()
+	if err != nil {
+		return "", nil, false, err
+	}
+	f = &sharedForward{
+		namespace: namespace,
+		service:   service,
+		localPort: localPort,
+		remote:    remotePort,
+		parent:    ctx,
+		users:     map[*runningService]bool{},
+	}
+	factory := &observedPortForwarderFactory{
+		PortForwarderFactory: k8s.NewWebSocketPortForwarderFactory(m.restConfig),
+		onCreate: func(podName string) {
+			m.observe(func() { f.pod = podName })
+		},
+	}
+	f.run = m.portForwardLoop(factory, namespace, service, localPort, remotePort)
+	m.forwards[name] = f
+	return name, f, false, nil
+}
+
+// start は、port-forwardのgoroutineを起動する（mesh.muを保持して呼び出す）
+func (f *sharedForward) start() {
+	ctx, cancel := context.WithCancel(f.parent)
+	f.cancel = cancel
+	go f.run(ctx)
+}
+
+// stop は、port-forwardのgoroutineを停止する（mesh.muを保持して呼び出す）
+func (f *sharedForward) stop() {
+	if f.cancel != nil {
+		f.cancel()
+		f.cancel = nil
+	}
+	f.pod = ""
+}
+
+// acquire は、rsの転送にport-forwardを使い始め、最初の利用者であれば起動する（mesh.muを保持して呼び出す）
+func (f *sharedForward) acquire(rs *runningService) {
+	if len(f.users) == 0 {
+		f.start()
+	}
+	f.users[rs] = true
+}
+
+// release は、rsの転送でport-forwardを使い終え、利用者がいなくなれば停止する（mesh.muを保持して呼び出す）
+func (f *sharedForward) release(rs *runningService) {
+	if !f.users[rs] {
+		return
+	}
+	delete(f.users, rs)
+	if len(f.users) == 0 {
+		f.stop()
+	}
+}
+
+// pruneForwards は、servicesのいずれからも参照されないport-forwardを停止して削除する（m.muを保持して呼び出す）
+func (m *mesh) pruneForwards(services map[string]*runningService) {
+	referenced := map[string]bool{}
+	for _, rs := range services {
+		for _, name := range rs.clusters {
+			referenced[name] = true
+		}
+	}
+	for name, f := range m.forwards {
+		if !referenced[name] {
+			f.stop()
+			delete(m.forwards, name)
+		}
+	}
+}
+
+// useCluster は、rsが参照するクラスタにnameを追加する
+func (rs *runningService) useCluster(name string) {
+	if !slices.Contains(rs.clusters, name) {
+		rs.clusters = append(rs.clusters, name)
+	}
+}
+
+// clusterUser は、クラスタを参照するサービスまたはroutesの転送先
+type clusterUser struct {
+	route envoy.Route // 転送先（routesの場合はPathBackend）
+	path  bool        // routesの転送先かどうか
+}
+
+func (u clusterUser) String() string {
+	if u.path {
+		return fmt.Sprintf("routes of '%s'", u.route.Host)
+	}
+	return fmt.Sprintf("service '%s'", u.route.Host)
+}
+
+// checkClusters は、ポートを解決した後のクラスタ名でサービス間の衝突を検証する。
+// 設定の検証ではport_nameとportが同じServiceのポートを指すかは分からないため、ここで再確認する。
+// サービスエントリ同士はEnvoyのvirtual host名・TCPリスナー名が重複するため同じクラスタを使えず、
+// TCPサービスのクラスタや上流のプロトコルが異なるクラスタはroutesの転送先と共有できない。
+func checkClusters(routes []envoy.Route) error {
+	entries := map[string]clusterUser{} // クラスタ名ごとのサービスエントリ
+	first := map[string]clusterUser{}   // クラスタ名ごとの最初の利用元
+	for _, r := range routes {
+		self := clusterUser{route: r}
+		if e, ok := entries[r.ClusterName]; ok {
+			return fmt.Errorf("%s forwards to the same Service port as %s (cluster '%s'); use routes of one service to share it", self, e, r.ClusterName)
+		}
+		entries[r.ClusterName] = self
+
+		users := []clusterUser{self}
+		for _, p := range r.Paths {
+			users = append(users, clusterUser{route: r.PathBackend(p), path: true})
+		}
+		for _, u := range users {
+			name := u.route.ClusterName
+			f, ok := first[name]
+			switch {
+			case !ok:
+				first[name] = u
+			case f.route.Type == "tcp" || u.route.Type == "tcp":
+				return fmt.Errorf("%s: cluster '%s' is already used by %s; a TCP service cannot share its Service port with routes", u, name, f)
+			case f.route.EffectiveUpstreamProtocol() != u.route.EffectiveUpstreamProtocol():
+				return fmt.Errorf("upstream protocol '%s' of cluster '%s' for %s differs from '%s' for %s",
+					u.route.EffectiveUpstreamProtocol(), name, u, f.route.EffectiveUpstreamProtocol(), f)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package run
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"os"
+	"sync"
+
+	"github.com/usadamasa/kubectl-localmesh/internal/config"
+	"github.com/usadamasa/kubectl-localmesh/internal/state"
+)
+
+// newInstanceID は、/etc/hostsの管理ブロックと状態ファイルに記録するインスタンスIDを返す
+func newInstanceID() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate instance id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// instanceName は、インスタンスの名前を返す（名前を記録していない以前のバージョンはデフォルトの名前）
+func instanceName(inst *state.Instance) string {
+	if inst.Name != "" {
+		return inst.Name
+	}
+	return config.DefaultName
+}
+
+// checkInstanceName は、同じ名前のインスタンスが実行中でないかを確認する
+func checkInstanceName(name string) error {
+	instances, err := state.List()
+	if err != nil {
+		return fmt.Errorf("failed to read runtime state: %w", err)
+	}
+	for _, inst := range instances {
+		if inst.PID == os.Getpid() || instanceName(inst) != name || !inst.Alive() {
+			continue
+		}
+		return fmt.Errorf("a kubectl-localmesh named '%s' is already running (pid %d, %s): "+
+			"stop it with 'kubectl-localmesh down --name %s', or choose another name with --name or 'name:' in the config",
+			name, inst.PID, inst.ConfigPath, name)
+	}
+	return nil
+}
+
+// otherListenAddresses は、実行中の他のインスタンスのTCPサービスがリスンしているループバックアドレスを返す。
+// 状態ファイルを読めない場合は空とする（リスンに失敗した場合はそのエラーで分かる）。
+func otherListenAddresses() map[netip.Addr]bool {
+	addrs := map[netip.Addr]bool{}
+	instances, _ := state.List()
+	for _, inst := range instances {
+		if inst.PID == os.Getpid() || !inst.Alive() {
+			continue
+		}
+		for _, svc := range inst.Services {
+			if addr, err := netip.ParseAddr(svc.ListenAddress); err == nil {
+				addrs[addr] = true
+			}
+		}
+	}
+	return addrs
+}
+
+// instanceRecorder は、実行中インスタンスの状態ファイルをmeshの状態に合わせて更新する。
+// down / status コマンドはこのファイルを参照する。
+type instanceRecorder struct {
+	m *mesh
+
+	mu     sync.Mutex
+	inst   state.Instance
+	closed bool
+}
+
+func newInstanceRecorder(m *mesh, inst state.Instance) *instanceRecorder {
+	return &instanceRecorder{m: m, inst: inst}
+}
+
+// save は、meshの現在の状態を状態ファイルに書き込む。
+// 状態ファイルはstatus表示用のため、失敗しても警告のみとする。
+func (r *instanceRecorder) save() {
+	services, err := r.m.serviceStates()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to collect runtime state: %v\n", err)
+		return
+	}
+	listenerPort := r.m.listenerPort()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// 終了処理後に遅れて届いた更新で状態ファイルを復活させない
+	if r.closed {
+		return
+	}
+
+	r.inst.ListenerPort = listenerPort
+	r.inst.Services = services
+	if err := state.Save(&r.inst); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to write runtime state: %v\n", err)
+	}
+}
+
+// setControlSocket は、制御APIのsocketのパスを記録する
+func (r *instanceRecorder) setControlSocket(path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inst.ControlSocket = path
+}
+
+// setDNS は、DNSサーバーのアドレスを記録する
+func (r *instanceRecorder) setDNS(addr string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inst.DNS = addr
+}
+
+// close は、状態ファイルを削除し以降の更新を無視する
+func (r *instanceRecorder) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closed = true
+	if err := state.Remove(r.inst.PID); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to remove runtime state: %v\n", err)
+	}
+}
@@ -0,0 +1,90 @@
+package run
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"runtime"
+
+	"github.com/usadamasa/kubectl-localmesh/internal/config"
+	"github.com/usadamasa/kubectl-localmesh/internal/loopback"
+)
+
+// loopbackAllocator は、TCPサービスのホスト名ごとに専用のループバックアドレスを割り当てる。
+// 同じポートでリスンする複数のTCPサービス（5432のDBを2つなど）をホスト名で区別できるようにする。
+type loopbackAllocator struct {
+	byHost map[string]netip.Addr
+	used   map[netip.Addr]bool
+	// external は、他のインスタンスが使用中のアドレスを返す（nil可）
+	external func() map[netip.Addr]bool
+}
+
+func newLoopbackAllocator() *loopbackAllocator {
+	return &loopbackAllocator{
+		byHost: map[string]netip.Addr{},
+		used:   map[netip.Addr]bool{},
+	}
+}
+
+// allocate は、hostのアドレスを返す（割り当て済みのホストには同じアドレスを返す）
+func (a *loopbackAllocator) allocate(host string) (string, error) {
+	if addr, ok := a.byHost[host]; ok {
+		return addr.String(), nil
+	}
+	var external map[netip.Addr]bool
+	if a.external != nil {
+		external = a.external()
+	}
+	// 127.0.0.1はHTTPリスナーとHTTPサービスのホスト名で使用する
+	for addr := config.AutoLoopbackFirst; addr.Compare(config.AutoLoopbackLast) <= 0; addr = addr.Next() {
+		if a.used[addr] || external[addr] {
+			continue
+		}
+		a.byHost[host] = addr
+		a.used[addr] = true
+		return addr.String(), nil
+	}
+	return "", fmt.Errorf("no loopback address left for '%s' (%s-%s are in use)", host, config.AutoLoopbackFirst, config.AutoLoopbackLast)
+}
+
+// retain は、hostsに含まれないホストのアドレスを解放し、解放したアドレスを返す
+func (a *loopbackAllocator) retain(hosts map[string]bool) []string {
+	var released []string
+	for host, addr := range a.byHost {
+		if hosts[host] {
+			continue
+		}
+		delete(a.byHost, host)
+		delete(a.used, addr)
+		released = append(released, addr.String())
+	}
+	return released
+}
+
+// release は、hostに割り当てたアドレスを解放する
+func (a *loopbackAllocator) release(host string) {
+	if addr, ok := a.byHost[host]; ok {
+		delete(a.byHost, host)
+		delete(a.used, addr)
+	}
+}
+
+// addLoopbackAlias は、アドレスをループバックインターフェースに追加する。
+// Linuxは127.0.0.0/8全体がloに割り当て済みのため何もしない。
+// macOSのlo0は127.0.0.1のみのため、root以外ではsudo -nのhelperでエイリアスを追加する。
+func addLoopbackAlias(addr string) error {
+	if runtime.GOOS != "darwin" {
+		return nil
+	}
+	return loopback.Add(addr)
+}
+
+// removeLoopbackAlias は、addLoopbackAliasで追加したアドレスを削除する
+func removeLoopbackAlias(addr string) {
+	if runtime.GOOS != "darwin" {
+		return
+	}
+	if err := loopback.Remove(addr); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to remove %s from lo0: %v\nrun 'sudo kubectl-localmesh loopback remove %s' to clean up\n", addr, err, addr)
+	}
+}
@@ -0,0 +1,72 @@
+package run
+
+import (
+	"fmt"
+	"net/netip"
+	"testing"
+)
+
+func TestLoopbackAllocator(t *testing.T) {
+	a := newLoopbackAllocator()
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"users-db.localhost", "127.0.0.2"},
+		{"billing-db.localhost", "127.0.0.3"},
+		// 割り当て済みのホストは同じアドレス
+		{"users-db.localhost", "127.0.0.2"},
+	}
+	for _, tt := range tests {
+		got, err := a.allocate(tt.host)
+		if err != nil {
+			t.Fatalf("allocate(%s) failed: %v", tt.host, err)
+		}
+		if got != tt.want {
+			t.Errorf("allocate(%s): expected %s, got %s", tt.host, tt.want, got)
+		}
+	}
+
+	// 解放したアドレスは再利用される
+	released := a.retain(map[string]bool{"billing-db.localhost": true})
+	if len(released) != 1 || released[0] != "127.0.0.2" {
+		t.Errorf("expected 127.0.0.2 to be released, got %v", released)
+	}
+	if got, _ := a.allocate("cache.localhost"); got != "127.0.0.2" {
+		t.Errorf("expected released address to be reused, got %s", got)
+	}
+	if got, _ := a.allocate("billing-db.localhost"); got != "127.0.0.3" {
+		t.Errorf("expected retained address to be kept, got %s", got)
+	}
+
+	// releaseで解放したアドレスも再利用される
+	a.release("cache.localhost")
+	a.release("unknown.localhost")
+	if got, _ := a.allocate("queue.localhost"); got != "127.0.0.2" {
+		t.Errorf("expected the address released by release to be reused, got %s", got)
+	}
+}
+
+func TestLoopbackAllocator_External(t *testing.T) {
+	a := newLoopbackAllocator()
+	// 他のインスタンスが使用中のアドレスは割り当てない
+	a.external = func() map[netip.Addr]bool {
+		return map[netip.Addr]bool{netip.MustParseAddr("127.0.0.2"): true}
+	}
+	if got, _ := a.allocate("users-db.localhost"); got != "127.0.0.3" {
+		t.Errorf("expected 127.0.0.3, got %s", got)
+	}
+}
+
+func TestLoopbackAllocator_Exhausted(t *testing.T) {
+	a := newLoopbackAllocator()
+	for i := 0; i < 253; i++ {
+		if _, err := a.allocate(fmt.Sprintf("db%d.localhost", i)); err != nil {
+			t.Fatalf("allocate #%d failed: %v", i, err)
+		}
+	}
+	if _, err := a.allocate("overflow.localhost"); err == nil {
+		t.Error("expected error when all loopback addresses are in use")
+	}
+}
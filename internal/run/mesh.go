@@ -0,0 +1,729 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/usadamasa/kubectl-localmesh/internal/config"
+	"github.com/usadamasa/kubectl-localmesh/internal/control"
+	"github.com/usadamasa/kubectl-localmesh/internal/dns"
+	"github.com/usadamasa/kubectl-localmesh/internal/envoy"
+	"github.com/usadamasa/kubectl-localmesh/internal/gcp"
+	"github.com/usadamasa/kubectl-localmesh/internal/hosts"
+	"github.com/usadamasa/kubectl-localmesh/internal/k8s"
+	"github.com/usadamasa/kubectl-localmesh/internal/pf"
+	"github.com/usadamasa/kubectl-localmesh/internal/state"
+)
+
+// mesh は、サービスごとのport-forward/SSH tunnelのgoroutineを管理する。
+// 設定の再読み込み時には変更のあったサービスだけを起動・停止する。
+type mesh struct {
+	logLevel   string
+	clientset  kubernetes.Interface
+	restConfig *rest.Config
+
+	// onChange は転送先のPodやSSH tunnelのプロセスが変わった際に呼び出される（nil可）
+	onChange func()
+
+	mu       sync.Mutex
+	cfg      *config.Config
+	services map[string]*runningService // キーはserviceKey
+	forwards map[string]*sharedForward  // キーはクラスタ名（サービスとroutesで共有する）
+	disabled map[string]bool            // 無効化されたホスト名（再読み込み後も維持）
+	loopback *loopbackAllocator         // TCPサービスのリスンアドレス（再読み込み後も維持）
+}
+
+// runningService は起動中のサービス1つ分の状態
+type runningService struct {
+	key    string
+	route  envoy.Route
+	kind   string // kubernetes|tcp
+	target string // 表示用の転送先
+
+	// parent は転送goroutineの親context
+	parent context.Context
+	// forward はSSH tunnelの転送goroutineの本体（ctxのキャンセルで終了する、port-forwardの場合はnil）
+	forward func(ctx context.Context)
+	// clusters はport-forwardを使うクラスタ名（サービス自身とroutesの転送先）
+	clusters []string
+
+	// 以下はmesh.muで保護される
+	cancel    context.CancelFunc // 転送停止中はnil
+	disabled  bool
+	tunnelPID int
+}
+
+func newMesh(logLevel string, clientset kubernetes.Interface, restConfig *rest.Config) *mesh {
+	return &mesh{
+		logLevel:   logLevel,
+		clientset:  clientset,
+		restConfig: restConfig,
+		services:   map[string]*runningService{},
+		forwards:   map[string]*sharedForward{},
+		disabled:   map[string]bool{},
+		loopback:   newLoopbackAllocator(),
+	}
+}
+
+// reloadResult は apply による変更内容
+type reloadResult struct {
+	added   int
+	removed int
+}
+
+// apply は、cfgの内容に合わせてサービスを起動・停止する。
+// 新規サービスの起動に失敗した場合は、このapplyで起動したサービスを停止し、
+// 既存の状態を維持したままエラーを返す。
+func (m *mesh) apply(ctx context.Context, cfg *config.Config) (reloadResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	desired := map[string]bool{}
+	next := map[string]*runningService{}
+	var routes []envoy.Route // 設定の順序のルート（クラスタの衝突の確認用）
+	var started []*runningService
+
+	// rollback は、このapplyで起動したサービスを停止し、既存のサービスだけの状態に戻す
+	rollback := func() {
+		for _, s := range started {
+			m.stopForward(s)
+		}
+		m.pruneForwards(m.services)
+		m.pruneLoopback(m.services)
+	}
+
+	for _, svcDef := range cfg.Services {
+		key, err := serviceKey(cfg, &svcDef)
+		if err != nil {
+			return reloadResult{}, err
+		}
+		desired[key] = true
+
+		if _, ok := next[key]; ok {
+			continue
+		}
+		if rs, ok := m.services[key]; ok {
+			next[key] = rs
+			routes = append(routes, rs.route)
+			continue
+		}
+
+		rs, err := m.prepareService(ctx, cfg, svcDef.Get())
+		if err != nil {
+			rollback()
+			return reloadResult{}, err
+		}
+		rs.key = key
+		rs.disabled = m.disabled[rs.route.Host]
+		next[key] = rs
+		routes = append(routes, rs.route)
+		started = append(started, rs)
+	}
+
+	// ポートを解決した結果、同じクラスタを共有できないサービスがないか確認
+	if err := checkClusters(routes); err != nil {
+		rollback()
+		return reloadResult{}, err
+	}
+	for _, rs := range started {
+		if !rs.disabled {
+			m.startForward(rs)
+		}
+	}
+
+	// 新しい設定に存在しないサービスを停止
+	removed := 0
+	for key, rs := range m.services {
+		if !desired[key] {
+			m.stopForward(rs)
+			removed++
+		}
+	}
+
+	m.cfg = cfg
+	m.services = next
+	// どのサービスからも参照されなくなったport-forwardを削除
+	m.pruneForwards(next)
+
+	// 設定から消えたTCPサービスのループバックアドレスを解放
+	m.pruneLoopback(next)
+
+	return reloadResult{added: len(started), removed: removed}, nil
+}
+
+// pruneLoopback は、servicesのTCPサービス以外に割り当てたループバックアドレスを解放し、
+// エイリアスを削除する（m.muを保持して呼び出す）
+func (m *mesh) pruneLoopback(services map[string]*runningService) {
+	tcpHosts := map[string]bool{}
+	for _, rs := range services {
+		if rs.route.Type == "tcp" {
+			tcpHosts[rs.route.Host] = true
+		}
+	}
+	for _, addr := range m.loopback.retain(tcpHosts) {
+		removeLoopbackAlias(addr)
+	}
+}
+
+// routes は、現在の設定の順序でEnvoyのルートを返す
+func (m *mesh) routes() ([]envoy.Route, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ordered, err := m.orderedServices()
+	if err != nil {
+		return nil, err
+	}
+
+	var routes []envoy.Route
+	for _, rs := range ordered {
+		// 無効化されたサービスはEnvoyのルーティング対象から外す
+		if rs.disabled {
+			continue
+		}
+		routes = append(routes, rs.route)
+	}
+	return routes, nil
+}
+
+// orderedServices は、現在の設定の順序で起動中のサービスを返す（m.muを保持して呼び出す）
+func (m *mesh) orderedServices() ([]*runningService, error) {
+	var ordered []*runningService
+	seen := map[string]bool{}
+	for _, svcDef := range m.cfg.Services {
+		key, err := serviceKey(m.cfg, &svcDef)
+		if err != nil {
+			return nil, err
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		ordered = append(ordered, m.services[key])
+	}
+	return ordered, nil
+}
+
+// hostEntries は、現在の設定の順序で/etc/hostsに書き込むエントリを返す。
+// TCPサービスは割り当てたループバックアドレス、それ以外は127.0.0.1に解決させる。
+func (m *mesh) hostEntries() ([]hosts.Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ordered, err := m.orderedServices()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []hosts.Entry
+	for _, rs := range ordered {
+		// ワイルドカードは/etc/hostsに書き込めないため、DNSサーバーでのみ解決する
+		if config.IsWildcardHost(rs.route.Host) {
+			continue
+		}
+		entries = append(entries, hosts.Entry{IP: hostsAddress(rs.route), Hostname: rs.route.Host})
+	}
+	return entries, nil
+}
+
+// dnsRecords は、DNSサーバーで解決するホスト名（ワイルドカードを含む）とアドレスを返す
+func (m *mesh) dnsRecords() ([]dns.Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ordered, err := m.orderedServices()
+	if err != nil {
+		return nil, err
+	}
+
+	var records []dns.Record
+	for _, rs := range ordered {
+		addr, err := netip.ParseAddr(hostsAddress(rs.route))
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, dns.Record{Host: rs.route.Host, Addr: addr})
+	}
+	return records, nil
+}
+
+// hostsAddress は、ルートのホスト名を解決させるアドレスを返す。
+// 全インターフェースでリスンする場合はループバックアドレスに解決させる。
+func hostsAddress(r envoy.Route) string {
+	addr, err := netip.ParseAddr(r.ListenAddress)
+	switch {
+	case err != nil:
+		return "127.0.0.1"
+	case addr.IsUnspecified() && addr.Is6():
+		return "::1"
+	case addr.IsUnspecified():
+		return "127.0.0.1"
+	default:
+		return addr.String()
+	}
+}
+
+// listenerPort は、現在の設定のHTTPリスナーポートを返す
+func (m *mesh) listenerPort() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cfg.ListenerPort
+}
+
+// tlsConfig は、現在の設定のTLS設定を返す（未設定の場合はnil）
+func (m *mesh) tlsConfig() *config.TLSConfig {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cfg.TLS
+}
+
+// serviceStates は、現在の設定の順序で各サービスの転送状態を返す
+func (m *mesh) serviceStates() ([]state.Service, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ordered, err := m.orderedServices()
+	if err != nil {
+		return nil, err
+	}
+
+	var states []state.Service
+	for _, rs := range ordered {
+		states = append(states, state.Service{
+			Host:          rs.route.Host,
+			Kind:          rs.kind,
+			Protocol:      rs.route.Type,
+			Target:        rs.target,
+			LocalPort:     rs.route.LocalPort,
+			ListenPort:    rs.route.ListenPort,
+			ListenAddress: rs.route.ListenAddress,
+			Pod:           m.podOf(rs),
+			TunnelPID:     rs.tunnelPID,
+			Disabled:      rs.disabled,
+		})
+	}
+	return states, nil
+}
+
+// podOf は、サービス自身の転送先のport-forwardが接続しているPodを返す（m.muを保持して呼び出す）
+func (m *mesh) podOf(rs *runningService) string {
+	f, ok := m.forwards[rs.route.ClusterName]
+	if !ok || rs.disabled {
+		return ""
+	}
+	return f.pod
+}
+
+// observe は、転送状態を更新してonChangeを呼び出す
+func (m *mesh) observe(update func()) {
+	m.mu.Lock()
+	update()
+	m.mu.Unlock()
+
+	if m.onChange != nil {
+		m.onChange()
+	}
+}
+
+// stop は、すべてのサービスを停止する
+func (m *mesh) stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, rs := range m.services {
+		m.stopForward(rs)
+	}
+	m.services = map[string]*runningService{}
+	m.pruneForwards(nil)
+
+	for _, addr := range m.loopback.retain(nil) {
+		removeLoopbackAlias(addr)
+	}
+}
+
+// reconnect は、指定ホストのport-forward/SSH tunnelを切断して張り直す。
+// 他のサービスと共有するport-forwardも張り直される。
+// ローカルポートは変わらないため、Envoyの設定は更新不要。
+func (m *mesh) reconnect(host string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rs, err := m.findByHost(host)
+	if err != nil {
+		return err
+	}
+	if rs.disabled {
+		return fmt.Errorf("service '%s' is disabled", host)
+	}
+
+	if rs.cancel != nil {
+		rs.cancel()
+		rs.cancel = nil
+	}
+	if rs.forward != nil {
+		m.startForward(rs)
+	}
+	for _, name := range rs.clusters {
+		f := m.forwards[name]
+		f.stop()
+		f.start()
+	}
+	return nil
+}
+
+// setEnabled は、指定ホストのサービスを有効化または無効化する。
+// 状態が変わった場合はtrueを返すので、呼び出し側でEnvoyの設定を更新する。
+func (m *mesh) setEnabled(host string, enabled bool) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rs, err := m.findByHost(host)
+	if err != nil {
+		return false, err
+	}
+	if rs.disabled == !enabled {
+		return false, nil
+	}
+
+	rs.disabled = !enabled
+	if enabled {
+		delete(m.disabled, host)
+		m.startForward(rs)
+	} else {
+		m.disabled[host] = true
+		m.stopForward(rs)
+		rs.tunnelPID = 0
+	}
+	return true, nil
+}
+
+// findByHost は、ホスト名に対応する起動中のサービスを返す（m.muを保持して呼び出す）
+func (m *mesh) findByHost(host string) (*runningService, error) {
+	for _, rs := range m.services {
+		if rs.route.Host == host {
+			return rs, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", control.ErrServiceNotFound, host)
+}
+
+// startForward は、転送goroutineを起動する（m.muを保持して呼び出す）。
+// port-forwardは他のサービスと共有し、最初の利用者が起動する。
+func (m *mesh) startForward(rs *runningService) {
+	if rs.forward != nil && rs.cancel == nil {
+		ctx, cancel := context.WithCancel(rs.parent)
+		rs.cancel = cancel
+		go rs.forward(ctx)
+	}
+	for _, name := range rs.clusters {
+		m.forwards[name].acquire(rs)
+	}
+}
+
+// stopForward は、転送goroutineを停止する（m.muを保持して呼び出す）。
+// 共有するport-forwardは最後の利用者が停止する。
+func (m *mesh) stopForward(rs *runningService) {
+	if rs.cancel != nil {
+		rs.cancel()
+		rs.cancel = nil
+	}
+	for _, name := range rs.clusters {
+		if f, ok := m.forwards[name]; ok {
+			f.release(rs)
+		}
+	}
+}
+
+// prepareService は、サービス1つ分の転送先を解決してローカルポートを割り当てる。
+// port-forwardまたはSSH tunnelのgoroutineはstartForwardで起動する。
+func (m *mesh) prepareService(ctx context.Context, cfg *config.Config, svc config.Service) (*runningService, error) {
+	var localPort int
+	var clusterName string
+	var routeType string
+	var listenPort int
+	var listenAddress string
+	var upstreamProtocol, upstreamSNI string
+	var pathRoutes []envoy.PathRoute
+
+	rs := &runningService{parent: ctx, kind: svc.GetKind()}
+
+	// type switchで型判別
+	switch s := svc.(type) {
+	case *config.TCPService:
+		// TCP + SSH Bastion経由の接続
+		bastion, ok := cfg.SSHBastions[s.SSHBastion]
+		if !ok {
+			return nil, fmt.Errorf("ssh_bastion '%s' not found for service '%s'", s.SSHBastion, s.Host)
+		}
+
+		lp, err := pf.FreeLocalPort()
+		if err != nil {
+			return nil, err
+		}
+		localPort = lp
+
+		clusterName = s.ClusterName()
+		routeType = "tcp"
+		listenPort = s.EffectiveLocalPort()
+		listenAddress = s.ListenAddress
+		rs.target = fmt.Sprintf("%s -> %s:%d", s.SSHBastion, s.TargetHost, s.TargetPort)
+
+		fmt.Printf(
+			"gcp-ssh: %-30s -> %s (instance=%s, zone=%s) -> %s:%d via 127.0.0.1:%d\n",
+			s.Host,
+			s.SSHBastion,
+			bastion.Instance,
+			bastion.Zone,
+			s.TargetHost,
+			s.TargetPort,
+			localPort,
+		)
+
+		// GCP SSH tunnel（自動再接続）
+		target, targetPort := s.TargetHost, s.TargetPort
+		rs.forward = func(svcCtx context.Context) {
+			if err := gcp.StartGCPSSHTunnelWithHook(
+				svcCtx,
+				bastion,
+				localPort,
+				target,
+				targetPort,
+				m.logLevel,
+				func(pid int) {
+					m.observe(func() { rs.tunnelPID = pid })
+				},
+			); err != nil {
+				// contextキャンセル以外のエラーをログ出力
+				if svcCtx.Err() == nil {
+					fmt.Fprintf(os.Stderr, "gcp-ssh tunnel error for %s: %v\n", bastion.Instance, err)
+				}
+			}
+		}
+
+	case *config.KubernetesService:
+		// Kubernetes Service経由の接続
+		resolved, err := k8s.ResolveServicePort(
+			ctx,
+			m.clientset,
+			s.Namespace,
+			s.Service,
+			s.PortName,
+			s.Port,
+			s.Protocol,
+		)
+		if err != nil {
+			return nil, err
+		}
+		remotePort := resolved.Port
+
+		// protocolの省略時はServiceのポートから推測したプロトコルを使う
+		var protocolNote string
+		if s.Protocol == "" {
+			protocolNote = " [" + describeInferredProtocol(resolved) + "]"
+		}
+		s = s.WithProtocol(resolved.Protocol)
+
+		// 他のホストのroutesと同じService・ポートであればport-forwardを共有する
+		name, f, shared, err := m.forwardFor(ctx, s.Namespace, s.Service, remotePort)
+		if err != nil {
+			return nil, err
+		}
+		if shared {
+			protocolNote += " (shared)"
+		}
+		localPort = f.localPort
+		clusterName = name
+		rs.useCluster(name)
+		routeType = s.Protocol
+		if routeType == "tcp" {
+			// ポートを共有せず、専用のTCPリスナーで転送する
+			listenPort = s.ListenPort
+		} else {
+			upstreamProtocol = effectiveUpstreamProtocol(s, resolved)
+			upstreamSNI = serviceDNSName(s.Namespace, s.Service)
+		}
+		rs.target = fmt.Sprintf("%s/%s:%d", s.Namespace, s.Service, remotePort)
+
+		fmt.Printf(
+			"pf: %-30s -> %s/%s:%d via 127.0.0.1:%d%s\n",
+			s.Host,
+			s.Namespace,
+			s.Service,
+			remotePort,
+			localPort,
+			protocolNote,
+		)
+
+		// routesの転送先ごとのport-forward
+		paths, err := m.preparePathRoutes(ctx, rs, s)
+		if err != nil {
+			return nil, err
+		}
+		pathRoutes = paths
+
+	default:
+		return nil, fmt.Errorf("unknown service type: %T", s)
+	}
+
+	// TCPサービスはアドレスの指定がなければホスト名ごとのループバックアドレスでリスンする
+	if routeType == "tcp" && listenAddress == "" {
+		// 変更前の同じホストのサービスが使用中のアドレスは解放しない
+		_, allocated := m.loopback.byHost[svc.GetHost()]
+		addr, err := m.loopback.allocate(svc.GetHost())
+		if err != nil {
+			return nil, err
+		}
+		if err := addLoopbackAlias(addr); err != nil {
+			if !allocated {
+				m.loopback.release(svc.GetHost())
+			}
+			return nil, err
+		}
+		listenAddress = addr
+	}
+	if routeType == "tcp" {
+		fmt.Printf("tcp: %-30s listening on %s\n", svc.GetHost(), net.JoinHostPort(listenAddress, strconv.Itoa(listenPort)))
+	}
+
+	rs.route = envoy.Route{
+		Host:        svc.GetHost(),
+		LocalPort:   localPort,
+		ClusterName: clusterName,
+		Type:        routeType,
+		ListenPort:  listenPort,
+
+		ListenAddress:    listenAddress,
+		UpstreamProtocol: upstreamProtocol,
+		UpstreamSNI:      upstreamSNI,
+		Paths:            pathRoutes,
+	}
+	if s, ok := svc.(*config.KubernetesService); ok {
+		applyRewrites(&rs.route, s)
+	}
+	return rs, nil
+}
+
+// describeInferredProtocol は、protocolを省略したサービスで使うプロトコルとその根拠を返す
+func describeInferredProtocol(p k8s.ServicePort) string {
+	if p.Protocol == "" {
+		return "protocol http (default)"
+	}
+	if p.UpstreamProtocol != "" {
+		return fmt.Sprintf("protocol %s, upstream_protocol %s (inferred from %s)", p.Protocol, p.UpstreamProtocol, p.InferredFrom)
+	}
+	return fmt.Sprintf("protocol %s (inferred from %s)", p.Protocol, p.InferredFrom)
+}
+
+// effectiveUpstreamProtocol は、サービスの上流のプロトコルを返す。
+// upstream_protocolを省略し、Serviceのポートが TLS（appProtocol: https など）の場合は推測した値を使う。
+// routesの転送先には引き継がない。
+func effectiveUpstreamProtocol(s *config.KubernetesService, resolved k8s.ServicePort) string {
+	if s.UpstreamProtocol == "" && resolved.UpstreamProtocol != "" {
+		return resolved.UpstreamProtocol
+	}
+	return s.EffectiveUpstreamProtocol()
+}
+
+// portForwardLoop は、Serviceへの自動再接続付きport-forwardを実行する関数を返す。
+// remotePortはServiceのポート番号で、Podのポートへの変換はk8sパッケージが行う。
+func (m *mesh) portForwardLoop(factory k8s.PortForwarderFactory, namespace, service string, localPort, remotePort int) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		if err := k8s.StartPortForwardLoopWithFactory(
+			ctx,
+			factory,
+			m.clientset,
+			namespace,
+			service,
+			localPort,
+			remotePort,
+		); err != nil {
+			// contextキャンセル以外のエラーをログ出力
+			if ctx.Err() == nil {
+				fmt.Fprintf(os.Stderr, "port-forward error for %s/%s: %v\n", namespace, service, err)
+			}
+		}
+	}
+}
+
+// preparePathRoutes は、routesの転送先を解決してrsが使うport-forwardに加える。
+// 同じService・ポートへの転送先は、サービス自身や他のホストを含めてport-forwardを共有する。
+func (m *mesh) preparePathRoutes(ctx context.Context, rs *runningService, s *config.KubernetesService) ([]envoy.PathRoute, error) {
+	var paths []envoy.PathRoute
+	for _, r := range s.Routes {
+		ns := s.RouteNamespace(r)
+		resolved, err := k8s.ResolveServicePort(ctx, m.clientset, ns, r.Service, r.PortName, r.Port, s.Protocol)
+		if err != nil {
+			return nil, fmt.Errorf("route %s of '%s': %w", describeRouteMatch(r), s.Host, err)
+		}
+		remotePort := resolved.Port
+
+		clusterName, f, _, err := m.forwardFor(ctx, ns, r.Service, remotePort)
+		if err != nil {
+			return nil, err
+		}
+		rs.useCluster(clusterName)
+
+		fmt.Printf(
+			"pf: %-30s -> %s/%s:%d via 127.0.0.1:%d (%s)\n",
+			s.Host,
+			ns,
+			r.Service,
+			remotePort,
+			f.localPort,
+			describeRouteMatch(r),
+		)
+
+		paths = append(paths, buildPathRoute(s, r, clusterName, f.localPort))
+	}
+	return paths, nil
+}
+
+// observedPortForwarderFactory は、port-forwardの接続先Podを通知するPortForwarderFactory
+type observedPortForwarderFactory struct {
+	k8s.PortForwarderFactory
+	onCreate func(podName string)
+}
+
+func (f *observedPortForwarderFactory) CreatePortForwarder(
+	ctx context.Context,
+	namespace, podName string,
+	localPort, remotePort int,
+) (k8s.PortForwarder, error) {
+	pf, err := f.PortForwarderFactory.CreatePortForwarder(ctx, namespace, podName, localPort, remotePort)
+	if err != nil {
+		return nil, err
+	}
+	f.onCreate(podName)
+	return pf, nil
+}
+
+// serviceKey は、サービス定義の同一性を判定するキーを返す。
+// 定義内容（TCPの場合は参照するSSH Bastionも含む）が変わらない限り同じキーになる。
+func serviceKey(cfg *config.Config, svcDef *config.ServiceDefinition) (string, error) {
+	b, err := yaml.Marshal(svcDef)
+	if err != nil {
+		return "", err
+	}
+	key := string(b)
+
+	if tcp, ok := svcDef.AsTCP(); ok {
+		if bastion, ok := cfg.SSHBastions[tcp.SSHBastion]; ok {
+			bb, err := yaml.Marshal(bastion)
+			if err != nil {
+				return "", err
+			}
+			key += string(bb)
+		}
+	}
+
+	return key, nil
+}
@@ -0,0 +1,660 @@
+package run
+
+import (
+	"errors"
+	"maps"
+	"net/netip"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/usadamasa/kubectl-localmesh/internal/config"
+	"github.com/usadamasa/kubectl-localmesh/internal/control"
+	"github.com/usadamasa/kubectl-localmesh/internal/dns"
+	"github.com/usadamasa/kubectl-localmesh/internal/envoy"
+	"github.com/usadamasa/kubectl-localmesh/internal/hosts"
+)
+
+func newKubernetesServiceDef(host, service string, port int) config.ServiceDefinition {
+	return config.NewServiceDefinition(&config.KubernetesService{
+		Host:      host,
+		Namespace: "default",
+		Service:   service,
+		Port:      port,
+		Protocol:  "http",
+	})
+}
+
+func TestMesh_ApplyOnlyRestartsChangedServices(t *testing.T) {
+	m := newMesh("info", fake.NewClientset(), nil)
+	defer m.stop()
+
+	cfg1 := &config.Config{
+		ListenerPort: 80,
+		Services: []config.ServiceDefinition{
+			newKubernetesServiceDef("users.localhost", "users", 8080),
+			newKubernetesServiceDef("billing.localhost", "billing", 8080),
+		},
+	}
+
+	result, err := m.apply(t.Context(), cfg1)
+	if err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if result.added != 2 || result.removed != 0 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	routes1, err := m.routes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// usersは変更なし、billingはポート変更、adminは追加
+	cfg2 := &config.Config{
+		ListenerPort: 80,
+		Services: []config.ServiceDefinition{
+			newKubernetesServiceDef("admin.localhost", "admin", 8080),
+			newKubernetesServiceDef("users.localhost", "users", 8080),
+			newKubernetesServiceDef("billing.localhost", "billing", 9090),
+		},
+	}
+
+	result, err = m.apply(t.Context(), cfg2)
+	if err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if result.added != 2 || result.removed != 1 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	routes2, err := m.routes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes2) != 3 {
+		t.Fatalf("expected 3 routes, got %d", len(routes2))
+	}
+
+	// 新しい設定の順序で返される
+	if routes2[0].Host != "admin.localhost" || routes2[1].Host != "users.localhost" {
+		t.Errorf("unexpected route order: %s, %s", routes2[0].Host, routes2[1].Host)
+	}
+
+	// 変更のないサービスはローカルポートとクラスタ名が維持される
+	if !reflect.DeepEqual(routes2[1], routes1[0]) {
+		t.Errorf("expected unchanged route %+v, got %+v", routes1[0], routes2[1])
+	}
+	if routes2[2].ClusterName != "default_billing_9090" {
+		t.Errorf("expected cluster 'default_billing_9090', got %q", routes2[2].ClusterName)
+	}
+
+	entries, err := m.hostEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[0] != (hosts.Entry{IP: "127.0.0.1", Hostname: "admin.localhost"}) {
+		t.Errorf("unexpected host entries: %v", entries)
+	}
+}
+
+func TestMesh_SetEnabled(t *testing.T) {
+	m := newMesh("info", fake.NewClientset(), nil)
+	defer m.stop()
+
+	cfg := &config.Config{
+		ListenerPort: 80,
+		Services: []config.ServiceDefinition{
+			newKubernetesServiceDef("users.localhost", "users", 8080),
+			newKubernetesServiceDef("billing.localhost", "billing", 8080),
+		},
+	}
+	if _, err := m.apply(t.Context(), cfg); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+
+	changed, err := m.setEnabled("billing.localhost", false)
+	if err != nil || !changed {
+		t.Fatalf("expected disable to change state, got changed=%v err=%v", changed, err)
+	}
+	if changed, _ := m.setEnabled("billing.localhost", false); changed {
+		t.Error("expected second disable to be a no-op")
+	}
+
+	// 無効化したサービスはルートから外れるが、状態には残る
+	routes, err := m.routes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 1 || routes[0].Host != "users.localhost" {
+		t.Errorf("unexpected routes: %+v", routes)
+	}
+	states, err := m.serviceStates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 2 || !states[1].Disabled {
+		t.Errorf("expected billing to be recorded as disabled: %+v", states)
+	}
+
+	// 無効化したサービスは再接続できない
+	if err := m.reconnect("billing.localhost"); err == nil {
+		t.Error("expected reconnect of a disabled service to fail")
+	}
+
+	// 設定を再読み込みしても無効化は維持される
+	if _, err := m.apply(t.Context(), cfg); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if routes, _ := m.routes(); len(routes) != 1 {
+		t.Errorf("expected billing to stay disabled after reload, got %+v", routes)
+	}
+
+	if changed, err := m.setEnabled("billing.localhost", true); err != nil || !changed {
+		t.Fatalf("expected enable to change state, got changed=%v err=%v", changed, err)
+	}
+	if routes, _ := m.routes(); len(routes) != 2 {
+		t.Errorf("expected 2 routes after enable, got %+v", routes)
+	}
+	if err := m.reconnect("billing.localhost"); err != nil {
+		t.Errorf("reconnect failed: %v", err)
+	}
+}
+
+func TestMesh_UnknownHost(t *testing.T) {
+	m := newMesh("info", fake.NewClientset(), nil)
+	defer m.stop()
+
+	cfg := &config.Config{
+		ListenerPort: 80,
+		Services: []config.ServiceDefinition{
+			newKubernetesServiceDef("users.localhost", "users", 8080),
+		},
+	}
+	if _, err := m.apply(t.Context(), cfg); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+
+	if err := m.reconnect("unknown.localhost"); !errors.Is(err, control.ErrServiceNotFound) {
+		t.Errorf("expected ErrServiceNotFound, got %v", err)
+	}
+	if _, err := m.setEnabled("unknown.localhost", false); !errors.Is(err, control.ErrServiceNotFound) {
+		t.Errorf("expected ErrServiceNotFound, got %v", err)
+	}
+}
+
+func TestMesh_PathRoutes(t *testing.T) {
+	m := newMesh("info", fake.NewClientset(), nil)
+	defer m.stop()
+
+	cfg := &config.Config{
+		ListenerPort: 80,
+		Services: []config.ServiceDefinition{
+			config.NewServiceDefinition(&config.KubernetesService{
+				Host:      "app.localhost",
+				Namespace: "default",
+				Service:   "web",
+				Port:      8080,
+				Protocol:  "http",
+				Routes: []config.HTTPRoute{
+					{Prefix: "/api", Service: "api", Port: 8080},
+					{Prefix: "/auth", Namespace: "auth", Service: "auth", Port: 9000, UpstreamProtocol: "h2c"},
+					{Path: "/v2", Service: "api", Port: 8080},
+					{Prefix: "/", Service: "web", Port: 8080, Headers: []config.HeaderMatch{{Name: "x-canary"}}},
+				},
+			}),
+		},
+	}
+	if _, err := m.apply(t.Context(), cfg); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+
+	routes, err := m.routes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 1 {
+		t.Fatalf("expected 1 route, got %d", len(routes))
+	}
+	r := routes[0]
+
+	wantClusters := []string{"default_api_8080", "auth_auth_9000", "default_api_8080", "default_web_8080"}
+	if len(r.Paths) != len(wantClusters) {
+		t.Fatalf("expected %d paths, got %d", len(wantClusters), len(r.Paths))
+	}
+	for i, want := range wantClusters {
+		if r.Paths[i].ClusterName != want {
+			t.Errorf("paths[%d]: expected cluster %s, got %s", i, want, r.Paths[i].ClusterName)
+		}
+	}
+
+	// 同じService・ポートへの転送先はport-forwardを共有する
+	if r.Paths[0].LocalPort != r.Paths[2].LocalPort {
+		t.Errorf("expected shared local port, got %d and %d", r.Paths[0].LocalPort, r.Paths[2].LocalPort)
+	}
+	if r.Paths[3].LocalPort != r.LocalPort {
+		t.Errorf("expected route to the service itself to use port %d, got %d", r.LocalPort, r.Paths[3].LocalPort)
+	}
+	if r.Paths[0].LocalPort == r.Paths[1].LocalPort || r.Paths[0].LocalPort == r.LocalPort {
+		t.Error("expected distinct local ports for distinct targets")
+	}
+
+	// namespaceとupstream_protocolは省略時にサービスの値を引き継ぐ
+	if r.Paths[0].UpstreamProtocol != "http1" || r.Paths[1].UpstreamProtocol != "h2c" {
+		t.Errorf("unexpected upstream protocols: %s, %s", r.Paths[0].UpstreamProtocol, r.Paths[1].UpstreamProtocol)
+	}
+	if r.Paths[1].UpstreamSNI != "auth.auth.svc" {
+		t.Errorf("expected SNI auth.auth.svc, got %s", r.Paths[1].UpstreamSNI)
+	}
+}
+
+func TestMesh_SharedRouteTargets(t *testing.T) {
+	m := newMesh("info", fake.NewClientset(), nil)
+	defer m.stop()
+
+	authRoute := config.HTTPRoute{Prefix: "/auth", Service: "auth", Port: 80}
+	apiRoute := config.HTTPRoute{Prefix: "/api", Service: "api", Port: 8080}
+	cfg := &config.Config{
+		ListenerPort: 80,
+		Services: []config.ServiceDefinition{
+			newKubernetesServiceDef("auth.localhost", "auth", 80),
+			config.NewServiceDefinition(&config.KubernetesService{
+				Host: "app.localhost", Namespace: "default", Service: "web", Port: 8080, Protocol: "http",
+				Routes: []config.HTTPRoute{authRoute, apiRoute},
+			}),
+			config.NewServiceDefinition(&config.KubernetesService{
+				Host: "admin.localhost", Namespace: "default", Service: "admin", Port: 8080, Protocol: "http",
+				Routes: []config.HTTPRoute{authRoute, apiRoute},
+			}),
+		},
+	}
+	if _, err := m.apply(t.Context(), cfg); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+
+	routes, err := m.routes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, app, admin := routes[0], routes[1], routes[2]
+
+	// 同じService・ポートへの転送先は、ホストをまたいでローカルポートとport-forwardを共有する
+	if app.Paths[0].LocalPort != auth.LocalPort || admin.Paths[0].LocalPort != auth.LocalPort {
+		t.Errorf("expected /auth to use port %d of auth.localhost, got %d and %d", auth.LocalPort, app.Paths[0].LocalPort, admin.Paths[0].LocalPort)
+	}
+	if app.Paths[1].LocalPort != admin.Paths[1].LocalPort {
+		t.Errorf("expected /api to share a local port, got %d and %d", app.Paths[1].LocalPort, admin.Paths[1].LocalPort)
+	}
+	if len(m.forwards) != 4 {
+		t.Errorf("expected 4 port-forwards, got %d", len(m.forwards))
+	}
+
+	// auth.localhostを無効化しても、routesが参照するport-forwardは止めない
+	if _, err := m.setEnabled("auth.localhost", false); err != nil {
+		t.Fatal(err)
+	}
+	if f := m.forwards["default_auth_80"]; f.cancel == nil {
+		t.Error("expected the shared port-forward to keep running")
+	}
+
+	// 参照するサービスがなくなったport-forwardは停止して削除する
+	cfg2 := &config.Config{
+		ListenerPort: 80,
+		Services:     []config.ServiceDefinition{cfg.Services[0]},
+	}
+	if _, err := m.apply(t.Context(), cfg2); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if _, ok := m.forwards["default_api_8080"]; ok || len(m.forwards) != 1 {
+		t.Errorf("expected only the auth port-forward to remain, got %v", slices.Collect(maps.Keys(m.forwards)))
+	}
+	if f := m.forwards["default_auth_80"]; f.cancel != nil {
+		t.Error("expected the port-forward of the disabled service to be stopped")
+	}
+}
+
+func TestMesh_KubernetesTCPService(t *testing.T) {
+	m := newMesh("info", fake.NewClientset(), nil)
+	defer m.stop()
+
+	cfg := &config.Config{
+		ListenerPort: 80,
+		Services: []config.ServiceDefinition{
+			config.NewServiceDefinition(&config.KubernetesService{
+				Host:       "users-db.localhost",
+				Namespace:  "db",
+				Service:    "postgres",
+				Port:       5432,
+				Protocol:   "tcp",
+				ListenPort: 15432,
+			}),
+		},
+	}
+	if _, err := m.apply(t.Context(), cfg); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+
+	routes, err := m.routes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 1 {
+		t.Fatalf("expected 1 route, got %d", len(routes))
+	}
+
+	// bastion経由のTCPルートと同様に専用のTCPリスナーで転送される
+	r := routes[0]
+	if r.Type != "tcp" || r.ListenPort != 15432 || r.ClusterName != "db_postgres_5432" {
+		t.Errorf("unexpected route: %+v", r)
+	}
+	if r.UpstreamProtocol != "" {
+		t.Errorf("expected no upstream protocol for tcp, got %s", r.UpstreamProtocol)
+	}
+
+	// 専用のループバックアドレスでリスンし、/etc/hostsでもそのアドレスに解決させる
+	if r.ListenAddress != "127.0.0.2" {
+		t.Errorf("expected listen address 127.0.0.2, got %q", r.ListenAddress)
+	}
+	entries, err := m.hostEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0] != (hosts.Entry{IP: "127.0.0.2", Hostname: "users-db.localhost"}) {
+		t.Errorf("unexpected host entries: %v", entries)
+	}
+}
+
+func TestMesh_FailedApplyReleasesLoopback(t *testing.T) {
+	m := newMesh("info", fake.NewClientset(), nil)
+	defer m.stop()
+
+	tcpService := func(host string, port int) config.ServiceDefinition {
+		return config.NewServiceDefinition(&config.KubernetesService{
+			Host: host, Namespace: "db", Service: "postgres", Port: port, Protocol: "tcp", ListenPort: 15432,
+		})
+	}
+	users := tcpService("users-db.localhost", 5432)
+	if _, err := m.apply(t.Context(), &config.Config{ListenerPort: 80, Services: []config.ServiceDefinition{users}}); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+
+	// 後続のエントリ（存在しないService）で失敗した再読み込みで割り当てたアドレスは解放する
+	cfg := &config.Config{
+		ListenerPort: 80,
+		Services: []config.ServiceDefinition{
+			users,
+			tcpService("billing-db.localhost", 5433),
+			config.NewServiceDefinition(&config.KubernetesService{
+				Host: "missing.localhost", Namespace: "default", Service: "missing", PortName: "http",
+			}),
+		},
+	}
+	if _, err := m.apply(t.Context(), cfg); err == nil {
+		t.Fatal("expected apply to fail")
+	}
+	want := map[string]netip.Addr{"users-db.localhost": netip.MustParseAddr("127.0.0.2")}
+	if !maps.Equal(m.loopback.byHost, want) {
+		t.Errorf("expected only the address of the running service to be kept, got %v", m.loopback.byHost)
+	}
+	if got, _ := m.loopback.allocate("cache.localhost"); got != "127.0.0.3" {
+		t.Errorf("expected the released address to be reused, got %s", got)
+	}
+}
+
+func TestMesh_WildcardHost(t *testing.T) {
+	m := newMesh("info", fake.NewClientset(), nil)
+	defer m.stop()
+
+	cfg := &config.Config{
+		ListenerPort: 80,
+		Services: []config.ServiceDefinition{
+			newKubernetesServiceDef("users.localhost", "users", 8080),
+			newKubernetesServiceDef("*.preview.localhost", "preview", 8080),
+			config.NewServiceDefinition(&config.KubernetesService{
+				Host:       "users-db.localhost",
+				Namespace:  "db",
+				Service:    "postgres",
+				Port:       5432,
+				Protocol:   "tcp",
+				ListenPort: 15432,
+			}),
+		},
+	}
+	if _, err := m.apply(t.Context(), cfg); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+
+	// ワイルドカードは/etc/hostsには書き込まず、DNSサーバーでのみ解決する
+	entries, err := m.hostEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantEntries := []hosts.Entry{
+		{IP: "127.0.0.1", Hostname: "users.localhost"},
+		{IP: "127.0.0.2", Hostname: "users-db.localhost"},
+	}
+	if !reflect.DeepEqual(entries, wantEntries) {
+		t.Errorf("host entries = %v, want %v", entries, wantEntries)
+	}
+
+	records, err := m.dnsRecords()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRecords := []dns.Record{
+		{Host: "users.localhost", Addr: netip.MustParseAddr("127.0.0.1")},
+		{Host: "*.preview.localhost", Addr: netip.MustParseAddr("127.0.0.1")},
+		{Host: "users-db.localhost", Addr: netip.MustParseAddr("127.0.0.2")},
+	}
+	if !reflect.DeepEqual(records, wantRecords) {
+		t.Errorf("dns records = %v, want %v", records, wantRecords)
+	}
+}
+
+func TestMesh_InferredProtocol(t *testing.T) {
+	h2c, https := "kubernetes.io/h2c", "https"
+	clientset := fake.NewClientset(&corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "users", Namespace: "default"},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
+				{Name: "api", Port: 8080, AppProtocol: &h2c},
+				{Name: "metrics", Port: 9100},
+				{Name: "web", Port: 8443, AppProtocol: &https},
+			},
+		},
+	})
+	m := newMesh("info", clientset, nil)
+	defer m.stop()
+
+	cfg := &config.Config{
+		ListenerPort: 80,
+		Services: []config.ServiceDefinition{
+			config.NewServiceDefinition(&config.KubernetesService{
+				Host:      "users.localhost",
+				Namespace: "default",
+				Service:   "users",
+				PortName:  "api",
+			}),
+			config.NewServiceDefinition(&config.KubernetesService{
+				Host:      "users-metrics.localhost",
+				Namespace: "default",
+				Service:   "users",
+				Port:      9100,
+			}),
+			config.NewServiceDefinition(&config.KubernetesService{
+				Host:      "users-web.localhost",
+				Namespace: "default",
+				Service:   "users",
+				PortName:  "web",
+				Routes:    []config.HTTPRoute{{Prefix: "/metrics", Service: "users", Port: 9100}},
+			}),
+		},
+	}
+	if _, err := m.apply(t.Context(), cfg); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+
+	routes, err := m.routes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// appProtocolからgrpc、手がかりのないポートはhttpとして転送する
+	if routes[0].Type != "grpc" || routes[0].UpstreamProtocol != config.UpstreamH2C {
+		t.Errorf("unexpected route for users.localhost: %+v", routes[0])
+	}
+	if routes[1].Type != "http" || routes[1].UpstreamProtocol != config.UpstreamHTTP1 {
+		t.Errorf("unexpected route for users-metrics.localhost: %+v", routes[1])
+	}
+	// appProtocol: httpsのポートにはTLSで接続し、routesの転送先には引き継がない
+	if routes[2].Type != "http" || routes[2].UpstreamProtocol != config.UpstreamAutoTLS || routes[2].UpstreamSNI != "users.default.svc" {
+		t.Errorf("unexpected route for users-web.localhost: %+v", routes[2])
+	}
+	if p := routes[2].Paths[0]; p.UpstreamProtocol != config.UpstreamHTTP1 {
+		t.Errorf("unexpected route target for users-web.localhost: %+v", p)
+	}
+}
+
+func TestMesh_DiscoveredTLSService(t *testing.T) {
+	https := "https"
+	clientset := fake.NewClientset(
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop", Labels: map[string]string{"mesh": "on"}},
+			Spec: corev1.ServiceSpec{
+				Selector: map[string]string{"app": "web"},
+				Ports:    []corev1.ServicePort{{Name: "web", Port: 8443, AppProtocol: &https}},
+			},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "admin", Namespace: "backoffice", Labels: map[string]string{"mesh": "on"}},
+			Spec: corev1.ServiceSpec{
+				Selector: map[string]string{"app": "admin"},
+				Ports:    []corev1.ServicePort{{Name: "web", Port: 8443, AppProtocol: &https}},
+			},
+		},
+	)
+	m := newMesh("info", clientset, nil)
+	defer m.stop()
+
+	cfg := &config.Config{
+		ListenerPort: 80,
+		Services: []config.ServiceDefinition{
+			config.NewServiceDefinition(&config.KubernetesDiscovery{Namespaces: []string{"shop"}, Selector: "mesh=on"}),
+			// protocolを指定したエントリでは推測した上流のプロトコルを使わない
+			config.NewServiceDefinition(&config.KubernetesDiscovery{Namespaces: []string{"backoffice"}, Selector: "mesh=on", Protocol: "http"}),
+		},
+	}
+	expanded, err := newDiscovery(clusterDiscovery(clientset)).load(t.Context(), cfg)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if _, err := m.apply(t.Context(), expanded); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+
+	routes, err := m.routes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 2 {
+		t.Fatalf("expected 2 routes, got %+v", routes)
+	}
+	if routes[0].Host != "web.shop.localhost" || routes[0].UpstreamProtocol != config.UpstreamAutoTLS || routes[0].UpstreamSNI != "web.shop.svc" {
+		t.Errorf("unexpected route for the discovered https port: %+v", routes[0])
+	}
+	if routes[1].Host != "admin.backoffice.localhost" || routes[1].UpstreamProtocol != config.UpstreamHTTP1 {
+		t.Errorf("unexpected route for the entry with protocol: %+v", routes[1])
+	}
+}
+
+func TestMesh_ResolvedClusterConflicts(t *testing.T) {
+	clientset := fake.NewClientset(&corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{{Name: "http", Port: 80}, {Name: "admin", Port: 8081}, {Name: "db", Port: 5432}},
+		},
+	})
+	byPort := newKubernetesServiceDef("web.localhost", "web", 80)
+
+	tests := []struct {
+		name     string
+		services []config.ServiceDefinition
+		wantErr  string
+	}{
+		{
+			name: "port and port_name of the same Service port",
+			services: []config.ServiceDefinition{config.NewServiceDefinition(&config.KubernetesService{
+				Host: "web-named.localhost", Namespace: "default", Service: "web", PortName: "http", Protocol: "http",
+			})},
+			wantErr: "service 'web-named.localhost' forwards to the same Service port as service 'web.localhost' (cluster 'default_web_80')",
+		},
+		{
+			name: "TCP service and routes",
+			services: []config.ServiceDefinition{
+				config.NewServiceDefinition(&config.KubernetesService{
+					Host: "db.localhost", Namespace: "default", Service: "web", PortName: "db", Protocol: "tcp", ListenPort: 15432,
+				}),
+				config.NewServiceDefinition(&config.KubernetesService{
+					Host: "admin.localhost", Namespace: "default", Service: "web", PortName: "admin", Protocol: "http",
+					Routes: []config.HTTPRoute{{Prefix: "/db", Service: "web", Port: 5432}},
+				}),
+			},
+			wantErr: "routes of 'admin.localhost': cluster 'default_web_5432' is already used by service 'db.localhost'; a TCP service cannot share its Service port with routes",
+		},
+		{
+			name: "different upstream protocol",
+			services: []config.ServiceDefinition{config.NewServiceDefinition(&config.KubernetesService{
+				Host: "admin.localhost", Namespace: "default", Service: "web", PortName: "admin", Protocol: "http",
+				Routes: []config.HTTPRoute{{Prefix: "/", Service: "web", PortName: "http", UpstreamProtocol: config.UpstreamH2C}},
+			})},
+			wantErr: "upstream protocol 'h2c' of cluster 'default_web_80' for routes of 'admin.localhost' differs from 'http1' for service 'web.localhost'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMesh("info", clientset, nil)
+			defer m.stop()
+			if _, err := m.apply(t.Context(), &config.Config{ListenerPort: 80, Services: []config.ServiceDefinition{byPort}}); err != nil {
+				t.Fatalf("apply failed: %v", err)
+			}
+
+			cfg := &config.Config{ListenerPort: 80, Services: append([]config.ServiceDefinition{byPort}, tt.services...)}
+			_, err := m.apply(t.Context(), cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+
+			// 失敗したapplyで作成したport-forwardは残らない
+			if len(m.services) != 1 || !slices.Equal(slices.Collect(maps.Keys(m.forwards)), []string{"default_web_80"}) {
+				t.Errorf("unexpected state after the failed apply: services=%d forwards=%v", len(m.services), slices.Collect(maps.Keys(m.forwards)))
+			}
+		})
+	}
+}
+
+func TestHostsAddress(t *testing.T) {
+	tests := []struct {
+		name          string
+		listenAddress string
+		want          string
+	}{
+		{name: "http route", listenAddress: "", want: "127.0.0.1"},
+		{name: "allocated loopback", listenAddress: "127.0.0.2", want: "127.0.0.2"},
+		{name: "explicit address", listenAddress: "192.168.1.10", want: "192.168.1.10"},
+		{name: "all ipv4 interfaces", listenAddress: "0.0.0.0", want: "127.0.0.1"},
+		{name: "all ipv6 interfaces", listenAddress: "::", want: "::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hostsAddress(envoy.Route{ListenAddress: tt.listenAddress}); got != tt.want {
+				t.Errorf("hostsAddress(%q) = %q, want %q", tt.listenAddress, got, tt.want)
+			}
+		})
+	}
+}
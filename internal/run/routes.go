@@ -0,0 +1,75 @@
+package run
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/usadamasa/kubectl-localmesh/internal/config"
+	"github.com/usadamasa/kubectl-localmesh/internal/envoy"
+)
+
+// buildPathRoute は、routesの1エントリを解決済みの転送先と合わせてenvoy.PathRouteに変換する
+func buildPathRoute(s *config.KubernetesService, r config.HTTPRoute, clusterName string, localPort int) envoy.PathRoute {
+	p := envoy.PathRoute{
+		Prefix:           r.Prefix,
+		Path:             r.Path,
+		Regex:            r.Regex,
+		LocalPort:        localPort,
+		ClusterName:      clusterName,
+		UpstreamProtocol: s.RouteUpstreamProtocol(r),
+		UpstreamSNI:      serviceDNSName(s.RouteNamespace(r), r.Service),
+	}
+	for _, h := range r.Headers {
+		p.Headers = append(p.Headers, envoy.HeaderMatch{
+			Name:   h.Name,
+			Exact:  h.Exact,
+			Prefix: h.Prefix,
+			Regex:  h.Regex,
+		})
+	}
+	return p
+}
+
+// describeRouteMatch は、routesのエントリの条件をログ出力用の文字列にする
+func describeRouteMatch(r config.HTTPRoute) string {
+	var parts []string
+	switch {
+	case r.Prefix != "":
+		parts = append(parts, "prefix="+r.Prefix)
+	case r.Path != "":
+		parts = append(parts, "path="+r.Path)
+	case r.Regex != "":
+		parts = append(parts, "regex="+r.Regex)
+	}
+	for _, h := range r.Headers {
+		switch {
+		case h.Exact != "":
+			parts = append(parts, fmt.Sprintf("header %s=%s", h.Name, h.Exact))
+		case h.Prefix != "":
+			parts = append(parts, fmt.Sprintf("header %s=%s*", h.Name, h.Prefix))
+		case h.Regex != "":
+			parts = append(parts, fmt.Sprintf("header %s~%s", h.Name, h.Regex))
+		default:
+			parts = append(parts, "header "+h.Name)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// applyRewrites は、サービスのリクエスト書き換えとヘッダー操作の設定をルートに反映する
+func applyRewrites(route *envoy.Route, s *config.KubernetesService) {
+	route.HostRewrite = s.HostRewrite
+	route.PrefixRewrite = s.PrefixRewrite
+	route.RequestHeadersToAdd = toEnvoyHeaderValues(s.RequestHeadersToAdd)
+	route.RequestHeadersToRemove = s.RequestHeadersToRemove
+	route.ResponseHeadersToAdd = toEnvoyHeaderValues(s.ResponseHeadersToAdd)
+	route.ResponseHeadersToRemove = s.ResponseHeadersToRemove
+}
+
+func toEnvoyHeaderValues(headers []config.HeaderValue) []envoy.HeaderValue {
+	var out []envoy.HeaderValue
+	for _, h := range headers {
+		out = append(out, envoy.HeaderValue{Name: h.Name, Value: h.Value})
+	}
+	return out
+}
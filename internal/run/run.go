@@ -4,215 +4,463 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 
 	"github.com/usadamasa/kubectl-localmesh/internal/config"
+	"github.com/usadamasa/kubectl-localmesh/internal/control"
+	"github.com/usadamasa/kubectl-localmesh/internal/dns"
 	"github.com/usadamasa/kubectl-localmesh/internal/envoy"
-	"github.com/usadamasa/kubectl-localmesh/internal/gcp"
 	"github.com/usadamasa/kubectl-localmesh/internal/hosts"
 	"github.com/usadamasa/kubectl-localmesh/internal/k8s"
 	"github.com/usadamasa/kubectl-localmesh/internal/pf"
+	"github.com/usadamasa/kubectl-localmesh/internal/proc"
+	"github.com/usadamasa/kubectl-localmesh/internal/state"
 )
 
-func Run(ctx context.Context, cfg *config.Config, logLevel string, updateHosts bool) error {
+// Options は up コマンドの実行オプション
+type Options struct {
+	LogLevel    string
+	UpdateHosts bool
+
+	// ConfigPaths は設定ファイルまたはディレクトリのパス（状態ファイルへの記録と Watch 時の再読み込みに使用）
+	ConfigPaths []string
+	// LoadOptions は設定ファイルの読み込みオプション（再読み込みで使用）
+	LoadOptions config.LoadOptions
+	// Watch が true の場合、設定ファイルの変更を検出して差分のみを反映する
+	Watch bool
+	// Proxy はプロキシの実装（envoy|builtin、空の場合はenvoy）
+	Proxy string
+	// Kube はkubeconfigとcontextの指定（kubectlと同じフラグ）
+	Kube k8s.ClientOptions
+	// ForceCluster が true の場合、接続先がcluster:と一致しなくても警告のみで起動する
+	ForceCluster bool
+	// Name はインスタンスの名前（name:より優先、空の場合はname:またはdefault）
+	Name string
+	// DNS が true の場合、ホスト名を解決するDNSサーバーをループバックアドレスで起動する
+	DNS bool
+}
+
+func Run(ctx context.Context, cfg *config.Config, opts Options) error {
+	proxyName := opts.Proxy
+	if proxyName == "" {
+		proxyName = ProxyEnvoy
+	}
+	if err := checkProxy(proxyName); err != nil {
+		return err
+	}
+
+	// 同じ名前のインスタンスは同時に実行できない
+	name := resolveName(opts, cfg)
+	if err := checkInstanceName(name); err != nil {
+		return err
+	}
+	// 状態ファイルと制御APIのsocketを置くディレクトリ
+	if _, err := state.EnsureDir(); err != nil {
+		return err
+	}
+	// down がPIDの再利用を見分けられるよう、プロセスの開始時刻を記録する
+	processStart, err := proc.StartTime(os.Getpid())
+	if err != nil {
+		return fmt.Errorf("failed to read the start time of this process: %w", err)
+	}
+
 	// Kubernetes client初期化
-	clientset, restConfig, err := k8s.NewClient()
+	kubeOpts := clientOptions(opts.Kube, cfg)
+	clientset, restConfig, err := k8s.NewClient(kubeOpts)
 	if err != nil {
 		return fmt.Errorf("failed to create kubernetes client: %w", err)
 	}
+	// Serviceを解決する前に接続先のクラスタを確認
+	if err := verifyCluster(ctx, cfg.Cluster, kubeOpts, clientset, restConfig, opts.ForceCluster); err != nil {
+		return err
+	}
+
+	// kubernetes-discoveryのエントリを見つかったServiceに展開
+	disc := newDiscovery(clusterDiscovery(clientset))
+	expanded, err := disc.load(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	// /etc/hostsの書き換えのみ権限のあるヘルパーで行う（起動前に実行できるかを確認）
+	// 管理ブロックには名前・インスタンスID・PIDを記録し、インスタンスごとに分けて異常終了後に回収できるようにする
+	instanceID, err := newInstanceID()
+	if err != nil {
+		return err
+	}
+	var hostsEditor hosts.Editor
+	if opts.UpdateHosts {
+		owner, err := hosts.NewOwner(name, instanceID, os.Getpid(), processStart)
+		if err != nil {
+			return err
+		}
+		hostsEditor, err = hosts.NewEditor(owner)
+		if err != nil {
+			return err
+		}
+	}
 
-	// /etc/hosts更新が必要な場合
-	if updateHosts {
-		// 権限チェック
-		if !hosts.HasPermission() {
-			return fmt.Errorf("need sudo: try 'sudo kubectl-localmesh ...'")
+	// systemd-resolvedの設定のみ権限のあるヘルパーで行う（起動前に実行できるかを確認）
+	dnsCfg := dnsConfig(cfg)
+	var splitDNS dns.SplitDNS
+	if opts.DNS && len(dnsCfg.ResolvedDomains) > 0 {
+		splitDNS, err = dns.NewSplitDNS(name)
+		if err != nil {
+			return err
 		}
+	}
 
-		// ホスト名リストを収集
-		var hostnames []string
-		for _, svcDef := range cfg.Services {
-			svc := svcDef.Get()
-			hostnames = append(hostnames, svc.GetHost())
+	var configPaths []string
+	for _, p := range opts.ConfigPaths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return err
+		}
+		configPaths = append(configPaths, abs)
+	}
+
+	// プロキシの準備
+	inst := state.Instance{
+		PID:          os.Getpid(),
+		ID:           instanceID,
+		Name:         name,
+		ConfigPath:   strings.Join(configPaths, ", "),
+		StartedAt:    time.Now(),
+		ProcessStart: processStart,
+		Proxy:        proxyName,
+		HostsUpdated: opts.UpdateHosts,
+	}
+	var dp dataPlane
+	switch proxyName {
+	case ProxyBuiltin:
+		dp = newBuiltinDataPlane()
+	default:
+		// Envoy admin（status コマンドのヘルスチェック用）
+		adminPort, err := pf.FreeLocalPort()
+		if err != nil {
+			return err
+		}
+		ed, err := newEnvoyDataPlane(opts.LogLevel, adminPort)
+		if err != nil {
+			return err
+		}
+		inst.EnvoyAdmin = fmt.Sprintf("127.0.0.1:%d", adminPort)
+		dp = ed
+	}
+	defer dp.close()
+
+	// サービスごとのport-forward/SSH tunnelを起動
+	// 転送先のPodやtunnelのプロセスが変わるたびに状態ファイルを更新する
+	m := newMesh(opts.LogLevel, clientset, restConfig)
+	// 同時に実行中の他のインスタンスとTCPサービスのアドレスが重ならないようにする
+	m.loopback.external = otherListenAddresses
+	rec := newInstanceRecorder(m, inst)
+	m.onChange = rec.save
+	defer rec.close()
+	defer m.stop()
+	if _, err := m.apply(ctx, expanded); err != nil {
+		return err
+	}
+
+	// DNSサーバー（ホスト名のレコードはpublishで更新する）
+	var dnsSrv *dns.Server
+	if opts.DNS {
+		dnsSrv, err = dns.Listen(dnsCfg.Listen, dnsCfg.Upstreams, dnsCfg.ResolvedDomains)
+		if err != nil {
+			return fmt.Errorf("failed to start DNS server: %w (set dns.listen to use another address)", err)
+		}
+		defer func() { _ = dnsSrv.Close() }()
+		go func() { _ = dnsSrv.Serve() }()
+		rec.setDNS(dnsSrv.Addr())
+	}
+
+	if opts.UpdateHosts {
+		// ワイルドカードは/etc/hostsに書き込めない
+		if !opts.DNS {
+			warnWildcardHosts(expanded)
 		}
 
 		// /etc/hostsに追加
-		if err := hosts.AddEntries(hostnames); err != nil {
+		entries, err := m.hostEntries()
+		if err != nil {
+			return err
+		}
+		if err := hostsEditor.Add(entries); err != nil {
 			return fmt.Errorf("failed to update /etc/hosts: %w", err)
 		}
 		fmt.Println("/etc/hosts updated successfully")
 
 		// 終了時にクリーンアップ
 		defer func() {
-			if err := hosts.RemoveEntries(); err != nil {
-				fmt.Fprintf(os.Stderr, "warning: failed to clean up /etc/hosts: %v\n", err)
+			if err := hostsEditor.Remove(); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: failed to clean up /etc/hosts: %v\nrun 'sudo kubectl-localmesh hosts remove --id %s' to clean up\n", err, instanceID)
 			} else {
 				fmt.Println("/etc/hosts cleaned up")
 			}
 		}()
 	}
 
-	tmpDir, err := os.MkdirTemp("", "kubectl-localmesh-")
-	if err != nil {
+	// 設定の再読み込みと制御APIからの操作が同時に起きてもプロキシの更新が競合しないようにする
+	var publishMu sync.Mutex
+	publish := func() error {
+		publishMu.Lock()
+		defer publishMu.Unlock()
+
+		routes, err := m.routes()
+		if err != nil {
+			return err
+		}
+		tlsListener, err := buildTLSListener(m.tlsConfig(), routes, true)
+		if err != nil {
+			return fmt.Errorf("failed to prepare TLS certificates: %w", err)
+		}
+		if err := dp.update(m.listenerPort(), routes, tlsListener); err != nil {
+			return err
+		}
+		if dnsSrv != nil {
+			records, err := m.dnsRecords()
+			if err != nil {
+				return err
+			}
+			dnsSrv.SetRecords(records)
+		}
+		rec.save()
+		return nil
+	}
+	if err := publish(); err != nil {
 		return err
 	}
-	defer func() { _ = os.RemoveAll(tmpDir) }()
-
-	var routes []envoy.Route
 
-	for _, svcDef := range cfg.Services {
-		svc := svcDef.Get()
-		var localPort int
-		var clusterName string
-		var routeType string
-		var listenPort int
+	// systemd-resolvedがdns.resolved_domainsの問い合わせをDNSサーバーに送るようにする
+	if splitDNS != nil {
+		if err := splitDNS.Apply(dnsSrv.Addr(), dnsCfg.ResolvedDomains); err != nil {
+			return fmt.Errorf("failed to configure systemd-resolved: %w", err)
+		}
+		fmt.Printf("systemd-resolved routes %s to %s\n", strings.Join(dnsCfg.ResolvedDomains, ", "), dnsSrv.Addr())
 
-		// type switchで型判別
-		switch s := svc.(type) {
-		case *config.TCPService:
-			// TCP + SSH Bastion経由の接続
-			bastion, ok := cfg.SSHBastions[s.SSHBastion]
-			if !ok {
-				return fmt.Errorf("ssh_bastion '%s' not found for service '%s'", s.SSHBastion, s.Host)
+		// 終了時にクリーンアップ
+		defer func() {
+			if err := splitDNS.Remove(); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: failed to clean up systemd-resolved: %v\nrun 'sudo kubectl-localmesh dns remove --name %s' to clean up\n", err, name)
+			} else {
+				fmt.Println("systemd-resolved cleaned up")
 			}
+		}()
+	}
 
-			lp, err := pf.FreeLocalPort()
-			if err != nil {
-				return err
+	// 制御API（Unix socket）
+	// 起動できなくてもメッシュ自体は動作するため警告のみとする
+	ctrlSrv, err := control.Listen(state.SocketPath(os.Getpid()), &meshController{m: m, publish: publish})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: control API disabled: %v\n", err)
+	} else {
+		rec.setControlSocket(ctrlSrv.Path())
+		defer func() { _ = ctrlSrv.Close() }()
+		go func() {
+			if err := ctrlSrv.Serve(); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: control API stopped: %v\n", err)
 			}
-			localPort = lp
-
-			clusterName = sanitize(fmt.Sprintf("tcp_%s_%s_%d", s.SSHBastion, s.TargetHost, s.TargetPort))
-			routeType = "tcp"
-			listenPort = s.TargetPort
-
-			fmt.Printf(
-				"gcp-ssh: %-30s -> %s (instance=%s, zone=%s) -> %s:%d via 127.0.0.1:%d\n",
-				s.Host,
-				s.SSHBastion,
-				bastion.Instance,
-				bastion.Zone,
-				s.TargetHost,
-				s.TargetPort,
-				localPort,
-			)
-
-			// GCP SSH tunnelをgoroutineで起動（自動再接続）
-			go func(b *config.SSHBastion, local int, target string, targetPort int) {
-				if err := gcp.StartGCPSSHTunnel(
-					ctx,
-					b,
-					local,
-					target,
-					targetPort,
-					logLevel,
-				); err != nil {
-					// contextキャンセル以外のエラーをログ出力
-					if ctx.Err() == nil {
-						fmt.Fprintf(os.Stderr, "gcp-ssh tunnel error for %s: %v\n", b.Instance, err)
-					}
-				}
-			}(bastion, localPort, s.TargetHost, s.TargetPort)
+		}()
+		// 状態ファイルにsocketのパスを記録
+		rec.save()
+	}
 
-		case *config.KubernetesService:
-			// Kubernetes Service経由の接続
-			remotePort, err := k8s.ResolveServicePort(
-				ctx,
-				clientset,
-				s.Namespace,
-				s.Service,
-				s.PortName,
-				s.Port,
-			)
-			if err != nil {
-				return err
-			}
+	fmt.Println()
+	fmt.Printf("name: %s\n", name)
+	if ed, ok := dp.(*envoyDataPlane); ok {
+		fmt.Printf("envoy config: %s\n", ed.bootstrap)
+	} else {
+		fmt.Println("proxy: builtin")
+	}
+	fmt.Printf("listen: 0.0.0.0:%d\n", cfg.ListenerPort)
+	if cfg.TLS != nil {
+		fmt.Printf("listen (tls): 0.0.0.0:%d\n", cfg.TLS.ListenerPort)
+	}
+	if dnsSrv != nil {
+		fmt.Printf("dns: %s\n", dnsSrv.Addr())
+	}
+	if ctrlSrv != nil {
+		fmt.Printf("control: %s\n", ctrlSrv.Path())
+	}
+	fmt.Println()
 
-			lp, err := pf.FreeLocalPort()
-			if err != nil {
-				return err
-			}
-			localPort = lp
+	u := &updater{m: m, publish: publish, opts: opts, hosts: hostsEditor, disc: disc, name: name, dns: dnsCfg, kubeContext: kubeOpts.Context, cluster: cfg.Cluster}
+	if opts.Watch {
+		fmt.Printf("watching %s for changes\n\n", strings.Join(opts.ConfigPaths, ", "))
+		go watchConfig(ctx, opts.ConfigPaths, watchInterval, func() {
+			u.reload(ctx)
+		})
+	}
+	// 再読み込みでwatch: trueのエントリが追加される場合もあるため常に起動する
+	if disc.watching() {
+		fmt.Printf("watching kubernetes-discovery every %s\n\n", discoveryInterval)
+	}
+	go watchDiscovery(ctx, discoveryInterval, func() {
+		u.rediscover(ctx)
+	})
 
-			clusterName = sanitize(fmt.Sprintf("%s_%s_%d", s.Namespace, s.Service, remotePort))
-			routeType = s.Protocol
-			if routeType == "" {
-				routeType = "http" // デフォルト
-			}
+	// プロキシ実行（contextキャンセル時に自動終了）
+	// port-forwardのgoroutineもcontextキャンセル時に自動終了する
+	return dp.run(ctx)
+}
 
-			fmt.Printf(
-				"pf: %-30s -> %s/%s:%d via 127.0.0.1:%d\n",
-				s.Host,
-				s.Namespace,
-				s.Service,
-				remotePort,
-				localPort,
-			)
-
-			// port-forwardをgoroutineで起動（自動再接続）
-			go func(ns, svc string, local, remote int) {
-				if err := k8s.StartPortForwardLoop(
-					ctx,
-					restConfig,
-					clientset,
-					ns,
-					svc,
-					local,
-					remote,
-				); err != nil {
-					// contextキャンセル以外のエラーをログ出力
-					if ctx.Err() == nil {
-						fmt.Fprintf(os.Stderr, "port-forward error for %s/%s: %v\n", ns, svc, err)
-					}
-				}
-			}(s.Namespace, s.Service, localPort, remotePort)
+// updater は、設定ファイルの再読み込みとServiceの再探索をmeshに反映する。
+// 失敗した場合は現在の状態を維持し、エラーをログ出力するのみとする。
+type updater struct {
+	m       *mesh
+	publish func() error
+	opts    Options
+	hosts   hosts.Editor // /etc/hostsを更新しない場合はnil
+
+	mu          sync.Mutex // 再読み込みと再探索を直列化する
+	disc        *discovery
+	name        string               // 起動時のインスタンスの名前
+	dns         *config.DNSConfig    // 起動時のdns:の値
+	kubeContext string               // 起動時に指定されたcontext（空の場合はcurrent-context）
+	cluster     *config.ClusterGuard // 確認済みのcluster:の値
+}
 
-		default:
-			return fmt.Errorf("unknown service type: %T", s)
+// reload は、設定ファイルを再読み込みして差分をmeshに反映する
+func (u *updater) reload(ctx context.Context) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	cfg, err := config.LoadFiles(u.opts.LoadOptions, u.opts.ConfigPaths...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config reload failed: %v\n", err)
+		return
+	}
+	// インスタンスの名前と接続先のクラスタは起動時のまま変えない
+	if name := resolveName(u.opts, cfg); name != u.name {
+		fmt.Fprintf(os.Stderr, "config reload failed: name changed from '%s' to '%s': restart to rename the instance\n", u.name, name)
+		return
+	}
+	if u.opts.DNS && !reflect.DeepEqual(dnsConfig(cfg), u.dns) {
+		fmt.Fprintf(os.Stderr, "config reload failed: dns changed: restart to apply it\n")
+		return
+	}
+	if kubeContext := clientOptions(u.opts.Kube, cfg).Context; kubeContext != u.kubeContext {
+		fmt.Fprintf(os.Stderr, "config reload failed: kube_context changed from '%s' to '%s': restart to switch clusters\n", u.kubeContext, kubeContext)
+		return
+	}
+	// cluster:が変わった場合は確認し直す
+	if !reflect.DeepEqual(cfg.Cluster, u.cluster) {
+		if err := verifyCluster(ctx, cfg.Cluster, clientOptions(u.opts.Kube, cfg), u.m.clientset, u.m.restConfig, u.opts.ForceCluster); err != nil {
+			fmt.Fprintf(os.Stderr, "config reload failed: %v\n", err)
+			return
 		}
+		u.cluster = cfg.Cluster
+	}
+	expanded, err := u.disc.load(ctx, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config reload failed: %v\n", err)
+		return
+	}
 
-		routes = append(routes, envoy.Route{
-			Host:        svc.GetHost(),
-			LocalPort:   localPort,
-			ClusterName: clusterName,
-			Type:        routeType,
-			ListenPort:  listenPort,
-		})
+	result, err := u.apply(ctx, expanded)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config reload failed: %v\n", err)
+		return
 	}
+	fmt.Printf("config reloaded: %d service(s) started, %d service(s) stopped\n", result.added, result.removed)
+}
 
-	envoyCfg := envoy.BuildConfig(cfg.ListenerPort, routes)
-	envoyPath := filepath.Join(tmpDir, "envoy.yaml")
+// rediscover は、watch: trueのkubernetes-discoveryでServiceを探し直して差分をmeshに反映する
+func (u *updater) rediscover(ctx context.Context) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
 
-	b, err := yaml.Marshal(envoyCfg)
+	if !u.disc.watching() {
+		return
+	}
+	expanded, err := u.disc.refresh(ctx)
 	if err != nil {
-		return err
+		fmt.Fprintf(os.Stderr, "service discovery failed: %v\n", err)
+		return
 	}
-	if err := os.WriteFile(envoyPath, b, 0644); err != nil {
-		return err
+
+	result, err := u.apply(ctx, expanded)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "service discovery failed: %v\n", err)
+		return
+	}
+	if result.added > 0 || result.removed > 0 {
+		fmt.Printf("services discovered: %d service(s) started, %d service(s) stopped\n", result.added, result.removed)
 	}
+}
 
-	fmt.Println()
-	fmt.Printf("envoy config: %s\n", envoyPath)
-	fmt.Printf("listen: 0.0.0.0:%d\n\n", cfg.ListenerPort)
-
-	envoyCmd := exec.CommandContext(
-		ctx,
-		"envoy",
-		"-c", envoyPath,
-		"-l", logLevel,
-	)
-	envoyCmd.Stdout = os.Stdout
-	envoyCmd.Stderr = os.Stderr
-
-	// Envoy実行（contextキャンセル時に自動終了）
-	// port-forwardのgoroutineもcontextキャンセル時に自動終了する
-	return envoyCmd.Run()
+// apply は、展開済みの設定をmeshに反映し、/etc/hostsとプロキシの設定を更新する（u.muを保持して呼び出す）
+func (u *updater) apply(ctx context.Context, cfg *config.Config) (reloadResult, error) {
+	oldEntries, err := u.m.hostEntries()
+	if err != nil {
+		return reloadResult{}, err
+	}
+
+	result, err := u.m.apply(ctx, cfg)
+	if err != nil {
+		return reloadResult{}, err
+	}
+
+	newEntries, err := u.m.hostEntries()
+	if err != nil {
+		return reloadResult{}, err
+	}
+	if u.hosts != nil && !slices.Equal(oldEntries, newEntries) {
+		if err := u.hosts.Update(newEntries); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to update /etc/hosts: %v\n", err)
+		}
+	}
+
+	if err := u.publish(); err != nil {
+		return reloadResult{}, err
+	}
+	return result, nil
+}
+
+// resolveName は、インスタンスの名前を返す（--nameが優先、どちらもない場合はdefault）
+func resolveName(opts Options, cfg *config.Config) string {
+	if opts.Name != "" {
+		return opts.Name
+	}
+	return cfg.EffectiveName()
+}
+
+// dnsConfig は、DNSサーバーの設定を返す（dns:がない場合はデフォルト）
+func dnsConfig(cfg *config.Config) *config.DNSConfig {
+	if cfg.DNS == nil {
+		return &config.DNSConfig{Listen: config.DefaultDNSListen}
+	}
+	return cfg.DNS
+}
+
+// warnWildcardHosts は、/etc/hostsに書き込めないワイルドカードのホスト名を警告する
+func warnWildcardHosts(cfg *config.Config) {
+	for i := range cfg.Services {
+		if host := cfg.Services[i].Get().GetHost(); config.IsWildcardHost(host) {
+			fmt.Fprintf(os.Stderr, "warning: wildcard host '%s' cannot be added to /etc/hosts: use --dns to resolve it\n", host)
+		}
+	}
+}
+
+// clientOptions は、kube_contextを反映したKubernetes clientのオプションを返す（--contextが優先）
+func clientOptions(opts k8s.ClientOptions, cfg *config.Config) k8s.ClientOptions {
+	if opts.Context == "" {
+		opts.Context = cfg.KubeContext
+	}
+	return opts
 }
 
-func DumpEnvoyConfig(ctx context.Context, cfg *config.Config, mockConfigPath string) error {
+func DumpEnvoyConfig(ctx context.Context, cfg *config.Config, mockConfigPath string, kube k8s.ClientOptions, forceCluster bool) error {
 	var mockCfg *config.MockConfig
 	var err error
 
@@ -225,16 +473,48 @@ func DumpEnvoyConfig(ctx context.Context, cfg *config.Config, mockConfigPath str
 	}
 
 	// モックモードでない場合はKubernetes clientを初期化
+	// （cluster:の確認はクラスタに接続する場合のみ行う）
 	var clientset *kubernetes.Clientset
+	discover := mockDiscovery(mockCfg)
 	if mockCfg == nil {
+		kubeOpts := clientOptions(kube, cfg)
+		var restConfig *rest.Config
 		var k8sErr error
-		clientset, _, k8sErr = k8s.NewClient()
+		clientset, restConfig, k8sErr = k8s.NewClient(kubeOpts)
 		if k8sErr != nil {
 			return fmt.Errorf("failed to create kubernetes client: %w", k8sErr)
 		}
+		if err := verifyCluster(ctx, cfg.Cluster, kubeOpts, clientset, restConfig, forceCluster); err != nil {
+			return err
+		}
+		discover = clusterDiscovery(clientset)
+	}
+
+	// kubernetes-discoveryのエントリを見つかったServiceに展開
+	cfg, err = newDiscovery(discover).load(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	// resolvePort は、モック設定またはclient-goでServiceのポートを解決する
+	resolvePort := func(namespace, service, portName string, port int, protocol string) (k8s.ServicePort, error) {
+		if mockCfg != nil {
+			p, err := findMockPort(mockCfg, namespace, service, portName)
+			if err == nil && protocol != "" {
+				p.Protocol, p.InferredFrom, p.UpstreamProtocol = protocol, "", ""
+			}
+			return p, err
+		}
+		return k8s.ResolveServicePort(ctx, clientset, namespace, service, portName, port, protocol)
 	}
 
 	var routes []envoy.Route
+	// protocolを省略したサービスのプロトコル（設定の先頭にコメントで出力する）
+	var inferred []string
+	// routesの転送先に割り当てるダミーのローカルポート
+	nextPathPort := 20000
+	// クラスタごとのダミーのローカルポート（upと同様に、同じService・ポートはホストをまたいで共有する）
+	localPorts := map[string]int{}
 
 	for i, svcDef := range cfg.Services {
 		svc := svcDef.Get()
@@ -242,52 +522,69 @@ func DumpEnvoyConfig(ctx context.Context, cfg *config.Config, mockConfigPath str
 		// type switchで型判別
 		switch s := svc.(type) {
 		case *config.KubernetesService:
-			var remotePort int
+			resolved, err := resolvePort(s.Namespace, s.Service, s.PortName, s.Port, s.Protocol)
+			if err != nil {
+				return err
+			}
+			remotePort := resolved.Port
+			if s.Protocol == "" {
+				inferred = append(inferred, fmt.Sprintf("%s: %s", s.Host, describeInferredProtocol(resolved)))
+			}
+			s = s.WithProtocol(resolved.Protocol)
 
-			// モック設定が指定されている場合はモックから取得
-			if mockCfg != nil {
-				remotePort, err = findMockPort(mockCfg, s.Namespace, s.Service, s.PortName)
+			clusterName := config.KubernetesClusterName(s.Namespace, s.Service, remotePort)
+
+			// ダミーのローカルポートを割り当て（実際にはport-forwardしない）
+			dummyLocalPort, ok := localPorts[clusterName]
+			if !ok {
+				dummyLocalPort = 10000 + i
+				localPorts[clusterName] = dummyLocalPort
+			}
+
+			// routesの転送先（同じService・ポートはローカルポートを共有する）
+			var paths []envoy.PathRoute
+			for _, r := range s.Routes {
+				ns := s.RouteNamespace(r)
+				routePort, err := resolvePort(ns, r.Service, r.PortName, r.Port, s.Protocol)
 				if err != nil {
-					return err
+					return fmt.Errorf("route %s of '%s': %w", describeRouteMatch(r), s.Host, err)
 				}
-			} else {
-				// モック設定がない場合は通常通りclient-goで解決
-				remotePort, err = k8s.ResolveServicePort(
-					ctx,
-					clientset,
-					s.Namespace,
-					s.Service,
-					s.PortName,
-					s.Port,
-				)
-				if err != nil {
-					return err
+				routeCluster := config.KubernetesClusterName(ns, r.Service, routePort.Port)
+				if _, ok := localPorts[routeCluster]; !ok {
+					localPorts[routeCluster] = nextPathPort
+					nextPathPort++
 				}
+				paths = append(paths, buildPathRoute(s, r, routeCluster, localPorts[routeCluster]))
 			}
 
-			// ダミーのローカルポートを割り当て（実際にはport-forwardしない）
-			dummyLocalPort := 10000 + i
-
-			clusterName := sanitize(fmt.Sprintf("%s_%s_%d", s.Namespace, s.Service, remotePort))
-
-			routes = append(routes, envoy.Route{
+			route := envoy.Route{
 				Host:        s.Host,
 				LocalPort:   dummyLocalPort,
 				ClusterName: clusterName,
 				Type:        s.Protocol,
-			})
+				Paths:       paths,
+			}
+			if s.Protocol == "tcp" {
+				route.ListenPort = s.ListenPort
+			} else {
+				route.UpstreamProtocol = effectiveUpstreamProtocol(s, resolved)
+				route.UpstreamSNI = serviceDNSName(s.Namespace, s.Service)
+				applyRewrites(&route, s)
+			}
+			routes = append(routes, route)
 
 		case *config.TCPService:
 			// TCPサービスの場合（dump-envoy-configでは簡易処理）
 			dummyLocalPort := 10000 + i
-			clusterName := sanitize(fmt.Sprintf("tcp_%s_%s_%d", s.SSHBastion, s.TargetHost, s.TargetPort))
+			clusterName := s.ClusterName()
 
 			routes = append(routes, envoy.Route{
-				Host:        s.Host,
-				LocalPort:   dummyLocalPort,
-				ClusterName: clusterName,
-				Type:        "tcp",
-				ListenPort:  s.TargetPort,
+				Host:          s.Host,
+				LocalPort:     dummyLocalPort,
+				ClusterName:   clusterName,
+				Type:          "tcp",
+				ListenPort:    s.EffectiveLocalPort(),
+				ListenAddress: s.ListenAddress,
 			})
 
 		default:
@@ -295,37 +592,71 @@ func DumpEnvoyConfig(ctx context.Context, cfg *config.Config, mockConfigPath str
 		}
 	}
 
-	envoyCfg := envoy.BuildConfig(cfg.ListenerPort, routes)
+	// upと同様に、ポートを解決した結果のクラスタの衝突を確認
+	if err := checkClusters(routes); err != nil {
+		return err
+	}
+
+	// TCPサービスにはupと同じ順序でループバックアドレスを割り当てる
+	loopback := newLoopbackAllocator()
+	for i := range routes {
+		if routes[i].Type != "tcp" || routes[i].ListenAddress != "" {
+			continue
+		}
+		addr, err := loopback.allocate(routes[i].Host)
+		if err != nil {
+			return err
+		}
+		routes[i].ListenAddress = addr
+	}
+
+	// 証明書は発行せず、up 実行時に使用されるパスを出力する
+	tlsListener, err := buildTLSListener(cfg.TLS, routes, false)
+	if err != nil {
+		return err
+	}
+
+	envoyCfg := envoy.BuildConfig(cfg.ListenerPort, routes, tlsListener)
 
 	b, err := yaml.Marshal(envoyCfg)
 	if err != nil {
 		return err
 	}
 
+	for _, note := range inferred {
+		fmt.Printf("# %s\n", note)
+	}
 	fmt.Print(string(b))
 	return nil
 }
 
-func findMockPort(mockCfg *config.MockConfig, namespace, service, portName string) (int, error) {
+func findMockPort(mockCfg *config.MockConfig, namespace, service, portName string) (k8s.ServicePort, error) {
 	for _, m := range mockCfg.Mocks {
 		if m.Namespace == namespace && m.Service == service && m.PortName == portName {
-			return m.ResolvedPort, nil
+			return mockPort(m), nil
 		}
 	}
-	return 0, fmt.Errorf("mock config not found for %s/%s (port_name=%s)", namespace, service, portName)
+	return k8s.ServicePort{}, fmt.Errorf("mock config not found for %s/%s (port_name=%s)", namespace, service, portName)
 }
 
-func sanitize(s string) string {
-	out := make([]rune, 0, len(s))
-	for _, r := range s {
-		if r >= 'a' && r <= 'z' ||
-			r >= 'A' && r <= 'Z' ||
-			r >= '0' && r <= '9' ||
-			r == '_' {
-			out = append(out, r)
-		} else {
-			out = append(out, '_')
-		}
+// mockPort は、モック設定のポートを、port_nameとapp_protocolから推測したプロトコル付きで返す
+func mockPort(m config.MockService) k8s.ServicePort {
+	p := corev1.ServicePort{Name: m.PortName, Port: int32(m.ResolvedPort)}
+	if m.AppProtocol != "" {
+		p.AppProtocol = &m.AppProtocol
 	}
-	return string(out)
+	protocol, from := k8s.InferProtocol(p)
+	return k8s.ServicePort{
+		Service:          m.Service,
+		Port:             m.ResolvedPort,
+		Name:             m.PortName,
+		Protocol:         protocol,
+		InferredFrom:     from,
+		UpstreamProtocol: k8s.InferUpstreamProtocol(p),
+	}
+}
+
+// serviceDNSName は、upstreamへTLSで接続する際のSNIとして使うServiceのクラスタ内DNS名を返す
+func serviceDNSName(namespace, service string) string {
+	return fmt.Sprintf("%s.%s.svc", service, namespace)
 }
@@ -0,0 +1,89 @@
+package run
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/usadamasa/kubectl-localmesh/internal/control"
+	"github.com/usadamasa/kubectl-localmesh/internal/state"
+)
+
+// ListServices prints the services of a running up instance, fetched through
+// its control API. pid or name selects the instance when several are running.
+// output is "table" or "json".
+func ListServices(ctx context.Context, w io.Writer, pid int, name, output string) error {
+	if output != "table" && output != "json" {
+		return fmt.Errorf("output must be 'table' or 'json', got '%s'", output)
+	}
+
+	client, err := controlClient(pid, name)
+	if err != nil {
+		return err
+	}
+	services, err := client.Services(ctx)
+	if err != nil {
+		return err
+	}
+
+	if output == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(services)
+	}
+	return writeServiceTable(w, services)
+}
+
+// ReconnectService forces the port-forward or SSH tunnel of host to reconnect.
+func ReconnectService(ctx context.Context, w io.Writer, pid int, name, host string) error {
+	client, err := controlClient(pid, name)
+	if err != nil {
+		return err
+	}
+	if _, err := client.Reconnect(ctx, host); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "service %s: reconnecting\n", host)
+	return err
+}
+
+// SetServiceEnabled enables or disables the service of host at runtime.
+func SetServiceEnabled(ctx context.Context, w io.Writer, pid int, name, host string, enabled bool) error {
+	client, err := controlClient(pid, name)
+	if err != nil {
+		return err
+	}
+	svc, err := client.SetEnabled(ctx, host, enabled)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "service %s: %s\n", host, svc.Status)
+	return err
+}
+
+// controlClient は、対象インスタンスの制御APIのクライアントを返す
+func controlClient(pid int, name string) (*control.Client, error) {
+	instances, err := state.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read runtime state: %w", err)
+	}
+
+	// 終了済みのインスタンスは操作できないため候補から除く
+	var running []*state.Instance
+	for _, inst := range instances {
+		if inst.Alive() {
+			running = append(running, inst)
+		}
+	}
+
+	targets, err := selectInstances(running, pid, name, false)
+	if err != nil {
+		return nil, err
+	}
+	inst := targets[0]
+	if inst.ControlSocket == "" {
+		return nil, fmt.Errorf("pid %d: control API is not available", inst.PID)
+	}
+	return control.NewClient(inst.ControlSocket), nil
+}
@@ -0,0 +1,112 @@
+package run
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/usadamasa/kubectl-localmesh/internal/state"
+)
+
+// instanceStatus は status コマンドの出力1件分
+type instanceStatus struct {
+	*state.Instance
+	Running  bool                  `json:"running"`
+	Envoy    string                `json:"envoy"`
+	Services []state.ServiceHealth `json:"services"`
+}
+
+// Status prints per-service health of the running up instances to w.
+// output is "table" or "json".
+func Status(w io.Writer, output string) error {
+	if output != "table" && output != "json" {
+		return fmt.Errorf("output must be 'table' or 'json', got '%s'", output)
+	}
+
+	instances, err := state.List()
+	if err != nil {
+		return fmt.Errorf("failed to read runtime state: %w", err)
+	}
+
+	statuses := []instanceStatus{}
+	for _, inst := range instances {
+		h := state.Check(inst)
+		statuses = append(statuses, instanceStatus{
+			Instance: inst,
+			Running:  h.Running,
+			Envoy:    h.Envoy,
+			Services: h.Services,
+		})
+	}
+
+	if output == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(statuses)
+	}
+
+	return writeStatusTable(w, statuses)
+}
+
+// writeStatusTable は、インスタンスごとにサービスの状態を表形式で出力する
+func writeStatusTable(w io.Writer, statuses []instanceStatus) error {
+	if len(statuses) == 0 {
+		_, err := fmt.Fprintln(w, "no running kubectl-localmesh instances")
+		return err
+	}
+
+	for i, st := range statuses {
+		if i > 0 {
+			_, _ = fmt.Fprintln(w)
+		}
+
+		running := "running"
+		if !st.Running {
+			running = "stale (process not found)"
+		}
+		_, _ = fmt.Fprintf(w, "pid %d: %s\n", st.PID, running)
+		_, _ = fmt.Fprintf(w, "name:    %s\n", instanceName(st.Instance))
+		_, _ = fmt.Fprintf(w, "config:  %s\n", st.ConfigPath)
+		_, _ = fmt.Fprintf(w, "started: %s\n", st.StartedAt.Format("2006-01-02 15:04:05"))
+		if st.Proxy == ProxyBuiltin {
+			// 組み込みプロキシはupプロセス内で動作するため、プロセスの状態がそのままプロキシの状態になる
+			_, _ = fmt.Fprintf(w, "proxy:   builtin (listen 0.0.0.0:%d)\n", st.ListenerPort)
+		} else {
+			_, _ = fmt.Fprintf(w, "envoy:   %s (admin %s, listen 0.0.0.0:%d)\n", st.Envoy, st.EnvoyAdmin, st.ListenerPort)
+		}
+		if st.DNS != "" {
+			_, _ = fmt.Fprintf(w, "dns:     %s\n", st.DNS)
+		}
+		_, _ = fmt.Fprintln(w)
+
+		if err := writeServiceTable(w, st.Services); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeServiceTable は、サービスごとの転送状態を表形式で出力する
+func writeServiceTable(w io.Writer, services []state.ServiceHealth) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "HOST\tKIND\tPROTOCOL\tTARGET\tLOCAL\tPOD/TUNNEL\tSTATUS")
+	for _, svc := range services {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t127.0.0.1:%d\t%s\t%s\n",
+			svc.Host, svc.Kind, svc.Protocol, svc.Target, svc.LocalPort, forwarder(svc.Service), svc.Status)
+	}
+	return tw.Flush()
+}
+
+// forwarder は、転送を担当しているPod名またはSSH tunnelのPIDを表示用に返す
+func forwarder(svc state.Service) string {
+	switch {
+	case svc.Pod != "":
+		return svc.Pod
+	case svc.TunnelPID != 0:
+		return "pid " + strconv.Itoa(svc.TunnelPID)
+	default:
+		return "-"
+	}
+}
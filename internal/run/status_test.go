@@ -0,0 +1,239 @@
+package run
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/usadamasa/kubectl-localmesh/internal/proc"
+	"github.com/usadamasa/kubectl-localmesh/internal/state"
+)
+
+// liveInstance は、pidの実行中のプロセスを記録したインスタンスを返す
+func liveInstance(t *testing.T, pid int) *state.Instance {
+	t.Helper()
+	start, err := proc.StartTime(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &state.Instance{PID: pid, ProcessStart: start}
+}
+
+// deadPID は、終了済みプロセスのPIDを返す
+func deadPID(t *testing.T) int {
+	t.Helper()
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return cmd.Process.Pid
+}
+
+func TestStatus_JSON(t *testing.T) {
+	t.Setenv("KUBECTL_LOCALMESH_STATE_DIR", t.TempDir())
+
+	inst := liveInstance(t, os.Getpid())
+	inst.ConfigPath = "/path/to/services.yaml"
+	inst.StartedAt = time.Now()
+	inst.ListenerPort = 80
+	inst.Services = []state.Service{
+		{Host: "users.localhost", Kind: "kubernetes", Protocol: "http", Target: "users/users-api:8080", LocalPort: 1, Pod: "users-api-0"},
+	}
+	if err := state.Save(inst); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Status(&buf, "json"); err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+
+	var got []map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, buf.String())
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected 1 instance, got %d", len(got))
+	}
+	if got[0]["config_path"] != "/path/to/services.yaml" {
+		t.Errorf("unexpected config_path: %v", got[0]["config_path"])
+	}
+	if got[0]["running"] != true {
+		t.Errorf("expected running true, got %v", got[0]["running"])
+	}
+	services := got[0]["services"].([]any)
+	svc := services[0].(map[string]any)
+	if svc["pod"] != "users-api-0" || svc["status"] != "down" {
+		t.Errorf("unexpected service status: %v", svc)
+	}
+}
+
+func TestStatus_Table(t *testing.T) {
+	t.Setenv("KUBECTL_LOCALMESH_STATE_DIR", t.TempDir())
+
+	var buf bytes.Buffer
+	if err := Status(&buf, "table"); err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "no running kubectl-localmesh instances") {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+
+	inst := liveInstance(t, os.Getpid())
+	inst.Name = "data"
+	inst.ConfigPath = "/path/to/services.yaml"
+	inst.DNS = "127.0.0.1:15353"
+	inst.Services = []state.Service{
+		{Host: "db.localhost", Kind: "tcp", Protocol: "tcp", Target: "primary -> 10.0.0.1:5432", LocalPort: 1, TunnelPID: 4321},
+	}
+	if err := state.Save(inst); err != nil {
+		t.Fatal(err)
+	}
+
+	buf.Reset()
+	if err := Status(&buf, "table"); err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	for _, want := range []string{"name:    data", "dns:     127.0.0.1:15353", "HOST", "db.localhost", "primary -> 10.0.0.1:5432", "pid 4321", "down"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestStatus_InvalidOutput(t *testing.T) {
+	if err := Status(&bytes.Buffer{}, "yaml"); err == nil {
+		t.Fatal("expected error for invalid output format, got nil")
+	}
+}
+
+func TestSelectInstances(t *testing.T) {
+	instances := []*state.Instance{{PID: 100}, {PID: 200, Name: "backend"}, {PID: 300, Name: "data"}}
+
+	if _, err := selectInstances(nil, 0, "", false); err == nil {
+		t.Error("expected error for no instances")
+	}
+
+	got, err := selectInstances(instances, 200, "", false)
+	if err != nil || len(got) != 1 || got[0].PID != 200 {
+		t.Errorf("unexpected selection by pid: %v, %v", got, err)
+	}
+
+	if _, err := selectInstances(instances, 400, "", false); err == nil {
+		t.Error("expected error for unknown pid")
+	}
+
+	got, err = selectInstances(instances, 0, "data", false)
+	if err != nil || len(got) != 1 || got[0].PID != 300 {
+		t.Errorf("unexpected selection by name: %v, %v", got, err)
+	}
+
+	// 名前を記録していないインスタンスはdefault
+	got, err = selectInstances(instances, 0, "default", false)
+	if err != nil || len(got) != 1 || got[0].PID != 100 {
+		t.Errorf("unexpected selection of the default name: %v, %v", got, err)
+	}
+
+	if _, err := selectInstances(instances, 0, "frontend", false); err == nil {
+		t.Error("expected error for unknown name")
+	}
+
+	_, err = selectInstances(instances, 0, "", false)
+	if err == nil || !strings.Contains(err.Error(), "--name, --pid or --all") || !strings.Contains(err.Error(), "backend: pid 200") {
+		t.Errorf("expected ambiguity error, got %v", err)
+	}
+
+	got, err = selectInstances(instances, 0, "", true)
+	if err != nil || len(got) != 3 {
+		t.Errorf("unexpected selection with all: %v, %v", got, err)
+	}
+
+	got, err = selectInstances(instances[:1], 0, "", false)
+	if err != nil || len(got) != 1 {
+		t.Errorf("unexpected selection of single instance: %v, %v", got, err)
+	}
+}
+
+func TestCheckInstanceName(t *testing.T) {
+	t.Setenv("KUBECTL_LOCALMESH_STATE_DIR", t.TempDir())
+
+	// 実行中のインスタンスとしてテストプロセス自身の親を使う
+	backend := liveInstance(t, os.Getppid())
+	backend.Name = "backend"
+	backend.ConfigPath = "/path/to/backend.yaml"
+	for _, inst := range []*state.Instance{backend, {PID: deadPID(t), Name: "data"}} {
+		if err := state.Save(inst); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := checkInstanceName("backend")
+	if err == nil || !strings.Contains(err.Error(), "a kubectl-localmesh named 'backend' is already running") {
+		t.Errorf("expected error for a running instance with the same name, got %v", err)
+	}
+	// 異常終了したインスタンスの名前は使える
+	if err := checkInstanceName("data"); err != nil {
+		t.Errorf("unexpected error for a stopped instance: %v", err)
+	}
+	if err := checkInstanceName("frontend"); err != nil {
+		t.Errorf("unexpected error for a new name: %v", err)
+	}
+}
+
+func TestDown_CleansUpStaleInstance(t *testing.T) {
+	t.Setenv("KUBECTL_LOCALMESH_STATE_DIR", t.TempDir())
+
+	inst := &state.Instance{PID: deadPID(t), ConfigPath: "/path/to/services.yaml"}
+	if err := state.Save(inst); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Down(0, "", false, time.Second); err != nil {
+		t.Fatalf("Down failed: %v", err)
+	}
+
+	instances, err := state.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 0 {
+		t.Errorf("expected stale state to be removed, got %d instances", len(instances))
+	}
+}
+
+func TestDown_DoesNotSignalReusedPID(t *testing.T) {
+	t.Setenv("KUBECTL_LOCALMESH_STATE_DIR", t.TempDir())
+
+	// PIDが別のプロセスに再利用された状態（開始時刻が記録と異なる）
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+	inst := liveInstance(t, cmd.Process.Pid)
+	inst.ProcessStart -= 60
+	if err := state.Save(inst); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Down(0, "", false, time.Second); err != nil {
+		t.Fatalf("Down failed: %v", err)
+	}
+	// 終了していればWait4がPIDを返す
+	var ws syscall.WaitStatus
+	if pid, err := syscall.Wait4(cmd.Process.Pid, &ws, syscall.WNOHANG, nil); err != nil || pid != 0 {
+		t.Errorf("expected the process reusing the pid not to be signalled: %v, %v", ws, err)
+	}
+	if _, err := state.Load(inst.PID); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the stale state to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package run
+
+import (
+	"github.com/usadamasa/kubectl-localmesh/internal/certs"
+	"github.com/usadamasa/kubectl-localmesh/internal/config"
+	"github.com/usadamasa/kubectl-localmesh/internal/envoy"
+)
+
+// buildTLSListener は、HTTPルートのホストごとのサーバー証明書を割り当てたTLSリスナーの設定を返す。
+// tlsCfgがnilの場合はnilを返す。
+// issueがtrueの場合はローカルCAで証明書を発行（既存の証明書が有効なら再利用）し、
+// falseの場合は保存先のパスのみを割り当てる（dump-envoy-config用）。
+func buildTLSListener(tlsCfg *config.TLSConfig, routes []envoy.Route, issue bool) (*envoy.TLSListener, error) {
+	if tlsCfg == nil {
+		return nil, nil
+	}
+
+	dir, err := certs.ResolveDir(tlsCfg.CADir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ca *certs.CA
+	if issue {
+		ca, err = certs.LoadOrCreateCA(dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tl := &envoy.TLSListener{Port: tlsCfg.ListenerPort}
+	for _, r := range routes {
+		// TLS終端するのはHTTP/gRPCのルートのみ
+		if r.Type == "tcp" {
+			continue
+		}
+
+		hc := certs.HostCertPaths(dir, r.Host)
+		if issue {
+			hc, err = ca.EnsureHostCert(r.Host)
+			if err != nil {
+				return nil, err
+			}
+		}
+		tl.Certs = append(tl.Certs, envoy.HostCert{Host: hc.Host, CertFile: hc.CertFile, KeyFile: hc.KeyFile})
+	}
+	return tl, nil
+}
@@ -0,0 +1,61 @@
+package run
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/usadamasa/kubectl-localmesh/internal/config"
+)
+
+// watchInterval は設定ファイルの変更を確認する間隔
+const watchInterval = time.Second
+
+// watchConfig は、設定ファイルの内容の変更をポーリングで検出し、変更のたびにonChangeを呼び出す。
+// includeされたファイルやディレクトリ内のファイルの追加・削除も変更として扱う。
+// エディタによる置き換え保存（rename）にも対応するため、mtimeではなく内容のハッシュで比較する。
+// contextがキャンセルされるまでブロックする。
+func watchConfig(ctx context.Context, paths []string, interval time.Duration, onChange func()) {
+	last, _ := configDigest(paths)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		digest, err := configDigest(paths)
+		if err != nil || digest == last {
+			// 保存途中でファイルが一時的に存在しない場合は次回に持ち越す
+			continue
+		}
+		last = digest
+		onChange()
+	}
+}
+
+// configDigest は、読み込む設定ファイルのパスと内容のSHA-256ハッシュを返す
+func configDigest(paths []string) ([sha256.Size]byte, error) {
+	files, err := config.Sources(paths...)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	h := sha256.New()
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return [sha256.Size]byte{}, err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", f, len(b))
+		h.Write(b)
+	}
+	var digest [sha256.Size]byte
+	h.Sum(digest[:0])
+	return digest, nil
+}
@@ -0,0 +1,85 @@
+package run
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatchConfig_DetectsContentChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "services.yaml")
+	if err := os.WriteFile(path, []byte("listener_port: 80\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	var calls atomic.Int32
+	done := make(chan struct{})
+	go func() {
+		watchConfig(ctx, []string{path}, 10*time.Millisecond, func() { calls.Add(1) })
+		close(done)
+	}()
+
+	// 変更なし
+	time.Sleep(50 * time.Millisecond)
+	if got := calls.Load(); got != 0 {
+		t.Fatalf("expected no change callback, got %d", got)
+	}
+
+	// 同じ内容での書き込みは変更として扱わない
+	if err := os.WriteFile(path, []byte("listener_port: 80\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := calls.Load(); got != 0 {
+		t.Fatalf("expected no change callback for same content, got %d", got)
+	}
+
+	// 内容の変更を検出する
+	if err := os.WriteFile(path, []byte("listener_port: 8080\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for calls.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("expected 1 change callback, got %d", got)
+	}
+
+	cancel()
+	<-done
+}
+
+func TestConfigDigest_IncludedFiles(t *testing.T) {
+	dir := t.TempDir()
+	main := filepath.Join(dir, "services.yaml")
+	if err := os.WriteFile(main, []byte("include: [conf.d]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "conf.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := configDigest([]string{main})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// includeしたディレクトリへのファイル追加を変更として検出する
+	if err := os.WriteFile(filepath.Join(dir, "conf.d", "local.yaml"), []byte("listener_port: 8080\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	after, err := configDigest([]string{main})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before == after {
+		t.Error("expected digest to change after adding an included file")
+	}
+}
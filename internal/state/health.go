@@ -0,0 +1,95 @@
+package state
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// checkTimeout はヘルスチェック1回あたりのタイムアウト
+const checkTimeout = 500 * time.Millisecond
+
+// Health はインスタンスのヘルスチェック結果
+type Health struct {
+	Running  bool            `json:"running"`
+	Envoy    string          `json:"envoy"` // LIVE|DRAINING|...|unreachable|n/a
+	Services []ServiceHealth `json:"services"`
+}
+
+// ServiceHealth はサービス1つ分のヘルスチェック結果
+type ServiceHealth struct {
+	Service
+	Status string `json:"status"` // ok|down|disabled
+}
+
+// Check probes the Envoy admin endpoint and the local end of every
+// port-forward / SSH tunnel recorded in the instance state.
+func Check(inst *Instance) *Health {
+	h := &Health{Running: inst.Alive()}
+
+	if !h.Running {
+		h.Envoy = "stopped"
+		for _, svc := range inst.Services {
+			h.Services = append(h.Services, ServiceHealth{Service: svc, Status: "down"})
+		}
+		return h
+	}
+
+	// 組み込みプロキシ（up --proxy=builtin）の場合はEnvoyが存在しない
+	if inst.Proxy == "builtin" {
+		h.Envoy = "n/a"
+	} else {
+		h.Envoy = checkEnvoy(inst.EnvoyAdmin)
+	}
+	for _, svc := range inst.Services {
+		h.Services = append(h.Services, CheckService(svc))
+	}
+	return h
+}
+
+// CheckService probes the local end of a single port-forward / SSH tunnel.
+func CheckService(svc Service) ServiceHealth {
+	if svc.Disabled {
+		return ServiceHealth{Service: svc, Status: "disabled"}
+	}
+
+	status := "down"
+	// port-forward/SSH tunnelは接続中のみローカルポートをlistenしている
+	if dialable(fmt.Sprintf("127.0.0.1:%d", svc.LocalPort)) {
+		status = "ok"
+	}
+	return ServiceHealth{Service: svc, Status: status}
+}
+
+// checkEnvoy は、Envoy admin の /ready の結果を返す
+func checkEnvoy(adminAddr string) string {
+	if adminAddr == "" {
+		return "unknown"
+	}
+
+	client := &http.Client{Timeout: checkTimeout}
+	resp, err := client.Get("http://" + adminAddr + "/ready")
+	if err != nil {
+		return "unreachable"
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "unreachable"
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// dialable は、アドレスにTCP接続できるかどうかを返す
+func dialable(addr string) bool {
+	conn, err := net.DialTimeout("tcp", addr, checkTimeout)
+	if err != nil {
+		return false
+	}
+	_ = conn.Close()
+	return true
+}
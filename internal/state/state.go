@@ -0,0 +1,277 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/usadamasa/kubectl-localmesh/internal/proc"
+)
+
+// dirName は、ユーザーのランタイムディレクトリ（またはキャッシュディレクトリ）に作成する状態ディレクトリの名前。
+// KUBECTL_LOCALMESH_STATE_DIR で上書きできる。
+const dirName = "kubectl-localmesh"
+
+// Instance は実行中の up プロセス1つ分の状態
+type Instance struct {
+	PID int `json:"pid"`
+	// ID はインスタンスごとにランダムなID（/etc/hostsの管理ブロックにも記録する）
+	ID string `json:"id,omitempty"`
+	// Name はインスタンスの名前（name: または --name、以前のバージョンでは空）
+	Name       string    `json:"name,omitempty"`
+	ConfigPath string    `json:"config_path"`
+	StartedAt  time.Time `json:"started_at"`
+	// ProcessStart はプロセスの開始時刻（Unix秒）。PIDが別のプロセスに再利用されていないかの確認に使う
+	ProcessStart  int64     `json:"process_start,omitempty"`
+	Proxy         string    `json:"proxy,omitempty"`          // envoy|builtin
+	EnvoyAdmin    string    `json:"envoy_admin,omitempty"`    // host:port
+	ControlSocket string    `json:"control_socket,omitempty"` // 制御APIのUnix socket
+	DNS           string    `json:"dns,omitempty"`            // up --dnsのDNSサーバーのhost:port
+	ListenerPort  int       `json:"listener_port"`
+	HostsUpdated  bool      `json:"hosts_updated"`
+	Services      []Service `json:"services"`
+}
+
+// Service はサービス1つ分の転送状態
+type Service struct {
+	Host          string `json:"host"`
+	Kind          string `json:"kind"`     // kubernetes|tcp
+	Protocol      string `json:"protocol"` // http|grpc|tcp
+	Target        string `json:"target"`   // 転送先（namespace/service:port など）
+	LocalPort     int    `json:"local_port"`
+	ListenPort    int    `json:"listen_port,omitempty"`
+	ListenAddress string `json:"listen_address,omitempty"` // TCPリスナーのループバックアドレス
+	Pod           string `json:"pod,omitempty"`
+	TunnelPID     int    `json:"tunnel_pid,omitempty"`
+	Disabled      bool   `json:"disabled,omitempty"`
+}
+
+// Dir returns the directory where runtime state files are stored: the
+// kubectl-localmesh directory in $XDG_RUNTIME_DIR or, if unset, in the user
+// cache directory. When running through sudo, the directory of the invoking
+// user is used, so that status and down find the instance without sudo.
+func Dir() string {
+	if dir := os.Getenv("KUBECTL_LOCALMESH_STATE_DIR"); dir != "" {
+		return dir
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, dirName)
+	}
+	if uid, ok := proc.SudoUID(); ok {
+		// sudoはXDG_RUNTIME_DIRやHOMEを引き継がないため、呼び出し元ユーザーのディレクトリを求める
+		if dir := fmt.Sprintf("/run/user/%d", uid); isDir(dir) {
+			return filepath.Join(dir, dirName)
+		}
+		if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+			return filepath.Join(userCacheDir(u.HomeDir), dirName)
+		}
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, dirName)
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", dirName, os.Geteuid()))
+}
+
+// userCacheDir は、ホームディレクトリhomeのユーザーのキャッシュディレクトリを返す（os.UserCacheDirと同じ規則）
+func userCacheDir(home string) string {
+	if runtime.GOOS == "darwin" {
+		return filepath.Join(home, "Library", "Caches")
+	}
+	return filepath.Join(home, ".cache")
+}
+
+func isDir(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
+
+// checkDir は、状態ディレクトリが存在すれば、呼び出し元のユーザー（proc.InvokingUID）が所有するディレクトリ（シンボリックリンクではない）かを確認する。
+// 他のユーザーが作成した状態ファイルを信用して、記録されたPIDにシグナルを送らないようにする。
+func checkDir(dir string) (exists bool, err error) {
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	if !fi.IsDir() {
+		return false, fmt.Errorf("state directory %s is not a directory", dir)
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok && int(st.Uid) != proc.InvokingUID() {
+		return false, fmt.Errorf("state directory %s is owned by another user (uid %d); remove it or set KUBECTL_LOCALMESH_STATE_DIR", dir, st.Uid)
+	}
+	return true, nil
+}
+
+// EnsureDir creates the state directory with mode 0700 if needed and
+// returns it. It refuses a directory owned by another user. When running
+// through sudo, the directory is owned by the invoking user.
+func EnsureDir() (string, error) {
+	dir := Dir()
+	exists, err := checkDir(dir)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return "", fmt.Errorf("failed to create state directory %s: %w", dir, err)
+		}
+		if err := chownToOwner(dir); err != nil {
+			return "", err
+		}
+	}
+	// 以前に作成したディレクトリも含め、他のユーザーからは参照できないようにする
+	if err := os.Chmod(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// chownToOwner は、sudo経由で実行された場合にファイルの所有者を呼び出し元ユーザーに変更する
+func chownToOwner(path string) error {
+	uid, ok := proc.SudoUID()
+	if !ok {
+		return nil
+	}
+	gid, err := strconv.Atoi(os.Getenv("SUDO_GID"))
+	if err != nil {
+		gid = -1
+	}
+	return os.Chown(path, uid, gid)
+}
+
+// Save writes the instance state to <Dir>/<pid>.json atomically.
+func Save(inst *Instance) error {
+	dir, err := EnsureDir()
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(inst, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filePath(inst.PID)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// sudo実行時でも一般ユーザーが status で読めるようにする
+	if err := chownToOwner(tmp.Name()); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Remove deletes the state file and control socket of the given PID.
+// Missing files are not an error.
+func Remove(pid int) error {
+	for _, path := range []string{filePath(pid), SocketPath(pid)} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// List returns all recorded instances ordered by PID, including ones whose
+// process has already exited (see Instance.Alive).
+func List() ([]*Instance, error) {
+	if exists, err := checkDir(Dir()); err != nil || !exists {
+		return nil, err
+	}
+	entries, err := os.ReadDir(Dir())
+	if err != nil {
+		return nil, err
+	}
+
+	var instances []*Instance
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		pid, err := strconv.Atoi(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			continue
+		}
+		inst, err := Load(pid)
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, inst)
+	}
+
+	sort.Slice(instances, func(i, j int) bool { return instances[i].PID < instances[j].PID })
+	return instances, nil
+}
+
+// Load reads the state file of the given PID.
+func Load(pid int) (*Instance, error) {
+	if _, err := checkDir(Dir()); err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(filePath(pid))
+	if err != nil {
+		return nil, err
+	}
+
+	var inst Instance
+	if err := json.Unmarshal(b, &inst); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", filePath(pid), err)
+	}
+	return &inst, nil
+}
+
+// Alive reports whether the process that recorded this state is still
+// running. The start time of the process must match the recorded one (see
+// proc.SameStart), so a PID reused by another process is not taken for the
+// instance.
+func (i *Instance) Alive() bool {
+	if !processAlive(i.PID) || i.ProcessStart == 0 {
+		return false
+	}
+	start, err := proc.StartTime(i.PID)
+	return err == nil && proc.SameStart(i.ProcessStart, start)
+}
+
+// processAlive は、シグナル0を送ってプロセスの存在を確認する。
+// 別ユーザー（root）のプロセスの場合はEPERMになるが、存在はしている。
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// SocketPath returns the path of the control API socket for the given PID.
+func SocketPath(pid int) string {
+	return filepath.Join(Dir(), fmt.Sprintf("%d.sock", pid))
+}
+
+// filePath は、PIDに対応する状態ファイルのパスを返す
+func filePath(pid int) string {
+	return filepath.Join(Dir(), fmt.Sprintf("%d.json", pid))
+}
@@ -0,0 +1,278 @@
+package state
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/usadamasa/kubectl-localmesh/internal/proc"
+)
+
+// setTestStateDir は、テスト用の状態ディレクトリを設定する
+func setTestStateDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("KUBECTL_LOCALMESH_STATE_DIR", dir)
+	return dir
+}
+
+func TestSaveLoadRemove(t *testing.T) {
+	setTestStateDir(t)
+
+	inst := &Instance{
+		PID:          os.Getpid(),
+		ConfigPath:   "/path/to/services.yaml",
+		StartedAt:    time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		EnvoyAdmin:   "127.0.0.1:9901",
+		ListenerPort: 80,
+		HostsUpdated: true,
+		Services: []Service{
+			{Host: "users.localhost", Kind: "kubernetes", Protocol: "grpc", Target: "users/users-api:50051", LocalPort: 10001, Pod: "users-api-0"},
+			{Host: "db.localhost", Kind: "tcp", Protocol: "tcp", Target: "primary -> 10.0.0.1:5432", LocalPort: 10002, ListenPort: 5432, TunnelPID: 1234},
+		},
+	}
+
+	if err := Save(inst); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := Load(inst.PID)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded.ConfigPath != inst.ConfigPath || loaded.EnvoyAdmin != inst.EnvoyAdmin || !loaded.HostsUpdated {
+		t.Errorf("unexpected instance: %+v", loaded)
+	}
+	if len(loaded.Services) != 2 || loaded.Services[0].Pod != "users-api-0" || loaded.Services[1].TunnelPID != 1234 {
+		t.Errorf("unexpected services: %+v", loaded.Services)
+	}
+
+	instances, err := List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(instances) != 1 || instances[0].PID != inst.PID {
+		t.Fatalf("unexpected instances: %+v", instances)
+	}
+
+	if err := Remove(inst.PID); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	// 2回目の削除はエラーにならない
+	if err := Remove(inst.PID); err != nil {
+		t.Fatalf("Remove of missing file failed: %v", err)
+	}
+
+	instances, err = List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(instances) != 0 {
+		t.Errorf("expected no instances, got %d", len(instances))
+	}
+}
+
+func TestList_MissingDir(t *testing.T) {
+	t.Setenv("KUBECTL_LOCALMESH_STATE_DIR", "/nonexistent/kubectl-localmesh")
+
+	instances, err := List()
+	if err != nil {
+		t.Fatalf("expected no error for missing dir, got %v", err)
+	}
+	if len(instances) != 0 {
+		t.Errorf("expected no instances, got %d", len(instances))
+	}
+}
+
+// processStart は、pidのプロセスの開始時刻を返す
+func processStart(t *testing.T, pid int) int64 {
+	t.Helper()
+	start, err := proc.StartTime(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return start
+}
+
+func TestInstance_Alive(t *testing.T) {
+	start := processStart(t, os.Getpid())
+	if !(&Instance{PID: os.Getpid(), ProcessStart: start}).Alive() {
+		t.Error("expected current process to be alive")
+	}
+	// btimeのずれや切り捨てで開始時刻が1秒ずれても同じプロセスとみなす
+	if !(&Instance{PID: os.Getpid(), ProcessStart: start + 1}).Alive() {
+		t.Error("expected current process to be alive with a start time off by one second")
+	}
+	if (&Instance{PID: 0}).Alive() {
+		t.Error("expected PID 0 not to be alive")
+	}
+	// PIDが再利用された（開始時刻が異なる）プロセスや、開始時刻の記録がない場合は実行中とみなさない
+	if (&Instance{PID: os.Getpid(), ProcessStart: start - 60}).Alive() {
+		t.Error("expected a process with another start time not to be alive")
+	}
+	if (&Instance{PID: os.Getpid()}).Alive() {
+		t.Error("expected an instance without a start time not to be alive")
+	}
+}
+
+func TestDir(t *testing.T) {
+	t.Setenv("KUBECTL_LOCALMESH_STATE_DIR", "")
+	t.Setenv("SUDO_UID", "")
+
+	runtimeDir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+	if got, want := Dir(), filepath.Join(runtimeDir, "kubectl-localmesh"); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+
+	t.Setenv("XDG_RUNTIME_DIR", "")
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		t.Skip(err)
+	}
+	if got, want := Dir(), filepath.Join(cacheDir, "kubectl-localmesh"); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestEnsureDir(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "state")
+	t.Setenv("KUBECTL_LOCALMESH_STATE_DIR", dir)
+
+	got, err := EnsureDir()
+	if err != nil || got != dir {
+		t.Fatalf("EnsureDir returned %s, %v", got, err)
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0700 {
+		t.Errorf("expected mode 0700, got %o", fi.Mode().Perm())
+	}
+
+	// 既存のディレクトリも他のユーザーから参照できないようにする
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := EnsureDir(); err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := os.Stat(dir); fi.Mode().Perm() != 0700 {
+		t.Errorf("expected mode 0700, got %o", fi.Mode().Perm())
+	}
+
+	// シンボリックリンクは使わない
+	link := filepath.Join(parent, "link")
+	if err := os.Symlink(dir, link); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("KUBECTL_LOCALMESH_STATE_DIR", link)
+	if _, err := EnsureDir(); err == nil {
+		t.Error("expected an error for a symlink")
+	}
+	if _, err := List(); err == nil {
+		t.Error("expected List to fail for a symlink")
+	}
+}
+
+func TestEnsureDir_OwnedByAnotherUser(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing the owner requires root")
+	}
+	t.Setenv("SUDO_UID", "")
+	dir := filepath.Join(t.TempDir(), "state")
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chown(dir, 12345, 12345); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("KUBECTL_LOCALMESH_STATE_DIR", dir)
+
+	if _, err := EnsureDir(); err == nil || !strings.Contains(err.Error(), "owned by another user") {
+		t.Errorf("expected an error for a directory owned by another user, got %v", err)
+	}
+	if _, err := List(); err == nil {
+		t.Error("expected List to fail for a directory owned by another user")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	// Envoy admin のモック
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ready" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("LIVE\n"))
+	}))
+	defer admin.Close()
+
+	// 接続中のport-forwardに相当するlistener
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = l.Close() }()
+	upPort := l.Addr().(*net.TCPAddr).Port
+
+	// 切断中のport-forwardに相当する空きポート
+	l2, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	downPort := l2.Addr().(*net.TCPAddr).Port
+	_ = l2.Close()
+
+	inst := &Instance{
+		PID:          os.Getpid(),
+		ProcessStart: processStart(t, os.Getpid()),
+		EnvoyAdmin:   strings.TrimPrefix(admin.URL, "http://"),
+		Services: []Service{
+			{Host: "up.localhost", LocalPort: upPort},
+			{Host: "down.localhost", LocalPort: downPort},
+		},
+	}
+
+	h := Check(inst)
+	if !h.Running {
+		t.Error("expected running")
+	}
+	if h.Envoy != "LIVE" {
+		t.Errorf("expected envoy LIVE, got %q", h.Envoy)
+	}
+	if len(h.Services) != 2 {
+		t.Fatalf("expected 2 services, got %d", len(h.Services))
+	}
+	if h.Services[0].Status != "ok" {
+		t.Errorf("expected up.localhost ok, got %q", h.Services[0].Status)
+	}
+	if h.Services[1].Status != "down" {
+		t.Errorf("expected down.localhost down, got %q", h.Services[1].Status)
+	}
+}
+
+func TestCheck_StoppedInstance(t *testing.T) {
+	inst := &Instance{
+		PID:      0,
+		Services: []Service{{Host: "api.localhost", LocalPort: 10001}},
+	}
+
+	h := Check(inst)
+	if h.Running {
+		t.Error("expected not running")
+	}
+	if h.Envoy != "stopped" {
+		t.Errorf("expected envoy stopped, got %q", h.Envoy)
+	}
+	if h.Services[0].Status != "down" {
+		t.Errorf("expected service down, got %q", h.Services[0].Status)
+	}
+}